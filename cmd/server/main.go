@@ -7,6 +7,8 @@ import (
 	"webci-refactored/internal/dal"
 	"webci-refactored/internal/queue"
 	"webci-refactored/internal/router"
+	"webci-refactored/internal/secret"
+	"webci-refactored/internal/service/auth"
 )
 
 // main 启动应用入口
@@ -16,6 +18,14 @@ func main() {
 	cfg := config.Load()
 	log.Printf("starting webci on %s", cfg.HTTPAddr)
 
+	// 服务端密钥：用于加密密文变量
+	if cfg.SecretKey == "" {
+		log.Printf("warning: SECRET_KEY not set, secret variables use a temporary key and cannot be read after restart")
+	}
+	if err := secret.Setup(cfg.SecretKey); err != nil {
+		log.Fatalf("init secret key error: %v", err)
+	}
+
 	// 2) 初始化数据库连接：当 MYSQL_DSN 为空时使用内存 SQLite，便于演示
 	db, err := dal.InitDB(cfg)
 	if err != nil {
@@ -27,6 +37,15 @@ func main() {
 		log.Fatalf("auto migrate error: %v", err)
 	}
 
+	// 初始管理员：确保 ADMIN_USERS 中的用户存在且为管理员，尚无用户时创建 admin
+	generated, err := auth.NewService(db).Bootstrap(cfg.AdminUsers, cfg.AdminPassword)
+	if err != nil {
+		log.Fatalf("bootstrap admin error: %v", err)
+	}
+	for name, pw := range generated {
+		log.Printf("created admin user %q with password %q, change it after first login", name, pw)
+	}
+
 	// 4) 初始化任务队列与执行器：提供入队、取消标记与并发执行能力
 	queue.InitWorkers(db)
 
@@ -2,17 +2,43 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config 应用配置
-// 包含 HTTP 监听地址、MySQL DSN、Git 仓库路径
+// 包含 HTTP 监听地址、MySQL DSN、Git 仓库路径、构建工作区目录、执行器数量、任务超时、产物存储、服务端密钥、初始管理员、GitLab 单点登录、webhook 与后台同步
 type Config struct {
-	HTTPAddr      string
-	MySQLDSN      string
-	RepoPath      string
-	GitLabBaseURL string
-	GitLabToken   string
-	GitLabProject string
+	HTTPAddr         string
+	MySQLDSN         string
+	RepoPath         string
+	WorkspaceDir     string
+	WorkerCount      int
+	JobTimeout       time.Duration
+	ArtifactDir      string
+	ArtifactMaxSize  int64
+	ArtifactExpireIn time.Duration
+	SecretKey        string
+	AdminUsers       []string
+	AdminPassword    string
+	GitLabBaseURL    string
+	GitLabToken      string
+	GitLabProject    string
+	// GitLab OAuth2 单点登录：ClientID 为空表示不启用
+	GitLabOAuthClientID     string
+	GitLabOAuthClientSecret string
+	GitLabOAuthURL          string
+	GitLabOAuthRedirectURL  string
+	GitLabOAuthDefaultRole  string
+	GitLabOAuthUserToken    bool
+	// GitLabOAuthInsecureTLS 跳过 GitLab 站点证书校验，仅用于内网自签名证书且需显式开启
+	GitLabOAuthInsecureTLS bool
+	// GitLab webhook 校验令牌：为空表示不接收 webhook
+	GitLabWebhookSecret string
+	// GitLab 后台同步间隔：0 表示不同步，CI 页面直接查询 GitLab
+	GitLabSyncInterval time.Duration
 }
 
 // Load 读取环境变量生成配置
@@ -25,11 +51,80 @@ func Load() Config {
 	}
 	// MySQL 连接串：留空表示使用内存 SQLite（演示友好）
 	dsn := os.Getenv("MYSQL_DSN")
-	// Git 仓库路径：用于分支 refresh 功能（可选）
+	// Git 仓库路径：用于分支 refresh 功能与构建检出（可选）
 	repo := os.Getenv("REPO_PATH")
+	// 构建工作区根目录：每个任务在其下创建独立目录，默认位于系统临时目录
+	ws := os.Getenv("WORKSPACE_DIR")
+	if ws == "" {
+		ws = filepath.Join(os.TempDir(), "webci-workspaces")
+	}
+	// 执行器数量：本实例同时运行的任务上限，非法值回退为默认 4
+	workers, _ := strconv.Atoi(os.Getenv("WORKER_COUNT"))
+	if workers <= 0 {
+		workers = 4
+	}
+	// 任务默认超时（Go 时长写法，如 30m）：环境与任务均未设置超时时使用，非法值回退为默认 1 小时
+	jobTimeout, err := time.ParseDuration(os.Getenv("JOB_TIMEOUT"))
+	if err != nil || jobTimeout <= 0 {
+		jobTimeout = time.Hour
+	}
+	// 产物存储目录：本地文件系统后端的根目录，默认位于系统临时目录
+	artifactDir := os.Getenv("ARTIFACT_DIR")
+	if artifactDir == "" {
+		artifactDir = filepath.Join(os.TempDir(), "webci-artifacts")
+	}
+	// 单个任务产物总大小上限（字节），非法值回退为默认 100MiB
+	artifactMax, _ := strconv.ParseInt(os.Getenv("ARTIFACT_MAX_SIZE"), 10, 64)
+	if artifactMax <= 0 {
+		artifactMax = 100 << 20
+	}
+	// 产物默认保留时长（Go 时长写法，如 168h），非法值回退为默认 30 天
+	artifactExpire, err := time.ParseDuration(os.Getenv("ARTIFACT_EXPIRE_IN"))
+	if err != nil || artifactExpire <= 0 {
+		artifactExpire = 30 * 24 * time.Hour
+	}
+	// 服务端密钥：加密存储密文变量，留空时使用进程内临时密钥（重启后无法解密）
+	secretKey := os.Getenv("SECRET_KEY")
+	// 管理员：逗号分隔的用户名，启动时确保这些用户存在且为 admin 角色
+	var admins []string
+	for _, u := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			admins = append(admins, u)
+		}
+	}
+	// 新建管理员的初始密码：留空时随机生成并输出到启动日志
+	adminPassword := os.Getenv("ADMIN_PASSWORD")
 	// GitLab 配置：从环境变量读取
 	glURL := os.Getenv("GITLAB_BASE_URL")
 	glToken := os.Getenv("GITLAB_TOKEN")
 	glProj := os.Getenv("GITLAB_PROJECT_ID")
-	return Config{HTTPAddr: addr, MySQLDSN: dsn, RepoPath: repo, GitLabBaseURL: glURL, GitLabToken: glToken, GitLabProject: glProj}
+	// GitLab 单点登录：应用 ID/密钥与回调地址（如 https://ci.example.com/auth/gitlab/callback）
+	oauthID := os.Getenv("GITLAB_OAUTH_CLIENT_ID")
+	oauthSecret := os.Getenv("GITLAB_OAUTH_CLIENT_SECRET")
+	oauthRedirect := os.Getenv("GITLAB_OAUTH_REDIRECT_URL")
+	// GitLab 站点根地址：留空时由 GITLAB_BASE_URL 去掉 /api/v4 得到
+	oauthURL := strings.TrimRight(os.Getenv("GITLAB_OAUTH_URL"), "/")
+	if oauthURL == "" {
+		oauthURL = strings.TrimSuffix(strings.TrimRight(glURL, "/"), "/api/v4")
+	}
+	// 首次通过 GitLab 登录时创建的本地用户角色，默认 viewer
+	oauthRole := os.Getenv("GITLAB_OAUTH_DEFAULT_ROLE")
+	if oauthRole == "" {
+		oauthRole = "viewer"
+	}
+	// 是否保存用户自己的 GitLab 令牌并以该用户身份执行建分支、合并等写操作
+	oauthUserToken, _ := strconv.ParseBool(os.Getenv("GITLAB_OAUTH_USER_TOKEN"))
+	// 单点登录默认校验 GitLab 证书，内网自签名证书时可显式关闭
+	oauthInsecure, _ := strconv.ParseBool(os.Getenv("GITLAB_OAUTH_INSECURE_SKIP_VERIFY"))
+	// GitLab webhook 的 Secret token：与请求头 X-Gitlab-Token 比对
+	webhookSecret := os.Getenv("GITLAB_WEBHOOK_SECRET")
+	// GitLab 后台同步间隔（Go 时长写法，如 1m）：0 表示不同步，非法值回退为默认 1 分钟
+	syncInterval := time.Minute
+	if v := os.Getenv("GITLAB_SYNC_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			syncInterval = d
+		}
+	}
+	return Config{HTTPAddr: addr, MySQLDSN: dsn, RepoPath: repo, WorkspaceDir: ws, WorkerCount: workers, JobTimeout: jobTimeout, ArtifactDir: artifactDir, ArtifactMaxSize: artifactMax, ArtifactExpireIn: artifactExpire, SecretKey: secretKey, AdminUsers: admins, AdminPassword: adminPassword, GitLabBaseURL: glURL, GitLabToken: glToken, GitLabProject: glProj,
+		GitLabOAuthClientID: oauthID, GitLabOAuthClientSecret: oauthSecret, GitLabOAuthURL: oauthURL, GitLabOAuthRedirectURL: oauthRedirect, GitLabOAuthDefaultRole: oauthRole, GitLabOAuthUserToken: oauthUserToken, GitLabOAuthInsecureTLS: oauthInsecure, GitLabWebhookSecret: webhookSecret, GitLabSyncInterval: syncInterval}
 }
@@ -0,0 +1,178 @@
+// Package cron 解析五段式 cron 表达式（分 时 日 月 周），用于描述周期性的时间窗口
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule 解析后的 cron 表达式
+// 每个字段以位图记录允许的取值；日与周同时受限时按 cron 惯例取并集
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+// field 字段取值范围与名称别名
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 周：0 与 7 均表示周日
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// Parse 解析五段式 cron 表达式
+// 每段支持 *、数字、名称（月份 jan-dec、星期 sun-sat）、a-b 区间、逗号列表与 /n 步长
+func Parse(spec string) (*Schedule, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("cron %q: expected 5 fields, got %d", spec, len(parts))
+	}
+	s := &Schedule{domStar: parts[2] == "*", dowStar: parts[4] == "*"}
+	var err error
+	for i, f := range []struct {
+		dst *uint64
+		def field
+	}{{&s.minute, minuteField}, {&s.hour, hourField}, {&s.dom, domField}, {&s.month, monthField}, {&s.dow, dowField}} {
+		if *f.dst, err = parseField(parts[i], f.def); err != nil {
+			return nil, fmt.Errorf("cron %q: %v", spec, err)
+		}
+	}
+	// 7 与 0 同为周日
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// parseField 解析单个字段为取值位图
+func parseField(expr string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s: invalid step in %q", f.name, part)
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(b); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s: invalid range %q", f.name, rng)
+			}
+		default:
+			v, err := f.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			// 单值带步长（如 5/15）表示从该值起到最大值
+			hi = v
+			if step > 1 {
+				hi = f.max
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value 解析字段中的单个取值（数字或名称）
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s: invalid value %q", f.name, s)
+	}
+	return v, nil
+}
+
+// Match 判断时刻 t（按其自身时区）所在的分钟是否命中表达式
+func (s *Schedule) Match(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 || s.hour&(1<<uint(t.Hour())) == 0 || s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domOK := s.dom&(1<<uint(t.Day())) != 0
+	dowOK := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
+
+// ActiveUntil 返回 t 所在连续命中区间的结束时刻，即 t 之后第一个不命中的分钟
+// 超过 limit 仍持续命中时返回 t+limit；t 本身不命中时返回 t。
+// 按字段位图跳跃查找：分钟字段在本小时内出现空缺时直接定位，否则按小时推进，时与分均不受限时按天推进，
+// 31 天的窗口最多循环 31×24 次
+func (s *Schedule) ActiveUntil(t time.Time, limit time.Duration) time.Time {
+	end := t.Add(limit)
+	m := t.Truncate(time.Minute)
+	if !s.Match(m) {
+		return t
+	}
+	for m.Before(end) {
+		if !s.Match(m) {
+			return m
+		}
+		// 本小时内 m 之后第一个不命中的分钟
+		if v := nextUnset(s.minute, m.Minute()+1, minuteField.max); v >= 0 {
+			return earlier(m.Add(time.Duration(v-m.Minute())*time.Minute), end)
+		}
+		if nextUnset(s.minute, 0, minuteField.max) < 0 && nextUnset(s.hour, 0, hourField.max) < 0 {
+			// 时与分全天命中：直接跳到次日零点，由日、月、周字段决定是否继续
+			m = time.Date(m.Year(), m.Month(), m.Day()+1, 0, 0, 0, 0, m.Location())
+			continue
+		}
+		m = m.Add(time.Duration(60-m.Minute()) * time.Minute)
+	}
+	return end
+}
+
+// nextUnset 返回位图 bits 在 [from, max] 内第一个未置位的取值，全部置位时返回 -1
+func nextUnset(bits uint64, from, max int) int {
+	for v := from; v <= max; v++ {
+		if bits&(1<<uint(v)) == 0 {
+			return v
+		}
+	}
+	return -1
+}
+
+// earlier 返回两个时刻中较早的一个
+func earlier(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
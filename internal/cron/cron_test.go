@@ -0,0 +1,101 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAndMatch(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	cases := []struct {
+		spec string
+		t    string
+		want bool
+	}{
+		// 周末全天（2026-10-17 为周六）
+		{"* * * * sat,sun", "2026-10-17 09:30", true},
+		{"* * * * 6,0", "2026-10-18 23:59", true},
+		{"* * * * 6-7", "2026-10-19 00:00", false},
+		// 周五 18 点以后
+		{"* 18-23 * * fri", "2026-10-16 18:00", true},
+		{"* 18-23 * * fri", "2026-10-16 17:59", false},
+		// 十月前七天（国庆）
+		{"* * 1-7 oct *", "2026-10-07 12:00", true},
+		{"* * 1-7 oct *", "2026-10-08 00:00", false},
+		// 步长
+		{"*/15 * * * *", "2026-10-16 10:45", true},
+		{"*/15 * * * *", "2026-10-16 10:46", false},
+		// 日与周同时受限时取并集
+		{"* * 13 * fri", "2026-10-16 10:00", true},
+		{"* * 13 * fri", "2026-10-13 10:00", true},
+		{"* * 13 * fri", "2026-10-14 10:00", false},
+	}
+	for _, c := range cases {
+		s, err := Parse(c.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", c.spec, err)
+		}
+		if got := s.Match(at(c.t)); got != c.want {
+			t.Errorf("%q at %s = %v, want %v", c.spec, c.t, got, c.want)
+		}
+	}
+	for _, bad := range []string{"* * * *", "60 * * * *", "* * * * mon-", "*/0 * * * *", "* 5-2 * * *"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) should fail", bad)
+		}
+	}
+}
+
+func TestActiveUntil(t *testing.T) {
+	s, _ := Parse("* 18-23 * * fri")
+	start := time.Date(2026, 10, 16, 20, 15, 30, 0, time.UTC)
+	if got := s.ActiveUntil(start, 24*time.Hour); !got.Equal(time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("ActiveUntil = %s", got)
+	}
+	always, _ := Parse("* * * * *")
+	if got := always.ActiveUntil(start, time.Hour); !got.Equal(start.Add(time.Hour)) {
+		t.Fatalf("ActiveUntil should stop at limit, got %s", got)
+	}
+}
+
+// TestActiveUntilMatchesMinuteScan 与逐分钟扫描的结果对照
+func TestActiveUntilMatchesMinuteScan(t *testing.T) {
+	scan := func(s *Schedule, t time.Time, limit time.Duration) time.Time {
+		end := t.Add(limit)
+		for m := t.Truncate(time.Minute); m.Before(end); m = m.Add(time.Minute) {
+			if !s.Match(m) {
+				if m.Before(t) {
+					return t
+				}
+				return m
+			}
+		}
+		return end
+	}
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	newYork, _ := time.LoadLocation("America/New_York")
+	specs := []string{"* * * * *", "* * * * sat,sun", "* 18-23 * * fri", "0-44 9-17 * * mon-fri", "*/15 * * * *", "* * 1-7 oct *", "* * 13 * fri", "* 22-23,0-5 * * *", "* * * * 6-7"}
+	starts := []time.Time{
+		time.Date(2026, 10, 16, 20, 15, 30, 0, time.UTC),
+		time.Date(2026, 10, 17, 0, 0, 0, 0, shanghai),
+		time.Date(2026, 10, 1, 9, 44, 59, 0, shanghai),
+		time.Date(2026, 10, 31, 23, 30, 0, 0, newYork),
+		time.Date(2026, 3, 7, 22, 10, 0, 0, newYork),
+	}
+	for _, spec := range specs {
+		s, _ := Parse(spec)
+		for _, start := range starts {
+			for _, limit := range []time.Duration{time.Hour, 72 * time.Hour, 31 * 24 * time.Hour} {
+				if got, want := s.ActiveUntil(start, limit), scan(s, start, limit); !got.Equal(want) {
+					t.Errorf("%q from %s (limit %s): got %s, want %s", spec, start, limit, got, want)
+				}
+			}
+		}
+	}
+}
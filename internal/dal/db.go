@@ -14,7 +14,17 @@ func InitDB(cfg config.Config) (*gorm.DB, error) {
 	// 当未提供 MySQL DSN 时，走内存 SQLite：无需安装数据库，适合快速演示与练习
 	// 说明：使用 shared cache 让多个连接共享同一内存数据库
 	if cfg.MySQLDSN == "" {
-		return gorm.Open(sqlite.Open("file:webci_demo?mode=memory&cache=shared"), &gorm.Config{})
+		db, err := gorm.Open(sqlite.Open("file:webci_demo?mode=memory&cache=shared"), &gorm.Config{})
+		if err != nil {
+			return nil, err
+		}
+		// SQLite 共享缓存下并发写事务会返回表锁错误：限制为单连接串行执行
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+		return db, nil
 	}
 	// 提供了 DSN 时，使用 MySQL 作为持久化存储
 	return gorm.Open(mysql.Open(cfg.MySQLDSN), &gorm.Config{})
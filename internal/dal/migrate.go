@@ -7,8 +7,9 @@ import (
 )
 
 // AutoMigrate 执行模型自动迁移
-// 迁移 branches、environments、jobs 三张表结构
+// 迁移 branches、environments、jobs、job_events、任务日志、产物、变量、部署记录、审批、冻结窗口、用户、访问令牌、GitLab 凭据、审计事件、GitLab 配置版本、GitLab webhook 事件、GitLab 操作记录、流水线任务类型与 GitLab 镜像（流水线、作业、提交、分支、合并请求与同步进度）表结构
 func AutoMigrate(db *gorm.DB) error {
 	// GORM 根据结构体与标签生成/更新表结构，保证开发与数据库一致
-	return db.AutoMigrate(&model.Branch{}, &model.Environment{}, &model.Job{})
+	return db.AutoMigrate(&model.Branch{}, &model.Environment{}, &model.Job{}, &model.JobEvent{}, &model.JobLogChunk{}, &model.JobLogArchive{}, &model.Artifact{}, &model.Variable{}, &model.Deployment{}, &model.Approval{}, &model.FreezeWindow{}, &model.User{}, &model.APIToken{}, &model.GitLabCredential{}, &model.AuditEvent{}, &model.GitLabConfig{}, &model.GitLabEvent{}, &model.GitLabTaskHint{}, &model.GitLabPipelineType{},
+		&model.GitLabPipeline{}, &model.GitLabJob{}, &model.GitLabCommit{}, &model.GitLabBranch{}, &model.GitLabMergeRequest{}, &model.GitLabSyncState{})
 }
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// APIToken 访问令牌模型
+// 映射 api_tokens 表：登录会话与个人 API 令牌均以 Bearer 令牌访问接口，仅保存令牌的 SHA-256 哈希
+type APIToken struct {
+	// 主键：自增 ID
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// 令牌所属用户
+	UserID uint64 `gorm:"index" json:"user_id"`
+	// 类型：session（登录会话）/personal（个人 API 令牌）
+	Kind string `gorm:"size:16" json:"kind"`
+	// 个人令牌名称，便于识别用途
+	Name string `gorm:"size:64" json:"name"`
+	// 令牌哈希（十六进制 SHA-256），不对外输出
+	TokenHash string `gorm:"size:64;uniqueIndex" json:"-"`
+	// 令牌前缀：明文的前若干字符，便于在列表中辨认
+	Prefix string `gorm:"size:16" json:"prefix"`
+	// 过期时间：为空表示不过期
+	ExpiresAt *time.Time `gorm:"type:datetime" json:"expires_at"`
+	// 最近一次使用时间
+	LastUsedAt *time.Time `gorm:"type:datetime" json:"last_used_at"`
+	// 创建时间
+	CreatedAt time.Time `gorm:"type:datetime" json:"created_at"`
+}
+
+// 令牌类型取值
+const (
+	TokenKindSession  = "session"
+	TokenKindPersonal = "personal"
+)
+
+// TableName 返回表名
+func (APIToken) TableName() string { return "api_tokens" }
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// Approval 部署审批记录模型
+// 映射 approvals 表：等待审批的任务每收到一次批准或拒绝追加一条，同一审批人对同一任务只能决定一次
+type Approval struct {
+	// 主键：自增 ID
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// 被审批的任务（独立任务或流水线父任务）与其目标环境
+	JobID uint64 `gorm:"uniqueIndex:idx_approval_job_user" json:"job_id"`
+	EnvID uint64 `gorm:"index" json:"env_id"`
+	// 审批人身份
+	Approver string `gorm:"size:64;uniqueIndex:idx_approval_job_user" json:"approver"`
+	// 决定：approved/rejected
+	Decision string `gorm:"size:16" json:"decision"`
+	// 审批意见
+	Comment string `gorm:"size:255" json:"comment"`
+	// 决定时间
+	CreatedAt time.Time `gorm:"type:datetime" json:"created_at"`
+}
+
+// 审批决定取值
+const (
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
+// TableName 返回表名
+func (Approval) TableName() string { return "approvals" }
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// Artifact 任务产物
+// 映射 artifacts 表，记录从任务工作区收集的单个文件；文件内容保存在产物存储后端
+type Artifact struct {
+	// 主键：产物 ID
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// 所属任务
+	JobID uint64 `gorm:"index" json:"job_id"`
+	// 文件在工作区内的相对路径（以 / 分隔）
+	Path string `gorm:"size:512" json:"path"`
+	// 文件大小（字节）与 SHA-256 校验和
+	Size   int64  `json:"size"`
+	SHA256 string `gorm:"column:sha256;size:64" json:"sha256"`
+	// 存储后端中的对象键
+	StorageKey string `gorm:"size:600" json:"-"`
+	// 过期时间：为空表示永久保留，过期后由调度器清理
+	ExpiresAt *time.Time `gorm:"type:datetime;index" json:"expires_at"`
+	// 收集时间
+	CreatedAt time.Time `gorm:"type:datetime" json:"created_at"`
+}
+
+// TableName 返回表名
+func (Artifact) TableName() string { return "artifacts" }
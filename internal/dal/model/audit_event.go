@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// AuditEvent 审计事件模型
+// 映射 audit_events 表：每次调用写接口（含被拒绝的调用）追加一条，记录操作者、动作、对象、请求摘要与结果
+type AuditEvent struct {
+	// 主键：自增 ID
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// 操作者用户名：登录请求为提交的用户名
+	Actor string `gorm:"size:64;index" json:"actor"`
+	// 动作，如 job.retry、gitlab.merge
+	Action string `gorm:"size:64;index" json:"action"`
+	// 操作对象：资源路径与请求体中的标识字段（分支名、MR 源与目标分支等）
+	Target string `gorm:"size:255" json:"target"`
+	// 请求方法与路径
+	Method string `gorm:"size:8" json:"method"`
+	Path   string `gorm:"size:255" json:"path"`
+	// 请求摘要：脱敏后的查询参数与请求体，超长截断
+	Summary string `gorm:"type:text" json:"summary"`
+	// 响应状态码与结果：success/failure，失败时记录错误信息
+	Status int    `json:"status"`
+	Result string `gorm:"size:16;index" json:"result"`
+	Error  string `gorm:"size:512" json:"error"`
+	// 客户端地址
+	RemoteAddr string `gorm:"size:64" json:"remote_addr"`
+	// 发生时间
+	CreatedAt time.Time `gorm:"type:datetime;index" json:"created_at"`
+}
+
+// 审计结果取值
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// TableName 返回表名
+func (AuditEvent) TableName() string { return "audit_events" }
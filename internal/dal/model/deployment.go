@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// Deployment 部署记录模型
+// 映射 deployments 表：每个绑定环境的顶层任务（独立任务或流水线）结束时写入一条，记录部署了什么、由谁、结果如何
+type Deployment struct {
+	// 主键：自增 ID
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// 目标环境
+	EnvID uint64 `gorm:"index" json:"env_id"`
+	// 执行部署的任务：独立任务或流水线父任务，一个任务只对应一条部署记录
+	JobID uint64 `gorm:"uniqueIndex" json:"job_id"`
+	// 部署来源：分支与提交，分支名冗余保存，分支删除后仍可追溯
+	BranchID   uint64 `gorm:"index" json:"branch_id"`
+	BranchName string `gorm:"size:128" json:"branch_name"`
+	CommitID   string `gorm:"size:64" json:"commit_id"`
+	// 回滚：回滚部署指向被重新部署的历史部署记录 ID，普通部署为 0
+	RollbackOf uint64 `json:"rollback_of"`
+	// 部署发起人
+	TriggerUser string `gorm:"size:64" json:"trigger_user"`
+	// 部署结果：任务终态（success/failed/canceled/timed_out）
+	Status string `gorm:"size:16;index" json:"status"`
+	// 部署开始与结束时间
+	StartedAt  *time.Time `gorm:"type:datetime" json:"started_at"`
+	FinishedAt time.Time  `gorm:"type:datetime" json:"finished_at"`
+	// 审计时间戳
+	CreatedAt time.Time `gorm:"type:datetime" json:"created_at"`
+}
+
+// TableName 返回表名
+func (Deployment) TableName() string { return "deployments" }
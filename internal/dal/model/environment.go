@@ -15,6 +15,15 @@ type Environment struct {
 	Name string `gorm:"size:128;uniqueIndex" json:"name"`
 	// 描述：环境说明或用途
 	Description string `gorm:"size:255" json:"description"`
+	// 并发上限：同一环境同时运行的任务数，0 表示不限制（如 prod 设为 1 避免并发部署）
+	MaxConcurrency int `gorm:"default:0" json:"max_concurrency"`
+	// 任务超时（秒）：覆盖服务默认超时，任务自身声明的超时优先；0 表示使用默认值
+	TimeoutSeconds int `gorm:"default:0" json:"timeout_seconds"`
+	// 保护规则：允许部署的分支模式（通配符或 /正则/，为空表示不限制）、
+	// 放行部署所需的审批人数（0 表示无需审批）与有权审批的用户（为空表示除触发人外任何人）
+	DeployBranches    StringList `gorm:"type:text" json:"deploy_branches"`
+	RequiredApprovals int        `gorm:"default:0" json:"required_approvals"`
+	Approvers         StringList `gorm:"type:text" json:"approvers"`
 	// 当前部署信息
 	CurrentDeployCommit string    `gorm:"size:64" json:"current_deploy_commit"`
 	CurrentDeployAt     time.Time `gorm:"type:datetime" json:"current_deploy_at"`
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// FreezeWindow 部署冻结窗口模型
+// 映射 freeze_windows 表：窗口期内不允许向所属环境发起新的部署（管理员附原因覆盖除外）
+// 窗口为日期区间（starts_at/ends_at）或周期性的 cron 表达式（命中的每一分钟均处于冻结中），二选一
+type FreezeWindow struct {
+	// 主键：自增 ID
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// 所属环境
+	EnvID uint64 `gorm:"index" json:"env_id"`
+	// 日期区间：[starts_at, ends_at)，cron 窗口为空
+	StartsAt *time.Time `gorm:"type:datetime" json:"starts_at"`
+	EndsAt   *time.Time `gorm:"type:datetime" json:"ends_at"`
+	// 周期窗口：五段式 cron 表达式，如 "* * * * sat,sun" 表示周末全天
+	Cron string `gorm:"size:128" json:"cron"`
+	// 时区：cron 表达式按该时区求值，日期区间中不带时区的时间也按该时区解析；为空表示 UTC
+	Timezone string `gorm:"size:64" json:"timezone"`
+	// 冻结原因，如"春节封版"
+	Reason string `gorm:"size:255" json:"reason"`
+	// 审计时间戳
+	CreatedAt time.Time `gorm:"type:datetime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:datetime" json:"updated_at"`
+}
+
+// TableName 返回表名
+func (FreezeWindow) TableName() string { return "freeze_windows" }
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// GitLabConfig GitLab 连接配置版本模型
+// 映射 gitlab_configs 表：每次修改追加一个新版本，版本号最大的为当前生效配置；访问令牌以服务端密钥加密存储
+type GitLabConfig struct {
+	// 主键：自增 ID
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// 版本号：从 1 递增
+	Version int `gorm:"uniqueIndex" json:"version"`
+	// GitLab API 地址、访问令牌密文与项目
+	BaseURL   string `gorm:"size:255" json:"base_url"`
+	Token     string `gorm:"type:text" json:"-"`
+	ProjectID string `gorm:"size:255" json:"project_id"`
+	// 本地仓库路径：分支刷新、构建检出与部署变更使用
+	RepoPath string `gorm:"size:512" json:"repo_path"`
+	// 修改人与说明
+	CreatedBy string `gorm:"size:64" json:"created_by"`
+	Note      string `gorm:"size:255" json:"note"`
+	// 生效时间
+	CreatedAt time.Time `gorm:"type:datetime" json:"created_at"`
+}
+
+// TableName 返回表名
+func (GitLabConfig) TableName() string { return "gitlab_configs" }
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// GitLabCredential 用户的 GitLab OAuth 令牌模型
+// 映射 gitlab_credentials 表：GitLab 单点登录时保存用户自己的访问令牌，用于以该用户身份操作 GitLab；
+// 令牌以服务端密钥加密存储
+type GitLabCredential struct {
+	// 主键：自增 ID
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// 所属用户：每个用户一条
+	UserID uint64 `gorm:"uniqueIndex" json:"user_id"`
+	// 访问令牌与刷新令牌密文
+	AccessToken  string `gorm:"type:text" json:"-"`
+	RefreshToken string `gorm:"type:text" json:"-"`
+	// 访问令牌过期时间：为空表示不过期
+	ExpiresAt *time.Time `gorm:"type:datetime" json:"expires_at"`
+	// 审计时间戳
+	CreatedAt time.Time `gorm:"type:datetime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:datetime" json:"updated_at"`
+}
+
+// TableName 返回表名
+func (GitLabCredential) TableName() string { return "gitlab_credentials" }
@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// GitLab webhook 事件类型
+const (
+	GitLabEventPush         = "push"
+	GitLabEventMergeRequest = "merge_request"
+	GitLabEventPipeline     = "pipeline"
+	GitLabEventJob          = "job"
+)
+
+// GitLabEvent GitLab webhook 事件模型
+// 映射 gitlab_events 表：保存 push、merge_request、pipeline 与 job 事件的关键字段与原始负载，作为任务类型判别的依据
+type GitLabEvent struct {
+	// 主键：自增 ID
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// 投递标识：X-Gitlab-Event-UUID，缺失时为负载摘要；GitLab 重试投递时按此去重
+	DeliveryID string `gorm:"size:64;uniqueIndex" json:"delivery_id"`
+	// 事件类型：push/merge_request/pipeline/job
+	Kind string `gorm:"size:32;index" json:"kind"`
+	// 动作或状态：MR 为 open/merge 等，流水线与作业为其状态
+	Action string `gorm:"size:32" json:"action"`
+	// 分支名（已去掉 refs/heads/）；MR 为目标分支，SourceRef 为源分支
+	Ref       string `gorm:"size:255;index" json:"ref"`
+	SourceRef string `gorm:"size:255" json:"source_ref,omitempty"`
+	// 提交：push 为推送后的提交，MR 为合并产生的提交，流水线与作业为其运行的提交
+	SHA       string `gorm:"size:64;index" json:"sha"`
+	BeforeSHA string `gorm:"size:64" json:"before_sha,omitempty"`
+	// 关联对象：流水线、作业与 MR 编号
+	PipelineID int64 `gorm:"index" json:"pipeline_id,omitempty"`
+	JobID      int64 `json:"job_id,omitempty"`
+	MRIID      int64 `gorm:"column:mr_iid" json:"mr_iid,omitempty"`
+	// 操作者、标题（提交标题、MR 标题或作业名）与链接
+	Username string `gorm:"size:64" json:"username"`
+	Title    string `gorm:"size:255" json:"title"`
+	URL      string `gorm:"size:512" json:"url"`
+	// 原始负载
+	Payload string `gorm:"type:longtext" json:"-"`
+	// 接收时间
+	CreatedAt time.Time `gorm:"type:datetime" json:"created_at"`
+}
+
+// TableName 返回表名
+func (GitLabEvent) TableName() string { return "gitlab_events" }
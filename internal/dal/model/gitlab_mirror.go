@@ -0,0 +1,130 @@
+package model
+
+import "time"
+
+// GitLabPipeline GitLab 流水线镜像模型
+// 映射 gitlab_pipelines 表：后台同步写入，CI 页面从此表读取；时间字段为 GitLab 上的时间
+type GitLabPipeline struct {
+	// 主键：GitLab 流水线 ID
+	ID  int64 `gorm:"primaryKey;autoIncrement:false" json:"id"`
+	IID int64 `gorm:"column:iid" json:"iid"`
+	// 分支、提交、状态与来源（push/web/merge_request_event 等）
+	Ref    string `gorm:"size:255;index" json:"ref"`
+	SHA    string `gorm:"size:64;index" json:"sha"`
+	Status string `gorm:"size:32" json:"status"`
+	Source string `gorm:"size:64" json:"source"`
+	// 触发用户（优先显示名）、链接与持续秒数
+	TriggerUser string `gorm:"size:255" json:"trigger_user"`
+	WebURL      string `gorm:"size:512" json:"web_url"`
+	Duration    int    `json:"duration"`
+	// GitLab 上的创建、更新与结束时间
+	CreatedAt  time.Time  `gorm:"type:datetime;autoCreateTime:false;index" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"type:datetime;autoUpdateTime:false;index" json:"updated_at"`
+	FinishedAt *time.Time `gorm:"type:datetime" json:"finished_at,omitempty"`
+	// 本地同步时间
+	SyncedAt time.Time `gorm:"type:datetime" json:"synced_at"`
+	// 获取详情、作业或提交失败的原因：此时只保存了列表中的字段，后续同步重试，成功后清空
+	SyncError string `gorm:"size:512" json:"sync_error,omitempty"`
+}
+
+// TableName 返回表名
+func (GitLabPipeline) TableName() string { return "gitlab_pipelines" }
+
+// GitLabJob GitLab 作业镜像模型
+// 映射 gitlab_jobs 表：随所属流水线一起同步
+type GitLabJob struct {
+	// 主键：GitLab 作业 ID
+	ID         int64 `gorm:"primaryKey;autoIncrement:false" json:"id"`
+	PipelineID int64 `gorm:"index" json:"pipeline_id"`
+	// 名称、阶段、状态与链接
+	Name   string `gorm:"size:255" json:"name"`
+	Stage  string `gorm:"size:255" json:"stage"`
+	Status string `gorm:"size:32" json:"status"`
+	WebURL string `gorm:"size:512" json:"web_url"`
+	// 持续秒数与 GitLab 上的时间
+	Duration   float64    `json:"duration"`
+	CreatedAt  time.Time  `gorm:"type:datetime;autoCreateTime:false" json:"created_at"`
+	StartedAt  *time.Time `gorm:"type:datetime" json:"started_at,omitempty"`
+	FinishedAt *time.Time `gorm:"type:datetime" json:"finished_at,omitempty"`
+}
+
+// TableName 返回表名
+func (GitLabJob) TableName() string { return "gitlab_jobs" }
+
+// GitLabCommit GitLab 提交镜像模型
+// 映射 gitlab_commits 表：提交不可变，只在首次遇到时获取
+type GitLabCommit struct {
+	// 主键：提交 SHA
+	SHA string `gorm:"primaryKey;size:64" json:"sha"`
+	// 标题、完整信息与作者
+	Title      string    `gorm:"size:512" json:"title"`
+	Message    string    `gorm:"type:text" json:"message"`
+	AuthorName string    `gorm:"size:255" json:"author_name"`
+	CreatedAt  time.Time `gorm:"type:datetime;autoCreateTime:false" json:"created_at"`
+}
+
+// TableName 返回表名
+func (GitLabCommit) TableName() string { return "gitlab_commits" }
+
+// GitLabBranch GitLab 分支镜像模型
+// 映射 gitlab_branches 表：每次同步整体对齐，GitLab 上已删除的分支随之删除
+type GitLabBranch struct {
+	// 主键：分支名
+	Name      string    `gorm:"primaryKey;size:255" json:"name"`
+	CommitSHA string    `gorm:"size:64" json:"commit_sha"`
+	Protected bool      `json:"protected"`
+	SyncedAt  time.Time `gorm:"type:datetime" json:"synced_at"`
+}
+
+// TableName 返回表名
+func (GitLabBranch) TableName() string { return "gitlab_branches" }
+
+// GitLabMergeRequest GitLab 合并请求镜像模型
+// 映射 gitlab_merge_requests 表：按项目内编号保存
+type GitLabMergeRequest struct {
+	// 主键：项目内 MR 编号
+	IID int64 `gorm:"column:iid;primaryKey;autoIncrement:false" json:"iid"`
+	// 标题、状态（opened/merged/closed/locked）、源与目标分支、作者与链接
+	Title        string `gorm:"size:512" json:"title"`
+	State        string `gorm:"size:32;index" json:"state"`
+	SourceBranch string `gorm:"size:255" json:"source_branch"`
+	TargetBranch string `gorm:"size:255" json:"target_branch"`
+	Author       string `gorm:"size:255" json:"author"`
+	WebURL       string `gorm:"size:512" json:"web_url"`
+	// 合并产生的提交
+	MergeCommitSHA  string `gorm:"size:64" json:"merge_commit_sha"`
+	SquashCommitSHA string `gorm:"size:64" json:"squash_commit_sha"`
+	// GitLab 上的时间
+	CreatedAt time.Time  `gorm:"type:datetime;autoCreateTime:false" json:"created_at"`
+	UpdatedAt time.Time  `gorm:"type:datetime;autoUpdateTime:false" json:"updated_at"`
+	MergedAt  *time.Time `gorm:"type:datetime" json:"merged_at,omitempty"`
+}
+
+// TableName 返回表名
+func (GitLabMergeRequest) TableName() string { return "gitlab_merge_requests" }
+
+// 同步的资源
+const (
+	SyncResourcePipelines     = "pipelines"
+	SyncResourceMergeRequests = "merge_requests"
+	SyncResourceBranches      = "branches"
+)
+
+// GitLabSyncState GitLab 同步进度模型
+// 映射 gitlab_sync_states 表：每种资源一行，记录所属项目、增量游标（已同步到的 GitLab 更新时间）与最近一次同步结果
+type GitLabSyncState struct {
+	// 主键：资源名
+	Resource string `gorm:"primaryKey;size:32" json:"resource"`
+	// 所属 GitLab 地址与项目：与当前配置不同时清空镜像重新同步
+	Project string `gorm:"size:512" json:"project"`
+	// 增量游标：下次只拉取更新时间晚于它的对象
+	Cursor *time.Time `gorm:"type:datetime" json:"cursor,omitempty"`
+	// 最近一次成功同步与全量对齐（清理 GitLab 上已删除的对象）的时间
+	LastSyncedAt *time.Time `gorm:"type:datetime" json:"last_synced_at,omitempty"`
+	LastFullAt   *time.Time `gorm:"type:datetime" json:"last_full_at,omitempty"`
+	// 最近一次同步的错误，成功后清空
+	LastError string `gorm:"type:text" json:"last_error,omitempty"`
+}
+
+// TableName 返回表名
+func (GitLabSyncState) TableName() string { return "gitlab_sync_states" }
@@ -0,0 +1,52 @@
+package model
+
+import "time"
+
+// 任务类型判别来源
+const (
+	TaskTypeSourceEvent   = "event"
+	TaskTypeSourceHint    = "hint"
+	TaskTypeSourceDefault = "default"
+	TaskTypeSourceManual  = "manual"
+)
+
+// GitLabTaskHint 本系统发起的 GitLab 操作记录模型
+// 映射 gitlab_task_hints 表：建分支记录分支与其起点提交，合并 MR 记录目标分支与合并提交，作为没有 webhook 事件时的判别依据
+type GitLabTaskHint struct {
+	// 主键：自增 ID
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// 操作：create_branch/merge；同一操作在同一分支与提交上只记录一次
+	Kind   string `gorm:"size:32;uniqueIndex:idx_gitlab_hint" json:"kind"`
+	Branch string `gorm:"size:255;uniqueIndex:idx_gitlab_hint" json:"branch"`
+	SHA    string `gorm:"size:64;uniqueIndex:idx_gitlab_hint;index" json:"sha"`
+	// 合并的 MR 编号、标题与链接
+	MRIID int64  `gorm:"column:mr_iid" json:"mr_iid,omitempty"`
+	Title string `gorm:"size:255" json:"title"`
+	URL   string `gorm:"size:512" json:"url"`
+	// 记录时间
+	CreatedAt time.Time `gorm:"type:datetime" json:"created_at"`
+}
+
+// TableName 返回表名
+func (GitLabTaskHint) TableName() string { return "gitlab_task_hints" }
+
+// GitLabPipelineType 流水线任务类型模型
+// 映射 gitlab_pipeline_types 表：每条 GitLab 流水线一条判别结果；来源为 default 的结果在出现新依据时重新判别，manual 为人工修正，不再自动改变
+type GitLabPipelineType struct {
+	// 主键：GitLab 流水线 ID
+	PipelineID int64 `gorm:"primaryKey;autoIncrement:false" json:"pipeline_id"`
+	// 流水线所在分支与提交
+	Ref string `gorm:"size:255" json:"ref"`
+	SHA string `gorm:"size:64" json:"sha"`
+	// 任务类型：创建分支/分支合并/修改文件
+	TaskType string `gorm:"size:32" json:"task_type"`
+	// 判别来源：event/hint/default/manual
+	Source string `gorm:"size:16" json:"source"`
+	// 人工修正人
+	UpdatedBy string    `gorm:"size:64" json:"updated_by,omitempty"`
+	CreatedAt time.Time `gorm:"type:datetime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:datetime" json:"updated_at"`
+}
+
+// TableName 返回表名
+func (GitLabPipelineType) TableName() string { return "gitlab_pipeline_types" }
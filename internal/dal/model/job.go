@@ -14,15 +14,54 @@ type Job struct {
 	// 归属维度：分支与环境 ID，便于过滤查询
 	BranchID uint64 `gorm:"index" json:"branch_id"`
 	EnvID    uint64 `gorm:"index" json:"env_id"`
-	// 状态机：pending → running → success/failed（index 便于统计与过滤）
-	Status string `gorm:"size:16;default:'pending';index" json:"status"`
+	// 任务类型：job 为可执行任务；pipeline 为流水线父任务，仅汇总子任务状态，不被执行器认领
+	Kind string `gorm:"size:16;default:'job'" json:"kind"`
+	// 流水线归属：子任务指向其流水线父任务 ID，顶层任务为 0
+	PipelineID uint64 `gorm:"index" json:"pipeline_id"`
+	// 任务定义：来自流水线文件的名称、阶段、依赖任务名与超时
+	Name           string     `gorm:"size:128" json:"name"`
+	Stage          string     `gorm:"size:64" json:"stage"`
+	Needs          StringList `gorm:"type:text" json:"needs"`
+	TimeoutSeconds int        `json:"timeout_seconds"`
+	// 变量：执行时注入为环境变量
+	Variables StringMap `gorm:"type:text" json:"variables"`
+	// 手动任务：流水线文件中 when: manual 的子任务依赖满足后转为 manual，由用户放行后才进入队列
+	Manual bool `json:"manual"`
+	// 状态机：created/manual/waiting_for_approval → pending → running → success/failed/canceled/timed_out，未执行的任务可转为 skipped
+	// 合法转换由任务服务校验（index 便于统计与过滤）
+	Status string `gorm:"size:32;default:'pending';index" json:"status"`
+	// 队列租约：认领任务的执行器实例与租约到期时间，执行期间由心跳续期
+	LeaseOwner     string     `gorm:"size:64;index" json:"lease_owner"`
+	LeaseExpiresAt *time.Time `gorm:"type:datetime" json:"lease_expires_at"`
+	// 认领次数：每次被执行器认领加一，用于限制崩溃恢复后的重复执行
+	Attempts int `json:"attempts"`
+	// 取消请求：持久化保存，任意实例的执行器都能识别
+	CancelRequested bool `json:"cancel_requested"`
 	// 触发用户：记录是谁发起任务
 	TriggerUser string `gorm:"size:64" json:"trigger_user"`
 	// 时间戳：开始/结束时间，便于度量耗时
 	StartTime *time.Time `gorm:"type:datetime" json:"start_time"`
 	EndTime   *time.Time `gorm:"type:datetime" json:"end_time"`
-	// 日志：构建过程的文本输出
-	Log string `gorm:"type:text" json:"log"`
+	// 构建步骤：shell 命令列表，执行器依次在工作区中运行
+	Steps StringList `gorm:"type:text" json:"steps"`
+	// 产物声明：任务成功后从工作区收集的路径（通配符）与保留秒数（0 使用默认值，-1 永久保留）
+	ArtifactPaths     StringList `gorm:"type:text" json:"artifact_paths"`
+	ArtifactsExpireIn int        `json:"artifacts_expire_in"`
+	// 重试链：retry_of 指向被重试的任务；retry_count 为本任务是第几次自动重试（原始任务与手动重试为 0）
+	RetryOf    uint64 `gorm:"index" json:"retry_of"`
+	RetryCount int    `json:"retry_count"`
+	// 自动重试策略：失败原因命中 retry_when（为空表示任意原因）且 retry_count 未达 retry_max 时由执行器自动重试
+	RetryMax  int        `json:"retry_max"`
+	RetryWhen StringList `gorm:"type:text" json:"retry_when"`
+	// 回滚标记：回滚任务指向其重新部署的部署记录 ID，普通任务为 0
+	RollbackOf uint64 `gorm:"index" json:"rollback_of"`
+	// 冻结覆盖：部署时环境处于冻结窗口，由管理员（触发用户）附原因覆盖放行时记录原因
+	FreezeOverride string `gorm:"size:255" json:"freeze_override"`
+	// 失败原因：任务以 failed/timed_out 结束时由执行器记录
+	FailureReason string `gorm:"size:32" json:"failure_reason"`
+	// 日志：内容按块存放在 job_log_chunks，任务结束后压缩归档到 job_log_archives；这里仅记录总字节数与归档标记
+	LogSize     int64 `json:"log_size"`
+	LogArchived bool  `json:"log_archived"`
 	// Git提交信息
 	CommitID      string     `gorm:"size:64" json:"commit_id"`
 	CommitMessage string     `gorm:"type:text" json:"commit_message"`
@@ -35,7 +74,54 @@ type Job struct {
 	CreatedAt time.Time      `gorm:"type:datetime" json:"created_at"`
 	UpdatedAt time.Time      `gorm:"type:datetime" json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	// 子任务：流水线父任务的展开结果，仅用于接口返回，不落库
+	Jobs []Job `gorm:"-" json:"jobs,omitempty"`
+	// 排队位置：pending 任务在全局队列中的名次（从 1 开始），仅用于接口返回
+	QueuePosition int `gorm:"-" json:"queue_position,omitempty"`
 }
 
+// 任务类型取值
+const (
+	JobKindJob      = "job"
+	JobKindPipeline = "pipeline"
+)
+
+// 任务状态取值
+const (
+	// JobStatusCreated 流水线子任务等待依赖完成
+	JobStatusCreated = "created"
+	// JobStatusManual 等待手动放行
+	JobStatusManual = "manual"
+	// JobStatusWaitingRetry 自动重试任务等待原任务的失败落库，仅由执行器放行，流水线推进不处理该状态
+	JobStatusWaitingRetry = "waiting_retry"
+	// JobStatusWaitingForApproval 部署到受保护环境的任务等待审批
+	JobStatusWaitingForApproval = "waiting_for_approval"
+	JobStatusPending            = "pending"
+	JobStatusRunning            = "running"
+	JobStatusSuccess            = "success"
+	JobStatusFailed             = "failed"
+	JobStatusCanceled           = "canceled"
+	JobStatusTimedOut           = "timed_out"
+	JobStatusSkipped            = "skipped"
+)
+
+// JobStatuses 全部任务状态，按生命周期先后排列；新增状态时须同步加入，统计与校验依赖该列表
+var JobStatuses = []string{
+	JobStatusCreated, JobStatusManual, JobStatusWaitingRetry, JobStatusWaitingForApproval, JobStatusPending, JobStatusRunning,
+	JobStatusSuccess, JobStatusFailed, JobStatusCanceled, JobStatusTimedOut, JobStatusSkipped,
+}
+
+// 任务失败原因取值，同时作为自动重试条件（另有 always 表示任意原因）
+const (
+	// FailureScript 构建步骤以非零退出码结束
+	FailureScript = "script_failure"
+	// FailureTimeout 任务执行超时
+	FailureTimeout = "job_timeout"
+	// FailureArtifact 产物收集失败（如超出大小上限）
+	FailureArtifact = "artifact_failure"
+	// FailureSystem 检出、工作区准备或执行器失联等系统原因
+	FailureSystem = "system_failure"
+)
+
 // TableName 返回表名
 func (Job) TableName() string { return "jobs" }
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// JobEvent 任务状态变更事件
+// 映射 job_events 表，每次状态转换追加一条记录，用于审计任务生命周期
+type JobEvent struct {
+	// 主键：自增 ID
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// 所属任务
+	JobID uint64 `gorm:"index" json:"job_id"`
+	// 状态转换：创建任务时 FromStatus 为空
+	FromStatus string `gorm:"size:32" json:"from_status"`
+	ToStatus   string `gorm:"size:32" json:"to_status"`
+	// 操作者：触发用户、执行器实例或 system
+	Actor string `gorm:"size:64" json:"actor"`
+	// 备注：转换原因，如退出码、恢复说明
+	Note string `gorm:"size:255" json:"note"`
+	// 发生时间
+	CreatedAt time.Time `gorm:"type:datetime;index" json:"created_at"`
+}
+
+// TableName 返回表名
+func (JobEvent) TableName() string { return "job_events" }
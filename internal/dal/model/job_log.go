@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// JobLogChunk 任务日志块
+// 映射 job_log_chunks 表，每次追加日志写入一块，按字节偏移排序即为完整日志
+type JobLogChunk struct {
+	// 主键：自增 ID
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// 所属任务与块起始字节偏移：联合唯一，支持按区间分页读取
+	JobID       uint64 `gorm:"uniqueIndex:idx_job_log_chunk" json:"job_id"`
+	StartOffset int64  `gorm:"uniqueIndex:idx_job_log_chunk" json:"start_offset"`
+	// 块长度（字节）
+	Size int `json:"size"`
+	// 块内容：按字节存储，超长输出在写入时拆分
+	Content []byte `gorm:"type:mediumblob" json:"-"`
+	// 写入时间
+	CreatedAt time.Time `gorm:"type:datetime" json:"created_at"`
+}
+
+// TableName 返回表名
+func (JobLogChunk) TableName() string { return "job_log_chunks" }
+
+// JobLogArchive 任务日志归档
+// 映射 job_log_archives 表，任务结束后将日志块合并为 gzip 压缩数据，覆盖 [0, Size) 字节区间
+type JobLogArchive struct {
+	// 主键：任务 ID
+	JobID uint64 `gorm:"primaryKey;autoIncrement:false" json:"job_id"`
+	// 归档覆盖的原始日志字节数
+	Size int64 `json:"size"`
+	// gzip 压缩后的日志
+	Data []byte `gorm:"type:longblob" json:"-"`
+	// 归档时间
+	CreatedAt time.Time `gorm:"type:datetime" json:"created_at"`
+}
+
+// TableName 返回表名
+func (JobLogArchive) TableName() string { return "job_log_archives" }
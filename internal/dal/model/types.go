@@ -0,0 +1,60 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// StringList 以 JSON 数组形式存储在 text 列中的字符串列表
+type StringList []string
+
+// Value 实现 driver.Valuer：空列表存为空字符串
+func (l StringList) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal([]string(l))
+	return string(b), err
+}
+
+// Scan 实现 sql.Scanner
+func (l *StringList) Scan(src interface{}) error {
+	return scanJSON(src, (*[]string)(l))
+}
+
+// StringMap 以 JSON 对象形式存储在 text 列中的键值对
+type StringMap map[string]string
+
+// Value 实现 driver.Valuer：空映射存为空字符串
+func (m StringMap) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(map[string]string(m))
+	return string(b), err
+}
+
+// Scan 实现 sql.Scanner
+func (m *StringMap) Scan(src interface{}) error {
+	return scanJSON(src, (*map[string]string)(m))
+}
+
+// scanJSON 兼容 string/[]byte/NULL 三种列值
+func scanJSON(src interface{}, dst interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("unsupported column type %T", src)
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	return json.Unmarshal(b, dst)
+}
@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// User 用户模型
+// 映射 users 表：本地用户以用户名与密码登录，GitLab 单点登录的用户以 gitlab_id 关联（无本地密码）；
+// 角色决定可访问的接口；禁用的用户无法登录，其令牌随之失效
+type User struct {
+	// 主键：自增 ID
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// 用户名：唯一，作为任务触发人、审批人等身份记录
+	Username string `gorm:"size:64;uniqueIndex" json:"username"`
+	// 密码哈希（bcrypt），不对外输出；仅通过 GitLab 登录的用户为空
+	PasswordHash string `gorm:"size:255" json:"-"`
+	// 关联的 GitLab 用户 ID，0 表示未关联
+	GitLabID int64 `gorm:"column:gitlab_id;index" json:"gitlab_id"`
+	// 角色：viewer/developer/maintainer/admin
+	Role string `gorm:"size:16" json:"role"`
+	// 禁用标记
+	Disabled bool `json:"disabled"`
+	// 审计时间戳
+	CreatedAt time.Time `gorm:"type:datetime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:datetime" json:"updated_at"`
+}
+
+// 用户角色取值：权限由低到高，高角色拥有低角色的全部权限
+const (
+	// RoleViewer 只读访问
+	RoleViewer = "viewer"
+	// RoleDeveloper 可触发、重试、取消任务与审批部署
+	RoleDeveloper = "developer"
+	// RoleMaintainer 可管理分支、环境、变量、冻结窗口，回滚部署与合并代码
+	RoleMaintainer = "maintainer"
+	// RoleAdmin 可管理用户与 GitLab 配置，并可覆盖部署冻结窗口
+	RoleAdmin = "admin"
+)
+
+// TableName 返回表名
+func (User) TableName() string { return "users" }
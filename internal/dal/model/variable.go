@@ -0,0 +1,43 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+	"webci-refactored/internal/secret"
+)
+
+// 变量作用域取值
+const (
+	VariableScopeJob         = "job"
+	VariableScopeEnvironment = "environment"
+)
+
+// Variable 变量模型
+// 映射 variables 表，保存环境级变量与任务级密文变量；执行时注入为环境变量
+type Variable struct {
+	// 主键：自增 ID
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// 归属：作用域（job/environment）与对应的任务或环境 ID，同一归属下键唯一
+	Scope   string `gorm:"size:16;uniqueIndex:idx_variable_key" json:"scope"`
+	OwnerID uint64 `gorm:"uniqueIndex:idx_variable_key" json:"owner_id"`
+	Key     string `gorm:"size:128;uniqueIndex:idx_variable_key" json:"key"`
+	// 值：普通变量存明文；密文变量明文为空，值以服务端密钥加密后存入 Encrypted
+	Value     string `gorm:"type:text" json:"value"`
+	Secret    bool   `json:"secret"`
+	Encrypted string `gorm:"type:text" json:"-"`
+	// 审计时间戳
+	CreatedAt time.Time `gorm:"type:datetime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:datetime" json:"updated_at"`
+}
+
+// TableName 返回表名
+func (Variable) TableName() string { return "variables" }
+
+// MarshalJSON 密文变量的值始终输出为掩码，避免任何接口泄露明文
+func (v Variable) MarshalJSON() ([]byte, error) {
+	type plain Variable
+	if v.Secret {
+		v.Value = secret.Mask
+	}
+	return json.Marshal(plain(v))
+}
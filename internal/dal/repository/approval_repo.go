@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"webci-refactored/internal/dal/model"
+
+	"gorm.io/gorm"
+)
+
+// ApprovalRepository 审批记录仓库
+// 提供审批决定的写入与按任务查询
+type ApprovalRepository struct{ db *gorm.DB }
+
+// NewApprovalRepository 创建审批记录仓库实例
+func NewApprovalRepository(db *gorm.DB) *ApprovalRepository { return &ApprovalRepository{db: db} }
+
+// Create 写入审批决定
+func (r *ApprovalRepository) Create(a *model.Approval) error { return r.db.Create(a).Error }
+
+// ListByJob 按时间顺序查询任务的全部审批决定
+func (r *ApprovalRepository) ListByJob(jobID uint64) ([]model.Approval, error) {
+	var items []model.Approval
+	if err := r.db.Where("job_id = ?", jobID).Order("id ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Decided 判断审批人是否已对任务作出决定
+func (r *ApprovalRepository) Decided(jobID uint64, approver string) (bool, error) {
+	var n int64
+	err := r.db.Model(&model.Approval{}).Where("job_id = ? AND approver = ?", jobID, approver).Count(&n).Error
+	return n > 0, err
+}
+
+// CountApproved 统计任务已获得的批准数
+func (r *ApprovalRepository) CountApproved(jobID uint64) (int64, error) {
+	var n int64
+	err := r.db.Model(&model.Approval{}).Where("job_id = ? AND decision = ?", jobID, model.ApprovalApproved).Count(&n).Error
+	return n, err
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"time"
+	"webci-refactored/internal/dal/model"
+
+	"gorm.io/gorm"
+)
+
+// ArtifactRepository 产物仓库
+// 提供产物记录的写入、查询与过期清理
+type ArtifactRepository struct{ db *gorm.DB }
+
+// NewArtifactRepository 创建产物仓库实例
+func NewArtifactRepository(db *gorm.DB) *ArtifactRepository { return &ArtifactRepository{db: db} }
+
+// Create 写入产物记录
+func (r *ArtifactRepository) Create(a *model.Artifact) error { return r.db.Create(a).Error }
+
+// Get 获取任务下的指定产物
+func (r *ArtifactRepository) Get(jobID, id uint64) (*model.Artifact, error) {
+	var a model.Artifact
+	if err := r.db.Where("id = ? AND job_id = ?", id, jobID).First(&a).Error; err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ListByJob 按路径顺序查询任务的全部产物
+func (r *ArtifactRepository) ListByJob(jobID uint64) ([]model.Artifact, error) {
+	var items []model.Artifact
+	if err := r.db.Where("job_id = ?", jobID).Order("path ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ListExpired 查询在 before 之前过期的产物
+func (r *ArtifactRepository) ListExpired(before time.Time, limit int) ([]model.Artifact, error) {
+	var items []model.Artifact
+	err := r.db.Where("expires_at IS NOT NULL AND expires_at < ?", before).
+		Order("expires_at ASC").Limit(limit).Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Delete 删除产物记录
+func (r *ArtifactRepository) Delete(id uint64) error {
+	return r.db.Delete(&model.Artifact{}, id).Error
+}
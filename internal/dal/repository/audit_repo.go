@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"strings"
+	"time"
+	"webci-refactored/internal/dal/model"
+
+	"gorm.io/gorm"
+)
+
+// AuditFilter 审计事件查询条件，空值表示不限
+type AuditFilter struct {
+	Actor string
+	// Action 精确匹配；以 * 结尾时按前缀匹配（如 gitlab.*）
+	Action string
+	// Target 子串匹配
+	Target string
+	Result string
+	Since  *time.Time
+	Until  *time.Time
+	// BeforeID 仅查询 ID 小于该值的事件，用于按 ID 翻页
+	BeforeID uint64
+}
+
+// AuditRepository 审计事件仓库
+// 提供审计事件的追加写入与按条件查询
+type AuditRepository struct{ db *gorm.DB }
+
+// NewAuditRepository 创建审计事件仓库实例
+func NewAuditRepository(db *gorm.DB) *AuditRepository { return &AuditRepository{db: db} }
+
+// Create 追加审计事件
+func (r *AuditRepository) Create(e *model.AuditEvent) error { return r.db.Create(e).Error }
+
+// List 按条件分页查询审计事件（按时间倒序），返回列表与总数
+func (r *AuditRepository) List(f AuditFilter, limit, offset int) ([]model.AuditEvent, int64, error) {
+	q := r.query(f)
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var items []model.AuditEvent
+	if err := q.Order("id DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// query 构造带过滤条件的查询
+func (r *AuditRepository) query(f AuditFilter) *gorm.DB {
+	q := r.db.Model(&model.AuditEvent{})
+	if f.Actor != "" {
+		q = q.Where("actor = ?", f.Actor)
+	}
+	if prefix, ok := strings.CutSuffix(f.Action, "*"); ok {
+		q = q.Where("action LIKE ? ESCAPE '!'", escapeLike(prefix)+"%")
+	} else if f.Action != "" {
+		q = q.Where("action = ?", f.Action)
+	}
+	if f.Target != "" {
+		q = q.Where("target LIKE ? ESCAPE '!'", "%"+escapeLike(f.Target)+"%")
+	}
+	if f.Result != "" {
+		q = q.Where("result = ?", f.Result)
+	}
+	if f.Since != nil {
+		q = q.Where("created_at >= ?", *f.Since)
+	}
+	if f.Until != nil {
+		q = q.Where("created_at < ?", *f.Until)
+	}
+	if f.BeforeID > 0 {
+		q = q.Where("id < ?", f.BeforeID)
+	}
+	return q
+}
+
+// escapeLike 转义 LIKE 通配符，转义符为 !（兼容 MySQL 与 SQLite）
+func escapeLike(s string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(s)
+}
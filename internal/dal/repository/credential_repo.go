@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"webci-refactored/internal/dal/model"
+
+	"gorm.io/gorm"
+)
+
+// CredentialRepository GitLab 凭据仓库
+// 提供用户 GitLab 令牌的按用户读取与覆盖写入
+type CredentialRepository struct{ db *gorm.DB }
+
+// NewCredentialRepository 创建 GitLab 凭据仓库实例
+func NewCredentialRepository(db *gorm.DB) *CredentialRepository {
+	return &CredentialRepository{db: db}
+}
+
+// GetByUser 获取用户的 GitLab 凭据
+func (r *CredentialRepository) GetByUser(userID uint64) (*model.GitLabCredential, error) {
+	var c model.GitLabCredential
+	if err := r.db.Where("user_id = ?", userID).First(&c).Error; err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Save 新增或覆盖用户的 GitLab 凭据
+func (r *CredentialRepository) Save(c *model.GitLabCredential) error {
+	var exist model.GitLabCredential
+	err := r.db.Where("user_id = ?", c.UserID).First(&exist).Error
+	if err == nil {
+		c.ID = exist.ID
+		c.CreatedAt = exist.CreatedAt
+		return r.db.Save(c).Error
+	}
+	if err != gorm.ErrRecordNotFound {
+		return err
+	}
+	return r.db.Create(c).Error
+}
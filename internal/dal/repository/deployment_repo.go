@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"errors"
+	"webci-refactored/internal/dal/model"
+
+	"gorm.io/gorm"
+)
+
+// DeploymentRepository 部署记录仓库
+// 提供部署记录的写入与按环境查询
+type DeploymentRepository struct{ db *gorm.DB }
+
+// NewDeploymentRepository 创建部署记录仓库实例
+func NewDeploymentRepository(db *gorm.DB) *DeploymentRepository {
+	return &DeploymentRepository{db: db}
+}
+
+// Record 写入部署记录；部署成功时同步刷新环境的当前部署版本
+// 同一任务重复写入时忽略（任务终态只会记录一次）
+func (r *DeploymentRepository) Record(d *model.Deployment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var n int64
+		if err := tx.Model(&model.Deployment{}).Where("job_id = ?", d.JobID).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return nil
+		}
+		if err := tx.Create(d).Error; err != nil {
+			return err
+		}
+		if d.Status != model.JobStatusSuccess {
+			return nil
+		}
+		return tx.Model(&model.Environment{}).Where("id = ?", d.EnvID).Updates(map[string]interface{}{
+			"current_deploy_commit": d.CommitID,
+			"current_deploy_at":     d.FinishedAt,
+		}).Error
+	})
+}
+
+// Get 获取环境下的指定部署记录
+func (r *DeploymentRepository) Get(envID, id uint64) (*model.Deployment, error) {
+	var d model.Deployment
+	if err := r.db.Where("id = ? AND env_id = ?", id, envID).First(&d).Error; err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListByEnv 分页查询环境的部署记录，最新的在前；status 非空时只返回该结果的部署
+func (r *DeploymentRepository) ListByEnv(envID uint64, status string, limit, offset int) ([]model.Deployment, int64, error) {
+	var items []model.Deployment
+	var total int64
+	q := r.db.Model(&model.Deployment{}).Where("env_id = ?", envID)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := q.Order("id DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// LastSuccessful 查询环境在 beforeID 之前最近一次成功的部署，beforeID 为 0 表示不限
+// 不存在时返回 nil
+func (r *DeploymentRepository) LastSuccessful(envID, beforeID uint64) (*model.Deployment, error) {
+	q := r.db.Where("env_id = ? AND status = ? AND commit_id <> ''", envID, model.JobStatusSuccess)
+	if beforeID > 0 {
+		q = q.Where("id < ?", beforeID)
+	}
+	var d model.Deployment
+	if err := q.Order("id DESC").First(&d).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+// LastSuccessfulExcept 查询环境最近一次提交不为 commit 的成功部署，不存在时返回 nil
+func (r *DeploymentRepository) LastSuccessfulExcept(envID uint64, commit string) (*model.Deployment, error) {
+	var d model.Deployment
+	err := r.db.Where("env_id = ? AND status = ? AND commit_id <> '' AND commit_id <> ?", envID, model.JobStatusSuccess, commit).
+		Order("id DESC").First(&d).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Active 查询环境中排队或执行中的部署任务（顶层任务），不存在时返回 nil
+func (r *DeploymentRepository) Active(envID uint64) (*model.Job, error) {
+	var j model.Job
+	err := r.db.Where("env_id = ? AND pipeline_id = 0 AND status IN ?", envID,
+		[]string{model.JobStatusCreated, model.JobStatusManual, model.JobStatusWaitingRetry, model.JobStatusWaitingForApproval, model.JobStatusPending, model.JobStatusRunning}).
+		Order("id ASC").First(&j).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &j, nil
+}
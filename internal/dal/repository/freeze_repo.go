@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"webci-refactored/internal/dal/model"
+
+	"gorm.io/gorm"
+)
+
+// FreezeRepository 冻结窗口仓库
+// 提供环境冻结窗口的增删查
+type FreezeRepository struct{ db *gorm.DB }
+
+// NewFreezeRepository 创建冻结窗口仓库实例
+func NewFreezeRepository(db *gorm.DB) *FreezeRepository { return &FreezeRepository{db: db} }
+
+// Create 创建冻结窗口
+func (r *FreezeRepository) Create(f *model.FreezeWindow) error { return r.db.Create(f).Error }
+
+// ListByEnv 按创建顺序查询环境的冻结窗口
+func (r *FreezeRepository) ListByEnv(envID uint64) ([]model.FreezeWindow, error) {
+	var items []model.FreezeWindow
+	if err := r.db.Where("env_id = ?", envID).Order("id ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ListAll 查询全部环境的冻结窗口
+func (r *FreezeRepository) ListAll() ([]model.FreezeWindow, error) {
+	var items []model.FreezeWindow
+	if err := r.db.Order("env_id ASC, id ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Delete 删除环境下的冻结窗口，返回是否存在
+func (r *FreezeRepository) Delete(envID, id uint64) (bool, error) {
+	res := r.db.Where("id = ? AND env_id = ?", id, envID).Delete(&model.FreezeWindow{})
+	return res.RowsAffected > 0, res.Error
+}
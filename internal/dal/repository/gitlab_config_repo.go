@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"errors"
+	"webci-refactored/internal/dal/model"
+
+	"gorm.io/gorm"
+)
+
+// GitLabConfigRepository GitLab 配置版本仓库
+// 提供配置版本的追加写入、当前版本与历史查询
+type GitLabConfigRepository struct{ db *gorm.DB }
+
+// NewGitLabConfigRepository 创建 GitLab 配置版本仓库实例
+func NewGitLabConfigRepository(db *gorm.DB) *GitLabConfigRepository {
+	return &GitLabConfigRepository{db: db}
+}
+
+// Create 追加新版本：在事务中分配下一个版本号
+func (r *GitLabConfigRepository) Create(c *model.GitLabConfig) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var last int
+		if err := tx.Model(&model.GitLabConfig{}).Select("COALESCE(MAX(version), 0)").Scan(&last).Error; err != nil {
+			return err
+		}
+		c.Version = last + 1
+		return tx.Create(c).Error
+	})
+}
+
+// Latest 获取当前生效的版本，尚无版本时返回 nil
+func (r *GitLabConfigRepository) Latest() (*model.GitLabConfig, error) {
+	var c model.GitLabConfig
+	if err := r.db.Order("version DESC").First(&c).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetByVersion 按版本号获取配置
+func (r *GitLabConfigRepository) GetByVersion(version int) (*model.GitLabConfig, error) {
+	var c model.GitLabConfig
+	if err := r.db.Where("version = ?", version).First(&c).Error; err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// List 按版本倒序列出配置历史
+func (r *GitLabConfigRepository) List(limit int) ([]model.GitLabConfig, error) {
+	var items []model.GitLabConfig
+	if err := r.db.Order("version DESC").Limit(limit).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
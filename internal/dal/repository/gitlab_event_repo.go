@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"webci-refactored/internal/dal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GitLabEventRepository GitLab webhook 事件仓库
+// 提供事件的幂等写入与按提交查询
+type GitLabEventRepository struct{ db *gorm.DB }
+
+// NewGitLabEventRepository 创建 GitLab webhook 事件仓库实例
+func NewGitLabEventRepository(db *gorm.DB) *GitLabEventRepository {
+	return &GitLabEventRepository{db: db}
+}
+
+// Create 写入事件，投递标识已存在时不写入并返回 false
+func (r *GitLabEventRepository) Create(e *model.GitLabEvent) (bool, error) {
+	res := r.db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "delivery_id"}}, DoNothing: true}).Create(e)
+	return res.RowsAffected > 0, res.Error
+}
+
+// GetByDeliveryID 按投递标识获取事件
+func (r *GitLabEventRepository) GetByDeliveryID(id string) (*model.GitLabEvent, error) {
+	var e model.GitLabEvent
+	if err := r.db.Where("delivery_id = ?", id).First(&e).Error; err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ListBySHAs 按接收顺序查询指定提交上的指定类型事件
+func (r *GitLabEventRepository) ListBySHAs(shas []string, kinds ...string) ([]model.GitLabEvent, error) {
+	var items []model.GitLabEvent
+	if len(shas) == 0 {
+		return items, nil
+	}
+	q := r.db.Omit("payload").Where("sha IN ?", shas)
+	if len(kinds) > 0 {
+		q = q.Where("kind IN ?", kinds)
+	}
+	if err := q.Order("id ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
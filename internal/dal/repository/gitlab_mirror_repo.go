@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"errors"
+	"webci-refactored/internal/dal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// deleteChunk 按 ID 批量删除时每批的数量
+const deleteChunk = 500
+
+// GitLabMirrorRepository GitLab 镜像仓库
+// 提供流水线、作业、提交、分支与合并请求镜像的写入、对齐与查询，以及同步进度读写
+type GitLabMirrorRepository struct{ db *gorm.DB }
+
+// NewGitLabMirrorRepository 创建 GitLab 镜像仓库实例
+func NewGitLabMirrorRepository(db *gorm.DB) *GitLabMirrorRepository {
+	return &GitLabMirrorRepository{db: db}
+}
+
+// States 查询全部资源的同步进度，按资源名索引
+func (r *GitLabMirrorRepository) States() (map[string]model.GitLabSyncState, error) {
+	var items []model.GitLabSyncState
+	if err := r.db.Order("resource ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[string]model.GitLabSyncState, len(items))
+	for _, s := range items {
+		out[s.Resource] = s
+	}
+	return out, nil
+}
+
+// SaveState 写入资源的同步进度
+func (r *GitLabMirrorRepository) SaveState(s *model.GitLabSyncState) error {
+	return r.db.Save(s).Error
+}
+
+// Reset 清空全部镜像与同步进度
+func (r *GitLabMirrorRepository) Reset() error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, m := range []interface{}{&model.GitLabJob{}, &model.GitLabPipeline{}, &model.GitLabCommit{}, &model.GitLabBranch{}, &model.GitLabMergeRequest{}, &model.GitLabSyncState{}} {
+			if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SavePipeline 在事务中写入流水线并整体替换其作业，commit 非空时一并写入
+func (r *GitLabMirrorRepository) SavePipeline(p *model.GitLabPipeline, jobs []model.GitLabJob, commit *model.GitLabCommit) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(p).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("pipeline_id = ?", p.ID).Delete(&model.GitLabJob{}).Error; err != nil {
+			return err
+		}
+		if len(jobs) > 0 {
+			if err := tx.Create(&jobs).Error; err != nil {
+				return err
+			}
+		}
+		if commit != nil {
+			return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(commit).Error
+		}
+		return nil
+	})
+}
+
+// SavePipelineError 写入获取详情失败的流水线：只更新列表中的字段与失败原因，保留已同步的详情与作业
+func (r *GitLabMirrorRepository) SavePipelineError(p *model.GitLabPipeline) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"ref", "sha", "status", "source", "web_url", "updated_at", "synced_at", "sync_error"}),
+	}).Create(p).Error
+}
+
+// FailedPipelines 查询获取详情失败、待重试的流水线
+func (r *GitLabMirrorRepository) FailedPipelines(limit int) ([]model.GitLabPipeline, error) {
+	var items []model.GitLabPipeline
+	if err := r.db.Where("sync_error <> ''").Order("id ASC").Limit(limit).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// DeletePipelines 删除流水线及其作业
+func (r *GitLabMirrorRepository) DeletePipelines(ids []int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(ids); start += deleteChunk {
+			end := start + deleteChunk
+			if end > len(ids) {
+				end = len(ids)
+			}
+			chunk := ids[start:end]
+			if err := tx.Where("pipeline_id IN ?", chunk).Delete(&model.GitLabJob{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ?", chunk).Delete(&model.GitLabPipeline{}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PipelineIDs 查询全部流水线 ID
+func (r *GitLabMirrorRepository) PipelineIDs() ([]int64, error) {
+	var ids []int64
+	err := r.db.Model(&model.GitLabPipeline{}).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// PipelineCursor 流水线键集分页游标
+// BeforeID 查询 ID 小于该值的一页（下一页），AfterID 查询 ID 大于该值、紧邻它的一页（上一页）；均为 0 时按偏移量分页。
+// 新流水线的 ID 更大，按游标翻页时已看到的页不会因新流水线到来而错位
+type PipelineCursor struct {
+	BeforeID int64
+	AfterID  int64
+}
+
+// ListPipelines 按 ID 倒序查询一页流水线
+func (r *GitLabMirrorRepository) ListPipelines(cur PipelineCursor, limit, offset int) ([]model.GitLabPipeline, error) {
+	var items []model.GitLabPipeline
+	switch {
+	case cur.BeforeID > 0:
+		if err := r.db.Where("id < ?", cur.BeforeID).Order("id DESC").Limit(limit).Find(&items).Error; err != nil {
+			return nil, err
+		}
+	case cur.AfterID > 0:
+		if err := r.db.Where("id > ?", cur.AfterID).Order("id ASC").Limit(limit).Find(&items).Error; err != nil {
+			return nil, err
+		}
+		for i, k := 0, len(items)-1; i < k; i, k = i+1, k-1 {
+			items[i], items[k] = items[k], items[i]
+		}
+	default:
+		if err := r.db.Order("id DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// CountPipelines 统计流水线数量：newerThan、olderThan 大于 0 时只统计 ID 大于、小于该值的流水线
+func (r *GitLabMirrorRepository) CountPipelines(newerThan, olderThan int64) (int64, error) {
+	q := r.db.Model(&model.GitLabPipeline{})
+	if newerThan > 0 {
+		q = q.Where("id > ?", newerThan)
+	}
+	if olderThan > 0 {
+		q = q.Where("id < ?", olderThan)
+	}
+	var n int64
+	err := q.Count(&n).Error
+	return n, err
+}
+
+// HasCommit 提交是否已保存
+func (r *GitLabMirrorRepository) HasCommit(sha string) (bool, error) {
+	var n int64
+	err := r.db.Model(&model.GitLabCommit{}).Where("sha = ?", sha).Count(&n).Error
+	return n > 0, err
+}
+
+// GetCommits 按 SHA 查询提交，按 SHA 索引
+func (r *GitLabMirrorRepository) GetCommits(shas []string) (map[string]model.GitLabCommit, error) {
+	out := make(map[string]model.GitLabCommit)
+	if len(shas) == 0 {
+		return out, nil
+	}
+	var items []model.GitLabCommit
+	if err := r.db.Where("sha IN ?", shas).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range items {
+		out[c.SHA] = c
+	}
+	return out, nil
+}
+
+// ReplaceBranches 以 GitLab 上的分支列表整体对齐：写入全部分支并删除列表之外的分支，返回删除数量
+func (r *GitLabMirrorRepository) ReplaceBranches(branches []model.GitLabBranch) (int, error) {
+	var deleted int
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		keep := make(map[string]bool, len(branches))
+		for i := range branches {
+			keep[branches[i].Name] = true
+			if err := tx.Save(&branches[i]).Error; err != nil {
+				return err
+			}
+		}
+		var names []string
+		if err := tx.Model(&model.GitLabBranch{}).Pluck("name", &names).Error; err != nil {
+			return err
+		}
+		var gone []string
+		for _, n := range names {
+			if !keep[n] {
+				gone = append(gone, n)
+			}
+		}
+		if len(gone) == 0 {
+			return nil
+		}
+		deleted = len(gone)
+		return tx.Where("name IN ?", gone).Delete(&model.GitLabBranch{}).Error
+	})
+	return deleted, err
+}
+
+// ListBranches 按名称查询全部分支
+func (r *GitLabMirrorRepository) ListBranches() ([]model.GitLabBranch, error) {
+	var items []model.GitLabBranch
+	if err := r.db.Order("name ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// SaveMergeRequest 写入合并请求
+func (r *GitLabMirrorRepository) SaveMergeRequest(m *model.GitLabMergeRequest) error {
+	return r.db.Save(m).Error
+}
+
+// MergeRequestIIDs 查询全部合并请求编号
+func (r *GitLabMirrorRepository) MergeRequestIIDs() ([]int64, error) {
+	var ids []int64
+	err := r.db.Model(&model.GitLabMergeRequest{}).Pluck("iid", &ids).Error
+	return ids, err
+}
+
+// DeleteMergeRequests 删除合并请求
+func (r *GitLabMirrorRepository) DeleteMergeRequests(iids []int64) error {
+	for start := 0; start < len(iids); start += deleteChunk {
+		end := start + deleteChunk
+		if end > len(iids) {
+			end = len(iids)
+		}
+		if err := r.db.Where("iid IN ?", iids[start:end]).Delete(&model.GitLabMergeRequest{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetState 查询资源的同步进度，尚未同步时返回只含资源名的记录
+func (r *GitLabMirrorRepository) GetState(resource string) (*model.GitLabSyncState, error) {
+	var s model.GitLabSyncState
+	if err := r.db.Where("resource = ?", resource).First(&s).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &model.GitLabSyncState{Resource: resource}, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"webci-refactored/internal/dal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GitLabTaskTypeRepository 流水线任务类型仓库
+// 提供操作记录的幂等写入与查询，以及按流水线读写任务类型判别结果
+type GitLabTaskTypeRepository struct{ db *gorm.DB }
+
+// NewGitLabTaskTypeRepository 创建流水线任务类型仓库实例
+func NewGitLabTaskTypeRepository(db *gorm.DB) *GitLabTaskTypeRepository {
+	return &GitLabTaskTypeRepository{db: db}
+}
+
+// CreateHint 写入操作记录，同一操作、分支与提交已存在时忽略
+func (r *GitLabTaskTypeRepository) CreateHint(h *model.GitLabTaskHint) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(h).Error
+}
+
+// ListHintsBySHAs 查询指定提交上的操作记录
+func (r *GitLabTaskTypeRepository) ListHintsBySHAs(shas []string) ([]model.GitLabTaskHint, error) {
+	var items []model.GitLabTaskHint
+	if len(shas) == 0 {
+		return items, nil
+	}
+	if err := r.db.Where("sha IN ?", shas).Order("id ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ListTypes 查询指定流水线的判别结果
+func (r *GitLabTaskTypeRepository) ListTypes(pipelineIDs []int64) ([]model.GitLabPipelineType, error) {
+	var items []model.GitLabPipelineType
+	if len(pipelineIDs) == 0 {
+		return items, nil
+	}
+	if err := r.db.Where("pipeline_id IN ?", pipelineIDs).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetType 获取流水线的判别结果
+func (r *GitLabTaskTypeRepository) GetType(pipelineID int64) (*model.GitLabPipelineType, error) {
+	var t model.GitLabPipelineType
+	if err := r.db.Where("pipeline_id = ?", pipelineID).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SaveType 写入判别结果，已存在时覆盖
+func (r *GitLabTaskTypeRepository) SaveType(t *model.GitLabPipelineType) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "pipeline_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"ref", "sha", "task_type", "source", "updated_by", "updated_at"}),
+	}).Create(t).Error
+}
+
+// DeleteType 删除判别结果，返回是否存在
+func (r *GitLabTaskTypeRepository) DeleteType(pipelineID int64) (bool, error) {
+	res := r.db.Where("pipeline_id = ?", pipelineID).Delete(&model.GitLabPipelineType{})
+	return res.RowsAffected > 0, res.Error
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"webci-refactored/internal/dal/model"
+
+	"gorm.io/gorm"
+)
+
+// JobEventRepository 任务事件仓库
+// 提供状态变更事件的写入与按任务查询
+type JobEventRepository struct{ db *gorm.DB }
+
+// NewJobEventRepository 创建任务事件仓库实例
+func NewJobEventRepository(db *gorm.DB) *JobEventRepository { return &JobEventRepository{db: db} }
+
+// Create 写入事件
+func (r *JobEventRepository) Create(e *model.JobEvent) error { return r.db.Create(e).Error }
+
+// ListByJob 按时间顺序查询任务的全部事件
+func (r *JobEventRepository) ListByJob(jobID uint64) ([]model.JobEvent, error) {
+	var items []model.JobEvent
+	if err := r.db.Where("job_id = ?", jobID).Order("id ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"time"
+	"webci-refactored/internal/dal/model"
+
+	"gorm.io/gorm"
+)
+
+// maxLogChunkSize 单个日志块的最大字节数，超长输出拆分为多块写入
+const maxLogChunkSize = 64 << 10
+
+// AppendLog 追加任务日志
+// 日志以块的形式追加到 job_log_chunks，先累加任务的 log_size 确定本块起始偏移：
+// MySQL 下该更新同时锁定任务行，保证并发追加的偏移连续且不重叠
+func (r *JobRepository) AppendLog(id uint64, text string) error {
+	if text == "" {
+		return nil
+	}
+	data := []byte(text)
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Job{}).Where("id = ?", id).Update("log_size", gorm.Expr("log_size + ?", len(data))).Error; err != nil {
+			return err
+		}
+		var j model.Job
+		if err := tx.Select("log_size").First(&j, id).Error; err != nil {
+			return err
+		}
+		start := j.LogSize - int64(len(data))
+		for len(data) > 0 {
+			n := len(data)
+			if n > maxLogChunkSize {
+				n = maxLogChunkSize
+			}
+			if err := tx.Create(&model.JobLogChunk{JobID: id, StartOffset: start, Size: n, Content: data[:n]}).Error; err != nil {
+				return err
+			}
+			start += int64(n)
+			data = data[n:]
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	notifyJob(id)
+	return nil
+}
+
+// ReadLog 读取任务日志 [offset, offset+limit) 字节区间，limit 小于 0 表示读到末尾
+// 已归档部分从 gzip 数据中解压读取，归档之后追加的部分从日志块读取
+func (r *JobRepository) ReadLog(id uint64, offset, limit int64) ([]byte, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	end := int64(-1)
+	if limit >= 0 {
+		end = offset + limit
+	}
+	var out bytes.Buffer
+	var archives []model.JobLogArchive
+	if err := r.db.Where("job_id = ?", id).Limit(1).Find(&archives).Error; err != nil {
+		return nil, err
+	}
+	archived := int64(0)
+	if len(archives) == 1 {
+		a := archives[0]
+		archived = a.Size
+		if offset < a.Size {
+			stop := a.Size
+			if end >= 0 && end < stop {
+				stop = end
+			}
+			gz, err := gzip.NewReader(bytes.NewReader(a.Data))
+			if err != nil {
+				return nil, err
+			}
+			if _, err := io.CopyN(io.Discard, gz, offset); err != nil {
+				return nil, err
+			}
+			if _, err := io.CopyN(&out, gz, stop-offset); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// 只查询与区间相交的日志块
+	q := r.db.Where("job_id = ? AND start_offset >= ? AND start_offset + size > ?", id, archived, offset)
+	if end >= 0 {
+		q = q.Where("start_offset < ?", end)
+	}
+	var chunks []model.JobLogChunk
+	if err := q.Order("start_offset ASC").Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range chunks {
+		from, to := int64(0), int64(len(c.Content))
+		if offset > c.StartOffset {
+			from = offset - c.StartOffset
+		}
+		if end >= 0 && end < c.StartOffset+to {
+			to = end - c.StartOffset
+		}
+		out.Write(c.Content[from:to])
+	}
+	return out.Bytes(), nil
+}
+
+// ListArchivable 查询结束时间早于 before、日志尚未归档的任务 ID
+func (r *JobRepository) ListArchivable(before time.Time, limit int) ([]uint64, error) {
+	var ids []uint64
+	err := r.db.Model(&model.Job{}).
+		Where("log_archived = ? AND log_size > 0 AND end_time IS NOT NULL AND end_time < ?", false, before).
+		Order("id ASC").Limit(limit).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// ArchiveLog 将任务的全部日志块压缩为 gzip 归档并删除已归档的日志块
+// 归档期间追加的日志块保留在原表，读取时与归档内容拼接
+func (r *JobRepository) ArchiveLog(id uint64) error {
+	data, err := r.ReadLog(id, 0, -1)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	size := int64(len(data))
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&model.JobLogArchive{JobID: id, Size: size, Data: buf.Bytes()}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("job_id = ? AND start_offset < ?", id, size).Delete(&model.JobLogChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Job{}).Where("id = ?", id).Update("log_archived", true).Error
+	})
+}
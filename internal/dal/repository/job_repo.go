@@ -26,6 +26,43 @@ func (r *JobRepository) Get(id uint64) (*model.Job, error) {
 	return &j, nil
 }
 
+// ListByPipeline 查询流水线下的全部子任务，按 ID 升序（即定义顺序）
+func (r *JobRepository) ListByPipeline(pipelineID uint64) ([]model.Job, error) {
+	var items []model.Job
+	if err := r.db.Where("pipeline_id = ?", pipelineID).Order("id ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// TransitionStatus 条件更新状态：仅当当前状态为 from 时更新为 to，并在同一事务中写入状态事件
+// 返回是否更新成功，用于并发场景下的幂等状态推进；转换是否合法由任务服务校验
+func (r *JobRepository) TransitionStatus(id uint64, from, to, actor, note string) (bool, error) {
+	ok := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.Job{}).Where("id = ? AND status = ?", id, from).Update("status", to)
+		if res.Error != nil || res.RowsAffected != 1 {
+			return res.Error
+		}
+		ok = true
+		return tx.Create(&model.JobEvent{JobID: id, FromStatus: from, ToStatus: to, Actor: actor, Note: note}).Error
+	})
+	if ok && err == nil {
+		notifyJob(id)
+	}
+	return ok, err
+}
+
+// CreateWithEvent 创建任务并记录初始状态事件
+func (r *JobRepository) CreateWithEvent(j *model.Job, actor string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(j).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.JobEvent{JobID: j.ID, ToStatus: j.Status, Actor: actor, Note: "created"}).Error
+	})
+}
+
 // List 条件查询任务
 func (r *JobRepository) List(branchID, envID *uint64, status *string, limit, offset int) ([]model.Job, int64, error) {
 	// 可选过滤：当指针非空时添加 Where 子句；按 id 倒序便于查看最新任务
@@ -50,21 +87,6 @@ func (r *JobRepository) List(branchID, envID *uint64, status *string, limit, off
 	return items, total, nil
 }
 
-// UpdateStatus 更新任务状态
-func (r *JobRepository) UpdateStatus(id uint64, status string) error {
-	return r.db.Model(&model.Job{}).Where("id = ?", id).Update("status", status).Error
-}
-
-// AppendLog 追加任务日志
-func (r *JobRepository) AppendLog(id uint64, text string) error {
-	// 兼容不同方言的字符串追加：MySQL 使用 CONCAT；SQLite 使用 ||
-	expr := gorm.Expr("CONCAT(IFNULL(log,''), ?)", text)
-	if r.db.Dialector.Name() == "sqlite" {
-		expr = gorm.Expr("COALESCE(log,'') || ?", text)
-	}
-	return r.db.Model(&model.Job{}).Where("id = ?", id).Update("log", expr).Error
-}
-
 // UpdateTimes 更新开始/结束时间
 func (r *JobRepository) UpdateTimes(id uint64, start, end *time.Time) error {
 	// 仅更新非空的时间字段，避免覆盖已有值
@@ -75,5 +97,171 @@ func (r *JobRepository) UpdateTimes(id uint64, start, end *time.Time) error {
 	if end != nil {
 		data["end_time"] = *end
 	}
-	return r.db.Model(&model.Job{}).Where("id = ?", id).Updates(data).Error
+	if err := r.db.Model(&model.Job{}).Where("id = ?", id).Updates(data).Error; err != nil {
+		return err
+	}
+	notifyJob(id)
+	return nil
+}
+
+// ClaimNext 认领最早的一个 pending 任务（流水线父任务除外）
+// 通过条件更新保证多个执行器并发认领时同一任务只会被一方拿到；
+// 已达并发上限的环境下的任务继续留在 pending，无可认领任务时返回 nil
+func (r *JobRepository) ClaimNext(owner string, lease time.Duration) (*model.Job, error) {
+	loads, err := r.environmentLoads()
+	if err != nil {
+		return nil, err
+	}
+	limits := make(map[uint64]int, len(loads))
+	var full []uint64
+	for _, l := range loads {
+		limits[l.ID] = l.MaxConcurrency
+		if l.Running >= int64(l.MaxConcurrency) {
+			full = append(full, l.ID)
+		}
+	}
+	q := r.db.Model(&model.Job{}).Where("status = ? AND kind <> ?", "pending", model.JobKindPipeline)
+	if len(full) > 0 {
+		q = q.Where("env_id NOT IN ?", full)
+	}
+	var candidates []model.Job
+	if err := q.Select("id", "env_id").Order("id ASC").Limit(10).Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range candidates {
+		now := time.Now()
+		until := now.Add(lease)
+		claimed := false
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			claim := tx.Model(&model.Job{}).Where("id = ? AND status = ?", c.ID, model.JobStatusPending)
+			if limit, ok := limits[c.EnvID]; ok {
+				// 认领时再次校验环境并发数，避免多个实例同时放行同一环境的任务
+				// MySQL 不允许在 UPDATE 的子查询中直接引用目标表，需包一层派生表
+				claim = claim.Where("(SELECT COUNT(*) FROM (SELECT id FROM jobs WHERE env_id = ? AND status = ? AND kind <> ? AND deleted_at IS NULL) busy) < ?",
+					c.EnvID, model.JobStatusRunning, model.JobKindPipeline, limit)
+			}
+			res := claim.Updates(map[string]interface{}{
+				"status":           model.JobStatusRunning,
+				"lease_owner":      owner,
+				"lease_expires_at": until,
+				"start_time":       now,
+				"attempts":         gorm.Expr("attempts + 1"),
+			})
+			if res.Error != nil || res.RowsAffected != 1 {
+				return res.Error
+			}
+			claimed = true
+			return tx.Create(&model.JobEvent{JobID: c.ID, FromStatus: model.JobStatusPending, ToStatus: model.JobStatusRunning, Actor: owner, Note: "claimed"}).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		if claimed {
+			notifyJob(c.ID)
+			return r.Get(c.ID)
+		}
+	}
+	return nil, nil
+}
+
+// envLoad 设置了并发上限的环境及其当前运行中的任务数
+type envLoad struct {
+	ID             uint64
+	MaxConcurrency int
+	Running        int64
+}
+
+// environmentLoads 查询设置了并发上限的环境的运行负载
+func (r *JobRepository) environmentLoads() ([]envLoad, error) {
+	var loads []envLoad
+	err := r.db.Raw(`SELECT e.id AS id, e.max_concurrency AS max_concurrency,
+		(SELECT COUNT(*) FROM jobs j WHERE j.env_id = e.id AND j.status = ? AND j.kind <> ? AND j.deleted_at IS NULL) AS running
+		FROM environments e WHERE e.max_concurrency > 0 AND e.deleted_at IS NULL`, "running", model.JobKindPipeline).Scan(&loads).Error
+	return loads, err
+}
+
+// PendingIDs 按认领顺序返回全部可执行的 pending 任务 ID，用于计算排队位置
+func (r *JobRepository) PendingIDs() ([]uint64, error) {
+	var ids []uint64
+	err := r.db.Model(&model.Job{}).Where("status = ? AND kind <> ?", "pending", model.JobKindPipeline).Order("id ASC").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// ExtendLease 心跳续期：仅当租约仍归属 owner 时更新到期时间
+func (r *JobRepository) ExtendLease(id uint64, owner string, until time.Time) (bool, error) {
+	res := r.db.Model(&model.Job{}).Where("id = ? AND lease_owner = ? AND status = ?", id, owner, "running").Update("lease_expires_at", until)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// ReleaseLease 任务结束后清理租约
+func (r *JobRepository) ReleaseLease(id uint64, owner string) error {
+	return r.db.Model(&model.Job{}).Where("id = ? AND lease_owner = ?", id, owner).Updates(map[string]interface{}{
+		"lease_owner":      "",
+		"lease_expires_at": nil,
+	}).Error
+}
+
+// ListRunning 查询全部执行中的可执行任务（不含流水线父任务）
+func (r *JobRepository) ListRunning() ([]model.Job, error) {
+	var items []model.Job
+	err := r.db.Where("status = ? AND kind = ?", model.JobStatusRunning, model.JobKindJob).Order("id ASC").Find(&items).Error
+	return items, err
+}
+
+// ListWaitingRetry 查询 before 之前即处于 waiting_retry 的自动重试任务（放行前执行器已失联）
+func (r *JobRepository) ListWaitingRetry(before time.Time) ([]model.Job, error) {
+	var items []model.Job
+	err := r.db.Where("status = ? AND updated_at < ?", model.JobStatusWaitingRetry, before).Order("id ASC").Find(&items).Error
+	return items, err
+}
+
+// SetFailureReason 记录任务失败原因
+func (r *JobRepository) SetFailureReason(id uint64, reason string) error {
+	return r.db.Model(&model.Job{}).Where("id = ?", id).Update("failure_reason", reason).Error
+}
+
+// ListExpiredLeases 查询租约已过期仍处于 running 的任务（执行器已失联）
+func (r *JobRepository) ListExpiredLeases(now time.Time) ([]model.Job, error) {
+	var items []model.Job
+	err := r.db.Where("status = ? AND lease_owner <> ? AND lease_expires_at < ?", "running", "", now).Order("id ASC").Find(&items).Error
+	return items, err
+}
+
+// Requeue 将失联任务放回 pending，条件更新避免与仍在续期的执行器冲突
+func (r *JobRepository) Requeue(id uint64, owner, actor, note string) (bool, error) {
+	ok := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.Job{}).Where("id = ? AND status = ? AND lease_owner = ?", id, model.JobStatusRunning, owner).Updates(map[string]interface{}{
+			"status":           model.JobStatusPending,
+			"lease_owner":      "",
+			"lease_expires_at": nil,
+			"start_time":       nil,
+		})
+		if res.Error != nil || res.RowsAffected != 1 {
+			return res.Error
+		}
+		ok = true
+		return tx.Create(&model.JobEvent{JobID: id, FromStatus: model.JobStatusRunning, ToStatus: model.JobStatusPending, Actor: actor, Note: note}).Error
+	})
+	if ok && err == nil {
+		notifyJob(id)
+	}
+	return ok, err
+}
+
+// RequestCancel 持久化取消请求
+func (r *JobRepository) RequestCancel(id uint64) error {
+	return r.db.Model(&model.Job{}).Where("id = ?", id).Update("cancel_requested", true).Error
+}
+
+// IsCancelRequested 查询任务是否已被请求取消
+func (r *JobRepository) IsCancelRequested(id uint64) (bool, error) {
+	var j model.Job
+	if err := r.db.Select("cancel_requested").First(&j, id).Error; err != nil {
+		return false, err
+	}
+	return j.CancelRequested, nil
 }
@@ -0,0 +1,41 @@
+package repository
+
+import "sync"
+
+// 任务变更订阅：日志追加、状态转换与时间更新后通知本进程内的订阅者
+var (
+	watchMu  sync.Mutex
+	watchers = map[uint64]map[chan struct{}]struct{}{}
+)
+
+// WatchJob 订阅任务的日志与状态变更，返回通知通道与取消订阅函数
+// 通道容量为 1，连续多次变更合并为一次通知；其他实例写入的变更不会通知，调用方需轮询兜底
+func WatchJob(id uint64) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	watchMu.Lock()
+	if watchers[id] == nil {
+		watchers[id] = map[chan struct{}]struct{}{}
+	}
+	watchers[id][ch] = struct{}{}
+	watchMu.Unlock()
+	return ch, func() {
+		watchMu.Lock()
+		delete(watchers[id], ch)
+		if len(watchers[id]) == 0 {
+			delete(watchers, id)
+		}
+		watchMu.Unlock()
+	}
+}
+
+// notifyJob 非阻塞通知任务的全部订阅者
+func notifyJob(id uint64) {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	for ch := range watchers[id] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"time"
+	"webci-refactored/internal/dal/model"
+
+	"gorm.io/gorm"
+)
+
+// TokenRepository 访问令牌仓库
+// 提供会话与个人令牌的写入、按哈希查找与吊销
+type TokenRepository struct{ db *gorm.DB }
+
+// NewTokenRepository 创建访问令牌仓库实例
+func NewTokenRepository(db *gorm.DB) *TokenRepository { return &TokenRepository{db: db} }
+
+// Create 写入令牌
+func (r *TokenRepository) Create(t *model.APIToken) error { return r.db.Create(t).Error }
+
+// GetByHash 按令牌哈希查找令牌
+func (r *TokenRepository) GetByHash(hash string) (*model.APIToken, error) {
+	var t model.APIToken
+	if err := r.db.Where("token_hash = ?", hash).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListByUser 按创建顺序查询用户指定类型的令牌
+func (r *TokenRepository) ListByUser(userID uint64, kind string) ([]model.APIToken, error) {
+	var items []model.APIToken
+	if err := r.db.Where("user_id = ? AND kind = ?", userID, kind).Order("id ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Delete 吊销用户的令牌，返回是否存在
+func (r *TokenRepository) Delete(userID, id uint64) (bool, error) {
+	res := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.APIToken{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// DeleteByHash 按令牌哈希吊销令牌（如退出登录）
+func (r *TokenRepository) DeleteByHash(hash string) error {
+	return r.db.Where("token_hash = ?", hash).Delete(&model.APIToken{}).Error
+}
+
+// DeleteExpired 删除 before 之前已过期的令牌
+func (r *TokenRepository) DeleteExpired(before time.Time) error {
+	return r.db.Where("expires_at IS NOT NULL AND expires_at < ?", before).Delete(&model.APIToken{}).Error
+}
+
+// Touch 记录令牌的最近使用时间
+func (r *TokenRepository) Touch(id uint64, at time.Time) error {
+	return r.db.Model(&model.APIToken{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"webci-refactored/internal/dal/model"
+
+	"gorm.io/gorm"
+)
+
+// UserRepository 用户仓库
+// 提供本地用户的增改查
+type UserRepository struct{ db *gorm.DB }
+
+// NewUserRepository 创建用户仓库实例
+func NewUserRepository(db *gorm.DB) *UserRepository { return &UserRepository{db: db} }
+
+// Create 创建用户
+func (r *UserRepository) Create(u *model.User) error { return r.db.Create(u).Error }
+
+// Get 按 ID 获取用户
+func (r *UserRepository) Get(id uint64) (*model.User, error) {
+	var u model.User
+	if err := r.db.First(&u, id).Error; err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// GetByUsername 按用户名获取用户
+func (r *UserRepository) GetByUsername(username string) (*model.User, error) {
+	var u model.User
+	if err := r.db.Where("username = ?", username).First(&u).Error; err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// GetByGitLabID 按关联的 GitLab 用户 ID 获取用户
+func (r *UserRepository) GetByGitLabID(gitlabID int64) (*model.User, error) {
+	var u model.User
+	if err := r.db.Where("gitlab_id = ?", gitlabID).First(&u).Error; err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// List 按创建顺序列出全部用户
+func (r *UserRepository) List() ([]model.User, error) {
+	var items []model.User
+	if err := r.db.Order("id ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Count 统计用户数量
+func (r *UserRepository) Count() (int64, error) {
+	var n int64
+	err := r.db.Model(&model.User{}).Count(&n).Error
+	return n, err
+}
+
+// Update 保存用户
+func (r *UserRepository) Update(u *model.User) error { return r.db.Save(u).Error }
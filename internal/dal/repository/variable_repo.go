@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"webci-refactored/internal/dal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// VariableRepository 变量仓库
+// 提供按作用域与归属读写变量
+type VariableRepository struct{ db *gorm.DB }
+
+// NewVariableRepository 创建变量仓库实例
+func NewVariableRepository(db *gorm.DB) *VariableRepository { return &VariableRepository{db: db} }
+
+// Upsert 写入变量，同一归属下的同名变量被覆盖
+func (r *VariableRepository) Upsert(v *model.Variable) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "scope"}, {Name: "owner_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "secret", "encrypted", "updated_at"}),
+	}).Create(v).Error
+}
+
+// List 按键名顺序查询归属下的全部变量
+func (r *VariableRepository) List(scope string, ownerID uint64) ([]model.Variable, error) {
+	var items []model.Variable
+	if err := r.db.Where("scope = ? AND owner_id = ?", scope, ownerID).Order("`key` ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Delete 删除归属下的指定变量，返回是否存在
+func (r *VariableRepository) Delete(scope string, ownerID uint64, key string) (bool, error) {
+	res := r.db.Where("scope = ? AND owner_id = ? AND `key` = ?", scope, ownerID, key).Delete(&model.Variable{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// Copy 将一个归属下的变量原样复制到另一个归属（密文不解密）
+func (r *VariableRepository) Copy(scope string, fromID, toID uint64) error {
+	items, err := r.List(scope, fromID)
+	if err != nil {
+		return err
+	}
+	for _, v := range items {
+		v.ID = 0
+		v.OwnerID = toID
+		if err := r.Upsert(&v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package artifact
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"webci-refactored/internal/config"
+	"webci-refactored/internal/logic/artifact"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"gorm.io/gorm"
+)
+
+// Handler 产物处理层
+type Handler struct {
+	logic *artifact.Logic
+}
+
+// NewHandler 创建产物处理层实例
+func NewHandler(db *gorm.DB, cfg config.Config) *Handler {
+	return &Handler{
+		logic: artifact.NewLogic(db, cfg),
+	}
+}
+
+// Ok 返回成功响应
+func Ok(c *app.RequestContext, data interface{}) {
+	c.JSON(200, map[string]interface{}{"code": 0, "message": "ok", "data": data})
+}
+
+// Err 返回错误响应
+func Err(c *app.RequestContext, status int, msg string) {
+	c.JSON(status, map[string]interface{}{"code": status, "message": msg})
+}
+
+// parseID 从路径参数中解析ID
+func parseID(c *app.RequestContext, name string) uint64 {
+	idStr := string(c.Param(name))
+	id, _ := strconv.ParseUint(idStr, 10, 64)
+	return id
+}
+
+// errStatus 按错误类型返回状态码：任务或产物不存在 404，产物已过期或文件已清理 410
+func errStatus(c *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		Err(c, 404, err.Error())
+	case errors.Is(err, artifact.ErrExpired), errors.Is(err, os.ErrNotExist):
+		Err(c, 410, "artifact expired")
+	default:
+		Err(c, 500, err.Error())
+	}
+}
+
+// List 查询任务产物
+func (h *Handler) List(c *app.RequestContext) {
+	items, err := h.logic.List(parseID(c, "id"))
+	if err != nil {
+		errStatus(c, err)
+		return
+	}
+	Ok(c, items)
+}
+
+// Download 下载单个产物文件，响应头 X-Artifact-SHA256 给出校验和
+func (h *Handler) Download(c *app.RequestContext) {
+	a, rc, err := h.logic.Open(parseID(c, "id"), parseID(c, "artifact_id"))
+	if err != nil {
+		errStatus(c, err)
+		return
+	}
+	c.Response.Header.Set("Content-Type", "application/octet-stream")
+	c.Response.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(a.Path)))
+	c.Response.Header.Set("X-Artifact-SHA256", a.SHA256)
+	// 响应写完后由框架关闭读取器
+	c.SetBodyStream(rc, int(a.Size))
+}
+
+// DownloadAll 将任务的全部产物打包为 zip 流式下载
+func (h *Handler) DownloadAll(c *app.RequestContext) {
+	id := parseID(c, "id")
+	items, err := h.logic.List(id)
+	if err != nil {
+		errStatus(c, err)
+		return
+	}
+	if len(items) == 0 {
+		Err(c, 404, "no artifacts")
+		return
+	}
+	pr, pw := io.Pipe()
+	go func() { pw.CloseWithError(h.logic.WriteZip(pw, items)) }()
+	c.Response.Header.Set("Content-Type", "application/zip")
+	c.Response.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"job-%d-artifacts.zip\"", id))
+	// 大小未知，按分块传输；客户端断开时框架关闭读取端，打包协程随之退出
+	c.SetBodyStream(pr, -1)
+}
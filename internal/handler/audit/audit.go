@@ -0,0 +1,127 @@
+package audit
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/logic/audit"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"gorm.io/gorm"
+)
+
+// Handler 审计处理层
+type Handler struct {
+	logic *audit.Logic
+}
+
+// NewHandler 创建审计处理层实例
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{
+		logic: audit.NewLogic(db),
+	}
+}
+
+// Logic 返回审计业务逻辑，供审计中间件写入事件
+func (h *Handler) Logic() *audit.Logic { return h.logic }
+
+// Ok 返回成功响应
+func Ok(c *app.RequestContext, data interface{}) {
+	c.JSON(200, map[string]interface{}{"code": 0, "message": "ok", "data": data})
+}
+
+// Err 返回错误响应
+func Err(c *app.RequestContext, status int, msg string) {
+	c.JSON(status, map[string]interface{}{"code": status, "message": msg})
+}
+
+// parseTime 解析时间查询参数：RFC3339 或日期（2006-01-02，UTC）；end 为真时仅写日期表示包含当天
+func parseTime(v string, end bool) (*time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return nil, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// parseFilter 解析查询条件：actor、action（以 * 结尾按前缀匹配）、target（子串）、result、since、until
+func parseFilter(c *app.RequestContext) (audit.Filter, bool) {
+	f := audit.Filter{Actor: c.Query("actor"), Action: c.Query("action"), Target: c.Query("target"), Result: c.Query("result")}
+	if f.Result != "" && f.Result != model.AuditSuccess && f.Result != model.AuditFailure {
+		Err(c, 400, "invalid result")
+		return f, false
+	}
+	if v := c.Query("since"); v != "" {
+		t, err := parseTime(v, false)
+		if err != nil {
+			Err(c, 400, "invalid since")
+			return f, false
+		}
+		f.Since = t
+	}
+	if v := c.Query("until"); v != "" {
+		t, err := parseTime(v, true)
+		if err != nil {
+			Err(c, 400, "invalid until")
+			return f, false
+		}
+		f.Until = t
+	}
+	return f, true
+}
+
+// List 查询审计事件
+// 查询参数：过滤条件见 parseFilter，limit（默认 50，最大 500）、offset
+func (h *Handler) List(c *app.RequestContext) {
+	f, ok := parseFilter(c)
+	if !ok {
+		return
+	}
+	limit, offset := 50, 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 500 {
+			Err(c, 400, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			Err(c, 400, "invalid offset")
+			return
+		}
+		offset = n
+	}
+	items, total, err := h.logic.List(f, limit, offset)
+	if err != nil {
+		Err(c, 500, err.Error())
+		return
+	}
+	Ok(c, map[string]interface{}{"items": items, "total": total})
+}
+
+// Export 以 CSV 导出符合条件的全部审计事件
+func (h *Handler) Export(c *app.RequestContext) {
+	f, ok := parseFilter(c)
+	if !ok {
+		return
+	}
+	var buf bytes.Buffer
+	if err := h.logic.Export(&buf, f); err != nil {
+		Err(c, 500, err.Error())
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="audit-`+time.Now().Format("20060102-150405")+`.csv"`)
+	c.SetStatusCode(200)
+	c.Write(buf.Bytes())
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+	"webci-refactored/internal/config"
+	"webci-refactored/internal/logic/auth"
+	"webci-refactored/internal/middleware"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"gorm.io/gorm"
+)
+
+// Handler 认证与用户处理层
+type Handler struct {
+	logic *auth.Logic
+
+	// 等待 GitLab 回调的账号关联请求：state -> 发起关联的用户
+	mu    sync.Mutex
+	links map[string]pendingLink
+}
+
+// NewHandler 创建认证处理层实例
+func NewHandler(db *gorm.DB, cfg config.Config) *Handler {
+	return &Handler{
+		logic: auth.NewLogic(db, cfg),
+		links: make(map[string]pendingLink),
+	}
+}
+
+// Logic 返回认证业务逻辑，供认证中间件解析令牌
+func (h *Handler) Logic() *auth.Logic { return h.logic }
+
+// Ok 返回成功响应
+func Ok(c *app.RequestContext, data interface{}) {
+	c.JSON(200, map[string]interface{}{"code": 0, "message": "ok", "data": data})
+}
+
+// Err 返回错误响应
+func Err(c *app.RequestContext, status int, msg string) {
+	c.JSON(status, map[string]interface{}{"code": status, "message": msg})
+}
+
+// parseID 从路径参数中解析ID
+func parseID(c *app.RequestContext) uint64 {
+	idStr := string(c.Param("id"))
+	id, _ := strconv.ParseUint(idStr, 10, 64)
+	return id
+}
+
+// Login 密码登录
+// 请求体：username 与 password；成功后返回会话令牌，并写入 HttpOnly 会话 Cookie 供浏览器页面使用
+func (h *Handler) Login(c *app.RequestContext) {
+	var in struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := c.Bind(&in); err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	token, u, err := h.logic.Login(in.Username, in.Password)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			Err(c, 401, err.Error())
+			return
+		}
+		Err(c, 500, err.Error())
+		return
+	}
+	c.SetCookie(middleware.SessionCookie, token, int(auth.SessionTTL/time.Second), "/", "", protocol.CookieSameSiteLaxMode, false, true)
+	Ok(c, map[string]interface{}{"token": token, "expires_at": time.Now().Add(auth.SessionTTL), "user": u})
+}
+
+// Logout 退出登录：吊销本次请求携带的令牌并清除会话 Cookie
+func (h *Handler) Logout(c *app.RequestContext) {
+	if err := h.logic.Logout(middleware.Token(c)); err != nil {
+		Err(c, 500, err.Error())
+		return
+	}
+	c.SetCookie(middleware.SessionCookie, "", -1, "/", "", protocol.CookieSameSiteLaxMode, false, true)
+	Ok(c, "logged out")
+}
+
+// Me 返回当前身份
+func (h *Handler) Me(c *app.RequestContext) {
+	id := middleware.Current(c)
+	Ok(c, map[string]interface{}{"id": id.UserID, "username": id.Username, "role": id.Role})
+}
+
+// ChangePassword 修改当前用户的密码
+// 请求体：old_password 与 new_password；成功后全部登录会话失效，需要重新登录
+func (h *Handler) ChangePassword(c *app.RequestContext) {
+	var in struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := c.Bind(&in); err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	if err := h.logic.ChangePassword(middleware.Current(c).UserID, in.OldPassword, in.NewPassword); err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			Err(c, 403, "old password does not match")
+			return
+		}
+		Err(c, 400, err.Error())
+		return
+	}
+	Ok(c, "password changed")
+}
+
+// ListTokens 查询当前用户的个人 API 令牌（不含令牌明文）
+func (h *Handler) ListTokens(c *app.RequestContext) {
+	items, err := h.logic.ListTokens(middleware.Current(c).UserID)
+	if err != nil {
+		Err(c, 500, err.Error())
+		return
+	}
+	Ok(c, items)
+}
+
+// CreateToken 为当前用户创建个人 API 令牌
+// 请求体：name 与可选的 expires_at（RFC3339）；令牌明文只在本次响应中返回
+func (h *Handler) CreateToken(c *app.RequestContext) {
+	var in struct {
+		Name      string     `json:"name"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.Bind(&in); err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	token, t, err := h.logic.CreateToken(middleware.Current(c).UserID, in.Name, in.ExpiresAt)
+	if err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	Ok(c, map[string]interface{}{"token": token, "info": t})
+}
+
+// RevokeToken 吊销当前用户的个人 API 令牌
+func (h *Handler) RevokeToken(c *app.RequestContext) {
+	ok, err := h.logic.RevokeToken(middleware.Current(c).UserID, parseID(c))
+	if err != nil {
+		Err(c, 500, err.Error())
+		return
+	}
+	if !ok {
+		Err(c, 404, "token not found")
+		return
+	}
+	Ok(c, "revoked")
+}
+
+// ListUsers 列出全部用户
+func (h *Handler) ListUsers(c *app.RequestContext) {
+	items, err := h.logic.ListUsers()
+	if err != nil {
+		Err(c, 500, err.Error())
+		return
+	}
+	Ok(c, items)
+}
+
+// CreateUser 创建本地用户
+// 请求体：username、password（至少 8 个字符）与 role（viewer/developer/maintainer/admin）；用户名已存在时返回 409
+func (h *Handler) CreateUser(c *app.RequestContext) {
+	var in struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Role     string `json:"role"`
+	}
+	if err := c.Bind(&in); err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	u, err := h.logic.CreateUser(in.Username, in.Password, in.Role)
+	if err != nil {
+		if errors.Is(err, auth.ErrUserExists) {
+			Err(c, 409, err.Error())
+			return
+		}
+		Err(c, 400, err.Error())
+		return
+	}
+	Ok(c, u)
+}
+
+// UpdateUser 更新用户
+// 请求体字段均可选：role、password、disabled；修改密码或禁用用户会吊销其登录会话
+func (h *Handler) UpdateUser(c *app.RequestContext) {
+	var in struct {
+		Role     *string `json:"role"`
+		Password *string `json:"password"`
+		Disabled *bool   `json:"disabled"`
+	}
+	if err := c.Bind(&in); err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	u, err := h.logic.UpdateUser(parseID(c), auth.UserUpdate{Role: in.Role, Password: in.Password, Disabled: in.Disabled})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Err(c, 404, err.Error())
+			return
+		}
+		Err(c, 400, err.Error())
+		return
+	}
+	Ok(c, u)
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"html/template"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// loginPage 登录页：提交用户名与密码，登录成功后跳转回 next；启用 GitLab 单点登录时提供 GitLab 登录入口
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>WebCI 登录</title>
+<style>body{font-family:sans-serif;max-width:320px;margin:80px auto}input,button{display:block;width:100%;margin:8px 0;padding:6px}#err{color:#c00}</style>
+</head><body>
+<h1>WebCI</h1>
+<form id="f">
+<input name="username" placeholder="用户名" autofocus required>
+<input name="password" type="password" placeholder="密码" required>
+<button type="submit">登录</button>
+<p id="err"></p>
+</form>
+{{if .GitLab}}<p><a href="/auth/gitlab/login?next={{.Next}}">使用 GitLab 登录</a></p>{{end}}
+<script>
+document.getElementById('f').onsubmit = async function (e) {
+  e.preventDefault();
+  const res = await fetch('/api/auth/login', {method: 'POST', headers: {'Content-Type': 'application/json'},
+    body: JSON.stringify({username: this.username.value, password: this.password.value})});
+  if (res.ok) { location.href = {{.Next}}; return; }
+  const body = await res.json().catch(() => ({}));
+  document.getElementById('err').textContent = body.message || '登录失败';
+};
+</script>
+</body></html>`))
+
+// LoginPage 渲染登录页
+// 查询参数 next 为登录后跳转的站内路径，缺省或非站内路径时跳转首页
+func (h *Handler) LoginPage(c *app.RequestContext) {
+	data := map[string]interface{}{"Next": safeNext(c.Query("next")), "GitLab": h.logic.GitLabEnabled()}
+	var sb strings.Builder
+	if err := loginPage.Execute(&sb, data); err != nil {
+		Err(c, 500, err.Error())
+		return
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.SetStatusCode(200)
+	c.Write([]byte(sb.String()))
+}
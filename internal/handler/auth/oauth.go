@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+	"webci-refactored/internal/logic/auth"
+	"webci-refactored/internal/middleware"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// stateCookie 保存 OAuth state 与登录后跳转路径的 Cookie 名称
+const stateCookie = "webci_oauth_state"
+
+// stateTTL 发起 GitLab 登录到回调之间的最长时间
+const stateTTL = 10 * time.Minute
+
+// pendingLink 已校验本地密码、等待 GitLab 回调的账号关联
+type pendingLink struct {
+	userID  uint64
+	expires time.Time
+}
+
+// safeNext 仅允许站内路径作为登录后的跳转地址
+// 浏览器把 "/\" 与 "//" 同样视为协议相对地址，带协议或主机的地址一律拒绝
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || len(next) > 1 && (next[1] == '/' || next[1] == '\\') {
+		return "/"
+	}
+	u, err := url.Parse(next)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "/"
+	}
+	return next
+}
+
+// startOAuth 生成随机 state 写入短期 Cookie，返回 state 与 GitLab 授权页地址
+func (h *Handler) startOAuth(c *app.RequestContext, next string) (string, string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	state := hex.EncodeToString(buf)
+	value := state + "." + base64.RawURLEncoding.EncodeToString([]byte(safeNext(next)))
+	c.SetCookie(stateCookie, value, int(stateTTL/time.Second), "/auth/gitlab", "", protocol.CookieSameSiteLaxMode, false, true)
+	return state, h.logic.GitLabAuthURL(state), nil
+}
+
+// GitLabLogin 发起 GitLab 单点登录
+// 生成随机 state 写入短期 Cookie 后跳转到 GitLab 授权页；查询参数 next 为登录后跳转的站内路径
+func (h *Handler) GitLabLogin(c *app.RequestContext) {
+	if !h.logic.GitLabEnabled() {
+		Err(c, 404, "gitlab sso is not configured")
+		return
+	}
+	_, target, err := h.startOAuth(c, c.Query("next"))
+	if err != nil {
+		Err(c, 500, err.Error())
+		return
+	}
+	c.Redirect(302, []byte(target))
+}
+
+// GitLabLink 为当前本地用户发起 GitLab 账号关联
+// 请求体：password 为当前用户的本地密码，next 为关联完成后跳转的站内路径；返回 GitLab 授权页地址，由浏览器跳转完成授权
+func (h *Handler) GitLabLink(c *app.RequestContext) {
+	if !h.logic.GitLabEnabled() {
+		Err(c, 404, "gitlab sso is not configured")
+		return
+	}
+	var in struct {
+		Password string `json:"password"`
+		Next     string `json:"next"`
+	}
+	if err := c.Bind(&in); err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	userID := middleware.Current(c).UserID
+	if err := h.logic.CheckPassword(userID, in.Password); err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			Err(c, 403, "password does not match")
+			return
+		}
+		Err(c, 500, err.Error())
+		return
+	}
+	state, target, err := h.startOAuth(c, in.Next)
+	if err != nil {
+		Err(c, 500, err.Error())
+		return
+	}
+	now := time.Now()
+	h.mu.Lock()
+	for k, v := range h.links {
+		if now.After(v.expires) {
+			delete(h.links, k)
+		}
+	}
+	h.links[state] = pendingLink{userID: userID, expires: now.Add(stateTTL)}
+	h.mu.Unlock()
+	Ok(c, map[string]interface{}{"url": target})
+}
+
+// takeLink 取出 state 对应且未过期的账号关联
+func (h *Handler) takeLink(state string) (pendingLink, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	link, ok := h.links[state]
+	delete(h.links, state)
+	return link, ok && time.Now().Before(link.expires)
+}
+
+// GitLabCallback GitLab 授权回调
+// 校验 state 后以授权码登录，写入会话 Cookie 并跳转回发起登录时的页面；
+// state 属于账号关联请求时改为关联发起关联的本地用户
+func (h *Handler) GitLabCallback(c *app.RequestContext) {
+	if !h.logic.GitLabEnabled() {
+		Err(c, 404, "gitlab sso is not configured")
+		return
+	}
+	saved := strings.SplitN(string(c.Cookie(stateCookie)), ".", 2)
+	c.SetCookie(stateCookie, "", -1, "/auth/gitlab", "", protocol.CookieSameSiteLaxMode, false, true)
+	if len(saved) != 2 || saved[0] == "" || saved[0] != c.Query("state") {
+		Err(c, 400, "invalid oauth state")
+		return
+	}
+	if msg := c.Query("error"); msg != "" {
+		Err(c, 401, "gitlab authorization denied: "+msg)
+		return
+	}
+	next, _ := base64.RawURLEncoding.DecodeString(saved[1])
+	if link, ok := h.takeLink(saved[0]); ok {
+		if _, err := h.logic.LinkGitLab(context.Background(), c.Query("code"), link.userID); err != nil {
+			oauthErr(c, err)
+			return
+		}
+		c.Redirect(302, []byte(safeNext(string(next))))
+		return
+	}
+	token, _, err := h.logic.LoginWithGitLab(context.Background(), c.Query("code"))
+	if err != nil {
+		oauthErr(c, err)
+		return
+	}
+	c.SetCookie(middleware.SessionCookie, token, int(auth.SessionTTL/time.Second), "/", "", protocol.CookieSameSiteLaxMode, false, true)
+	c.Redirect(302, []byte(safeNext(string(next))))
+}
+
+// oauthErr 映射 GitLab 登录与关联的错误：身份被拒绝为 403，其余视为 GitLab 调用失败
+func oauthErr(c *app.RequestContext, err error) {
+	if errors.Is(err, auth.ErrInvalidCredentials) || errors.Is(err, auth.ErrAccountConflict) || errors.Is(err, auth.ErrLinkRequired) {
+		Err(c, 403, err.Error())
+		return
+	}
+	Err(c, 502, err.Error())
+}
@@ -1,8 +1,11 @@
 package branch
 
 import (
+	"errors"
 	"strconv"
 	"webci-refactored/internal/logic/branch"
+	"webci-refactored/internal/middleware"
+	"webci-refactored/internal/pipeline"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"gorm.io/gorm"
@@ -118,17 +121,26 @@ func (h *Handler) Refresh(c *app.RequestContext) {
 func (h *Handler) MockPush(c *app.RequestContext) {
 	id := parseID(c)
 	var in struct {
-		Pusher      string  `json:"pusher"`
-		EnvID       *uint64 `json:"env_id"`
-		TriggerUser string  `json:"trigger_user"`
-		Message     string  `json:"message"`
+		Pusher  string  `json:"pusher"`
+		EnvID   *uint64 `json:"env_id"`
+		Message string  `json:"message"`
 	}
 	if err := c.Bind(&in); err != nil {
 		Err(c, 400, err.Error())
 		return
 	}
-	b, job, err := h.logic.MockPush(id, in.Pusher, in.EnvID, in.TriggerUser, in.Message)
+	b, job, err := h.logic.MockPush(id, in.Pusher, in.EnvID, middleware.Username(c), in.Message)
 	if err != nil {
+		// 流水线定义校验失败属于请求方问题，返回 400
+		var ve *pipeline.ValidationError
+		if errors.As(err, &ve) {
+			Err(c, 400, err.Error())
+			return
+		}
+		if errors.Is(err, branch.ErrDeployBlocked) {
+			Err(c, 403, err.Error())
+			return
+		}
 		Err(c, 500, err.Error())
 		return
 	}
@@ -1,8 +1,10 @@
 package environment
 
 import (
+	"errors"
 	"strconv"
 	"webci-refactored/internal/logic/environment"
+	"webci-refactored/internal/middleware"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"gorm.io/gorm"
@@ -14,9 +16,9 @@ type Handler struct {
 }
 
 // NewHandler 创建环境处理层实例
-func NewHandler(db *gorm.DB) *Handler {
+func NewHandler(db *gorm.DB, repoPath string) *Handler {
 	return &Handler{
-		logic: environment.NewLogic(db),
+		logic: environment.NewLogic(db, repoPath),
 	}
 }
 
@@ -51,13 +53,25 @@ func (h *Handler) List(c *app.RequestContext) {
 
 // Create 创建环境
 func (h *Handler) Create(c *app.RequestContext) {
-	var in struct{ Name, Description string }
+	var in struct {
+		Name, Description string
+		MaxConcurrency    int `json:"max_concurrency"`
+		TimeoutSeconds    int `json:"timeout_seconds"`
+		// 保护规则：允许部署的分支模式、所需审批人数与审批人名单
+		DeployBranches    []string `json:"deploy_branches"`
+		RequiredApprovals int      `json:"required_approvals"`
+		Approvers         []string `json:"approvers"`
+	}
 	// 绑定 JSON 请求体
 	if err := c.Bind(&in); err != nil {
 		Err(c, 400, err.Error())
 		return
 	}
-	e, err := h.logic.Create(in.Name, in.Description)
+	e, err := h.logic.Create(in.Name, in.Description, in.MaxConcurrency, in.TimeoutSeconds, environment.Protection{
+		DeployBranches:    in.DeployBranches,
+		RequiredApprovals: in.RequiredApprovals,
+		Approvers:         in.Approvers,
+	})
 	if err != nil {
 		Err(c, 400, err.Error())
 		return
@@ -85,15 +99,36 @@ func (h *Handler) Update(c *app.RequestContext) {
 		Err(c, 404, err.Error())
 		return
 	}
-	var in struct{ Name, Description string }
+	var in struct {
+		Name, Description string
+		// 并发上限与任务超时：未传入时保持不变
+		MaxConcurrency *int `json:"max_concurrency"`
+		TimeoutSeconds *int `json:"timeout_seconds"`
+		// 保护规则：未传入时保持不变
+		DeployBranches    *[]string `json:"deploy_branches"`
+		RequiredApprovals *int      `json:"required_approvals"`
+		Approvers         *[]string `json:"approvers"`
+	}
 	if err := c.Bind(&in); err != nil {
 		Err(c, 400, err.Error())
 		return
 	}
+	if in.MaxConcurrency != nil && *in.MaxConcurrency < 0 {
+		Err(c, 400, "max_concurrency must not be negative")
+		return
+	}
+	if in.TimeoutSeconds != nil && *in.TimeoutSeconds < 0 {
+		Err(c, 400, "timeout_seconds must not be negative")
+		return
+	}
 	// 更新基本字段并持久化
-	e, err = h.logic.Update(id, in.Name, in.Description)
+	e, err = h.logic.Update(id, in.Name, in.Description, in.MaxConcurrency, in.TimeoutSeconds, environment.ProtectionUpdate{
+		DeployBranches:    in.DeployBranches,
+		RequiredApprovals: in.RequiredApprovals,
+		Approvers:         in.Approvers,
+	})
 	if err != nil {
-		Err(c, 500, err.Error())
+		Err(c, 400, err.Error())
 		return
 	}
 	Ok(c, e)
@@ -108,3 +143,202 @@ func (h *Handler) Delete(c *app.RequestContext) {
 	}
 	Ok(c, "deleted")
 }
+
+// ListVariables 查询环境变量
+func (h *Handler) ListVariables(c *app.RequestContext) {
+	items, err := h.logic.ListVariables(parseID(c))
+	if err != nil {
+		Err(c, 404, err.Error())
+		return
+	}
+	Ok(c, items)
+}
+
+// SetVariable 新增或覆盖环境变量
+// 请求体：value 与 secret（是否为密文变量）；密文变量的值在响应中以掩码返回
+func (h *Handler) SetVariable(c *app.RequestContext) {
+	id := parseID(c)
+	if _, err := h.logic.Get(id); err != nil {
+		Err(c, 404, err.Error())
+		return
+	}
+	var in struct {
+		Value  string `json:"value"`
+		Secret bool   `json:"secret"`
+	}
+	if err := c.Bind(&in); err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	v, err := h.logic.SetVariable(id, c.Param("key"), in.Value, in.Secret)
+	if err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	Ok(c, v)
+}
+
+// DeleteVariable 删除环境变量
+func (h *Handler) DeleteVariable(c *app.RequestContext) {
+	if err := h.logic.DeleteVariable(parseID(c), c.Param("key")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Err(c, 404, "variable not found")
+			return
+		}
+		Err(c, 500, err.Error())
+		return
+	}
+	Ok(c, "deleted")
+}
+
+// UpdateRepoPath 更新计算部署变更所用的本地仓库路径
+func (h *Handler) UpdateRepoPath(path string) { h.logic.UpdateRepoPath(path) }
+
+// ListDeployments 查询环境的部署历史
+// 查询参数：status（如 success 列出可回滚的版本）、limit（默认 20，最大 100）、offset
+func (h *Handler) ListDeployments(c *app.RequestContext) {
+	limit, offset := 20, 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 100 {
+			Err(c, 400, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			Err(c, 400, "invalid offset")
+			return
+		}
+		offset = n
+	}
+	items, total, err := h.logic.ListDeployments(parseID(c), c.Query("status"), limit, offset)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Err(c, 404, "environment not found")
+			return
+		}
+		Err(c, 500, err.Error())
+		return
+	}
+	Ok(c, map[string]interface{}{"items": items, "total": total})
+}
+
+// DeploymentChanges 查询部署相对于上一次成功部署新增的提交与文件差异
+func (h *Handler) DeploymentChanges(c *app.RequestContext) {
+	deployID, _ := strconv.ParseUint(c.Param("deployment_id"), 10, 64)
+	changes, err := h.logic.DeploymentChanges(parseID(c), deployID)
+	if err != nil {
+		Err(c, changesStatus(err), err.Error())
+		return
+	}
+	Ok(c, changes)
+}
+
+// PendingChanges 查询"上次部署以来的变更"：ref（分支、标签或提交）相对于环境当前部署版本
+// 查询参数 ref 省略时使用上次成功部署的分支
+func (h *Handler) PendingChanges(c *app.RequestContext) {
+	changes, err := h.logic.PendingChanges(parseID(c), c.Query("ref"))
+	if err != nil {
+		Err(c, changesStatus(err), err.Error())
+		return
+	}
+	Ok(c, changes)
+}
+
+// Rollback 将环境回滚到历史成功部署
+// 触发用户为当前身份；请求体：deployment_id（省略时回滚到上一个不同版本）与可选的 freeze_override（管理员覆盖冻结窗口的原因）；
+// 环境中已有排队或执行中的部署时返回 409
+func (h *Handler) Rollback(c *app.RequestContext) {
+	var in struct {
+		DeploymentID   uint64 `json:"deployment_id"`
+		FreezeOverride string `json:"freeze_override"`
+	}
+	if err := c.Bind(&in); err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	j, err := h.logic.Rollback(parseID(c), in.DeploymentID, middleware.Username(c), in.FreezeOverride)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			Err(c, 404, err.Error())
+		case errors.Is(err, environment.ErrDeployRunning), errors.Is(err, environment.ErrNoRollbackTarget), errors.Is(err, environment.ErrNotRollbackable):
+			Err(c, 409, err.Error())
+		case errors.Is(err, environment.ErrDeployBlocked):
+			Err(c, 403, err.Error())
+		default:
+			Err(c, 400, err.Error())
+		}
+		return
+	}
+	Ok(c, j)
+}
+
+// changesStatus 将变更计算错误映射为 HTTP 状态码
+func changesStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, environment.ErrUnknownRevision):
+		return 404
+	case errors.Is(err, environment.ErrNoRef):
+		return 400
+	case errors.Is(err, environment.ErrNoRepository), errors.Is(err, environment.ErrNoCommit):
+		return 409
+	default:
+		return 500
+	}
+}
+
+// ListFreezes 查询环境的冻结窗口
+func (h *Handler) ListFreezes(c *app.RequestContext) {
+	items, err := h.logic.ListFreezes(parseID(c))
+	if err != nil {
+		Err(c, 404, err.Error())
+		return
+	}
+	Ok(c, items)
+}
+
+// CreateFreeze 创建冻结窗口
+// 请求体：cron（五段式 cron 表达式）或 starts_at/ends_at（RFC3339、"2006-01-02 15:04" 或 "2006-01-02"）二选一，
+// 以及可选的 timezone（如 Asia/Shanghai，默认 UTC）与 reason
+func (h *Handler) CreateFreeze(c *app.RequestContext) {
+	id := parseID(c)
+	if _, err := h.logic.Get(id); err != nil {
+		Err(c, 404, err.Error())
+		return
+	}
+	var in struct {
+		Cron     string `json:"cron"`
+		Timezone string `json:"timezone"`
+		StartsAt string `json:"starts_at"`
+		EndsAt   string `json:"ends_at"`
+		Reason   string `json:"reason"`
+	}
+	if err := c.Bind(&in); err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	f, err := h.logic.CreateFreeze(id, environment.FreezeInput{Cron: in.Cron, Timezone: in.Timezone, StartsAt: in.StartsAt, EndsAt: in.EndsAt, Reason: in.Reason})
+	if err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	Ok(c, f)
+}
+
+// DeleteFreeze 删除冻结窗口
+func (h *Handler) DeleteFreeze(c *app.RequestContext) {
+	freezeID, _ := strconv.ParseUint(c.Param("freeze_id"), 10, 64)
+	if err := h.logic.DeleteFreeze(parseID(c), freezeID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Err(c, 404, "freeze window not found")
+			return
+		}
+		Err(c, 500, err.Error())
+		return
+	}
+	Ok(c, "deleted")
+}
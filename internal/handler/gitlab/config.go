@@ -0,0 +1,143 @@
+package gitlab
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"webci-refactored/internal/config"
+	"webci-refactored/internal/logic/gitlab"
+	"webci-refactored/internal/middleware"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"gorm.io/gorm"
+)
+
+// configView 配置的对外视图：不含令牌
+func configView(cfg config.Config, version int) map[string]interface{} {
+	return map[string]interface{}{
+		"base_url":   cfg.GitLabBaseURL,
+		"project_id": cfg.GitLabProject,
+		"repo_path":  cfg.RepoPath,
+		"token_set":  cfg.GitLabToken != "",
+		"version":    version,
+	}
+}
+
+// Config 返回当前生效的配置
+func (h *Handler) Config() config.Config {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.cfg
+}
+
+// OnRepoPath 注册本地仓库路径变更回调（分支、任务与环境处理层），配置应用时依次调用
+func (h *Handler) OnRepoPath(fn func(string)) { h.repoHooks = append(h.repoHooks, fn) }
+
+// GetConfig 查询当前配置与版本号
+func (h *Handler) GetConfig(c *app.RequestContext) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	view := configView(h.cfg, h.version)
+	if h.loadErr != nil {
+		view["load_error"] = h.loadErr.Error()
+	}
+	Ok(c, view)
+}
+
+// UpdateConfig 修改 GitLab 配置
+// 请求体：base_url、token、project_id、repo_path（留空的字段保持不变）与可选 note；
+// 新配置先向 GitLab 发起一次项目查询校验，通过后保存为新版本并同时应用到业务逻辑与各处理层的仓库路径
+func (h *Handler) UpdateConfig(c *app.RequestContext) {
+	var in struct {
+		BaseURL   string `json:"base_url"`
+		Token     string `json:"token"`
+		ProjectID string `json:"project_id"`
+		RepoPath  string `json:"repo_path"`
+		Note      string `json:"note"`
+	}
+	if err := c.Bind(&in); err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	h.applyMu.Lock()
+	defer h.applyMu.Unlock()
+	next := h.Config()
+	if in.BaseURL != "" {
+		next.GitLabBaseURL = in.BaseURL
+	}
+	if in.Token != "" {
+		next.GitLabToken = in.Token
+	}
+	if in.ProjectID != "" {
+		next.GitLabProject = in.ProjectID
+	}
+	if in.RepoPath != "" {
+		next.RepoPath = in.RepoPath
+	}
+	h.apply(c, next, in.Note)
+}
+
+// ConfigHistory 按版本倒序查询配置历史（不含令牌）
+func (h *Handler) ConfigHistory(c *app.RequestContext) {
+	items, err := h.store.History(100)
+	if err != nil {
+		Err(c, 500, err.Error())
+		return
+	}
+	Ok(c, items)
+}
+
+// RestoreConfig 恢复到历史版本：同样先校验，通过后保存为新版本并应用
+func (h *Handler) RestoreConfig(c *app.RequestContext) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		Err(c, 400, "invalid version")
+		return
+	}
+	h.applyMu.Lock()
+	defer h.applyMu.Unlock()
+	next, _, err := h.store.Resolve(h.Config(), version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Err(c, 404, "config version not found")
+			return
+		}
+		Err(c, 500, err.Error())
+		return
+	}
+	h.apply(c, next, fmt.Sprintf("restore version %d", version))
+}
+
+// apply 校验、保存并应用配置，须持有 applyMu
+// 未配置 SECRET_KEY 时拒绝保存；校验在任何修改之前完成，校验失败时不保存也不改变运行中的配置
+func (h *Handler) apply(c *app.RequestContext, next config.Config, note string) {
+	if err := h.store.CheckKey(); err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	if err := gitlab.ValidateRepoPath(next.RepoPath); err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	logic, err := gitlab.Connect(next, h.classifier, h.mirror)
+	if err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	saved, err := h.store.Save(next, middleware.Username(c), note)
+	if err != nil {
+		Err(c, 500, err.Error())
+		return
+	}
+	// 业务逻辑与各处理层的仓库路径在同一把锁内切换，读者不会看到新旧配置混用
+	h.mu.Lock()
+	if h.cfg.RepoPath != next.RepoPath {
+		for _, fn := range h.repoHooks {
+			fn(next.RepoPath)
+		}
+	}
+	h.logic, h.cfg, h.version, h.loadErr = logic, next, saved.Version, nil
+	h.mu.Unlock()
+	h.wakeSync(false)
+	Ok(c, configView(next, saved.Version))
+}
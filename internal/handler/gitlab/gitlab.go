@@ -1,37 +1,114 @@
 package gitlab
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"log"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 	"webci-refactored/internal/config"
 	"webci-refactored/internal/logic/gitlab"
+	"webci-refactored/internal/middleware"
 
 	"github.com/cloudwego/hertz/pkg/app"
+	"gorm.io/gorm"
 )
 
 var gitlabTemplate embed.FS
 
+// UserTokens 按用户名查询其 GitLab 访问令牌，用户未关联 GitLab 时返回空
+type UserTokens func(ctx context.Context, username string) (string, error)
+
 // Handler GitLab处理层
+// 持有当前生效的配置与业务逻辑，配置变更时整体替换；GitLab 尚未配置时接口返回 503
 type Handler struct {
-	logic *gitlab.Logic
+	mu        sync.RWMutex
+	logic     *gitlab.Logic
+	cfg       config.Config
+	version   int
+	store     *gitlab.ConfigStore
+	repoHooks []func(string)
+	// applyMu 串行化配置变更（校验、保存与应用）
+	applyMu sync.Mutex
+	tokens  UserTokens
+	// events webhook 事件存储，webhookSecret 为校验令牌（为空不接收 webhook）
+	events        *gitlab.EventStore
+	webhookSecret string
+	// classifier 流水线任务类型判别，配置变更后沿用
+	classifier *gitlab.Classifier
+	// mirror 本地镜像（未启用后台同步时为空），syncWake 唤醒后台同步，值为是否全量对齐
+	mirror       *gitlab.Mirror
+	syncInterval time.Duration
+	syncWake     chan bool
+	// loadErr 已保存的配置无法加载（如 SECRET_KEY 变更），此时不回退到环境变量，待重新保存配置
+	loadErr error
 }
 
 // NewHandler 创建GitLab处理层实例
-func NewHandler(cfg config.Config) (*Handler, error) {
-	log.Printf("Creating GitLab handler with config: baseURL=%s, project=%s", cfg.GitLabBaseURL, cfg.GitLabProject)
+// 数据库中已保存的配置版本优先于环境变量；配置不完整或创建失败时仍返回处理层，待通过配置接口完成配置；
+// 已保存的配置无法解密时不回退到环境变量，GitLab 接口返回该错误直到重新保存配置
+func NewHandler(cfg config.Config, db *gorm.DB) *Handler {
+	h := &Handler{store: gitlab.NewConfigStore(db), events: gitlab.NewEventStore(db), webhookSecret: cfg.GitLabWebhookSecret}
+	h.classifier = gitlab.NewClassifier(db, h.events)
+	if cfg.GitLabSyncInterval > 0 {
+		h.mirror = gitlab.NewMirror(db)
+		h.syncInterval = cfg.GitLabSyncInterval
+		h.syncWake = make(chan bool, 1)
+	}
+	merged, current, err := h.store.Overlay(cfg)
+	if err != nil {
+		log.Printf("Error: failed to load saved gitlab config, gitlab stays unavailable until the config is saved again: %v", err)
+		h.cfg, h.loadErr = cfg, err
+		if current != nil {
+			h.version = current.Version
+		}
+		return h
+	}
+	if current != nil {
+		cfg = merged
+		h.version = current.Version
+	}
+	h.cfg = cfg
+	log.Printf("Creating GitLab handler with config: baseURL=%s, project=%s, version=%d", cfg.GitLabBaseURL, cfg.GitLabProject, h.version)
 
 	// 创建GitLab业务逻辑
-	logic, err := gitlab.NewLogic(cfg)
+	logic, err := gitlab.NewLogic(cfg, h.classifier, h.mirror)
 	if err != nil {
-		log.Printf("Failed to create gitlab logic: %v", err)
-		return nil, err
+		log.Printf("Warning: gitlab is not configured: %v", err)
+		return h
 	}
+	h.logic = logic
+	return h
+}
 
-	return &Handler{
-		logic: logic,
-	}, nil
+// current 返回当前生效的业务逻辑，未配置时为 nil
+func (h *Handler) current() *gitlab.Logic {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.logic
+}
+
+// Configured 是否已配置 GitLab
+func (h *Handler) Configured() bool { return h.current() != nil }
+
+// ready 返回当前业务逻辑，GitLab 尚未配置时返回 503
+func (h *Handler) ready(c *app.RequestContext) (*gitlab.Logic, bool) {
+	l := h.current()
+	if l == nil {
+		h.mu.RLock()
+		loadErr := h.loadErr
+		h.mu.RUnlock()
+		if loadErr != nil {
+			Err(c, 503, "saved gitlab config cannot be loaded: "+loadErr.Error())
+			return nil, false
+		}
+		Err(c, 503, "gitlab is not configured")
+		return nil, false
+	}
+	return l, true
 }
 
 // Ok 返回成功响应
@@ -45,6 +122,27 @@ func Err(c *app.RequestContext, status int, msg string) {
 	c.JSON(status, map[string]interface{}{"code": status, "message": msg})
 }
 
+// UseUserTokens 启用以当前用户自己的 GitLab 令牌执行写操作（建分支、创建与合并 MR、提升）
+// 当前用户未关联 GitLab 时仍使用配置中的共享令牌
+func (h *Handler) UseUserTokens(fn UserTokens) { h.tokens = fn }
+
+// logicFor 返回当前请求使用的业务逻辑：启用用户令牌且当前用户已关联 GitLab 时以其令牌访问
+func (h *Handler) logicFor(c *app.RequestContext) (*gitlab.Logic, bool) {
+	l, ok := h.ready(c)
+	if !ok || h.tokens == nil {
+		return l, ok
+	}
+	token, err := h.tokens(context.Background(), middleware.Username(c))
+	if err == nil && token != "" {
+		l, err = l.WithToken(token)
+	}
+	if err != nil {
+		Err(c, 401, "gitlab credential unavailable: "+err.Error())
+		return nil, false
+	}
+	return l, true
+}
+
 // PageContent 返回GitLab流水线任务页面的HTML内容
 func (h *Handler) PageContent() string {
 	return GetJobListTemplate()
@@ -60,8 +158,12 @@ func (h *Handler) Page(c *app.RequestContext) {
 
 // ListPipelines 列出流水线
 func (h *Handler) ListPipelines(c *app.RequestContext) {
+	l, ok := h.ready(c)
+	if !ok {
+		return
+	}
 	log.Printf("Handling ListPipelines request")
-	pipelines, err := h.logic.ListPipelines()
+	pipelines, err := l.ListPipelines()
 	if err != nil {
 		log.Printf("Failed to list pipelines: %v", err)
 		Err(c, 500, err.Error())
@@ -73,7 +175,11 @@ func (h *Handler) ListPipelines(c *app.RequestContext) {
 }
 
 // GetPipeline 获取流水线详情
-func (h *Handler) GetPipeline(c *app.RequestContext) {
+func (h *Handler) GetPipeline(ctx context.Context, c *app.RequestContext) {
+	l, ok := h.ready(c)
+	if !ok {
+		return
+	}
 	log.Printf("Handling GetPipeline request")
 	// 从路径参数读取 id，并转换为整数
 	idStr := string(c.Param("id"))
@@ -85,7 +191,7 @@ func (h *Handler) GetPipeline(c *app.RequestContext) {
 	}
 
 	log.Printf("Getting details for pipeline %d", id)
-	details, err := h.logic.GetPipelineDetails(id)
+	details, err := l.GetPipelineDetails(ctx, id)
 	if err != nil {
 		log.Printf("Failed to get pipeline %d: %v", id, err)
 		Err(c, 500, err.Error())
@@ -96,10 +202,45 @@ func (h *Handler) GetPipeline(c *app.RequestContext) {
 	Ok(c, details)
 }
 
+// SetTaskType 人工修正流水线的任务类型
+// 请求体 {task_type}，取值为 创建分支/分支合并/修改文件；为空时撤销修正，恢复自动判别
+func (h *Handler) SetTaskType(ctx context.Context, c *app.RequestContext) {
+	l, ok := h.ready(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(string(c.Param("id")))
+	if err != nil {
+		Err(c, 400, "invalid pipeline id")
+		return
+	}
+	var in struct {
+		TaskType string `json:"task_type"`
+	}
+	if err := c.Bind(&in); err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	t, err := l.SetTaskType(ctx, id, strings.TrimSpace(in.TaskType), middleware.Username(c))
+	if errors.Is(err, gitlab.ErrInvalidTaskType) {
+		Err(c, 400, err.Error())
+		return
+	}
+	if err != nil {
+		Err(c, 500, err.Error())
+		return
+	}
+	Ok(c, t)
+}
+
 // ListBranches 列出分支
 func (h *Handler) ListBranches(c *app.RequestContext) {
+	l, ok := h.ready(c)
+	if !ok {
+		return
+	}
 	log.Printf("Handling ListBranches request")
-	branches, err := h.logic.ListBranches()
+	branches, err := l.ListBranches()
 	if err != nil {
 		log.Printf("Failed to list branches: %v", err)
 		Err(c, 500, err.Error())
@@ -110,8 +251,12 @@ func (h *Handler) ListBranches(c *app.RequestContext) {
 	Ok(c, branches)
 }
 
-// ListJobs 列出流水线任务（用于CI模拟器页面展示）
-func (h *Handler) ListJobs(c *app.RequestContext) {
+// ListJobs 列出流水线任务（用于CI模拟器页面展示），请求方断开时停止查询 GitLab
+func (h *Handler) ListJobs(ctx context.Context, c *app.RequestContext) {
+	l, ok := h.ready(c)
+	if !ok {
+		return
+	}
 	log.Printf("Handling ListJobs request for CI simulator page")
 	page := 1
 	perPage := 20
@@ -125,22 +270,43 @@ func (h *Handler) ListJobs(c *app.RequestContext) {
 			perPage = n
 		}
 	}
-	pageData, err := h.logic.ListJobsPage(page, perPage)
+	// GitLab 每页最多返回 100 条，超出时总页数会与请求的每页条数不一致
+	if perPage > 100 {
+		perPage = 100
+	}
+	// before_id、after_id 为本地镜像的键集游标（来自上一次响应的 next_before_id、prev_after_id），优先于 page
+	var cur gitlab.PipelineCursor
+	if v := c.Query("before_id"); len(v) > 0 {
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil && n > 0 {
+			cur.BeforeID = n
+		}
+	}
+	if v := c.Query("after_id"); len(v) > 0 && cur.BeforeID == 0 {
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil && n > 0 {
+			cur.AfterID = n
+		}
+	}
+	pageData, err := l.ListJobsPage(ctx, page, perPage, cur)
+	if errors.Is(err, context.Canceled) {
+		// 请求方已断开，无需响应
+		log.Printf("ListJobs canceled: client disconnected")
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to list jobs for CI page: %v", err)
 		Err(c, 500, err.Error())
 		return
 	}
 
-	log.Printf("Successfully listed %d jobs for CI simulator page", len(pageData.Items))
+	log.Printf("Successfully listed %d jobs for CI simulator page (%d row errors)", len(pageData.Items), len(pageData.Errors))
 	Ok(c, pageData)
 }
 
-func (h *Handler) UpdateConfig(cfg config.Config) error {
-	return h.logic.UpdateConfig(cfg)
-}
-
 func (h *Handler) CreateBranch(c *app.RequestContext) {
+	l, ok := h.logicFor(c)
+	if !ok {
+		return
+	}
 	var in struct {
 		Name string `json:"name"`
 		Ref  string `json:"ref"`
@@ -162,16 +328,19 @@ func (h *Handler) CreateBranch(c *app.RequestContext) {
 		return
 	}
 	in.Ref = "main"
-	b, err := h.logic.CreateBranch(in.Name, in.Ref)
+	b, err := l.CreateBranch(in.Name, in.Ref)
 	if err != nil {
 		Err(c, 500, err.Error())
 		return
 	}
-	h.logic.RecordCreateBranchHint(in.Name)
 	Ok(c, b)
 }
 
 func (h *Handler) CreateMergeRequest(c *app.RequestContext) {
+	l, ok := h.logicFor(c)
+	if !ok {
+		return
+	}
 	var in struct {
 		SourceBranch string `json:"source_branch"`
 		TargetBranch string `json:"target_branch"`
@@ -193,7 +362,7 @@ func (h *Handler) CreateMergeRequest(c *app.RequestContext) {
 		Err(c, 400, "source and target branch must differ")
 		return
 	}
-	_, _, mr, err := h.logic.CreateMergeRequest(gitlab.CreateMRInput{
+	_, _, mr, err := l.CreateMergeRequest(gitlab.CreateMRInput{
 		SourceBranch: in.SourceBranch,
 		TargetBranch: in.TargetBranch,
 		Title:        in.Title,
@@ -206,13 +375,14 @@ func (h *Handler) CreateMergeRequest(c *app.RequestContext) {
 		Err(c, 500, err.Error())
 		return
 	}
-	if mr != nil {
-		h.logic.RecordMergeBranchHintWithURL(in.TargetBranch, mr.WebURL, in.Title)
-	}
 	Ok(c, mr)
 }
 
 func (h *Handler) AcceptMergeRequest(c *app.RequestContext) {
+	l, ok := h.logicFor(c)
+	if !ok {
+		return
+	}
 	idStr := string(c.Param("iid"))
 	iid, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -226,18 +396,20 @@ func (h *Handler) AcceptMergeRequest(c *app.RequestContext) {
 		Message      string `json:"merge_commit_message"`
 	}
 	_ = c.Bind(&in)
-	mr, err := h.logic.AcceptMergeRequest(iid, in.Squash, in.RemoveSource, in.MWPS, in.Message)
+	mr, err := l.AcceptMergeRequest(iid, in.Squash, in.RemoveSource, in.MWPS, in.Message)
 	if err != nil {
 		Err(c, 500, err.Error())
 		return
 	}
-	if mr != nil {
-		h.logic.RecordMergeBranchHint(mr.TargetBranch)
-	}
+	log.Printf("merge request !%d accepted by %s", iid, middleware.Username(c))
 	Ok(c, mr)
 }
 
 func (h *Handler) AutoMerge(c *app.RequestContext) {
+	l, ok := h.logicFor(c)
+	if !ok {
+		return
+	}
 	var in struct {
 		SourceBranch string `json:"source_branch"`
 		TargetBranch string `json:"target_branch"`
@@ -260,7 +432,7 @@ func (h *Handler) AutoMerge(c *app.RequestContext) {
 		Err(c, 400, "source and target branch must differ")
 		return
 	}
-	_, _, mr, err := h.logic.CreateMergeRequest(gitlab.CreateMRInput{
+	_, _, mr, err := l.CreateMergeRequest(gitlab.CreateMRInput{
 		SourceBranch: in.SourceBranch,
 		TargetBranch: in.TargetBranch,
 		Title:        in.Title,
@@ -277,15 +449,20 @@ func (h *Handler) AutoMerge(c *app.RequestContext) {
 		Err(c, 500, "failed to create or find merge request")
 		return
 	}
-	acc, err := h.logic.AcceptMergeRequest(mr.IID, in.Squash, in.RemoveSource, in.MWPS, in.Message)
+	acc, err := l.AcceptMergeRequest(mr.IID, in.Squash, in.RemoveSource, in.MWPS, in.Message)
 	if err != nil {
 		Err(c, 500, "auto merge failed, please merge manually: "+err.Error())
 		return
 	}
+	log.Printf("merge request !%d accepted by %s", mr.IID, middleware.Username(c))
 	Ok(c, acc)
 }
 
 func (h *Handler) Promote(c *app.RequestContext) {
+	l, ok := h.logicFor(c)
+	if !ok {
+		return
+	}
 	var in struct {
 		SourcePrefix string `json:"source_prefix"`
 		Name         string `json:"name"`
@@ -305,7 +482,7 @@ func (h *Handler) Promote(c *app.RequestContext) {
 		Err(c, 400, "source_prefix/name required")
 		return
 	}
-	mr, err := h.logic.Promote(gitlab.PromoteInput{
+	mr, err := l.Promote(gitlab.PromoteInput{
 		SourcePrefix: in.SourcePrefix,
 		Name:         in.Name,
 		Target:       in.Target,
@@ -323,10 +500,11 @@ func (h *Handler) Promote(c *app.RequestContext) {
 		Ok(c, nil)
 		return
 	}
-	acc, err := h.logic.AcceptMergeRequest(mr.IID, in.Squash, in.RemoveSource, in.MWPS, in.Message)
+	acc, err := l.AcceptMergeRequest(mr.IID, in.Squash, in.RemoveSource, in.MWPS, in.Message)
 	if err != nil {
 		Err(c, 500, err.Error())
 		return
 	}
+	log.Printf("merge request !%d accepted by %s", mr.IID, middleware.Username(c))
 	Ok(c, acc)
 }
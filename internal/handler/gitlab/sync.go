@@ -0,0 +1,86 @@
+package gitlab
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// syncTimeout 单次后台同步的时限
+const syncTimeout = 10 * time.Minute
+
+// StartSync 启动后台同步：立即同步一次，之后按间隔、收到 webhook、配置变更或手动触发时再次同步；未启用本地镜像时不做任何事
+func (h *Handler) StartSync() {
+	if h.mirror == nil {
+		return
+	}
+	go h.runSync()
+}
+
+// runSync 后台同步循环，GitLab 尚未配置时跳过本轮
+func (h *Handler) runSync() {
+	ticker := time.NewTicker(h.syncInterval)
+	defer ticker.Stop()
+	full := false
+	for {
+		if l := h.current(); l != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+			report, err := l.Sync(ctx, full)
+			cancel()
+			if err != nil {
+				log.Printf("gitlab sync failed: %v", err)
+			} else {
+				log.Printf("gitlab sync done: %+v", *report)
+			}
+		}
+		select {
+		case <-ticker.C:
+			full = false
+		case full = <-h.syncWake:
+		}
+	}
+}
+
+// wakeSync 唤醒后台同步；已有待处理的唤醒时不重复排队
+func (h *Handler) wakeSync(full bool) {
+	if h.syncWake == nil {
+		return
+	}
+	select {
+	case h.syncWake <- full:
+	default:
+	}
+}
+
+// SyncStatus 查询本地镜像的同步状态：是否启用、同步间隔与各资源的进度
+func (h *Handler) SyncStatus(c *app.RequestContext) {
+	l, ok := h.ready(c)
+	if !ok {
+		return
+	}
+	states, err := l.SyncStates()
+	if err != nil {
+		Err(c, 500, err.Error())
+		return
+	}
+	Ok(c, map[string]interface{}{"enabled": h.mirror != nil, "interval": h.syncInterval.String(), "states": states})
+}
+
+// TriggerSync 立即触发一次后台同步，请求体 {full} 为真时同时全量对齐
+func (h *Handler) TriggerSync(c *app.RequestContext) {
+	if _, ok := h.ready(c); !ok {
+		return
+	}
+	if h.mirror == nil {
+		Err(c, 400, "gitlab sync is disabled")
+		return
+	}
+	var in struct {
+		Full bool `json:"full"`
+	}
+	_ = c.Bind(&in)
+	h.wakeSync(in.Full)
+	c.JSON(202, map[string]interface{}{"code": 0, "message": "ok", "data": map[string]interface{}{"queued": true, "full": in.Full}})
+}
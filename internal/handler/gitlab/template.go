@@ -71,6 +71,14 @@ func GetJobListTemplate() string {
             background-color: #fff3cd;
             color: #856404;
         }
+        .status-canceled {
+            background-color: #e2e3e5;
+            color: #383d41;
+        }
+        .status-timed_out {
+            background-color: #f5c6cb;
+            color: #721c24;
+        }
         .commit-id {
             font-family: monospace;
             font-size: 12px;
@@ -119,6 +127,9 @@ func GetJobListTemplate() string {
         .tag-create { background:#e8f0fe; color:#1a73e8; border:1px solid #c6dcff; }
         .tag-merge { background:#fff4e5; color:#b4690e; border:1px solid #ffd8a8; }
         .tag-edit { background:#f1f3f4; color:#5f6368; border:1px solid #e0e0e0; }
+        .log-viewer { display:none; margin-top: 12px; border: 1px solid #ddd; border-radius: 6px; }
+        .log-viewer-header { display:flex; align-items:center; gap: 10px; padding: 8px 12px; background:#f8f9fa; border-bottom:1px solid #ddd; }
+        .log-viewer pre { margin:0; padding: 12px; max-height: 480px; overflow:auto; background:#1e1e1e; color:#d4d4d4; font-family: monospace; font-size: 12px; white-space: pre-wrap; word-break: break-all; }
     </style>
 </head>
 <body>
@@ -184,6 +195,8 @@ func GetJobListTemplate() string {
             <select id="authorFilter" onchange="filterJobs()"><option value="">所有提交作者</option></select>
             <input type="date" id="createdDate" onchange="filterJobs()" />
             <button onclick="refreshJobs()">刷新</button>
+            <span id="syncInfo" style="color:#666; font-size:12px;"></span>
+            <span id="rowErrors" style="color:#c0392b; font-size:12px;"></span>
         </div>
         
         <table id="jobsTable">
@@ -214,16 +227,48 @@ func GetJobListTemplate() string {
             <button class="btn btn-secondary" id="jumpBtn">跳转</button>
             <button class="btn btn-secondary" id="nextPageBtn">下一页</button>
         </div>
+
+        <h2 style="margin-top:32px; color:#333;">构建任务</h2>
+        <table id="localJobsTable">
+            <thead>
+                <tr>
+                    <th>ID</th>
+                    <th>状态</th>
+                    <th>名称</th>
+                    <th>触发用户</th>
+                    <th>提交ID</th>
+                    <th>创建时间</th>
+                    <th>操作</th>
+                </tr>
+            </thead>
+            <tbody id="localJobsTableBody"></tbody>
+        </table>
+        <div class="log-viewer" id="logViewer">
+            <div class="log-viewer-header">
+                <strong id="logViewerTitle"></strong>
+                <span class="status" id="logViewerStatus"></span>
+                <label><input type="checkbox" id="logAutoScroll" checked>自动滚动</label>
+                <button class="btn btn-secondary" onclick="closeLog()">关闭</button>
+            </div>
+            <pre id="logViewerBody"></pre>
+        </div>
     </div>
 
     <script>
         var currentPage = 1;
         var pageSize = 20;
         var totalPages = 1;
+        var totalItems = 0;
+        // 本地镜像提供的键集游标：按游标翻页时新流水线到来也不会错位；pageQuery 为当前页的查询，刷新时保持在当前页
+        var nextBeforeID = 0;
+        var prevAfterID = 0;
+        var hasNextPage = false;
+        var pageQuery = '';
         var jobsController = null;
         window.onload = function() {
             bindPager();
             loadJobs();
+            loadLocalJobs();
             loadBranches();
             loadEnvironments();
             var pfEl = document.getElementById('promotePrefix');
@@ -231,10 +276,12 @@ func GetJobListTemplate() string {
         };
 
         // 获取任务列表
-        function loadJobs() {
+        function loadJobs(query) {
+            if (query !== undefined) { pageQuery = query; }
+            if (!pageQuery) { pageQuery = 'page='+currentPage; }
             if (jobsController) { try { jobsController.abort(); } catch(e){} }
             jobsController = new AbortController();
-            fetch('/api/gitlab/jobs?page='+currentPage+'&per_page='+pageSize, { signal: jobsController.signal })
+            fetch('/api/gitlab/jobs?'+pageQuery+'&per_page='+pageSize, { signal: jobsController.signal })
                 .then(response => {
                     if (!response.ok) {
                         throw new Error('Network response was not ok: ' + response.status);
@@ -249,12 +296,22 @@ func GetJobListTemplate() string {
                         if (Array.isArray(payload)) {
                             items = payload;
                             totalPages = 1;
+                            totalItems = items.length;
+                            nextBeforeID = prevAfterID = 0;
+                            hasNextPage = false;
                         } else {
                             items = (payload && payload.items) || [];
                             var pg = (payload && payload.pagination) || {};
-                            totalPages = pg.total_pages || 1;
+                            // total_pages 为 0 表示 GitLab 未返回总数
+                            totalPages = pg.total_pages || 0;
+                            totalItems = pg.total_items || 0;
                             currentPage = pg.current_page || currentPage;
+                            nextBeforeID = pg.next_before_id || 0;
+                            prevAfterID = pg.prev_after_id || 0;
+                            hasNextPage = !!(pg.next_page || nextBeforeID);
                         }
+                        updateSyncInfo(payload && payload.last_synced);
+                        updateRowErrors(payload && payload.errors);
                         renderJobs(items);
                     } else {
                         console.error('获取任务列表失败:', data.message);
@@ -353,21 +410,100 @@ func GetJobListTemplate() string {
         }
 
         // 刷新任务列表
-        function refreshJobs() { loadJobs(); }
+        function refreshJobs() { loadJobs(); loadLocalJobs(); }
+
+        // 加载本地构建任务
+        function loadLocalJobs() {
+            fetch('/api/jobs').then(function(r){ return r.json(); }).then(function(d){
+                if(d.code!==0) return;
+                var items = (d.data&&d.data.items) || [];
+                var tbody = document.getElementById('localJobsTableBody');
+                tbody.innerHTML = '';
+                items.forEach(function(j){
+                    var row = document.createElement('tr');
+                    var name = j.name || (j.kind==='pipeline' ? 'pipeline' : '-');
+                    var status = j.status + (j.queue_position ? ' #'+j.queue_position : '');
+                    row.innerHTML = '<td>'+j.id+'</td>'
+                        + '<td><span class="status status-'+j.status+'">'+status+'</span></td>'
+                        + '<td>'+name+'</td>'
+                        + '<td>'+(j.trigger_user||'')+'</td>'
+                        + '<td class="commit-id">'+(j.commit_id ? j.commit_id.substring(0, 8) : '')+'</td>'
+                        + '<td>'+(j.created_at||'')+'</td>'
+                        + '<td class="actions"><button class="btn btn-primary" onclick="openLog('+j.id+')">日志</button></td>';
+                    tbody.appendChild(row);
+                });
+            }).catch(function(e){ console.error('加载构建任务失败', e); });
+        }
+
+        // 日志查看：通过 SSE 实时追加日志，断线重连时浏览器携带 Last-Event-ID 从断点续传
+        var logSource = null;
+        function openLog(id) {
+            closeLog();
+            var body = document.getElementById('logViewerBody');
+            var statusEl = document.getElementById('logViewerStatus');
+            body.textContent = '';
+            statusEl.textContent = '';
+            document.getElementById('logViewerTitle').textContent = '任务 #'+id+' 日志';
+            document.getElementById('logViewer').style.display = 'block';
+            logSource = new EventSource('/api/jobs/'+id+'/log/stream');
+            logSource.addEventListener('log', function(e){
+                var d = JSON.parse(e.data);
+                body.textContent += d.text;
+                if(document.getElementById('logAutoScroll').checked){ body.scrollTop = body.scrollHeight; }
+            });
+            logSource.addEventListener('status', function(e){
+                var d = JSON.parse(e.data);
+                statusEl.textContent = d.status;
+                statusEl.className = 'status status-'+d.status;
+            });
+            logSource.addEventListener('end', function(){
+                closeLog(true);
+                loadLocalJobs();
+            });
+        }
+
+        function closeLog(keepVisible) {
+            if(logSource){ logSource.close(); logSource = null; }
+            if(!keepVisible){ document.getElementById('logViewer').style.display = 'none'; }
+        }
+
+        // 显示本地镜像最近一次同步时间，直接查询 GitLab 时显示为实时数据
+        function updateSyncInfo(lastSynced){
+            var el = document.getElementById('syncInfo');
+            if(!el) return;
+            el.textContent = lastSynced ? ('最后同步：' + new Date(lastSynced).toLocaleString('zh-CN', { hour12:false })) : '实时数据';
+        }
+
+        // 显示获取详情失败的流水线：这些行只有列表中的字段，悬停查看原因
+        function updateRowErrors(errors){
+            var el = document.getElementById('rowErrors');
+            if(!el) return;
+            errors = errors || [];
+            var ids = [];
+            errors.forEach(function(e){ if(ids.indexOf(e.pipeline_id)<0){ ids.push(e.pipeline_id); } });
+            el.textContent = ids.length ? ('⚠ ' + ids.length + ' 条流水线信息不完整：#' + ids.join(', #')) : '';
+            el.title = errors.map(function(e){ return '#' + e.pipeline_id + ' ' + e.message; }).join('\n');
+        }
 
         function bindPager(){
-            document.getElementById('prevPageBtn').onclick=function(){ if(currentPage>1){ currentPage--; loadJobs(); } };
-            document.getElementById('nextPageBtn').onclick=function(){ if(currentPage<totalPages){ currentPage++; loadJobs(); } };
-            document.getElementById('jumpBtn').onclick=function(){ var v=parseInt(document.getElementById('jumpInput').value,10); if(!isNaN(v)&&v>=1&&v<=totalPages){ currentPage=v; loadJobs(); } };
+            document.getElementById('prevPageBtn').onclick=function(){
+                if(prevAfterID){ loadJobs('after_id='+prevAfterID); }
+                else if(currentPage>1){ currentPage--; loadJobs('page='+currentPage); }
+            };
+            document.getElementById('nextPageBtn').onclick=function(){
+                if(nextBeforeID){ loadJobs('before_id='+nextBeforeID); }
+                else if(hasNextPage){ currentPage++; loadJobs('page='+currentPage); }
+            };
+            document.getElementById('jumpBtn').onclick=function(){ var v=parseInt(document.getElementById('jumpInput').value,10); if(!isNaN(v)&&v>=1&&(!totalPages||v<=totalPages)){ currentPage=v; loadJobs('page='+v); } };
         }
 
         function updatePager(returnedCount){
             var info=document.getElementById('pageInfo');
-            info.textContent='第 '+currentPage+' / 共 '+totalPages+' 页';
+            info.textContent = totalPages ? ('第 '+currentPage+' / 共 '+totalPages+' 页，'+totalItems+' 条') : ('第 '+currentPage+' 页');
             var prev=document.getElementById('prevPageBtn');
             var next=document.getElementById('nextPageBtn');
-            prev.disabled = currentPage<=1;
-            next.disabled = currentPage>=totalPages || returnedCount===0;
+            prev.disabled = !prevAfterID && currentPage<=1;
+            next.disabled = !hasNextPage || returnedCount===0;
         }
 
         function loadBranches(){
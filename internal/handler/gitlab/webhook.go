@@ -0,0 +1,44 @@
+package gitlab
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/logic/gitlab"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// Webhook 接收 GitLab webhook
+// 以请求头 X-Gitlab-Token 校验后保存 push、merge_request、pipeline 与 job 事件并唤醒后台同步；其它事件类型忽略并返回成功，避免 GitLab 重试
+func (h *Handler) Webhook(c *app.RequestContext) {
+	if h.webhookSecret == "" {
+		Err(c, 503, "gitlab webhook is not configured")
+		return
+	}
+	token := c.GetHeader("X-Gitlab-Token")
+	if subtle.ConstantTimeCompare(token, []byte(h.webhookSecret)) != 1 {
+		Err(c, 401, "invalid webhook token")
+		return
+	}
+	kind := string(c.GetHeader("X-Gitlab-Event"))
+	e, duplicate, err := h.events.Ingest(kind, string(c.GetHeader("X-Gitlab-Event-UUID")), c.Request.Body())
+	if errors.Is(err, gitlab.ErrUnsupportedEvent) {
+		Ok(c, map[string]interface{}{"ignored": true, "event": kind})
+		return
+	}
+	if err != nil {
+		Err(c, 400, err.Error())
+		return
+	}
+	if !duplicate {
+		if l := h.current(); l != nil && e.Kind == model.GitLabEventPipeline {
+			l.ForgetPipeline(int(e.PipelineID))
+		}
+		// GitLab 上有变化，立即增量同步本地镜像
+		h.wakeSync(false)
+	}
+	log.Printf("gitlab webhook: %s event %d on %s@%.8s (duplicate=%v)", e.Kind, e.ID, e.Ref, e.SHA, duplicate)
+	Ok(c, map[string]interface{}{"id": e.ID, "kind": e.Kind, "duplicate": duplicate})
+}
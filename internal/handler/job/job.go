@@ -1,22 +1,28 @@
 package job
 
 import (
+	"errors"
 	"strconv"
 	"webci-refactored/internal/logic/job"
+	"webci-refactored/internal/middleware"
+	"webci-refactored/internal/pipeline"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"gorm.io/gorm"
 )
 
+// maxLogPage 分页读取日志时单页的最大字节数
+const maxLogPage = 1 << 20
+
 // Handler 任务处理层
 type Handler struct {
 	logic *job.Logic
 }
 
 // NewHandler 创建任务处理层实例
-func NewHandler(db *gorm.DB) *Handler {
+func NewHandler(db *gorm.DB, repoPath string) *Handler {
 	return &Handler{
-		logic: job.NewLogic(db),
+		logic: job.NewLogic(db, repoPath),
 	}
 }
 
@@ -37,26 +43,152 @@ func parseID(c *app.RequestContext) uint64 {
 	return id
 }
 
+// errStatus 按错误类型返回状态码：非法状态转换或不可重试 409，未定义状态 400，任务不存在 404
+func errStatus(c *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, job.ErrIllegalTransition), errors.Is(err, job.ErrNotRetryable),
+		errors.Is(err, job.ErrNotWaiting), errors.Is(err, job.ErrAlreadyDecided):
+		Err(c, 409, err.Error())
+	case errors.Is(err, job.ErrDeployBlocked), errors.Is(err, job.ErrApproverNotAllowed):
+		Err(c, 403, err.Error())
+	case errors.Is(err, job.ErrUnknownStatus):
+		Err(c, 400, err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		Err(c, 404, err.Error())
+	default:
+		Err(c, 500, err.Error())
+	}
+}
+
 // Create 创建任务
 func (h *Handler) Create(c *app.RequestContext) {
 	var in struct {
-		BranchID    uint64 `json:"branch_id"`
-		EnvID       uint64 `json:"env_id"`
-		TriggerUser string `json:"trigger_user"`
+		BranchID  uint64   `json:"branch_id"`
+		EnvID     uint64   `json:"env_id"`
+		Steps     []string `json:"steps"`
+		Artifacts []string `json:"artifacts"`
+		// 任务超时（秒）：0 表示使用环境或服务默认值
+		TimeoutSeconds int `json:"timeout_seconds"`
+		// 任务变量：secret 为 true 的变量加密存储，日志与响应中以掩码显示
+		Variables []struct {
+			Key    string `json:"key"`
+			Value  string `json:"value"`
+			Secret bool   `json:"secret"`
+		} `json:"variables"`
+		Retry struct {
+			Max  int      `json:"max"`
+			When []string `json:"when"`
+		} `json:"retry"`
+		// 冻结覆盖原因：环境处于冻结窗口时，管理员给出原因方可部署
+		FreezeOverride string `json:"freeze_override"`
 	}
 	// 绑定请求体并校验必要字段
 	if err := c.Bind(&in); err != nil {
 		Err(c, 400, err.Error())
 		return
 	}
-	j, err := h.logic.Create(in.BranchID, in.EnvID, in.TriggerUser)
+	vars := make([]job.Variable, 0, len(in.Variables))
+	for _, v := range in.Variables {
+		vars = append(vars, job.Variable{Key: v.Key, Value: v.Value, Secret: v.Secret})
+	}
+	// 触发用户取自认证身份
+	j, err := h.logic.Create(in.BranchID, in.EnvID, middleware.Username(c), in.Steps, job.JobOptions{
+		Artifacts:      in.Artifacts,
+		TimeoutSeconds: in.TimeoutSeconds,
+		Variables:      vars,
+		Retry:          pipeline.Retry{Max: in.Retry.Max, When: in.Retry.When},
+		FreezeOverride: in.FreezeOverride,
+	})
 	if err != nil {
+		// 环境保护规则拒绝返回 403，其余为请求参数问题
+		if errors.Is(err, job.ErrDeployBlocked) {
+			Err(c, 403, err.Error())
+			return
+		}
 		Err(c, 400, err.Error())
 		return
 	}
 	Ok(c, j)
 }
 
+// Retry 重试已结束的任务
+// 触发用户为当前身份；请求体可选：freeze_override 为管理员覆盖冻结窗口的原因
+func (h *Handler) Retry(c *app.RequestContext) {
+	var in struct {
+		FreezeOverride string `json:"freeze_override"`
+	}
+	if len(c.Request.Body()) > 0 {
+		if err := c.Bind(&in); err != nil {
+			Err(c, 400, err.Error())
+			return
+		}
+	}
+	j, err := h.logic.Retry(parseID(c), middleware.Username(c), in.FreezeOverride)
+	if err != nil {
+		errStatus(c, err)
+		return
+	}
+	Ok(c, j)
+}
+
+// decision 审批请求体
+type decision struct {
+	Comment string `json:"comment"`
+}
+
+// bindDecision 绑定审批请求体，请求体可省略
+func bindDecision(c *app.RequestContext) (*decision, bool) {
+	var in decision
+	if len(c.Request.Body()) == 0 {
+		return &in, true
+	}
+	if err := c.Bind(&in); err != nil {
+		Err(c, 400, err.Error())
+		return nil, false
+	}
+	return &in, true
+}
+
+// Approve 批准等待审批的部署任务
+// 审批人为当前身份；请求体可选 comment；批准数达到环境要求时任务放行
+func (h *Handler) Approve(c *app.RequestContext) {
+	in, ok := bindDecision(c)
+	if !ok {
+		return
+	}
+	j, err := h.logic.Approve(parseID(c), middleware.Username(c), in.Comment)
+	if err != nil {
+		errStatus(c, err)
+		return
+	}
+	Ok(c, j)
+}
+
+// Reject 拒绝等待审批的部署任务，任务转为 canceled
+// 审批人为当前身份；请求体可选 comment
+func (h *Handler) Reject(c *app.RequestContext) {
+	in, ok := bindDecision(c)
+	if !ok {
+		return
+	}
+	j, err := h.logic.Reject(parseID(c), middleware.Username(c), in.Comment)
+	if err != nil {
+		errStatus(c, err)
+		return
+	}
+	Ok(c, j)
+}
+
+// Approvals 查询任务的审批记录
+func (h *Handler) Approvals(c *app.RequestContext) {
+	items, err := h.logic.Approvals(parseID(c))
+	if err != nil {
+		errStatus(c, err)
+		return
+	}
+	Ok(c, items)
+}
+
 // List 查询任务
 func (h *Handler) List(c *app.RequestContext) {
 	var limit, offset = 50, 0
@@ -106,33 +238,70 @@ func (h *Handler) UpdateStatus(c *app.RequestContext) {
 		Err(c, 400, err.Error())
 		return
 	}
-	j, err := h.logic.UpdateStatus(id, in.Status, in.LogAppend)
+	j, err := h.logic.UpdateStatus(id, in.Status, in.LogAppend, middleware.Username(c))
 	if err != nil {
-		Err(c, 500, err.Error())
+		errStatus(c, err)
 		return
 	}
 	Ok(c, j)
 }
 
+// Events 查询任务状态变更事件
+func (h *Handler) Events(c *app.RequestContext) {
+	id := parseID(c)
+	items, err := h.logic.Events(id)
+	if err != nil {
+		Err(c, 404, err.Error())
+		return
+	}
+	Ok(c, map[string]interface{}{"items": items})
+}
+
 // Log 单独获取构建日志
+// 支持 offset/limit 按字节区间分页读取（limit 上限 1MiB），未传入时返回完整日志；
+// 响应头 X-Log-Size 为日志总字节数，X-Log-Next-Offset 为下一页的起始偏移
 func (h *Handler) Log(c *app.RequestContext) {
 	id := parseID(c)
-	log, err := h.logic.Log(id)
+	offset, limit := int64(0), int64(-1)
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			Err(c, 400, "invalid offset")
+			return
+		}
+		offset = n
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			Err(c, 400, "invalid limit")
+			return
+		}
+		if n > maxLogPage {
+			n = maxLogPage
+		}
+		limit = n
+	}
+	log, size, err := h.logic.Log(id, offset, limit)
 	if err != nil {
 		Err(c, 404, err.Error())
 		return
 	}
+	c.Response.Header.Set("X-Log-Size", strconv.FormatInt(size, 10))
+	c.Response.Header.Set("X-Log-Next-Offset", strconv.FormatInt(offset+int64(len(log)), 10))
 	// 直接返回纯文本日志，适配前端的 log 视图
-	c.String(200, log)
+	c.Data(200, "text/plain; charset=utf-8", log)
 }
 
 // Cancel 取消任务
 func (h *Handler) Cancel(c *app.RequestContext) {
 	id := parseID(c)
-	// 标记取消供执行器识别
-	if err := h.logic.Cancel(id); err != nil {
-		Err(c, 500, err.Error())
+	// 排队中的任务立即取消，执行中的任务中止进程
+	if err := h.logic.Cancel(id, middleware.Username(c)); err != nil {
+		errStatus(c, err)
 		return
 	}
 	Ok(c, "cancelled")
 }
+
+func (h *Handler) UpdateRepoPath(path string) { h.logic.UpdateRepoPath(path) }
@@ -0,0 +1,128 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/cloudwego/hertz/pkg/protocol/http1/resp"
+)
+
+const (
+	// streamPollInterval 轮询兜底间隔：覆盖其他实例写入、本进程收不到通知的日志
+	streamPollInterval = time.Second
+	// streamKeepAlive 无新日志时发送注释行保活，避免代理断开空闲连接
+	streamKeepAlive = 15 * time.Second
+	// streamEndGrace 任务进入终态后等待结束日志写完的最长时间
+	streamEndGrace = 2 * time.Second
+)
+
+// StreamLog 以 SSE 实时推送任务日志
+// 从 offset（或 EventSource 重连时的 Last-Event-ID）指定的字节偏移开始，推送新增日志与状态变化，
+// 任务结束后发送 end 事件并关闭连接；ctx 取消（客户端断开）或写出失败时立即停止。事件：
+//   - log：id 为下次续传的偏移，data 为 {"offset","text"}
+//   - status：data 为 {"status"}
+//   - end：data 为 {"offset","status"}
+func (h *Handler) StreamLog(ctx context.Context, c *app.RequestContext) {
+	id := parseID(c)
+	offset := int64(0)
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			Err(c, 400, "invalid offset")
+			return
+		}
+		offset = n
+	}
+	if v := string(c.GetHeader("Last-Event-ID")); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+			offset = n
+		}
+	}
+	tail, err := h.logic.TailLog(id, offset)
+	if err != nil {
+		Err(c, 404, err.Error())
+		return
+	}
+	notify, stop := h.logic.WatchLog(id)
+	defer stop()
+
+	c.SetStatusCode(200)
+	c.Response.Header.Set("Content-Type", "text/event-stream; charset=utf-8")
+	c.Response.Header.Set("Cache-Control", "no-cache")
+	c.Response.Header.Set("X-Accel-Buffering", "no")
+	w := resp.NewChunkedBodyWriter(&c.Response, c.GetWriter())
+	c.Response.HijackWriter(w)
+
+	poll := time.NewTicker(streamPollInterval)
+	defer poll.Stop()
+	lastWrite := time.Now()
+	var terminalAt time.Time
+	status := ""
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		if tail.Text != "" {
+			if writeEvent(w, "log", strconv.FormatInt(tail.Offset, 10), map[string]interface{}{"offset": tail.Offset, "text": tail.Text}) != nil {
+				return
+			}
+			lastWrite = time.Now()
+		}
+		if tail.Status != status {
+			status = tail.Status
+			if writeEvent(w, "status", "", map[string]interface{}{"status": status}) != nil {
+				return
+			}
+			lastWrite = time.Now()
+		}
+		if tail.Terminal && terminalAt.IsZero() {
+			terminalAt = time.Now()
+		}
+		// 终态且结束时间已写入说明日志已完整；超过宽限期仍未写入时同样结束，避免连接悬挂
+		if tail.Done || (!terminalAt.IsZero() && time.Since(terminalAt) >= streamEndGrace) {
+			_ = writeEvent(w, "end", "", map[string]interface{}{"offset": tail.Offset, "status": status})
+			return
+		}
+		// 还有未读完的日志时直接读取下一段，否则等待变更通知或轮询
+		if !tail.More {
+			if time.Since(lastWrite) >= streamKeepAlive {
+				if _, err := w.Write([]byte(": ping\n\n")); err != nil || w.Flush() != nil {
+					return
+				}
+				lastWrite = time.Now()
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-notify:
+			case <-poll.C:
+			}
+		}
+		if tail, err = h.logic.TailLog(id, tail.Offset); err != nil {
+			_ = writeEvent(w, "error", "", map[string]interface{}{"message": err.Error()})
+			return
+		}
+	}
+}
+
+// writeEvent 写出一条 SSE 事件并立即刷新
+func writeEvent(w network.ExtWriter, event, id string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("event: %s\n", event)
+	if id != "" {
+		msg += "id: " + id + "\n"
+	}
+	msg += "data: " + string(payload) + "\n\n"
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	return w.Flush()
+}
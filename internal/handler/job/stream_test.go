@@ -0,0 +1,171 @@
+package job
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"webci-refactored/internal/dal"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sseEvent 解析出的一条 SSE 事件
+type sseEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+// startStreamServer 启动只挂载日志流接口的服务，返回服务地址与执行中的任务
+// wrap 可替换处理器收到的 context，用于模拟请求取消
+func startStreamServer(t *testing.T, wrap func(context.Context) context.Context) (string, *gorm.DB, *model.Job) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	j := &model.Job{Kind: model.JobKindJob, Status: model.JobStatusRunning, TriggerUser: "alice", StartTime: &now}
+	if err := db.Create(j).Error; err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	hd := NewHandler(db, "")
+	h := server.New(server.WithHostPorts(addr), server.WithExitWaitTime(0))
+	h.GET("/jobs/:id/log/stream", func(c context.Context, ctx *app.RequestContext) {
+		if wrap != nil {
+			c = wrap(c)
+		}
+		hd.StreamLog(c, ctx)
+	})
+	go h.Run()
+	t.Cleanup(func() { _ = h.Shutdown(context.Background()) })
+	for i := 0; !h.IsRunning(); i++ {
+		if i > 100 {
+			t.Fatal("server did not start")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return "http://" + addr, db, j
+}
+
+// readEvents 逐条读取 SSE 事件并发送到返回的通道，连接结束时关闭通道
+func readEvents(t *testing.T, url string) <-chan sseEvent {
+	// 不复用连接：服务关闭时无需等待空闲连接超时
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	res, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	ch := make(chan sseEvent, 16)
+	go func() {
+		defer close(ch)
+		sc := bufio.NewScanner(res.Body)
+		var ev sseEvent
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				ev.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.data)
+			case line == "" && ev.name != "":
+				ch <- ev
+				ev = sseEvent{}
+			}
+		}
+	}()
+	return ch
+}
+
+// next 等待下一条事件，超时或连接结束时失败
+func next(t *testing.T, ch <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-ch:
+		if !ok {
+			t.Fatal("stream closed early")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return sseEvent{}
+}
+
+func TestStreamLogFollowsRunningJob(t *testing.T) {
+	base, db, j := startStreamServer(t, nil)
+	jobs := repository.NewJobRepository(db)
+	if err := jobs.AppendLog(j.ID, "step 1\n"); err != nil {
+		t.Fatal(err)
+	}
+	ch := readEvents(t, fmt.Sprintf("%s/jobs/%d/log/stream", base, j.ID))
+
+	expect := func(name, key, value string) {
+		t.Helper()
+		ev := next(t, ch)
+		if ev.name != name || fmt.Sprint(ev.data[key]) != value {
+			t.Fatalf("expected %s %s=%q, got %s %v", name, key, value, ev.name, ev.data)
+		}
+	}
+	expect("log", "text", "step 1\n")
+	expect("status", "status", model.JobStatusRunning)
+	for _, chunk := range []string{"step 2\n", "step 3\n"} {
+		if err := jobs.AppendLog(j.ID, chunk); err != nil {
+			t.Fatal(err)
+		}
+		expect("log", "text", chunk)
+	}
+	end := time.Now()
+	if err := jobs.UpdateTimes(j.ID, nil, &end); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := jobs.TransitionStatus(j.ID, model.JobStatusRunning, model.JobStatusSuccess, "system", ""); !ok || err != nil {
+		t.Fatalf("transition failed: %v %v", ok, err)
+	}
+	expect("status", "status", model.JobStatusSuccess)
+	expect("end", "status", model.JobStatusSuccess)
+	if _, ok := <-ch; ok {
+		t.Fatal("stream should close after the end event")
+	}
+}
+
+func TestStreamLogStopsOnContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	base, _, j := startStreamServer(t, func(context.Context) context.Context { return ctx })
+	ch := readEvents(t, fmt.Sprintf("%s/jobs/%d/log/stream", base, j.ID))
+	if ev := next(t, ch); ev.name != "status" {
+		t.Fatalf("expected initial status event, got %s", ev.name)
+	}
+	// 任务仍在执行：只有请求取消能结束连接
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("no events expected after cancellation")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("stream did not stop after the request context was canceled")
+	}
+}
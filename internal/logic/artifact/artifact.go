@@ -0,0 +1,79 @@
+package artifact
+
+import (
+	"archive/zip"
+	"io"
+	"webci-refactored/internal/config"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+	"webci-refactored/internal/service/artifact"
+	"webci-refactored/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// ErrExpired 产物已过期：供处理层映射 HTTP 状态码
+var ErrExpired = artifact.ErrExpired
+
+// Logic 产物业务逻辑
+type Logic struct {
+	db   *gorm.DB
+	svc  *artifact.Service
+	jobs *repository.JobRepository
+}
+
+// NewLogic 创建产物业务逻辑实例，产物存放在 cfg.ArtifactDir 下的本地存储
+func NewLogic(db *gorm.DB, cfg config.Config) *Logic {
+	return &Logic{
+		db:   db,
+		svc:  artifact.NewService(db, storage.NewLocal(cfg.ArtifactDir), cfg.ArtifactMaxSize, cfg.ArtifactExpireIn),
+		jobs: repository.NewJobRepository(db),
+	}
+}
+
+// List 查询任务未过期的产物
+func (l *Logic) List(jobID uint64) ([]model.Artifact, error) {
+	if _, err := l.jobs.Get(jobID); err != nil {
+		return nil, err
+	}
+	return l.svc.List(jobID)
+}
+
+// Open 打开任务下的单个产物，调用方负责关闭返回的读取器
+func (l *Logic) Open(jobID, id uint64) (*model.Artifact, io.ReadCloser, error) {
+	a, err := l.svc.Get(jobID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	rc, err := l.svc.Open(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, rc, nil
+}
+
+// WriteZip 将产物按原相对路径打包为 zip 写入 w
+func (l *Logic) WriteZip(w io.Writer, items []model.Artifact) error {
+	zw := zip.NewWriter(w)
+	for i := range items {
+		if err := l.addToZip(zw, &items[i]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// addToZip 写入单个 zip 条目
+func (l *Logic) addToZip(zw *zip.Writer, a *model.Artifact) error {
+	rc, err := l.svc.Open(a)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: a.Path, Method: zip.Deflate, Modified: a.CreatedAt})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, rc)
+	return err
+}
@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"io"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/service/audit"
+
+	"gorm.io/gorm"
+)
+
+// Logic 审计业务逻辑
+type Logic struct {
+	svc *audit.Service
+}
+
+// NewLogic 创建审计业务逻辑实例
+func NewLogic(db *gorm.DB) *Logic {
+	return &Logic{svc: audit.NewService(db)}
+}
+
+// Filter 审计事件查询条件
+type Filter = audit.Filter
+
+// Describe 生成操作对象与脱敏的请求摘要
+func Describe(path, query string, body []byte) (string, string) {
+	return audit.Describe(path, query, body)
+}
+
+// Record 写入审计事件
+func (l *Logic) Record(e *model.AuditEvent) error { return l.svc.Record(e) }
+
+// List 按条件分页查询审计事件
+func (l *Logic) List(f Filter, limit, offset int) ([]model.AuditEvent, int64, error) {
+	return l.svc.List(f, limit, offset)
+}
+
+// Export 按条件以 CSV 导出审计事件
+func (l *Logic) Export(w io.Writer, f Filter) error { return l.svc.Export(w, f) }
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"time"
+	"webci-refactored/internal/config"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/service/auth"
+
+	"gorm.io/gorm"
+)
+
+// Logic 认证业务逻辑
+type Logic struct {
+	svc    *auth.Service
+	gitlab *auth.GitLabOAuth
+}
+
+// NewLogic 创建认证业务逻辑实例
+// 配置了 GitLab 应用时启用 GitLab 单点登录，配置不完整时仅告警并关闭
+func NewLogic(db *gorm.DB, cfg config.Config) *Logic {
+	o, err := auth.NewGitLabOAuth(cfg)
+	if err != nil {
+		log.Printf("Warning: gitlab sso disabled: %v", err)
+	}
+	return &Logic{svc: auth.NewService(db), gitlab: o}
+}
+
+// 认证错误：供处理层映射 HTTP 状态码
+var (
+	ErrInvalidCredentials = auth.ErrInvalidCredentials
+	ErrInvalidToken       = auth.ErrInvalidToken
+	ErrUserExists         = auth.ErrUserExists
+	ErrAccountConflict    = auth.ErrAccountConflict
+	ErrLinkRequired       = auth.ErrLinkRequired
+)
+
+// SessionTTL 登录会话有效期
+const SessionTTL = auth.SessionTTL
+
+// UserUpdate 用户的部分更新
+type UserUpdate = auth.UserUpdate
+
+// HasRole 判断角色 have 是否拥有角色 need 的权限
+func HasRole(have, need string) bool { return auth.HasRole(have, need) }
+
+// Login 密码登录，返回会话令牌与用户
+func (l *Logic) Login(username, password string) (string, *model.User, error) {
+	return l.svc.Login(username, password)
+}
+
+// Logout 吊销当前会话或令牌
+func (l *Logic) Logout(token string) error { return l.svc.Logout(token) }
+
+// ChangePassword 修改当前用户的密码
+func (l *Logic) ChangePassword(userID uint64, oldPassword, newPassword string) error {
+	return l.svc.ChangePassword(userID, oldPassword, newPassword)
+}
+
+// Authenticate 校验令牌，返回令牌所属的用户
+func (l *Logic) Authenticate(token string) (*model.User, error) { return l.svc.Authenticate(token) }
+
+// ListTokens 查询用户的个人 API 令牌
+func (l *Logic) ListTokens(userID uint64) ([]model.APIToken, error) { return l.svc.ListTokens(userID) }
+
+// CreateToken 创建个人 API 令牌，返回令牌明文（仅此一次）与记录
+func (l *Logic) CreateToken(userID uint64, name string, expiresAt *time.Time) (string, *model.APIToken, error) {
+	return l.svc.CreateToken(userID, name, expiresAt)
+}
+
+// RevokeToken 吊销个人 API 令牌，返回是否存在
+func (l *Logic) RevokeToken(userID, id uint64) (bool, error) { return l.svc.RevokeToken(userID, id) }
+
+// ListUsers 列出全部用户
+func (l *Logic) ListUsers() ([]model.User, error) { return l.svc.ListUsers() }
+
+// CreateUser 创建本地用户
+func (l *Logic) CreateUser(username, password, role string) (*model.User, error) {
+	return l.svc.CreateUser(username, password, role)
+}
+
+// UpdateUser 更新用户角色、密码或禁用状态
+func (l *Logic) UpdateUser(id uint64, in UserUpdate) (*model.User, error) {
+	return l.svc.UpdateUser(id, in)
+}
+
+// GitLabEnabled 是否启用 GitLab 单点登录
+func (l *Logic) GitLabEnabled() bool { return l.gitlab != nil }
+
+// GitLabUserTokens 是否以用户自己的 GitLab 令牌执行写操作
+func (l *Logic) GitLabUserTokens() bool { return l.gitlab != nil && l.gitlab.UserToken() }
+
+// GitLabAuthURL 返回 GitLab 授权页地址
+func (l *Logic) GitLabAuthURL(state string) string { return l.gitlab.AuthCodeURL(state) }
+
+// LoginWithGitLab 以 GitLab 授权码登录，返回会话令牌与用户
+func (l *Logic) LoginWithGitLab(ctx context.Context, code string) (string, *model.User, error) {
+	return l.svc.LoginWithGitLab(ctx, l.gitlab, code)
+}
+
+// CheckPassword 校验用户的本地密码
+func (l *Logic) CheckPassword(userID uint64, password string) error {
+	return l.svc.CheckPassword(userID, password)
+}
+
+// LinkGitLab 将本地用户关联到授权码对应的 GitLab 账号
+func (l *Logic) LinkGitLab(ctx context.Context, code string, userID uint64) (*model.User, error) {
+	return l.svc.LinkGitLab(ctx, l.gitlab, code, userID)
+}
+
+// GitLabToken 返回用户保存的 GitLab 访问令牌，用户未关联 GitLab 时返回空
+func (l *Logic) GitLabToken(ctx context.Context, username string) (string, error) {
+	return l.svc.GitLabToken(ctx, l.gitlab, username)
+}
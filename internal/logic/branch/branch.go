@@ -3,16 +3,22 @@ package branch
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"time"
 	"webci-refactored/internal/dal/model"
 	"webci-refactored/internal/dal/repository"
 	"webci-refactored/internal/queue"
 	"webci-refactored/internal/service/branch"
+	"webci-refactored/internal/service/environment"
 	"webci-refactored/internal/service/job"
 
 	"gorm.io/gorm"
 )
 
+// ErrDeployBlocked 环境保护规则禁止本次部署：供处理层映射 HTTP 状态码
+var ErrDeployBlocked = environment.ErrDeployBlocked
+
 // Logic 分支业务逻辑
 type Logic struct {
 	db       *gorm.DB
@@ -93,14 +99,25 @@ func (l *Logic) Refresh(id uint64) (*model.Branch, error) {
 }
 
 // MockPush 模拟一次用户推送：生成随机 commit，并可选触发 CI 任务
+// 指定环境时先校验部署准入，被禁止时不移动分支；创建任务失败时恢复分支原来的提交
 func (l *Logic) MockPush(id uint64, pusher string, envID *uint64, triggerUser, message string) (*model.Branch, *model.Job, error) {
 	b, err := l.branches.Get(id)
 	if err != nil {
 		return nil, nil, err
 	}
+	// 推送人缺省为触发用户
+	if pusher == "" {
+		pusher = triggerUser
+	}
 	if pusher == "" {
 		pusher = "demo"
 	}
+	if envID != nil {
+		if err := l.jobSvc.CheckDeploy(*envID, b.Name); err != nil {
+			return nil, nil, err
+		}
+	}
+	prev := *b
 	buf := make([]byte, 20)
 	if _, err := rand.Read(buf); err != nil {
 		return nil, nil, err
@@ -120,11 +137,13 @@ func (l *Logic) MockPush(id uint64, pusher string, envID *uint64, triggerUser, m
 		if user == "" {
 			user = pusher
 		}
-		j, err := l.jobSvc.Create(id, *envID, user)
+		j, err := l.submit(b, *envID, user)
 		if err != nil {
+			if rerr := l.branches.Update(&prev); rerr != nil {
+				return nil, nil, fmt.Errorf("%w (restore branch head: %v)", err, rerr)
+			}
 			return nil, nil, err
 		}
-		queue.Enqueue(j.ID)
 		if message != "" {
 			_ = l.jobSvc.AppendLog(j.ID, "[COMMIT] "+hash+" "+message+"\n")
 		} else {
@@ -135,6 +154,28 @@ func (l *Logic) MockPush(id uint64, pusher string, envID *uint64, triggerUser, m
 	return b, job, nil
 }
 
+// submit 为分支创建任务：分支提交中存在流水线定义文件时展开为流水线，否则创建单个任务
+func (l *Logic) submit(b *model.Branch, envID uint64, user string) (*model.Job, error) {
+	content, commit, err := l.svc.ReadPipelineFile(b)
+	if err == nil {
+		p, err := l.jobSvc.CreatePipeline(b, envID, user, commit, content, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		queue.Dispatch(p)
+		return p, nil
+	}
+	if !errors.Is(err, branch.ErrNoPipelineFile) {
+		return nil, err
+	}
+	j, err := l.jobSvc.Create(b.ID, envID, user, nil, job.JobOptions{})
+	if err != nil {
+		return nil, err
+	}
+	queue.Dispatch(j)
+	return j, nil
+}
+
 // Error 自定义错误类型
 type Error struct {
 	Message string
@@ -0,0 +1,108 @@
+package branch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"webci-refactored/internal/dal"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/pipeline"
+
+	"github.com/glebarez/sqlite"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB 为每个测试创建独立的内存 SQLite 并完成迁移
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// initRepo 在临时目录创建 Git 仓库，master 分支提交中包含给定的流水线定义文件
+func initRepo(t *testing.T, pipelineFile string) string {
+	t.Helper()
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, pipeline.FileName), []byte(pipelineFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add(pipeline.FileName); err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "ci", Email: "ci@example.com", When: time.Now()}
+	if _, err := w.Commit("init", &git.CommitOptions{Author: sig}); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestMockPushBlockedDeployKeepsBranchHead(t *testing.T) {
+	db := openTestDB(t)
+	env := &model.Environment{Name: "prod", DeployBranches: model.StringList{"main"}}
+	b := &model.Branch{Name: "feature/x", LastCommitID: "abc", LastPusher: "carol"}
+	for _, v := range []interface{}{env, b} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	l := NewLogic(db, "")
+	if _, _, err := l.MockPush(b.ID, "alice", &env.ID, "alice", ""); !errors.Is(err, ErrDeployBlocked) {
+		t.Fatalf("expected ErrDeployBlocked, got %v", err)
+	}
+	got, _ := l.branches.Get(b.ID)
+	if got.LastCommitID != "abc" || got.LastPusher != "carol" {
+		t.Fatalf("refused deploy must not move the branch: %+v", got)
+	}
+	var n int64
+	db.Model(&model.Job{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("refused deploy must not create jobs, got %d", n)
+	}
+}
+
+func TestMockPushPipelineFile(t *testing.T) {
+	db := openTestDB(t)
+	master := &model.Branch{Name: "master", LastCommitID: "abc"}
+	ghost := &model.Branch{Name: "ghost"}
+	for _, b := range []*model.Branch{master, ghost} {
+		if err := db.Create(b).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	l := NewLogic(db, initRepo(t, "build:\n  script: [make]\n  needs: [missing]\n"))
+	var noEnv uint64
+
+	// 分支只存在于数据库、不在 Git 仓库中时退回单个任务
+	_, j, err := l.MockPush(ghost.ID, "alice", &noEnv, "alice", "")
+	if err != nil || j == nil || j.Kind != model.JobKindJob {
+		t.Fatalf("missing ref should fall back to a single job: %+v %v", j, err)
+	}
+
+	// 流水线定义无效时返回校验错误，分支提交保持不变
+	var ve *pipeline.ValidationError
+	if _, _, err := l.MockPush(master.ID, "alice", &noEnv, "alice", ""); !errors.As(err, &ve) {
+		t.Fatalf("expected a pipeline validation error, got %v", err)
+	}
+	if got, _ := l.branches.Get(master.ID); got.LastCommitID != "abc" {
+		t.Fatalf("failed push must not move the branch: %+v", got)
+	}
+}
@@ -1,27 +1,44 @@
 package dashboard
 
 import (
+	"time"
 	"webci-refactored/internal/service/dashboard"
+	"webci-refactored/internal/service/environment"
 
 	"gorm.io/gorm"
 )
 
 // Logic 仪表盘业务逻辑
 type Logic struct {
-	svc *dashboard.Service
+	svc  *dashboard.Service
+	envs *environment.Service
 }
 
 // NewLogic 创建仪表盘业务逻辑实例
 func NewLogic(db *gorm.DB) *Logic {
 	return &Logic{
-		svc: dashboard.NewService(db),
+		svc:  dashboard.NewService(db),
+		envs: environment.NewService(db),
 	}
 }
 
 // Overview 总览统计
-func (l *Logic) Overview() (map[string]int64, error) {
-	// 返回各状态的数量与总数，便于页面总览展示
-	return l.svc.Overview()
+// 返回各状态的数量与总数，并在 active_freezes 中列出当前生效的部署冻结窗口
+func (l *Logic) Overview() (map[string]interface{}, error) {
+	counts, err := l.svc.Overview()
+	if err != nil {
+		return nil, err
+	}
+	freezes, err := l.envs.ActiveFreezes(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]interface{}, len(counts)+1)
+	for k, v := range counts {
+		res[k] = v
+	}
+	res["active_freezes"] = freezes
+	return res, nil
 }
 
 // BranchStats 分支维度统计
@@ -1,37 +1,77 @@
 package environment
 
 import (
+	"errors"
 	"webci-refactored/internal/dal/model"
 	"webci-refactored/internal/dal/repository"
+	"webci-refactored/internal/queue"
+	"webci-refactored/internal/service/deployment"
 	"webci-refactored/internal/service/environment"
+	"webci-refactored/internal/service/job"
+	"webci-refactored/internal/service/variable"
 
 	"gorm.io/gorm"
 )
 
 // Logic 环境业务逻辑
 type Logic struct {
-	db   *gorm.DB
-	svc  *environment.Service
-	envs *repository.EnvironmentRepository
+	db      *gorm.DB
+	svc     *environment.Service
+	vars    *variable.Service
+	deploys *deployment.Service
+	jobs    *job.Service
+	envs    *repository.EnvironmentRepository
 }
 
 // NewLogic 创建环境业务逻辑实例
-func NewLogic(db *gorm.DB) *Logic {
+func NewLogic(db *gorm.DB, repoPath string) *Logic {
 	return &Logic{
-		db:   db,
-		svc:  environment.NewService(db),
-		envs: repository.NewEnvironmentRepository(db),
+		db:      db,
+		svc:     environment.NewService(db),
+		vars:    variable.NewService(db),
+		deploys: deployment.NewService(db, repoPath),
+		jobs:    job.NewService(db),
+		envs:    repository.NewEnvironmentRepository(db),
 	}
 }
 
+func (l *Logic) UpdateRepoPath(path string) { l.deploys.SetRepoPath(path) }
+
+// Protection 环境保护规则
+type Protection struct {
+	// DeployBranches 允许部署的分支模式，为空表示不限制
+	DeployBranches []string
+	// RequiredApprovals 放行部署所需的审批人数，0 表示无需审批
+	RequiredApprovals int
+	// Approvers 有权审批的用户，为空表示除触发人外任何人
+	Approvers []string
+}
+
+// ProtectionUpdate 环境保护规则的部分更新，字段为空时保留原有设置
+type ProtectionUpdate struct {
+	DeployBranches    *[]string
+	RequiredApprovals *int
+	Approvers         *[]string
+}
+
 // List 列出环境
 func (l *Logic) List(limit, offset int) ([]model.Environment, int64, error) {
 	return l.envs.List(limit, offset)
 }
 
 // Create 创建环境
-func (l *Logic) Create(name, description string) (*model.Environment, error) {
-	e := &model.Environment{Name: name, Description: description}
+func (l *Logic) Create(name, description string, maxConcurrency, timeoutSeconds int, p Protection) (*model.Environment, error) {
+	if maxConcurrency < 0 {
+		return nil, errors.New("max_concurrency must not be negative")
+	}
+	if timeoutSeconds < 0 {
+		return nil, errors.New("timeout_seconds must not be negative")
+	}
+	e := &model.Environment{Name: name, Description: description, MaxConcurrency: maxConcurrency, TimeoutSeconds: timeoutSeconds,
+		DeployBranches: p.DeployBranches, RequiredApprovals: p.RequiredApprovals, Approvers: p.Approvers}
+	if err := environment.ValidateProtection(e); err != nil {
+		return nil, err
+	}
 	// 服务层校验名称非空与唯一；若存在返回现有记录实现幂等
 	if err := l.svc.Create(e); err != nil {
 		return nil, err
@@ -45,7 +85,14 @@ func (l *Logic) Get(id uint64) (*model.Environment, error) {
 }
 
 // Update 更新环境
-func (l *Logic) Update(id uint64, name, description string) (*model.Environment, error) {
+// maxConcurrency、timeoutSeconds 与保护规则字段为空时保留原有设置
+func (l *Logic) Update(id uint64, name, description string, maxConcurrency, timeoutSeconds *int, p ProtectionUpdate) (*model.Environment, error) {
+	if maxConcurrency != nil && *maxConcurrency < 0 {
+		return nil, errors.New("max_concurrency must not be negative")
+	}
+	if timeoutSeconds != nil && *timeoutSeconds < 0 {
+		return nil, errors.New("timeout_seconds must not be negative")
+	}
 	e, err := l.envs.Get(id)
 	if err != nil {
 		return nil, err
@@ -53,6 +100,24 @@ func (l *Logic) Update(id uint64, name, description string) (*model.Environment,
 	// 更新基本字段并持久化
 	e.Name = name
 	e.Description = description
+	if maxConcurrency != nil {
+		e.MaxConcurrency = *maxConcurrency
+	}
+	if timeoutSeconds != nil {
+		e.TimeoutSeconds = *timeoutSeconds
+	}
+	if p.DeployBranches != nil {
+		e.DeployBranches = *p.DeployBranches
+	}
+	if p.RequiredApprovals != nil {
+		e.RequiredApprovals = *p.RequiredApprovals
+	}
+	if p.Approvers != nil {
+		e.Approvers = *p.Approvers
+	}
+	if err := environment.ValidateProtection(e); err != nil {
+		return nil, err
+	}
 	if err := l.envs.Update(e); err != nil {
 		return nil, err
 	}
@@ -63,3 +128,116 @@ func (l *Logic) Update(id uint64, name, description string) (*model.Environment,
 func (l *Logic) Delete(id uint64) error {
 	return l.envs.Delete(id)
 }
+
+// ListVariables 查询环境变量，密文变量的值以掩码返回
+func (l *Logic) ListVariables(envID uint64) ([]model.Variable, error) {
+	return l.vars.ListEnvironment(envID)
+}
+
+// SetVariable 新增或覆盖环境变量，密文变量加密存储
+func (l *Logic) SetVariable(envID uint64, key, value string, secret bool) (*model.Variable, error) {
+	v := &model.Variable{Key: key, Value: value, Secret: secret}
+	if err := l.vars.SetEnvironment(envID, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// DeleteVariable 删除环境变量，变量不存在时返回 gorm.ErrRecordNotFound
+func (l *Logic) DeleteVariable(envID uint64, key string) error {
+	ok, err := l.vars.DeleteEnvironment(envID, key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Changes 两次部署之间的变更
+type Changes = deployment.Changes
+
+// 变更计算错误：供处理层映射 HTTP 状态码
+var (
+	ErrNoRepository    = deployment.ErrNoRepository
+	ErrNoCommit        = deployment.ErrNoCommit
+	ErrNoRef           = deployment.ErrNoRef
+	ErrUnknownRevision = deployment.ErrUnknownRevision
+)
+
+// 回滚错误：供处理层映射 HTTP 状态码
+var (
+	ErrDeployBlocked    = environment.ErrDeployBlocked
+	ErrDeployRunning    = deployment.ErrDeployRunning
+	ErrNoRollbackTarget = deployment.ErrNoRollbackTarget
+	ErrNotRollbackable  = deployment.ErrNotRollbackable
+)
+
+// ListDeployments 分页查询环境的部署历史，status 非空时按部署结果过滤（如 success 列出可回滚的版本）
+func (l *Logic) ListDeployments(envID uint64, status string, limit, offset int) ([]model.Deployment, int64, error) {
+	if _, err := l.envs.Get(envID); err != nil {
+		return nil, 0, err
+	}
+	return l.deploys.List(envID, status, limit, offset)
+}
+
+// DeploymentChanges 查询部署相对于上一次成功部署的变更
+func (l *Logic) DeploymentChanges(envID, id uint64) (*Changes, error) {
+	return l.deploys.Changes(envID, id)
+}
+
+// PendingChanges 查询 ref 相对于环境当前部署版本的变更，ref 为空时使用上次部署的分支
+func (l *Logic) PendingChanges(envID uint64, ref string) (*Changes, error) {
+	if _, err := l.envs.Get(envID); err != nil {
+		return nil, err
+	}
+	return l.deploys.Pending(envID, ref)
+}
+
+// Rollback 将环境回滚到历史成功部署 deploymentID（为 0 时回滚到上一个不同版本）
+// 复制该次部署的任务并固定提交后入队；环境中已有排队或执行中的部署时拒绝
+// 环境处于冻结窗口时需管理员给出覆盖原因 override
+func (l *Logic) Rollback(envID, deploymentID uint64, triggerUser, override string) (*model.Job, error) {
+	if _, err := l.envs.Get(envID); err != nil {
+		return nil, err
+	}
+	d, err := l.deploys.RollbackTarget(envID, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	j, err := l.jobs.Rollback(d, triggerUser, override)
+	if err != nil {
+		return nil, err
+	}
+	queue.Dispatch(j)
+	return j, nil
+}
+
+// ListFreezes 查询环境的冻结窗口
+func (l *Logic) ListFreezes(envID uint64) ([]model.FreezeWindow, error) {
+	if _, err := l.envs.Get(envID); err != nil {
+		return nil, err
+	}
+	return l.svc.ListFreezes(envID)
+}
+
+// FreezeInput 创建冻结窗口的参数：cron 表达式或日期区间，附时区与原因
+type FreezeInput = environment.FreezeInput
+
+// CreateFreeze 为环境创建冻结窗口，窗口期内的新部署被拒绝（管理员附原因覆盖除外）
+func (l *Logic) CreateFreeze(envID uint64, in FreezeInput) (*model.FreezeWindow, error) {
+	return l.svc.CreateFreeze(envID, in)
+}
+
+// DeleteFreeze 删除冻结窗口，不存在时返回 gorm.ErrRecordNotFound
+func (l *Logic) DeleteFreeze(envID, id uint64) error {
+	ok, err := l.svc.DeleteFreeze(envID, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
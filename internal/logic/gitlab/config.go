@@ -0,0 +1,69 @@
+package gitlab
+
+import (
+	"fmt"
+	"webci-refactored/internal/config"
+	svc "webci-refactored/internal/service/gitlab"
+
+	"github.com/go-git/go-git/v5"
+	"gorm.io/gorm"
+)
+
+// ConfigStore GitLab 配置持久化
+type ConfigStore = svc.ConfigStore
+
+// NewConfigStore 创建 GitLab 配置持久化实例
+func NewConfigStore(db *gorm.DB) *ConfigStore { return svc.NewConfigStore(db) }
+
+// EventStore GitLab webhook 事件存储
+type EventStore = svc.EventStore
+
+// ErrUnsupportedEvent 不处理的 webhook 事件类型
+var ErrUnsupportedEvent = svc.ErrUnsupportedEvent
+
+// NewEventStore 创建 GitLab webhook 事件存储实例
+func NewEventStore(db *gorm.DB) *EventStore { return svc.NewEventStore(db) }
+
+// Classifier 流水线任务类型判别
+type Classifier = svc.Classifier
+
+// ErrInvalidTaskType 不支持的任务类型
+var ErrInvalidTaskType = svc.ErrInvalidTaskType
+
+// NewClassifier 创建任务类型判别实例
+func NewClassifier(db *gorm.DB, events *EventStore) *Classifier { return svc.NewClassifier(db, events) }
+
+// Mirror GitLab 本地镜像
+type Mirror = svc.Mirror
+
+// SyncReport 一次同步的结果
+type SyncReport = svc.SyncReport
+
+// PipelineCursor 流水线键集分页游标
+type PipelineCursor = svc.PipelineCursor
+
+// NewMirror 创建 GitLab 本地镜像实例
+func NewMirror(db *gorm.DB) *Mirror { return svc.NewMirror(db) }
+
+// Connect 以配置创建业务逻辑并向 GitLab 发起一次项目查询，校验通过才返回
+func Connect(cfg config.Config, classifier *Classifier, mirror *Mirror) (*Logic, error) {
+	l, err := NewLogic(cfg, classifier, mirror)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.service.CheckProject(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// ValidateRepoPath 校验本地仓库路径是 Git 仓库，空路径表示不使用本地仓库
+func ValidateRepoPath(path string) error {
+	if path == "" {
+		return nil
+	}
+	if _, err := git.PlainOpen(path); err != nil {
+		return fmt.Errorf("repo_path %s is not a git repository: %v", path, err)
+	}
+	return nil
+}
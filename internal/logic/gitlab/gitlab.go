@@ -1,12 +1,13 @@
 package gitlab
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"sort"
 	"sync"
 	"time"
 	"webci-refactored/internal/config"
+	"webci-refactored/internal/dal/model"
 	svc "webci-refactored/internal/service/gitlab"
 
 	"github.com/xanzy/go-gitlab"
@@ -16,12 +17,14 @@ import (
 type Logic struct {
 	service *svc.Service
 	config  config.Config
-	mu      sync.Mutex
-	hints   []taskHint
+	// classifier 流水线任务类型判别，为空时全部视为修改文件
+	classifier *svc.Classifier
+	// mirror 本地镜像，为空时 CI 页面与分支列表直接查询 GitLab
+	mirror *svc.Mirror
 }
 
-// NewLogic 创建GitLab业务逻辑实例
-func NewLogic(cfg config.Config) (*Logic, error) {
+// NewLogic 创建GitLab业务逻辑实例，classifier 为任务类型判别、mirror 为本地镜像（均可为空）
+func NewLogic(cfg config.Config, classifier *svc.Classifier, mirror *svc.Mirror) (*Logic, error) {
 	log.Printf("Creating GitLab logic with config: baseURL=%s, project=%s", cfg.GitLabBaseURL, cfg.GitLabProject)
 
 	// 创建GitLab服务
@@ -32,19 +35,25 @@ func NewLogic(cfg config.Config) (*Logic, error) {
 	}
 
 	return &Logic{
-		service: service,
-		config:  cfg,
+		service:    service,
+		config:     cfg,
+		classifier: classifier,
+		mirror:     mirror,
 	}, nil
 }
 
-func (l *Logic) UpdateConfig(cfg config.Config) error {
-	if err := l.service.Reconfigure(cfg); err != nil {
-		return err
+// WithToken 返回以用户自己的 GitLab 令牌执行操作的业务逻辑，任务类型判别与本地镜像与原实例共享
+func (l *Logic) WithToken(token string) (*Logic, error) {
+	service, err := l.service.WithToken(token)
+	if err != nil {
+		return nil, err
 	}
-	l.config = cfg
-	return nil
+	return &Logic{service: service, config: l.config, classifier: l.classifier, mirror: l.mirror}, nil
 }
 
+// ForgetPipeline 丢弃流水线详情缓存，收到流水线事件时调用
+func (l *Logic) ForgetPipeline(pipelineID int) { l.service.ForgetPipeline(pipelineID) }
+
 // ListPipelines 获取项目流水线列表
 func (l *Logic) ListPipelines() ([]*PipelineInfo, error) {
 	log.Printf("Logic: Listing pipelines")
@@ -73,18 +82,18 @@ func (l *Logic) ListPipelines() ([]*PipelineInfo, error) {
 }
 
 // GetPipelineDetails 获取流水线详细信息
-func (l *Logic) GetPipelineDetails(pipelineID int) (*PipelineDetails, error) {
+func (l *Logic) GetPipelineDetails(ctx context.Context, pipelineID int) (*PipelineDetails, error) {
 	log.Printf("Logic: Getting details for pipeline %d", pipelineID)
 
 	// 获取流水线详情
-	pipeline, err := l.service.GetPipeline(pipelineID)
+	pipeline, err := l.service.GetPipeline(ctx, pipelineID)
 	if err != nil {
 		log.Printf("Logic: Failed to get pipeline %d: %v", pipelineID, err)
 		return nil, err
 	}
 
 	// 获取作业列表
-	jobs, err := l.service.ListJobs(pipelineID)
+	jobs, err := l.service.ListJobs(ctx, pipelineID)
 	if err != nil {
 		log.Printf("Logic: Failed to list jobs for pipeline %d: %v", pipelineID, err)
 		return nil, err
@@ -113,6 +122,11 @@ func (l *Logic) GetPipelineDetails(pipelineID int) (*PipelineDetails, error) {
 
 // ListBranches 获取项目分支列表
 func (l *Logic) ListBranches() ([]*BranchInfo, error) {
+	if synced, err := l.mirrorReady(); err != nil {
+		return nil, err
+	} else if synced != nil {
+		return l.listBranchesFromMirror()
+	}
 	log.Printf("Logic: Listing branches")
 
 	// 获取分支列表
@@ -141,6 +155,9 @@ func (l *Logic) CreateBranch(name, ref string) (*BranchInfo, error) {
 	if err != nil {
 		return nil, err
 	}
+	if b.Commit != nil {
+		l.recordHint(&model.GitLabTaskHint{Kind: svc.HintCreateBranch, Branch: b.Name, SHA: b.Commit.ID})
+	}
 	return &BranchInfo{Name: b.Name, CommitSHA: b.Commit.ID, Protected: b.Protected}, nil
 }
 
@@ -164,7 +181,6 @@ func (l *Logic) CreateMergeRequest(in CreateMRInput) (*PipelineInfo, *JobInfo, *
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	l.RecordMergeBranchHintWithURL(in.TargetBranch, mr.WebURL, in.Title)
 	return nil, nil, mr, nil
 }
 
@@ -262,232 +278,139 @@ func (l *Logic) AcceptMergeRequest(iid int, squash, removeSource, mwps bool, mes
 	if err != nil {
 		return nil, err
 	}
-	l.RecordMergeFromMR(mr)
+	l.recordMerge(mr)
 	return mr, nil
 }
 
-// ListJobsForCIPage 获取用于CI模拟器页面展示的流水线任务列表
-func (l *Logic) ListJobsForCIPage() ([]*GitLabJobInfo, error) {
-	log.Printf("Logic: Listing jobs for CI page")
+// ciConcurrency CI 页面并发获取流水线详情与提交的数量
+const ciConcurrency = 8
 
-	// 获取流水线列表
-	pipelines, err := l.service.ListPipelines()
-	if err != nil {
-		log.Printf("Logic: Failed to list pipelines: %v", err)
-		return nil, err
-	}
+// RowError CI 页面中获取详情或提交失败的行：该行仍以列表中的字段返回
+type RowError struct {
+	PipelineID int64  `json:"pipeline_id"`
+	Message    string `json:"message"`
+}
 
-	// 转换为CI模拟器页面所需格式
-	results := make([]*GitLabJobInfo, len(pipelines))
-	sem := make(chan struct{}, 8)
+// aggregateCIRows 以有限并发获取流水线详情与提交，组装 CI 页面的行（按 ID 去重、保持列表顺序）。
+// 每次 GitLab 调用各有超时；单条失败时该行只含列表中的字段并记入返回的失败列表；
+// ctx 取消（请求方断开）时停止派发、等待在途调用随之返回，并返回 ctx 的错误
+func (l *Logic) aggregateCIRows(ctx context.Context, pipelines []*gitlab.PipelineInfo) ([]*GitLabJobInfo, []RowError, error) {
+	rows := make([]*GitLabJobInfo, len(pipelines))
+	errs := make([][]RowError, len(pipelines))
+	sem := make(chan struct{}, ciConcurrency)
 	var wg sync.WaitGroup
+dispatch:
 	for i, p := range pipelines {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break dispatch
+		}
 		wg.Add(1)
-		sem <- struct{}{}
 		go func(idx int, pi *gitlab.PipelineInfo) {
 			defer func() { <-sem; wg.Done() }()
-			d, err := l.service.GetPipeline(pi.ID)
-			if err != nil {
-				return
-			}
-			var duration string
-			if d.Duration > 0 {
-				duration = fmt.Sprintf("%ds", d.Duration)
-			} else if d.CreatedAt != nil && d.UpdatedAt != nil {
-				diff := d.UpdatedAt.Sub(*d.CreatedAt)
-				duration = fmt.Sprintf("%ds", int(diff.Seconds()))
-			}
-			var createdAt string
-			var createdTs int64
-			if d.CreatedAt != nil {
-				loc, _ := time.LoadLocation("Asia/Shanghai")
-				createdAt = d.CreatedAt.In(loc).Format("2006-01-02 15:04:05")
-				createdTs = d.CreatedAt.In(loc).UnixMilli()
-			}
-			var triggerUser string
-			if d.User != nil {
-				if d.User.Name != "" {
-					triggerUser = d.User.Name
-				} else {
-					triggerUser = d.User.Username
-				}
-			}
-			var commitMsg string
-			var commitAuthor string
-			if pi.SHA != "" {
-				if c, err := l.service.GetCommit(pi.SHA); err == nil && c != nil {
-					commitMsg = c.Title
-					if commitMsg == "" {
-						commitMsg = c.Message
-					}
-					commitAuthor = c.AuthorName
-				}
-			}
-			results[idx] = &GitLabJobInfo{ID: int64(pi.ID), Status: pi.Status, BranchName: pi.Ref, EnvironmentName: "", TriggerUser: triggerUser, CommitID: pi.SHA, CommitMessage: commitMsg, CommitAuthor: commitAuthor, CreatedAt: createdAt, WebURL: pi.WebURL, Duration: duration, TaskType: "修改文件"}
-			_ = createdTs
+			rows[idx], errs[idx] = l.ciRow(ctx, pi)
 		}(i, p)
 	}
 	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
 	var jobs []*GitLabJobInfo
+	var failed []RowError
 	seen := make(map[int64]struct{})
-	for _, r := range results {
-		if r == nil {
-			continue
-		}
+	for i, r := range rows {
 		if _, ok := seen[r.ID]; ok {
 			continue
 		}
 		seen[r.ID] = struct{}{}
 		jobs = append(jobs, r)
+		failed = append(failed, errs[i]...)
 	}
-
 	l.applyTaskTypeClassification(jobs)
-	log.Printf("Logic: Successfully converted %d jobs for CI page", len(jobs))
-	return jobs, nil
+	return jobs, failed, nil
 }
 
-func (l *Logic) ListJobsForCIPageWithPagination(page, perPage int) ([]*GitLabJobInfo, error) {
-	pipelines, _, err := l.service.ListPipelinesWithPagination(page, perPage)
-	if err != nil {
-		return nil, err
+// ciRow 组装一行：先以列表字段填充，再以详情补充触发用户、创建时间与持续时间，以提交补充提交信息
+func (l *Logic) ciRow(ctx context.Context, pi *gitlab.PipelineInfo) (*GitLabJobInfo, []RowError) {
+	row := &GitLabJobInfo{ID: int64(pi.ID), Status: pi.Status, BranchName: pi.Ref, CommitID: pi.SHA, WebURL: pi.WebURL, TaskType: svc.TaskTypeChange}
+	if pi.CreatedAt != nil {
+		row.CreatedAt = formatCreatedAt(*pi.CreatedAt)
 	}
-	results := make([]*GitLabJobInfo, len(pipelines))
-	sem := make(chan struct{}, 8)
-	var wg sync.WaitGroup
-	for i, p := range pipelines {
-		wg.Add(1)
-		sem <- struct{}{}
-		go func(idx int, pi *gitlab.PipelineInfo) {
-			defer func() { <-sem; wg.Done() }()
-			d, err := l.service.GetPipeline(pi.ID)
-			if err != nil {
-				return
-			}
-			var duration string
-			if d.Duration > 0 {
-				duration = fmt.Sprintf("%ds", d.Duration)
-			} else if d.CreatedAt != nil && d.UpdatedAt != nil {
-				diff := d.UpdatedAt.Sub(*d.CreatedAt)
-				duration = fmt.Sprintf("%ds", int(diff.Seconds()))
-			}
-			var createdAt string
-			var createdTs int64
-			if d.CreatedAt != nil {
-				loc, _ := time.LoadLocation("Asia/Shanghai")
-				createdAt = d.CreatedAt.In(loc).Format("2006-01-02 15:04:05")
-				createdTs = d.CreatedAt.In(loc).UnixMilli()
-			}
-			var triggerUser string
-			if d.User != nil {
-				if d.User.Name != "" {
-					triggerUser = d.User.Name
-				} else {
-					triggerUser = d.User.Username
-				}
-			}
-			var commitMsg string
-			var commitAuthor string
-			if pi.SHA != "" {
-				if c, err := l.service.GetCommit(pi.SHA); err == nil && c != nil {
-					commitMsg = c.Title
-					if commitMsg == "" {
-						commitMsg = c.Message
-					}
-					commitAuthor = c.AuthorName
-				}
+	var errs []RowError
+	if d, err := l.service.GetPipeline(ctx, pi.ID); err != nil {
+		errs = append(errs, RowError{PipelineID: row.ID, Message: err.Error()})
+	} else {
+		var created, updated time.Time
+		if d.CreatedAt != nil {
+			created = *d.CreatedAt
+			row.CreatedAt = formatCreatedAt(created)
+		}
+		if d.UpdatedAt != nil {
+			updated = *d.UpdatedAt
+		}
+		row.Duration = formatDuration(d.Duration, created, updated)
+		if d.User != nil {
+			row.TriggerUser = d.User.Name
+			if row.TriggerUser == "" {
+				row.TriggerUser = d.User.Username
 			}
-			results[idx] = &GitLabJobInfo{ID: int64(pi.ID), Status: pi.Status, BranchName: pi.Ref, EnvironmentName: "", TriggerUser: triggerUser, CommitID: pi.SHA, CommitMessage: commitMsg, CommitAuthor: commitAuthor, CreatedAt: createdAt, WebURL: pi.WebURL, Duration: duration, TaskType: "修改文件"}
-			_ = createdTs
-		}(i, p)
-	}
-	wg.Wait()
-	var jobs []*GitLabJobInfo
-	seen := make(map[int64]struct{})
-	for _, r := range results {
-		if r == nil {
-			continue
 		}
-		if _, ok := seen[r.ID]; ok {
-			continue
+	}
+	if pi.SHA != "" {
+		if c, err := l.service.GetCommit(ctx, pi.SHA); err != nil {
+			errs = append(errs, RowError{PipelineID: row.ID, Message: err.Error()})
+		} else if c != nil {
+			row.CommitMessage = c.Title
+			if row.CommitMessage == "" {
+				row.CommitMessage = c.Message
+			}
+			row.CommitAuthor = c.AuthorName
 		}
-		seen[r.ID] = struct{}{}
-		jobs = append(jobs, r)
 	}
-	l.applyTaskTypeClassification(jobs)
-	return jobs, nil
+	return row, errs
 }
 
+// applyTaskTypeClassification 按流水线 ID 读取或判别任务类型
 func (l *Logic) applyTaskTypeClassification(jobs []*GitLabJobInfo) {
-	l.mu.Lock()
-	hints := append([]taskHint(nil), l.hints...)
-	l.mu.Unlock()
-	byBranch := make(map[string][]*GitLabJobInfo)
 	for _, j := range jobs {
-		b := j.BranchName
-		byBranch[b] = append(byBranch[b], j)
-		j.TaskType = "修改文件"
-	}
-	// 排序按创建时间升序
-	loc, _ := time.LoadLocation("Asia/Shanghai")
-	parse := func(s string) time.Time { t, _ := time.ParseInLocation("2006-01-02 15:04:05", s, loc); return t }
-	for b, arr := range byBranch {
-		if len(arr) == 0 {
-			continue
-		}
-		sort.Slice(arr, func(i, k int) bool { return parse(arr[i].CreatedAt).Before(parse(arr[k].CreatedAt)) })
-		// 处理创建分支：将提示后的第一条记录钉为创建分支
-		for _, h := range hints {
-			if h.Kind == "create_branch" && h.Branch == b {
-				var best *GitLabJobInfo
-				for _, j := range arr {
-					ct := parse(j.CreatedAt)
-					if h.Ts.IsZero() || !ct.IsZero() {
-						if ct.After(h.Ts.Add(-2 * time.Minute)) {
-							best = j
-							break
-						}
-						if best == nil {
-							best = j
-						}
-					}
-				}
-				if best != nil {
-					best.TaskType = "创建分支"
-					best.CommitMessage = "创建分支"
-				}
-			}
+		j.TaskType = svc.TaskTypeChange
+	}
+	if l.classifier == nil || len(jobs) == 0 {
+		return
+	}
+	refs := make([]svc.PipelineRef, 0, len(jobs))
+	for _, j := range jobs {
+		refs = append(refs, svc.PipelineRef{ID: j.ID, Ref: j.BranchName, SHA: j.CommitID})
+	}
+	types, err := l.classifier.Classify(refs)
+	if err != nil {
+		log.Printf("Logic: Failed to classify pipelines: %v", err)
+		return
+	}
+	for _, j := range jobs {
+		if t, ok := types[j.ID]; ok {
+			j.TaskType = t
 		}
-		// 处理合并：在提示时间窗口内标记为分支合并（不覆盖创建分支）
-		for _, h := range hints {
-			if h.Kind == "merge" && h.Branch == b {
-				if h.SHA != "" {
-					var matched bool
-					for _, j := range arr {
-						if j.TaskType == "创建分支" {
-							continue
-						}
-						if j.CommitID == h.SHA {
-							j.TaskType = "分支合并"
-							matched = true
-						}
-					}
-					// 若有SHA但未匹配到任何记录，则追加一个合成记录以展示此次合并
-					if !matched {
-						created := h.Ts.In(loc).Format("2006-01-02 15:04:05")
-						synth := &GitLabJobInfo{ID: -time.Now().UnixNano(), Status: "pending", BranchName: h.Branch, EnvironmentName: "", TriggerUser: "", CommitID: h.SHA, CommitMessage: h.Title, CommitAuthor: "", CreatedAt: created, WebURL: h.URL, Duration: "", TaskType: "分支合并"}
-						jobs = append(jobs, synth)
-					}
-				} else {
-					// 没有合并提交SHA（例如仅创建了MR），生成一条合成记录用于列表展示，不影响其它记录分类
-					created := h.Ts.In(loc).Format("2006-01-02 15:04:05")
-					synth := &GitLabJobInfo{ID: -time.Now().UnixNano(), Status: "pending", BranchName: h.Branch, EnvironmentName: "", TriggerUser: "", CommitID: "", CommitMessage: h.Title, CommitAuthor: "", CreatedAt: created, WebURL: h.URL, Duration: "", TaskType: "分支合并"}
-					jobs = append(jobs, synth)
-				}
-			}
+		if j.TaskType == svc.TaskTypeCreateBranch {
+			j.CommitMessage = svc.TaskTypeCreateBranch
 		}
 	}
 }
 
+// SetTaskType 人工修正流水线的任务类型，taskType 为空时撤销修正
+func (l *Logic) SetTaskType(ctx context.Context, pipelineID int, taskType, actor string) (*model.GitLabPipelineType, error) {
+	if l.classifier == nil {
+		return nil, fmt.Errorf("task type classification is not available")
+	}
+	p, err := l.service.GetPipeline(ctx, pipelineID)
+	if err != nil {
+		return nil, err
+	}
+	return l.classifier.SetTaskType(svc.PipelineRef{ID: int64(p.ID), Ref: p.Ref, SHA: p.SHA}, taskType, actor)
+}
+
+// Pagination CI 页面的分页信息；GitLab 未返回总数（超过 10000 条）时 TotalItems 与 TotalPages 为 0
 type Pagination struct {
 	CurrentPage int `json:"current_page"`
 	PerPage     int `json:"per_page"`
@@ -495,36 +418,42 @@ type Pagination struct {
 	TotalItems  int `json:"total_items"`
 	NextPage    int `json:"next_page"`
 	PrevPage    int `json:"prev_page"`
+	// NextBeforeID、PrevAfterID 下一页与上一页的键集游标（分别作为 before_id、after_id 传入），读取本地镜像时提供
+	NextBeforeID int64 `json:"next_before_id,omitempty"`
+	PrevAfterID  int64 `json:"prev_after_id,omitempty"`
 }
 
 type GitLabJobsPage struct {
 	Items      []*GitLabJobInfo `json:"items"`
 	Pagination Pagination       `json:"pagination"`
+	// LastSynced 本地镜像最近一次同步的时间，直接查询 GitLab 时为空
+	LastSynced *time.Time `json:"last_synced,omitempty"`
+	// Errors 获取详情或提交失败的行，这些行只含流水线列表中的字段
+	Errors []RowError `json:"errors,omitempty"`
 }
 
-func (l *Logic) ListJobsPage(page, perPage int) (*GitLabJobsPage, error) {
-	_, resp, err := l.service.ListPipelinesWithPagination(page, perPage)
+// ListJobsPage 分页获取 CI 页面的流水线任务：启用本地镜像且已完成首次同步时从本地表读取并支持键集游标 cur，
+// 否则直接查询 GitLab（只按页码分页，忽略游标）；ctx 为请求的 context，请求方断开时停止查询
+func (l *Logic) ListJobsPage(ctx context.Context, page, perPage int, cur PipelineCursor) (*GitLabJobsPage, error) {
+	if synced, err := l.mirrorReady(); err != nil {
+		return nil, err
+	} else if synced != nil {
+		return l.listJobsPageFromMirror(page, perPage, cur, synced)
+	}
+	pipelines, resp, err := l.service.ListPipelinesWithPagination(ctx, page, perPage)
 	if err != nil {
 		return nil, err
 	}
-	items, err := l.ListJobsForCIPageWithPagination(page, perPage)
+	items, failed, err := l.aggregateCIRows(ctx, pipelines)
 	if err != nil {
 		return nil, err
 	}
-	cur := resp.CurrentPage
-	tot := resp.TotalPages
-	var next int
-	var prev int
-	if tot > 0 {
-		if cur < tot {
-			next = cur + 1
-		}
-		if cur > 1 {
-			prev = cur - 1
-		}
+	// 总数与页码来自 GitLab 的 X-Total、X-Total-Pages、X-Next-Page 等响应头
+	pg := Pagination{CurrentPage: resp.CurrentPage, PerPage: perPage, TotalPages: resp.TotalPages, TotalItems: resp.TotalItems, NextPage: resp.NextPage, PrevPage: resp.PreviousPage}
+	if pg.CurrentPage == 0 {
+		pg.CurrentPage = page
 	}
-	pg := Pagination{CurrentPage: cur, PerPage: perPage, TotalPages: tot, TotalItems: 0, NextPage: next, PrevPage: prev}
-	return &GitLabJobsPage{Items: items, Pagination: pg}, nil
+	return &GitLabJobsPage{Items: items, Pagination: pg, Errors: failed}, nil
 }
 
 // PipelineInfo 流水线信息
@@ -575,42 +504,25 @@ type GitLabJobInfo struct {
 	Duration        string `json:"duration"`
 	TaskType        string `json:"task_type"`
 }
-type taskHint struct {
-	Kind   string
-	Branch string
-	Ts     time.Time
-	URL    string
-	Title  string
-	SHA    string
-}
-
-func (l *Logic) RecordCreateBranchHint(branch string) {
-	l.mu.Lock()
-	l.hints = append(l.hints, taskHint{Kind: "create_branch", Branch: branch, Ts: time.Now()})
-	l.mu.Unlock()
-}
 
-func (l *Logic) RecordMergeBranchHint(branch string) {
-	l.mu.Lock()
-	l.hints = append(l.hints, taskHint{Kind: "merge", Branch: branch, Ts: time.Now()})
-	l.mu.Unlock()
-}
-
-func (l *Logic) RecordMergeBranchHintWithURL(branch, url, title string) {
-	l.mu.Lock()
-	l.hints = append(l.hints, taskHint{Kind: "merge", Branch: branch, Ts: time.Now(), URL: url, Title: title})
-	l.mu.Unlock()
+// recordHint 保存本系统发起的操作，失败只记录日志
+func (l *Logic) recordHint(h *model.GitLabTaskHint) {
+	if l.classifier == nil {
+		return
+	}
+	if err := l.classifier.RecordHint(h); err != nil {
+		log.Printf("Logic: Failed to record %s hint on %s: %v", h.Kind, h.Branch, err)
+	}
 }
 
-func (l *Logic) RecordMergeFromMR(mr *gitlab.MergeRequest) {
+// recordMerge 记录 MR 合并产生的提交；尚未完成的合并（流水线成功后自动合并）没有提交，由 webhook 合并事件判别
+func (l *Logic) recordMerge(mr *gitlab.MergeRequest) {
 	if mr == nil {
 		return
 	}
-	ts := time.Now()
-	if mr.MergedAt != nil {
-		ts = *mr.MergedAt
+	sha := mr.MergeCommitSHA
+	if sha == "" {
+		sha = mr.SquashCommitSHA
 	}
-	l.mu.Lock()
-	l.hints = append(l.hints, taskHint{Kind: "merge", Branch: mr.TargetBranch, Ts: ts, URL: mr.WebURL, Title: mr.Title, SHA: mr.MergeCommitSHA})
-	l.mu.Unlock()
+	l.recordHint(&model.GitLabTaskHint{Kind: svc.HintMerge, Branch: mr.TargetBranch, SHA: sha, MRIID: int64(mr.IID), Title: mr.Title, URL: mr.WebURL})
 }
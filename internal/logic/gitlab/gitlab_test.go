@@ -0,0 +1,113 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"webci-refactored/internal/config"
+)
+
+// ciFake 模拟 GitLab 的流水线列表、流水线详情与提交接口：3 条流水线，2 号详情返回 403；
+// block 为真时详情请求一直阻塞到请求被取消
+type ciFake struct {
+	block    bool
+	inflight int32
+}
+
+func (f *ciFake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	created := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	switch {
+	case strings.HasSuffix(path, "/pipelines"):
+		w.Header().Set("X-Total", "3")
+		var items []map[string]interface{}
+		for id := 3; id >= 1; id-- {
+			items = append(items, map[string]interface{}{"id": id, "ref": "main", "sha": fmt.Sprintf("%040x", id), "status": "success", "created_at": created})
+		}
+		_ = json.NewEncoder(w).Encode(items)
+	case strings.Contains(path, "/pipelines/"):
+		if f.block {
+			atomic.AddInt32(&f.inflight, 1)
+			<-r.Context().Done()
+			atomic.AddInt32(&f.inflight, -1)
+			return
+		}
+		if strings.HasSuffix(path, "/pipelines/2") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 1, "duration": 42, "created_at": created, "user": map[string]string{"username": "alice"}})
+	case strings.Contains(path, "/repository/commits/"):
+		_ = json.NewEncoder(w).Encode(map[string]string{"title": "fix", "author_name": "Bob"})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newCILogic(t *testing.T, fake *ciFake) *Logic {
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	l, err := NewLogic(config.Config{GitLabBaseURL: srv.URL + "/api/v4", GitLabToken: "t", GitLabProject: "1"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestListJobsPageReportsRowErrors(t *testing.T) {
+	l := newCILogic(t, &ciFake{})
+	page, err := l.ListJobsPage(context.Background(), 1, 20, PipelineCursor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 3 || page.Items[1].ID != 2 {
+		t.Fatalf("failed rows must be kept in order: %+v", page.Items)
+	}
+	ok, failed := page.Items[0], page.Items[1]
+	if ok.TriggerUser != "alice" || ok.Duration != "42s" || ok.CommitAuthor != "Bob" {
+		t.Fatalf("row enriched from details and commit: %+v", ok)
+	}
+	if failed.Status != "success" || failed.CommitAuthor != "Bob" || failed.TriggerUser != "" || failed.CreatedAt == "" {
+		t.Fatalf("failed row keeps the list fields: %+v", failed)
+	}
+	if page.Pagination.TotalItems != 3 {
+		t.Fatalf("total must come from X-Total: %+v", page.Pagination)
+	}
+	if len(page.Errors) != 1 || page.Errors[0].PipelineID != 2 || page.Errors[0].Message == "" {
+		t.Fatalf("errors: %+v", page.Errors)
+	}
+}
+
+func TestListJobsPageStopsOnCancel(t *testing.T) {
+	fake := &ciFake{block: true}
+	l := newCILogic(t, fake)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for atomic.LoadInt32(&fake.inflight) == 0 {
+			time.Sleep(5 * time.Millisecond)
+		}
+		cancel()
+	}()
+	start := time.Now()
+	_, err := l.ListJobsPage(ctx, 1, 20, PipelineCursor{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("want context.Canceled, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("canceled request took %v", d)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&fake.inflight) != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&fake.inflight); n != 0 {
+		t.Fatalf("%d GitLab calls still in flight after cancel", n)
+	}
+}
@@ -0,0 +1,106 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"webci-refactored/internal/dal/model"
+)
+
+// Sync 执行一次本地镜像同步，full 为真时同时全量对齐；未启用本地镜像时返回错误
+func (l *Logic) Sync(ctx context.Context, full bool) (*SyncReport, error) {
+	if l.mirror == nil {
+		return nil, fmt.Errorf("gitlab sync is disabled")
+	}
+	return l.mirror.Sync(ctx, l.service, full)
+}
+
+// SyncStates 返回本地镜像各资源的同步进度，未启用本地镜像时为空
+func (l *Logic) SyncStates() ([]model.GitLabSyncState, error) {
+	if l.mirror == nil {
+		return nil, nil
+	}
+	return l.mirror.States()
+}
+
+// mirrorReady 返回本地镜像最近一次同步的时间；未启用或尚未完成首次同步时为 nil，此时直接查询 GitLab
+func (l *Logic) mirrorReady() (*time.Time, error) {
+	if l.mirror == nil {
+		return nil, nil
+	}
+	return l.mirror.LastSynced()
+}
+
+// listJobsPageFromMirror 从本地镜像分页读取 CI 页面的流水线任务：有游标时按游标，否则按页码；
+// 当前页码由本页之前的流水线数量推算（之前不足整页时也算作一页），同时返回上一页与下一页的游标
+func (l *Logic) listJobsPageFromMirror(page, perPage int, cur PipelineCursor, synced *time.Time) (*GitLabJobsPage, error) {
+	res, err := l.mirror.Pipelines(cur, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, err
+	}
+	pipelines, commits := res.Items, res.Commits
+	items := make([]*GitLabJobInfo, 0, len(pipelines))
+	var failed []RowError
+	for _, p := range pipelines {
+		if p.SyncError != "" {
+			failed = append(failed, RowError{PipelineID: p.ID, Message: p.SyncError})
+		}
+		c := commits[p.SHA]
+		msg := c.Title
+		if msg == "" {
+			msg = c.Message
+		}
+		items = append(items, &GitLabJobInfo{ID: p.ID, Status: p.Status, BranchName: p.Ref, TriggerUser: p.TriggerUser, CommitID: p.SHA, CommitMessage: msg, CommitAuthor: c.AuthorName, CreatedAt: formatCreatedAt(p.CreatedAt), WebURL: p.WebURL, Duration: formatDuration(p.Duration, p.CreatedAt, p.UpdatedAt)})
+	}
+	l.applyTaskTypeClassification(items)
+	current := (int(res.Newer)+perPage-1)/perPage + 1
+	pg := Pagination{CurrentPage: current, PerPage: perPage, TotalPages: int((res.Total + int64(perPage) - 1) / int64(perPage)), TotalItems: int(res.Total)}
+	if pg.TotalPages < current {
+		pg.TotalPages = current
+	}
+	if len(pipelines) > 0 && res.Older > 0 {
+		pg.NextPage = current + 1
+		pg.NextBeforeID = pipelines[len(pipelines)-1].ID
+	}
+	if len(pipelines) > 0 && res.Newer > 0 {
+		pg.PrevPage = current - 1
+		if pg.PrevPage < 1 {
+			pg.PrevPage = 1
+		}
+		pg.PrevAfterID = pipelines[0].ID
+	}
+	return &GitLabJobsPage{Items: items, Pagination: pg, LastSynced: synced, Errors: failed}, nil
+}
+
+// listBranchesFromMirror 从本地镜像读取分支列表
+func (l *Logic) listBranchesFromMirror() ([]*BranchInfo, error) {
+	branches, err := l.mirror.Branches()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*BranchInfo, 0, len(branches))
+	for _, b := range branches {
+		result = append(result, &BranchInfo{Name: b.Name, CommitSHA: b.CommitSHA, Protected: b.Protected})
+	}
+	return result, nil
+}
+
+// formatCreatedAt 以北京时间格式化创建时间，零值为空
+func formatCreatedAt(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+	return t.In(loc).Format("2006-01-02 15:04:05")
+}
+
+// formatDuration 格式化持续时间：优先使用 GitLab 给出的秒数，没有时以更新与创建时间之差估算
+func formatDuration(seconds int, created, updated time.Time) string {
+	if seconds > 0 {
+		return fmt.Sprintf("%ds", seconds)
+	}
+	if !created.IsZero() && !updated.IsZero() {
+		return fmt.Sprintf("%ds", int(updated.Sub(created).Seconds()))
+	}
+	return ""
+}
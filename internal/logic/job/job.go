@@ -1,59 +1,208 @@
 package job
 
 import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
 	"webci-refactored/internal/dal/model"
 	"webci-refactored/internal/dal/repository"
 	"webci-refactored/internal/queue"
+	"webci-refactored/internal/service/branch"
+	"webci-refactored/internal/service/environment"
 	"webci-refactored/internal/service/job"
 
 	"gorm.io/gorm"
 )
 
+// 状态机错误：供处理层映射 HTTP 状态码
+var (
+	ErrIllegalTransition = job.ErrIllegalTransition
+	ErrUnknownStatus     = job.ErrUnknownStatus
+	ErrNotRetryable      = job.ErrNotRetryable
+)
+
+// 部署保护与审批错误：供处理层映射 HTTP 状态码
+var (
+	ErrDeployBlocked      = environment.ErrDeployBlocked
+	ErrNotWaiting         = job.ErrNotWaiting
+	ErrApproverNotAllowed = job.ErrApproverNotAllowed
+	ErrAlreadyDecided     = job.ErrAlreadyDecided
+)
+
+// JobOptions 单个任务的可选定义（产物与自动重试策略）
+type JobOptions = job.JobOptions
+
+// Variable 创建任务时传入的变量
+type Variable = model.Variable
+
 // Logic 任务业务逻辑
 type Logic struct {
-	db   *gorm.DB
-	svc  *job.Service
-	jobs *repository.JobRepository
+	db        *gorm.DB
+	svc       *job.Service
+	branchSvc *branch.Service
+	jobs      *repository.JobRepository
+	events    *repository.JobEventRepository
+	branches  *repository.BranchRepository
 }
 
 // NewLogic 创建任务业务逻辑实例
-func NewLogic(db *gorm.DB) *Logic {
+func NewLogic(db *gorm.DB, repoPath string) *Logic {
 	return &Logic{
-		db:   db,
-		svc:  job.NewService(db),
-		jobs: repository.NewJobRepository(db),
+		db:        db,
+		svc:       job.NewService(db),
+		branchSvc: branch.NewService(db, repoPath),
+		jobs:      repository.NewJobRepository(db),
+		events:    repository.NewJobEventRepository(db),
+		branches:  repository.NewBranchRepository(db),
 	}
 }
 
+func (l *Logic) UpdateRepoPath(path string) { l.branchSvc.SetRepoPath(path) }
+
 // Create 创建任务
-func (l *Logic) Create(branchID, envID uint64, triggerUser string) (*model.Job, error) {
+// 未显式传入步骤且分支提交中存在流水线定义文件时，展开为流水线父任务与子任务
+func (l *Logic) Create(branchID, envID uint64, triggerUser string, steps []string, opts JobOptions) (*model.Job, error) {
+	if len(steps) == 0 {
+		b, err := l.branches.Get(branchID)
+		if err != nil {
+			return nil, err
+		}
+		content, commit, err := l.branchSvc.ReadPipelineFile(b)
+		if err == nil {
+			p, err := l.svc.CreatePipeline(b, envID, triggerUser, commit, content, opts.Variables, opts.FreezeOverride)
+			if err != nil {
+				return nil, err
+			}
+			queue.Dispatch(p)
+			return p, nil
+		}
+		if !errors.Is(err, branch.ErrNoPipelineFile) {
+			return nil, err
+		}
+	}
 	// 绑定请求体并校验必要字段（服务层会对 trigger_user 做二次校验）
-	j, err := l.svc.Create(branchID, envID, triggerUser)
+	j, err := l.svc.Create(branchID, envID, triggerUser, steps, opts)
 	if err != nil {
 		return nil, err
 	}
-	// 推入队列，异步执行器开始处理
-	queue.Enqueue(j.ID)
+	// 推入队列，异步执行器开始处理；受保护环境的任务等待审批
+	queue.Dispatch(j)
 	return j, nil
 }
 
+// Retry 重试已结束的任务，新任务通过 retry_of 关联原任务
+// 流水线父任务重试时整体复制并启动一条新流水线；override 为管理员覆盖冻结窗口的原因
+func (l *Logic) Retry(id uint64, triggerUser, override string) (*model.Job, error) {
+	j, err := l.svc.Retry(id, triggerUser, override)
+	if err != nil {
+		return nil, err
+	}
+	queue.Dispatch(j)
+	return j, nil
+}
+
+// Approve 批准等待审批的部署任务，批准数达到环境要求时放行
+func (l *Logic) Approve(id uint64, approver, comment string) (*model.Job, error) {
+	j, released, err := l.svc.Approve(id, approver, comment)
+	if err != nil {
+		return nil, err
+	}
+	if released {
+		queue.Dispatch(j)
+	}
+	return l.jobs.Get(id)
+}
+
+// Reject 拒绝等待审批的部署任务，任务转为 canceled
+func (l *Logic) Reject(id uint64, approver, comment string) (*model.Job, error) {
+	if _, err := l.svc.Reject(id, approver, comment); err != nil {
+		return nil, err
+	}
+	return l.jobs.Get(id)
+}
+
+// Approvals 查询任务的审批记录
+func (l *Logic) Approvals(id uint64) ([]model.Approval, error) { return l.svc.Approvals(id) }
+
 // List 查询任务
 func (l *Logic) List(branchID, envID *uint64, status *string, limit, offset int) ([]model.Job, int64, error) {
-	return l.jobs.List(branchID, envID, status, limit, offset)
+	items, total, err := l.jobs.List(branchID, envID, status, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := l.fillQueuePositions(items); err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
 }
 
 // Get 获取任务详情
+// 流水线父任务同时返回其子任务列表
 func (l *Logic) Get(id uint64) (*model.Job, error) {
-	return l.jobs.Get(id)
+	j, err := l.jobs.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if j.Kind == model.JobKindPipeline {
+		children, err := l.jobs.ListByPipeline(id)
+		if err != nil {
+			return nil, err
+		}
+		j.Jobs = children
+		if err := l.fillQueuePositions(j.Jobs); err != nil {
+			return nil, err
+		}
+	}
+	items := []model.Job{*j}
+	if err := l.fillQueuePositions(items); err != nil {
+		return nil, err
+	}
+	j.QueuePosition = items[0].QueuePosition
+	return j, nil
+}
+
+// fillQueuePositions 为 pending 任务填充排队位置
+// 位置即认领顺序中的名次；受环境并发上限阻塞的任务同样保留其名次
+func (l *Logic) fillQueuePositions(items []model.Job) error {
+	pending := false
+	for _, j := range items {
+		if j.Status == "pending" && j.Kind != model.JobKindPipeline {
+			pending = true
+			break
+		}
+	}
+	if !pending {
+		return nil
+	}
+	ids, err := l.jobs.PendingIDs()
+	if err != nil {
+		return err
+	}
+	pos := make(map[uint64]int, len(ids))
+	for i, id := range ids {
+		pos[id] = i + 1
+	}
+	for i := range items {
+		items[i].QueuePosition = pos[items[i].ID]
+	}
+	return nil
 }
 
-// UpdateStatus 更新任务状态
-func (l *Logic) UpdateStatus(id uint64, status, logAppend string) (*model.Job, error) {
+// UpdateStatus 更新任务状态，actor 为发起变更的用户
+func (l *Logic) UpdateStatus(id uint64, status, logAppend, actor string) (*model.Job, error) {
 	// 状态与日志均为可选：只要有传入就执行对应更新
-	if status != "" {
-		if err := l.svc.SetStatus(id, status); err != nil {
+	// 设置为 canceled 等同于取消任务，执行中的进程会被中止；设置为 pending 放行 manual 任务，其余状态不能手动设置
+	if status == model.JobStatusCanceled {
+		if err := l.Cancel(id, actor); err != nil {
+			return nil, err
+		}
+	} else if status != "" {
+		j, err := l.svc.SetStatus(id, status, actor)
+		if err != nil {
 			return nil, err
 		}
+		// 放行的手动任务进入队列
+		queue.Dispatch(j)
 	}
 	if logAppend != "" {
 		if err := l.svc.AppendLog(id, logAppend); err != nil {
@@ -63,22 +212,141 @@ func (l *Logic) UpdateStatus(id uint64, status, logAppend string) (*model.Job, e
 	return l.jobs.Get(id)
 }
 
-// Log 单独获取构建日志
-func (l *Logic) Log(id uint64) (string, error) {
+// Events 查询任务的状态变更事件
+func (l *Logic) Events(id uint64) ([]model.JobEvent, error) {
+	if _, err := l.jobs.Get(id); err != nil {
+		return nil, err
+	}
+	return l.events.ListByJob(id)
+}
+
+// tailChunkSize 实时日志单次读取的最大字节数
+const tailChunkSize = 64 << 10
+
+// Log 按字节区间读取构建日志，limit 小于 0 表示读到末尾；同时返回日志总字节数
+func (l *Logic) Log(id uint64, offset, limit int64) ([]byte, int64, error) {
 	j, err := l.jobs.Get(id)
 	if err != nil {
-		return "", err
+		return nil, 0, err
+	}
+	if offset > j.LogSize {
+		offset = j.LogSize
 	}
-	// 直接返回纯文本日志
-	return j.Log, nil
+	data, err := l.jobs.ReadLog(id, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, j.LogSize, nil
+}
+
+// LogTail 日志增量读取结果
+type LogTail struct {
+	// 自 offset 起新增的日志
+	Text string
+	// 下次读取的字节偏移
+	Offset int64
+	// 偏移之后仍有未读取的日志
+	More bool
+	// 任务当前状态
+	Status string
+	// 任务已进入终态
+	Terminal bool
+	// 任务已结束且日志已完整读取（终态、已记录结束时间且已读到末尾）
+	Done bool
 }
 
+// TailLog 读取自字节偏移 offset 起新增的日志，单次最多读取 tailChunkSize 字节
+// 偏移超出日志长度时按日志末尾处理
+func (l *Logic) TailLog(id uint64, offset int64) (*LogTail, error) {
+	j, err := l.jobs.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || offset > j.LogSize {
+		offset = j.LogSize
+	}
+	data, err := l.jobs.ReadLog(id, offset, tailChunkSize)
+	if err != nil {
+		return nil, err
+	}
+	// 截断处可能落在多字节字符中间，留到下次读取
+	if len(data) == tailChunkSize {
+		data = trimPartialRune(data)
+	}
+	next := offset + int64(len(data))
+	return &LogTail{
+		Text:     string(data),
+		Offset:   next,
+		More:     next < j.LogSize,
+		Status:   j.Status,
+		Terminal: job.IsTerminal(j.Status),
+		Done:     job.IsTerminal(j.Status) && j.EndTime != nil && next >= j.LogSize,
+	}, nil
+}
+
+// trimPartialRune 去掉末尾不完整的 UTF-8 字符
+func trimPartialRune(b []byte) []byte {
+	for i := 1; i <= utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// WatchLog 订阅任务日志与状态变更通知
+func (l *Logic) WatchLog(id uint64) (<-chan struct{}, func()) { return repository.WatchJob(id) }
+
 // Cancel 取消任务
-func (l *Logic) Cancel(id uint64) error {
-	// 标记取消供执行器识别，并追加取消请求的日志
+// 排队中的任务立即转为 canceled，执行中的任务中止其进程；
+// 流水线父任务会取消全部未结束的子任务，并由流水线汇总为 canceled；actor 为发起取消的用户
+func (l *Logic) Cancel(id uint64, actor string) error {
+	j, err := l.jobs.Get(id)
+	if err != nil {
+		return err
+	}
+	if j.Kind != model.JobKindPipeline {
+		if err := l.cancelJob(id, actor); err != nil {
+			return err
+		}
+		// 未开始即取消的子任务（如 manual 任务）不会经过执行器，由此推进流水线，下游任务随之跳过
+		if j.PipelineID > 0 {
+			queue.StartPipeline(j.PipelineID)
+		}
+		return nil
+	}
+	if job.IsTerminal(j.Status) {
+		return fmt.Errorf("%w: pipeline already %s", ErrIllegalTransition, j.Status)
+	}
+	// 父任务只记录取消请求：尚未放行的子任务在推进时一并取消
 	queue.MarkCancel(id)
-	if err := l.svc.Cancel(id); err != nil {
+	children, err := l.jobs.ListByPipeline(id)
+	if err != nil {
 		return err
 	}
+	for _, c := range children {
+		if job.IsTerminal(c.Status) {
+			continue
+		}
+		if err := l.cancelJob(c.ID, actor); err != nil && !errors.Is(err, ErrIllegalTransition) {
+			return err
+		}
+	}
+	queue.StartPipeline(id)
+	return nil
+}
+
+// cancelJob 取消单个可执行任务，执行中的任务通知执行器中止
+func (l *Logic) cancelJob(id uint64, actor string) error {
+	running, err := l.svc.Cancel(id, actor)
+	if err != nil {
+		return err
+	}
+	if running {
+		queue.MarkCancel(id)
+	}
 	return nil
 }
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/logic/audit"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// Audit 审计中间件：在写接口处理完成后记录操作者、动作、对象、请求摘要与结果
+// 应放在角色校验之前，使越权被拒的调用同样留痕；写入失败只记录日志，不影响响应
+func Audit(l *audit.Logic, action string) app.HandlerFunc {
+	return func(c context.Context, ctx *app.RequestContext) {
+		ctx.Next(c)
+		body := ctx.Request.Body()
+		target, summary := audit.Describe(string(ctx.Path()), string(ctx.Request.URI().QueryString()), body)
+		e := &model.AuditEvent{
+			Actor:      Username(ctx),
+			Action:     action,
+			Target:     target,
+			Method:     string(ctx.Method()),
+			Path:       string(ctx.Path()),
+			Summary:    summary,
+			Status:     ctx.Response.StatusCode(),
+			RemoteAddr: ctx.ClientIP(),
+		}
+		// 响应体为统一的 {code,message,data}：失败时取 message，新建资源时补充其 ID
+		var resp struct {
+			Message string          `json:"message"`
+			Data    json.RawMessage `json:"data"`
+		}
+		if json.Unmarshal(ctx.Response.Body(), &resp) == nil {
+			if e.Status >= 400 {
+				e.Error = resp.Message
+			} else {
+				var created struct {
+					ID uint64 `json:"id"`
+				}
+				if json.Unmarshal(resp.Data, &created) == nil && created.ID > 0 && ctx.Param("id") == "" {
+					e.Target += " id=" + strconv.FormatUint(created.ID, 10)
+				}
+			}
+		}
+		// 登录请求尚无身份，以提交的用户名作为操作者
+		if e.Actor == "" {
+			var in struct {
+				Username string `json:"username"`
+			}
+			_ = json.Unmarshal(body, &in)
+			e.Actor = in.Username
+		}
+		if err := l.Record(e); err != nil {
+			log.Printf("Warning: failed to record audit event %s: %v", action, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Package middleware 提供 HTTP 中间件：认证访问令牌并按角色校验接口权限
+package middleware
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"webci-refactored/internal/logic/auth"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// SessionCookie 登录会话 Cookie 名称，浏览器页面以此携带会话令牌
+const SessionCookie = "webci_session"
+
+// identityKey 请求上下文中保存当前身份的键
+const identityKey = "identity"
+
+// Identity 已认证的请求身份
+type Identity struct {
+	UserID   uint64
+	Username string
+	Role     string
+}
+
+// Authenticate 认证中间件：从 Authorization: Bearer 头或会话 Cookie 中读取令牌并解析身份
+// 未认证的接口请求返回 401，页面请求重定向到登录页
+func Authenticate(l *auth.Logic) app.HandlerFunc {
+	return func(c context.Context, ctx *app.RequestContext) {
+		u, err := l.Authenticate(Token(ctx))
+		if err != nil {
+			deny(ctx, 401, "authentication required")
+			return
+		}
+		ctx.Set(identityKey, &Identity{UserID: u.ID, Username: u.Username, Role: u.Role})
+		ctx.Next(c)
+	}
+}
+
+// Require 角色校验中间件：当前身份的角色低于 role 时返回 403，须在 Authenticate 之后使用
+func Require(role string) app.HandlerFunc {
+	return func(c context.Context, ctx *app.RequestContext) {
+		id := Current(ctx)
+		if id == nil {
+			deny(ctx, 401, "authentication required")
+			return
+		}
+		if !auth.HasRole(id.Role, role) {
+			deny(ctx, 403, "requires role "+role)
+			return
+		}
+		ctx.Next(c)
+	}
+}
+
+// Token 读取请求携带的令牌：优先 Authorization: Bearer 头，其次会话 Cookie
+func Token(ctx *app.RequestContext) string {
+	if h := string(ctx.GetHeader("Authorization")); h != "" {
+		if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+			return strings.TrimSpace(h[7:])
+		}
+		return ""
+	}
+	return string(ctx.Cookie(SessionCookie))
+}
+
+// Current 返回当前请求的身份，未认证时返回 nil
+func Current(ctx *app.RequestContext) *Identity {
+	v, ok := ctx.Get(identityKey)
+	if !ok {
+		return nil
+	}
+	id, _ := v.(*Identity)
+	return id
+}
+
+// Username 返回当前请求的用户名，未认证时为空
+func Username(ctx *app.RequestContext) string {
+	if id := Current(ctx); id != nil {
+		return id.Username
+	}
+	return ""
+}
+
+// deny 终止请求：接口返回 JSON 错误，页面未认证时重定向到登录页
+func deny(ctx *app.RequestContext, status int, msg string) {
+	path := string(ctx.Request.URI().Path())
+	if status == 401 && !strings.HasPrefix(path, "/api") {
+		ctx.Redirect(302, []byte("/login?next="+url.QueryEscape(string(ctx.Request.URI().RequestURI()))))
+		ctx.Abort()
+		return
+	}
+	ctx.AbortWithStatusJSON(status, map[string]interface{}{"code": status, "message": msg})
+}
@@ -0,0 +1,512 @@
+package pipeline
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName 仓库根目录下的流水线定义文件名
+const FileName = ".nvwa-ci.yml"
+
+// DefaultStages 未声明 stages 时使用的默认阶段顺序
+var DefaultStages = []string{"build", "test", "deploy"}
+
+// defaultStage 任务未声明 stage 时归入的阶段
+const defaultStage = "test"
+
+// Pipeline 流水线定义
+// 由阶段顺序、全局变量与按文件顺序排列的任务组成
+type Pipeline struct {
+	Stages    []string
+	Variables map[string]string
+	Jobs      []*Job
+}
+
+// Job 流水线中的单个任务定义
+type Job struct {
+	Name      string
+	Stage     string
+	Script    []string
+	Needs     []string
+	Variables map[string]string
+	Only      []string
+	Except    []string
+	Timeout   time.Duration
+	Artifacts Artifacts
+	Retry     Retry
+	// Manual 为 when: manual：依赖满足后停在 manual，由用户手动放行
+	Manual bool
+	// hasNeeds 区分未声明 needs 与显式声明空 needs（后者表示不等待前序阶段）
+	hasNeeds bool
+}
+
+// Artifacts 任务产物声明：任务成功后从工作区收集的文件
+type Artifacts struct {
+	// Paths 相对工作区的路径或通配符，匹配到目录时收集其下全部文件
+	Paths []string
+	// ExpireIn 保留时长，0 表示使用服务端默认值
+	ExpireIn time.Duration
+	// Never 永久保留（expire_in: never）
+	Never bool
+}
+
+// MaxRetry 单个任务自动重试次数上限
+const MaxRetry = 2
+
+// retryWhenValues 自动重试条件的合法取值：always 或任务失败原因（与 model.Failure* 取值一致）
+var retryWhenValues = map[string]bool{
+	"always":           true,
+	"script_failure":   true,
+	"job_timeout":      true,
+	"artifact_failure": true,
+	"system_failure":   true,
+}
+
+// Retry 任务自动重试策略：失败原因命中 When（为空表示任意原因）时最多重试 Max 次
+type Retry struct {
+	Max  int
+	When []string
+}
+
+// ValidateRetry 检查重试次数范围与重试条件取值
+func ValidateRetry(r Retry) error {
+	if r.Max < 0 || r.Max > MaxRetry {
+		return fmt.Errorf("retry max must be between 0 and %d", MaxRetry)
+	}
+	for _, w := range r.When {
+		if !retryWhenValues[w] {
+			return fmt.Errorf("unknown retry condition %q", w)
+		}
+	}
+	return nil
+}
+
+// ValidationError 流水线定义校验错误，汇总所有问题一次性返回
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid pipeline: " + strings.Join(e.Problems, "; ")
+}
+
+// stringList 兼容单个字符串或字符串列表两种写法
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*l = stringList{n.Value}
+		return nil
+	}
+	var items []string
+	if err := n.Decode(&items); err != nil {
+		return err
+	}
+	*l = items
+	return nil
+}
+
+// rawRetry 兼容 retry: 2 与 retry: {max: 2, when: [...]} 两种写法
+type rawRetry struct {
+	Max  int        `yaml:"max"`
+	When stringList `yaml:"when"`
+}
+
+func (r *rawRetry) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		return n.Decode(&r.Max)
+	}
+	type plain rawRetry
+	return n.Decode((*plain)(r))
+}
+
+// rawJob 任务的 YAML 结构
+type rawJob struct {
+	Stage     string            `yaml:"stage"`
+	Script    stringList        `yaml:"script"`
+	Needs     *stringList       `yaml:"needs"`
+	Variables map[string]string `yaml:"variables"`
+	Only      stringList        `yaml:"only"`
+	Except    stringList        `yaml:"except"`
+	Timeout   string            `yaml:"timeout"`
+	Artifacts *rawArtifacts     `yaml:"artifacts"`
+	Retry     rawRetry          `yaml:"retry"`
+	When      string            `yaml:"when"`
+}
+
+// rawArtifacts 产物声明的 YAML 结构
+type rawArtifacts struct {
+	Paths    stringList `yaml:"paths"`
+	ExpireIn string     `yaml:"expire_in"`
+}
+
+// Parse 解析并校验流水线定义
+// 顶层 stages/variables 为保留键，以 . 开头的键视为隐藏模板被忽略，其余键均为任务
+func Parse(data []byte) (*Pipeline, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, &ValidationError{Problems: []string{err.Error()}}
+	}
+	p := &Pipeline{Variables: map[string]string{}}
+	if len(root.Content) == 0 {
+		return nil, &ValidationError{Problems: []string{"empty pipeline file"}}
+	}
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil, &ValidationError{Problems: []string{"top level must be a mapping"}}
+	}
+	var problems []string
+	// 按文件顺序遍历键值对，保证任务顺序稳定
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		key, val := doc.Content[i].Value, doc.Content[i+1]
+		switch {
+		case key == "stages":
+			if err := val.Decode(&p.Stages); err != nil {
+				problems = append(problems, fmt.Sprintf("stages: %v", err))
+			}
+		case key == "variables":
+			if err := val.Decode(&p.Variables); err != nil {
+				problems = append(problems, fmt.Sprintf("variables: %v", err))
+			}
+		case strings.HasPrefix(key, "."):
+			continue
+		default:
+			var rj rawJob
+			if err := val.Decode(&rj); err != nil {
+				problems = append(problems, fmt.Sprintf("job %s: %v", key, err))
+				continue
+			}
+			j, errs := buildJob(key, rj)
+			problems = append(problems, errs...)
+			p.Jobs = append(p.Jobs, j)
+		}
+	}
+	if len(p.Stages) == 0 {
+		p.Stages = DefaultStages
+	}
+	problems = append(problems, p.validate()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return p, nil
+}
+
+// buildJob 将 YAML 结构转换为任务定义并检查字段
+func buildJob(name string, rj rawJob) (*Job, []string) {
+	var problems []string
+	j := &Job{
+		Name:      name,
+		Stage:     rj.Stage,
+		Script:    rj.Script,
+		Variables: rj.Variables,
+		Only:      rj.Only,
+		Except:    rj.Except,
+		Retry:     Retry{Max: rj.Retry.Max, When: rj.Retry.When},
+	}
+	if j.Stage == "" {
+		j.Stage = defaultStage
+	}
+	if rj.Needs != nil {
+		j.Needs = *rj.Needs
+		j.hasNeeds = true
+	}
+	if len(j.Script) == 0 {
+		problems = append(problems, fmt.Sprintf("job %s: script required", name))
+	}
+	switch rj.When {
+	case "", "on_success":
+	case "manual":
+		j.Manual = true
+	default:
+		problems = append(problems, fmt.Sprintf("job %s: unknown when %q (expected on_success or manual)", name, rj.When))
+	}
+	if rj.Timeout != "" {
+		d, err := parseTimeout(rj.Timeout)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("job %s: invalid timeout %q", name, rj.Timeout))
+		}
+		j.Timeout = d
+	}
+	if err := ValidateRetry(j.Retry); err != nil {
+		problems = append(problems, fmt.Sprintf("job %s: %v", name, err))
+	}
+	if rj.Artifacts != nil {
+		problems = append(problems, buildArtifacts(name, *rj.Artifacts, &j.Artifacts)...)
+	}
+	for _, pat := range append(append([]string(nil), j.Only...), j.Except...) {
+		if _, err := MatchBranch(pat, ""); err != nil {
+			problems = append(problems, fmt.Sprintf("job %s: invalid branch pattern %q", name, pat))
+		}
+	}
+	return j, problems
+}
+
+// buildArtifacts 检查产物路径并解析保留时长
+func buildArtifacts(name string, ra rawArtifacts, a *Artifacts) []string {
+	var problems []string
+	if len(ra.Paths) == 0 {
+		problems = append(problems, fmt.Sprintf("job %s: artifacts paths required", name))
+	}
+	for _, p := range ra.Paths {
+		clean, err := CleanArtifactPath(p)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("job %s: %v", name, err))
+			continue
+		}
+		a.Paths = append(a.Paths, clean)
+	}
+	if ra.ExpireIn != "" {
+		d, never, err := parseExpireIn(ra.ExpireIn)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("job %s: invalid artifacts expire_in %q", name, ra.ExpireIn))
+		}
+		a.ExpireIn, a.Never = d, never
+	}
+	return problems
+}
+
+// CleanArtifactPath 规范化产物路径：必须是工作区内的相对路径，且通配符语法合法
+func CleanArtifactPath(p string) (string, error) {
+	clean := path.Clean(strings.TrimSpace(p))
+	if p == "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("artifact path %q must stay inside the workspace", p)
+	}
+	if _, err := path.Match(clean, ""); err != nil {
+		return "", fmt.Errorf("invalid artifact path %q", p)
+	}
+	return clean, nil
+}
+
+// expireUnits expire_in 支持的自然语言时间单位
+var expireUnits = map[string]time.Duration{
+	"sec": time.Second, "second": time.Second,
+	"min": time.Minute, "minute": time.Minute,
+	"hr": time.Hour, "hour": time.Hour,
+	"day": 24 * time.Hour, "week": 7 * 24 * time.Hour,
+}
+
+// parseExpireIn 解析产物保留时长：never、Go 时长写法（72h）或“数量 单位”（30 mins、1 week）
+func parseExpireIn(s string) (time.Duration, bool, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if s == "never" {
+		return 0, true, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		if d <= 0 {
+			return 0, false, fmt.Errorf("expire_in must be positive")
+		}
+		return d, false, nil
+	}
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return 0, false, fmt.Errorf("unsupported expire_in")
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n <= 0 {
+		return 0, false, fmt.Errorf("expire_in must be a positive number")
+	}
+	unit, ok := expireUnits[strings.TrimSuffix(fields[1], "s")]
+	if !ok {
+		return 0, false, fmt.Errorf("unknown unit %s", fields[1])
+	}
+	return time.Duration(n) * unit, false, nil
+}
+
+// parseTimeout 支持 Go 时长写法（10m、1h30m）或纯数字秒数
+func parseTimeout(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n <= 0 {
+			return 0, fmt.Errorf("timeout must be positive")
+		}
+		return time.Duration(n) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("timeout must be positive")
+	}
+	return d, nil
+}
+
+// validate 校验阶段、依赖与循环引用
+func (p *Pipeline) validate() []string {
+	var problems []string
+	stageIdx := p.stageIndex()
+	byName := make(map[string]*Job, len(p.Jobs))
+	for _, j := range p.Jobs {
+		byName[j.Name] = j
+		if _, ok := stageIdx[j.Stage]; !ok {
+			problems = append(problems, fmt.Sprintf("job %s: unknown stage %s", j.Name, j.Stage))
+		}
+	}
+	if len(p.Jobs) == 0 {
+		problems = append(problems, "no jobs defined")
+	}
+	for _, j := range p.Jobs {
+		for _, n := range j.Needs {
+			dep, ok := byName[n]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("job %s: needs unknown job %s", j.Name, n))
+				continue
+			}
+			if stageIdx[dep.Stage] > stageIdx[j.Stage] {
+				problems = append(problems, fmt.Sprintf("job %s: needs %s from a later stage", j.Name, n))
+			}
+		}
+	}
+	if len(problems) == 0 {
+		if cycle := findCycle(p.Jobs, byName); cycle != "" {
+			problems = append(problems, "needs cycle: "+cycle)
+		}
+	}
+	return problems
+}
+
+func (p *Pipeline) stageIndex() map[string]int {
+	idx := make(map[string]int, len(p.Stages))
+	for i, s := range p.Stages {
+		idx[s] = i
+	}
+	return idx
+}
+
+// findCycle 深度优先检测 needs 循环，返回形如 a -> b -> a 的路径
+func findCycle(jobs []*Job, byName map[string]*Job) string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(jobs))
+	var stack []string
+	var visit func(name string) string
+	visit = func(name string) string {
+		switch state[name] {
+		case visiting:
+			return strings.Join(append(stack, name), " -> ")
+		case done:
+			return ""
+		}
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, n := range byName[name].Needs {
+			if c := visit(n); c != "" {
+				return c
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = done
+		return ""
+	}
+	for _, j := range jobs {
+		if c := visit(j.Name); c != "" {
+			return c
+		}
+	}
+	return ""
+}
+
+// ForBranch 按 only/except 规则筛选出分支需要运行的任务
+// 返回的任务按阶段顺序排列，并把隐式依赖（前序阶段全部任务）展开为显式 needs
+func (p *Pipeline) ForBranch(branch string) ([]*Job, error) {
+	var selected []*Job
+	for _, j := range p.Jobs {
+		if j.runsOn(branch) {
+			selected = append(selected, j)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, &ValidationError{Problems: []string{fmt.Sprintf("no jobs match branch %s", branch)}}
+	}
+	stageIdx := p.stageIndex()
+	sort.SliceStable(selected, func(a, b int) bool { return stageIdx[selected[a].Stage] < stageIdx[selected[b].Stage] })
+	present := make(map[string]bool, len(selected))
+	for _, j := range selected {
+		present[j.Name] = true
+	}
+	var problems []string
+	out := make([]*Job, 0, len(selected))
+	for _, j := range selected {
+		cp := *j
+		cp.Variables = mergeVariables(p.Variables, j.Variables)
+		if j.hasNeeds {
+			for _, n := range j.Needs {
+				if !present[n] {
+					problems = append(problems, fmt.Sprintf("job %s: needs %s which does not run on branch %s", j.Name, n, branch))
+				}
+			}
+		} else {
+			cp.Needs = nil
+			for _, prev := range selected {
+				if stageIdx[prev.Stage] < stageIdx[j.Stage] {
+					cp.Needs = append(cp.Needs, prev.Name)
+				}
+			}
+		}
+		out = append(out, &cp)
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return out, nil
+}
+
+// runsOn 判断任务是否在指定分支上运行：先匹配 only，再排除 except
+func (j *Job) runsOn(branch string) bool {
+	if len(j.Only) > 0 {
+		matched := false
+		for _, pat := range j.Only {
+			if ok, _ := MatchBranch(pat, branch); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, pat := range j.Except {
+		if ok, _ := MatchBranch(pat, branch); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchBranch 分支匹配：/.../ 包裹的按正则匹配，其余按通配符匹配（* 可跨越 /）
+func MatchBranch(pattern, branch string) (bool, error) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(branch), nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return false, err
+	}
+	// release/* 需要匹配 release/1.0/hotfix：把 / 视为普通字符再匹配
+	ok, _ := path.Match(strings.ReplaceAll(pattern, "/", "\x00"), strings.ReplaceAll(branch, "/", "\x00"))
+	return ok, nil
+}
+
+// mergeVariables 合并全局变量与任务变量，任务变量优先
+func mergeVariables(global, local map[string]string) map[string]string {
+	out := make(map[string]string, len(global)+len(local))
+	for k, v := range global {
+		out[k] = v
+	}
+	for k, v := range local {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,164 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sample = `
+stages: [build, test, deploy]
+variables:
+  GOFLAGS: -mod=mod
+.template:
+  script: echo hidden
+build:
+  stage: build
+  script:
+    - go build ./...
+  timeout: 10m
+unit:
+  stage: test
+  script: go test ./...
+  variables:
+    GOFLAGS: -count=1
+lint:
+  stage: test
+  needs: []
+  script: go vet ./...
+deploy:
+  stage: deploy
+  needs: [unit]
+  script: ./deploy.sh
+  only: [main, /^release\/.+$/]
+`
+
+func TestParseAndExpandForBranch(t *testing.T) {
+	p, err := Parse([]byte(sample))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(p.Jobs) != 4 {
+		t.Fatalf("expected 4 jobs, got %d", len(p.Jobs))
+	}
+	jobs, err := p.ForBranch("release/1.2")
+	if err != nil {
+		t.Fatalf("for branch: %v", err)
+	}
+	byName := map[string]*Job{}
+	var order []string
+	for _, j := range jobs {
+		byName[j.Name] = j
+		order = append(order, j.Name)
+	}
+	if strings.Join(order, ",") != "build,unit,lint,deploy" {
+		t.Fatalf("unexpected order: %v", order)
+	}
+	if byName["build"].Timeout != 10*time.Minute {
+		t.Fatalf("timeout not parsed: %v", byName["build"].Timeout)
+	}
+	if got := strings.Join(byName["unit"].Needs, ","); got != "build" {
+		t.Fatalf("implicit needs = %q", got)
+	}
+	if len(byName["lint"].Needs) != 0 {
+		t.Fatalf("explicit empty needs should not wait: %v", byName["lint"].Needs)
+	}
+	if byName["unit"].Variables["GOFLAGS"] != "-count=1" || byName["build"].Variables["GOFLAGS"] != "-mod=mod" {
+		t.Fatalf("variables not merged: %v / %v", byName["unit"].Variables, byName["build"].Variables)
+	}
+
+	jobs, err = p.ForBranch("feature/x")
+	if err != nil {
+		t.Fatalf("for branch: %v", err)
+	}
+	for _, j := range jobs {
+		if j.Name == "deploy" {
+			t.Fatalf("deploy should only run on main/release branches")
+		}
+	}
+}
+
+func TestParseValidationErrors(t *testing.T) {
+	cases := map[string]string{
+		"unknown stage":               "a:\n  stage: nope\n  script: x\n",
+		"script required":             "a:\n  stage: build\n",
+		"needs unknown":               "a:\n  script: x\n  needs: [b]\n",
+		"later stage":                 "a:\n  stage: build\n  script: x\n  needs: [b]\nb:\n  stage: deploy\n  script: x\n",
+		"needs cycle":                 "a:\n  script: x\n  needs: [b]\nb:\n  script: x\n  needs: [a]\n",
+		"invalid timeout":             "a:\n  script: x\n  timeout: soon\n",
+		"inside the workspace":        "a:\n  script: x\n  artifacts:\n    paths: [../secret]\n",
+		"invalid artifacts expire_in": "a:\n  script: x\n  artifacts:\n    paths: [dist]\n    expire_in: 3 fortnights\n",
+		"no jobs defined":             "stages: [build]\n",
+	}
+	for want, src := range cases {
+		_, err := Parse([]byte(src))
+		var ve *ValidationError
+		if !errors.As(err, &ve) {
+			t.Fatalf("%s: expected ValidationError, got %v", want, err)
+		}
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: unexpected message %q", want, err.Error())
+		}
+	}
+}
+
+func TestForBranchMissingNeeds(t *testing.T) {
+	p, err := Parse([]byte("a:\n  script: x\n  only: [main]\nb:\n  script: x\n  needs: [a]\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if _, err := p.ForBranch("dev"); err == nil || !strings.Contains(err.Error(), "does not run on branch dev") {
+		t.Fatalf("expected missing needs error, got %v", err)
+	}
+}
+
+func TestParseArtifacts(t *testing.T) {
+	src := "a:\n  script: x\n  artifacts:\n    paths: [dist/, ./bin/*.tar.gz]\n    expire_in: 1 week\n" +
+		"b:\n  script: x\n  artifacts:\n    paths: coverage.out\n    expire_in: never\n"
+	p, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	a := p.Jobs[0].Artifacts
+	if strings.Join(a.Paths, ",") != "dist,bin/*.tar.gz" || a.ExpireIn != 7*24*time.Hour || a.Never {
+		t.Fatalf("unexpected artifacts: %+v", a)
+	}
+	b := p.Jobs[1].Artifacts
+	if strings.Join(b.Paths, ",") != "coverage.out" || !b.Never {
+		t.Fatalf("unexpected artifacts: %+v", b)
+	}
+}
+
+func TestParseRetry(t *testing.T) {
+	p, err := Parse([]byte("a:\n  script: x\n  retry: 2\nb:\n  script: x\n  retry:\n    max: 1\n    when: [script_failure, job_timeout]\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if p.Jobs[0].Retry.Max != 2 || len(p.Jobs[0].Retry.When) != 0 {
+		t.Fatalf("unexpected retry: %+v", p.Jobs[0].Retry)
+	}
+	if p.Jobs[1].Retry.Max != 1 || strings.Join(p.Jobs[1].Retry.When, ",") != "script_failure,job_timeout" {
+		t.Fatalf("unexpected retry: %+v", p.Jobs[1].Retry)
+	}
+	for _, src := range []string{"a:\n  script: x\n  retry: 5\n", "a:\n  script: x\n  retry:\n    max: 1\n    when: [flaky]\n"} {
+		var ve *ValidationError
+		if _, err := Parse([]byte(src)); !errors.As(err, &ve) {
+			t.Fatalf("expected validation error for %q, got %v", src, err)
+		}
+	}
+}
+
+func TestParseWhen(t *testing.T) {
+	p, err := Parse([]byte("build:\n  script: x\n  when: on_success\ndeploy:\n  script: x\n  when: manual\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if p.Jobs[0].Manual || !p.Jobs[1].Manual {
+		t.Fatalf("unexpected when: %v %v", p.Jobs[0].Manual, p.Jobs[1].Manual)
+	}
+	var ve *ValidationError
+	if _, err := Parse([]byte("a:\n  script: x\n  when: always\n")); !errors.As(err, &ve) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+}
@@ -1,91 +1,283 @@
 package queue
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"time"
 	"webci-refactored/internal/config"
 	"webci-refactored/internal/dal/model"
 	"webci-refactored/internal/dal/repository"
-
-	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
+	"webci-refactored/internal/secret"
+	variablesvc "webci-refactored/internal/service/variable"
 )
 
 // dispatcher 任务调度器
-// 从队列中取出 jobID 并执行 Mock 构建
+// 在执行器数量上限内从数据库认领 pending 任务并交给执行器运行；
+// 被唤醒（入队或有执行器空闲）或轮询到期时再次认领
 func dispatcher() {
-	repo := repository.NewJobRepository(globalDB)
-	branches := repository.NewBranchRepository(globalDB)
-	envs := repository.NewEnvironmentRepository(globalDB)
 	cfg := config.Load()
-	for id := range jobQueue {
-		go func(jobID uint64) {
-			// 并发执行：每个任务一个 goroutine，模拟构建流水线
-			log.Printf("dispatch job=%d", jobID)
-			now := time.Now()
-			// 状态切换为 running，并记录开始时间
-			if err := repo.UpdateStatus(jobID, "running"); err != nil {
-				log.Printf("status running err: %v", err)
-				return
-			}
-			if err := repo.UpdateTimes(jobID, &now, nil); err != nil {
-				log.Printf("start time err: %v", err)
-			}
-			_ = repo.AppendLog(jobID, fmt.Sprintf("[START] job %d at %s\n", jobID, now.Format(time.RFC3339)))
-			// 模拟执行耗时：2~5 秒随机
-			dur := time.Duration(2+rand.Intn(4)) * time.Second
-			_ = repo.AppendLog(jobID, fmt.Sprintf("[RUNNING] executing for %s...\n", dur))
-			time.Sleep(dur)
-			end := time.Now()
-			// 取消优先：被标记取消的任务直接失败并记录日志
-			if IsCanceled(jobID) {
-				_ = repo.UpdateTimes(jobID, nil, &end)
-				_ = repo.UpdateStatus(jobID, "failed")
-				_ = repo.AppendLog(jobID, "[FAILED] job cancelled\n")
-				return
+	repo := repository.NewJobRepository(globalDB)
+	// 执行器槽位：容量即本实例同时运行的任务上限
+	slots := make(chan struct{}, cfg.WorkerCount)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	lastRecover := time.Now()
+	for {
+	claim:
+		for {
+			select {
+			case slots <- struct{}{}:
+			default:
+				// 执行器已满：剩余任务留在 pending，等待槽位释放
+				break claim
 			}
-			// 随机成功/失败：70% 成功率用于演示
-			ok := rand.Intn(100) >= 30
-			_ = repo.UpdateTimes(jobID, nil, &end)
-			if ok {
-				_ = repo.UpdateStatus(jobID, "success")
-				_ = repo.AppendLog(jobID, "[SUCCESS] job finished\n")
-				j, _ := repo.Get(jobID)
-				if cfg.RepoPath != "" {
-					if r, err := git.PlainOpen(cfg.RepoPath); err == nil {
-						b, _ := branches.Get(j.BranchID)
-						if b != nil {
-							ref := plumbing.ReferenceName("refs/heads/" + b.Name)
-							if rf, err2 := r.Reference(ref, true); err2 == nil {
-								if co, err3 := r.CommitObject(rf.Hash()); err3 == nil {
-									ct := co.Author.When
-									globalDB.Model(&model.Job{}).Where("id = ?", jobID).Updates(map[string]interface{}{
-										"commit_id":      rf.Hash().String(),
-										"commit_message": co.Message,
-										"commit_author":  co.Author.Name,
-										"commit_time":    ct,
-									})
-								}
-							}
-						}
-					}
-				}
-				if j.EnvID > 0 {
-					e, _ := envs.Get(j.EnvID)
-					if e != nil {
-						t := time.Now()
-						globalDB.Model(&model.Environment{}).Where("id = ?", j.EnvID).Updates(map[string]interface{}{
-							"current_deploy_commit": j.CommitID,
-							"current_deploy_at":     t,
-						})
-					}
+			j, err := repo.ClaimNext(workerID, leaseTTL)
+			if err != nil || j == nil {
+				<-slots
+				if err != nil {
+					log.Printf("claim job err: %v", err)
 				}
-			} else {
-				_ = repo.UpdateStatus(jobID, "failed")
-				_ = repo.AppendLog(jobID, "[FAILED] build failed\n")
+				break
 			}
-		}(id)
+			go func() {
+				defer func() {
+					<-slots
+					wake()
+				}()
+				runJob(cfg, j)
+			}()
+		}
+		// 周期性维护：其他实例崩溃遗留的任务在租约过期后重新入队；回收超时无结果的任务；
+		// 放行遗留的自动重试任务；已结束任务的日志压缩归档；清理过期产物
+		if time.Since(lastRecover) >= leaseTTL {
+			recoverExpired()
+			reapOverdue(cfg)
+			releaseStaleRetries()
+			archiveLogs()
+			purgeArtifacts(cfg)
+			lastRecover = time.Now()
+		}
+		select {
+		case <-wakeCh:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runJob 执行单个已认领的构建任务
+// 检出分支到独立工作区，逐个运行构建步骤，并根据退出码更新任务状态
+func runJob(cfg config.Config, j *model.Job) {
+	repo := repository.NewJobRepository(globalDB)
+	branches := repository.NewBranchRepository(globalDB)
+	jobID := j.ID
+	log.Printf("dispatch job=%d attempt=%d", jobID, j.Attempts)
+
+	// 流水线子任务：结束后推进同一流水线中的后续任务
+	if j.PipelineID > 0 {
+		defer advancePipeline(j.PipelineID)
+	}
+	defer func() { _ = repo.ReleaseLease(jobID, workerID) }()
+	// 排队期间已被取消：不再执行
+	if j.CancelRequested {
+		finish(jobID, model.JobStatusCanceled, "canceled before start", "[CANCELED] job canceled\n")
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var leaseLost atomic.Bool
+	go heartbeat(ctx, repo, jobID, cancel, &leaseLost)
+	// 超时到期后取消执行上下文，步骤所在的进程组随之被终止
+	timeout := jobTimeout(cfg, j)
+	runCtx, cancelTimeout := context.WithTimeout(ctx, timeout)
+	defer cancelTimeout()
+	trackRunning(jobID, cancel)
+	defer untrackRunning(jobID)
+
+	if j.PipelineID > 0 {
+		advancePipeline(j.PipelineID)
+	}
+	_ = repo.AppendLog(jobID, fmt.Sprintf("[START] job %d at %s on %s, timeout %s\n", jobID, time.Now().Format(time.RFC3339), workerID, timeout))
+
+	// 解析环境与任务变量；密文变量的值在写入日志前被掩码
+	vars, err := variablesvc.NewService(globalDB).Resolve(j)
+	if err != nil {
+		fail(j, model.JobStatusFailed, model.FailureSystem, err.Error(), fmt.Sprintf("[FAILED] %v\n", err))
+		return
+	}
+	out := newLogWriter(func(text string) error { return repo.AppendLog(jobID, secret.MaskText(text, vars.Secrets)) })
+	workspace := filepath.Join(cfg.WorkspaceDir, fmt.Sprintf("job-%d", jobID))
+	defer os.RemoveAll(workspace)
+	runErr := execute(runCtx, cfg, j, branches, workspace, vars.Env, out)
+	_ = out.Flush()
+
+	// 租约已被其他实例接管：结果由新的执行者负责写回
+	if leaseLost.Load() {
+		log.Printf("job=%d lease lost, discarding result", jobID)
+		return
+	}
+	// 取消优先：被标记取消的任务转为 canceled 并记录日志
+	if IsCanceled(jobID) {
+		finish(jobID, model.JobStatusCanceled, "canceled", "[CANCELED] job canceled\n")
+		return
+	}
+	if errors.Is(runErr, context.DeadlineExceeded) {
+		fail(j, model.JobStatusTimedOut, model.FailureTimeout, "exceeded timeout of "+timeout.String(), fmt.Sprintf("[TIMED OUT] job exceeded timeout of %s and was killed\n", timeout))
+		return
+	}
+	if runErr != nil {
+		fail(j, model.JobStatusFailed, failureReason(runErr), runErr.Error(), fmt.Sprintf("[FAILED] %v\n", runErr))
+		return
+	}
+	// 部署记录由任务服务在状态转换时写入
+	finish(jobID, model.JobStatusSuccess, "", "[SUCCESS] job finished\n")
+}
+
+// finish 将执行中的任务转为终态，记录结束时间并追加结果日志
+// 任务状态已被他处修改（如手动设置）时不覆盖，返回 false
+func finish(id uint64, status, note, logText string) bool {
+	if !setStatus(id, model.JobStatusRunning, status, workerID, note) {
+		return false
+	}
+	// 先写日志再写结束时间：日志流以结束时间判定日志已完整
+	repo := repository.NewJobRepository(globalDB)
+	_ = repo.AppendLog(id, logText)
+	end := time.Now()
+	_ = repo.UpdateTimes(id, nil, &end)
+	return true
+}
+
+// fail 将执行中的任务转为失败终态并记录失败原因，满足自动重试策略时放行重试任务
+func fail(j *model.Job, status, reason, note, logText string) {
+	// 任务已被回收流程结束（如超时回收）：不再重复处理，也不创建重试
+	if cur, err := repository.NewJobRepository(globalDB).Get(j.ID); err != nil || cur.Status != model.JobStatusRunning {
+		return
+	}
+	retry := prepareRetry(j, reason)
+	ok := finish(j.ID, status, note, logText)
+	if ok {
+		_ = repository.NewJobRepository(globalDB).SetFailureReason(j.ID, reason)
+	}
+	releaseRetry(retry, ok)
+}
+
+// jobTimeout 任务生效的超时：任务声明优先，其次为环境设置，最后为服务默认值
+func jobTimeout(cfg config.Config, j *model.Job) time.Duration {
+	if j.TimeoutSeconds > 0 {
+		return time.Duration(j.TimeoutSeconds) * time.Second
+	}
+	if j.EnvID > 0 {
+		if e, err := repository.NewEnvironmentRepository(globalDB).Get(j.EnvID); err == nil && e.TimeoutSeconds > 0 {
+			return time.Duration(e.TimeoutSeconds) * time.Second
+		}
+	}
+	return cfg.JobTimeout
+}
+
+// errArtifacts 产物收集失败
+var errArtifacts = errors.New("artifacts")
+
+// failureReason 按执行错误归类失败原因
+func failureReason(err error) string {
+	var stepErr *StepError
+	switch {
+	case errors.As(err, &stepErr):
+		return model.FailureScript
+	case errors.Is(err, errArtifacts):
+		return model.FailureArtifact
+	default:
+		return model.FailureSystem
+	}
+}
+
+// heartbeat 定期续期任务租约，并同步其他实例写入的取消请求
+// 续期失败说明租约已被恢复流程接管，此时终止本地执行
+func heartbeat(ctx context.Context, repo *repository.JobRepository, id uint64, cancel context.CancelFunc, lost *atomic.Bool) {
+	t := time.NewTicker(leaseTTL / 3)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		ok, err := repo.ExtendLease(id, workerID, time.Now().Add(leaseTTL))
+		if err != nil {
+			log.Printf("extend lease job=%d err: %v", id, err)
+			continue
+		}
+		if !ok {
+			lost.Store(true)
+			cancel()
+			return
+		}
+		if c, _ := repo.IsCancelRequested(id); c {
+			cancel()
+		}
+	}
+}
+
+// execute 准备工作区并运行任务声明的构建步骤，vars 为已解析的变量（KEY=VALUE）
+func execute(ctx context.Context, cfg config.Config, j *model.Job, branches *repository.BranchRepository, workspace string, vars []string, out *logWriter) error {
+	b, err := branches.Get(j.BranchID)
+	if err != nil {
+		return fmt.Errorf("load branch %d: %w", j.BranchID, err)
+	}
+	if err := os.RemoveAll(workspace); err != nil {
+		return err
+	}
+	if cfg.RepoPath == "" {
+		// 未配置仓库路径（演示模式）：使用空工作区运行步骤
+		fmt.Fprintf(out, "[CHECKOUT] REPO_PATH not configured, using empty workspace\n")
+		if err := os.MkdirAll(workspace, 0o755); err != nil {
+			return err
+		}
+	} else {
+		co, err := checkoutRevision(ctx, cfg.RepoPath, b.Name, j.CommitID, workspace)
+		if err != nil {
+			return fmt.Errorf("checkout: %w", err)
+		}
+		fmt.Fprintf(out, "[CHECKOUT] %s at %s\n", b.Name, co.Hash)
+		// 回写检出的提交信息，便于页面展示与环境部署记录
+		globalDB.Model(&model.Job{}).Where("id = ?", j.ID).Updates(map[string]interface{}{
+			"commit_id":      co.Hash,
+			"commit_message": co.Message,
+			"commit_author":  co.Author,
+			"commit_time":    co.When,
+		})
+		j.CommitID = co.Hash
+	}
+	if len(j.Steps) == 0 {
+		fmt.Fprintf(out, "[INFO] no steps declared\n")
+		return collectArtifacts(cfg, j, workspace, out)
+	}
+	env := append(os.Environ(),
+		fmt.Sprintf("CI_JOB_ID=%d", j.ID),
+		"CI_JOB_NAME="+j.Name,
+		"CI_JOB_STAGE="+j.Stage,
+		"CI_COMMIT_BRANCH="+b.Name,
+		"CI_COMMIT_SHA="+j.CommitID,
+		"CI_PROJECT_DIR="+workspace,
+	)
+	env = append(env, vars...)
+	if err := runSteps(ctx, workspace, j.Steps, env, out); err != nil {
+		return err
+	}
+	return collectArtifacts(cfg, j, workspace, out)
+}
+
+// collectArtifacts 步骤全部成功后收集任务声明的产物，超出大小上限或写入失败时任务失败
+func collectArtifacts(cfg config.Config, j *model.Job, workspace string, out *logWriter) error {
+	if len(j.ArtifactPaths) == 0 {
+		return nil
+	}
+	_, err := newArtifactService(cfg).Collect(j, workspace, out)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errArtifacts, err)
 	}
+	return nil
 }
@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"log"
+	"time"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+	jobsvc "webci-refactored/internal/service/job"
+)
+
+// StartPipeline 启动流水线：放行没有依赖或依赖已满足的子任务
+// 之后每个子任务开始与结束时，执行器都会再次推进该流水线
+func StartPipeline(id uint64) { advancePipeline(id) }
+
+// advancePipeline 推进流水线
+// 依赖全部成功的 created 子任务转为 pending 并入队（手动任务转为 manual 等待放行）；依赖未成功的子任务标记为 skipped；
+// 流水线被取消时未放行的子任务转为 canceled；最后根据子任务状态汇总父任务状态
+func advancePipeline(id uint64) {
+	repo := repository.NewJobRepository(globalDB)
+	all, err := repo.ListByPipeline(id)
+	if err != nil {
+		log.Printf("load pipeline=%d err: %v", id, err)
+		return
+	}
+	// 被自动重试取代的子任务不再参与推进与汇总
+	children := jobsvc.LatestAttempts(all)
+	canceled := IsCanceled(id)
+	statusByName := make(map[string]string, len(children))
+	for _, c := range children {
+		statusByName[c.Name] = c.Status
+	}
+	// 子任务按定义顺序排列，下游任务总在上游之后，单次遍历即可传播跳过状态
+	for i := range children {
+		c := &children[i]
+		if c.Status != model.JobStatusCreated {
+			continue
+		}
+		if canceled {
+			if setStatus(c.ID, model.JobStatusCreated, model.JobStatusCanceled, actorPipeline, "pipeline canceled") {
+				closeUnstarted(repo, c.ID, "[CANCELED] pipeline canceled\n")
+			}
+			c.Status = model.JobStatusCanceled
+			statusByName[c.Name] = c.Status
+			continue
+		}
+		reason := ""
+		ready := true
+		for _, n := range c.Needs {
+			switch statusByName[n] {
+			case model.JobStatusSuccess:
+			case model.JobStatusFailed, model.JobStatusSkipped, model.JobStatusCanceled, model.JobStatusTimedOut:
+				if reason == "" {
+					reason = "dependency " + n + " did not succeed"
+				}
+			default:
+				ready = false
+			}
+		}
+		switch {
+		case reason != "":
+			if setStatus(c.ID, model.JobStatusCreated, model.JobStatusSkipped, actorPipeline, reason) {
+				closeUnstarted(repo, c.ID, "[SKIPPED] "+reason+"\n")
+			}
+			c.Status = model.JobStatusSkipped
+		case ready && c.Manual:
+			setStatus(c.ID, model.JobStatusCreated, model.JobStatusManual, actorPipeline, "needs satisfied, waiting for manual action")
+			c.Status = model.JobStatusManual
+		case ready:
+			if setStatus(c.ID, model.JobStatusCreated, model.JobStatusPending, actorPipeline, "needs satisfied") {
+				Enqueue(c.ID)
+			}
+			c.Status = model.JobStatusPending
+		}
+		statusByName[c.Name] = c.Status
+	}
+	updatePipelineStatus(repo, id, children, canceled)
+}
+
+// closeUnstarted 为未执行即结束的子任务写入原因与结束时间
+func closeUnstarted(repo *repository.JobRepository, id uint64, logText string) {
+	_ = repo.AppendLog(id, logText)
+	now := time.Now()
+	_ = repo.UpdateTimes(id, nil, &now)
+}
+
+// updatePipelineStatus 汇总子任务状态写回父任务，并在流水线结束时记录时间与部署
+func updatePipelineStatus(repo *repository.JobRepository, id uint64, children []model.Job, canceled bool) {
+	parent, err := repo.Get(id)
+	if err != nil {
+		return
+	}
+	statuses := make([]string, 0, len(children))
+	for _, c := range children {
+		statuses = append(statuses, c.Status)
+	}
+	next := aggregateStatus(statuses, canceled)
+	if next == parent.Status {
+		return
+	}
+	now := time.Now()
+	// 子任务在父任务切到 running 前就已结束（并发推进丢失了中间状态）：先补记 running，保证事件序列合法
+	// 未开始即被取消的流水线可直接转为 canceled
+	if parent.Status == model.JobStatusPending && next != model.JobStatusRunning && next != model.JobStatusCanceled {
+		if !setStatus(id, model.JobStatusPending, model.JobStatusRunning, actorPipeline, "") {
+			return
+		}
+		parent.Status = model.JobStatusRunning
+		if parent.StartTime == nil {
+			_ = repo.UpdateTimes(id, &now, nil)
+		}
+	}
+	// 条件更新：并发推进时只有一方能完成同一次状态切换
+	if !setStatus(id, parent.Status, next, actorPipeline, "") {
+		return
+	}
+	switch next {
+	case model.JobStatusRunning:
+		if parent.StartTime == nil {
+			_ = repo.UpdateTimes(id, &now, nil)
+		}
+	case model.JobStatusSuccess, model.JobStatusFailed, model.JobStatusCanceled:
+		_ = repo.AppendLog(id, "[PIPELINE] finished with status "+next+"\n")
+		_ = repo.UpdateTimes(id, nil, &now)
+	}
+}
+
+// aggregateStatus 流水线状态汇总规则
+// 全部结束：存在失败则 failed，存在取消或流水线被取消则 canceled，否则 success；
+// 有任务已开始则 running；否则 pending
+func aggregateStatus(statuses []string, canceled bool) string {
+	done, started, failed := true, false, false
+	for _, s := range statuses {
+		switch s {
+		case model.JobStatusSuccess:
+			started = true
+		case model.JobStatusFailed, model.JobStatusTimedOut:
+			started, failed = true, true
+		case model.JobStatusCanceled:
+			canceled = true
+		case model.JobStatusSkipped:
+		case model.JobStatusRunning, model.JobStatusWaitingRetry:
+			// 等待放行的自动重试说明原任务已执行过
+			started, done = true, false
+		default:
+			done = false
+		}
+	}
+	switch {
+	case done && failed:
+		return model.JobStatusFailed
+	case done && canceled:
+		return model.JobStatusCanceled
+	case done:
+		return model.JobStatusSuccess
+	case started:
+		return model.JobStatusRunning
+	default:
+		return model.JobStatusPending
+	}
+}
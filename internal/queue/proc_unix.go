@@ -0,0 +1,33 @@
+//go:build !windows
+
+package queue
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup 让构建步骤运行在独立进程组中，便于整体终止
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup 向整个进程组发送 SIGKILL，连同步骤派生的子进程一起终止
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// processAlive 判断本机进程 pid 是否存在：信号 0 只做存在性检查，EPERM 说明进程存在但属于其他用户
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// shellCommand 使用 sh -c 执行单条构建步骤
+func shellCommand(ctx context.Context, step string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", step)
+}
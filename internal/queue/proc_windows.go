@@ -0,0 +1,35 @@
+//go:build windows
+
+package queue
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup Windows 下不支持进程组，保持默认行为
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup Windows 下仅终止步骤进程本身
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+// processAlive 判断本机进程 pid 是否存在：进程不存在时 FindProcess 返回错误
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
+
+// shellCommand 使用 cmd /C 执行单条构建步骤
+func shellCommand(ctx context.Context, step string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", step)
+}
@@ -1,50 +1,363 @@
 package queue
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+	"webci-refactored/internal/config"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+	artifactsvc "webci-refactored/internal/service/artifact"
+	jobsvc "webci-refactored/internal/service/job"
+	"webci-refactored/internal/storage"
 
 	"gorm.io/gorm"
 )
 
+const (
+	// leaseTTL 任务租约时长：执行器每 leaseTTL/3 续期一次，超过该时长未续期视为失联
+	leaseTTL = 30 * time.Second
+	// pollInterval 轮询间隔：兜底发现其他实例写入或恢复出来的 pending 任务
+	pollInterval = 2 * time.Second
+	// maxAttempts 崩溃恢复上限：同一任务被认领超过该次数后不再重新入队
+	maxAttempts = 3
+	// reapGrace 超时回收宽限期：任务超过超时仍为 running 且再过该时长仍未结束，视为执行器失联或卡死
+	reapGrace = leaseTTL
+	// logArchiveDelay 任务结束后延迟压缩归档日志，留出时间写入收尾日志
+	logArchiveDelay = 10 * time.Second
+	// 状态事件中的操作者：恢复流程与流水线推进
+	actorSystem   = "system"
+	actorPipeline = "pipeline"
+)
+
 // queue 管理结构
 var (
-	jobQueue   chan uint64
-	cancelLock sync.RWMutex
-	cancelMap  map[uint64]bool
-	globalDB   *gorm.DB
+	wakeCh      chan struct{}
+	runningLock sync.Mutex
+	runningMap  map[uint64]context.CancelFunc
+	globalDB    *gorm.DB
+	workerID    string
 )
 
-// InitWorkers 初始化队列与取消映射，并启动调度器
-// 需在服务启动时调用
+// InitWorkers 恢复失联任务并启动调度器
+// 任务队列即 jobs 表中的 pending 记录，服务重启不会丢失；需在服务启动时调用
 func InitWorkers(db *gorm.DB) {
 	// 保存全局 DB 句柄供执行器使用
 	globalDB = db
-	// 有缓冲通道：允许短时间突发的任务提交，避免阻塞
-	jobQueue = make(chan uint64, 128)
-	// 取消映射：记录被请求取消的任务 ID
-	cancelMap = make(map[uint64]bool)
-	// 启动后台调度器：持续消费队列中的任务 ID
+	// 唤醒通道：容量为 1，多次入队通知合并为一次轮询
+	wakeCh = make(chan struct{}, 1)
+	// 运行映射：记录本实例执行中任务的取消函数，用于立即终止进程
+	runningMap = make(map[uint64]context.CancelFunc)
+	workerID = newWorkerID()
+	// 启动恢复：本机上次进程遗留的 running 任务立即处理，不等租约过期；其他实例的失联任务按租约回收
+	recoverOwnLeases()
+	recoverExpired()
+	// 启动后台调度器：持续从数据库认领 pending 任务
 	go dispatcher()
-	log.Printf("workers initialized")
+	log.Printf("workers initialized id=%s", workerID)
+}
+
+// newWorkerID 生成执行器实例标识：主机名-进程号-随机后缀
+func newWorkerID() string {
+	host, _ := os.Hostname()
+	buf := make([]byte, 4)
+	_, _ = rand.Read(buf)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(buf))
 }
 
-// Enqueue 推入任务 ID 到队列
-func Enqueue(id uint64) { jobQueue <- id }
+// Enqueue 通知调度器有新的 pending 任务
+// 任务本身已持久化在数据库中，这里仅做非阻塞唤醒
+func Enqueue(id uint64) { wake() }
+
+// Dispatch 放行新建的顶层任务：流水线父任务开始推进，可执行任务通知调度器
+// 等待审批的任务暂不放行，审批通过后再次调用
+func Dispatch(j *model.Job) {
+	switch {
+	case j.Status == model.JobStatusWaitingForApproval:
+	case j.Kind == model.JobKindPipeline:
+		StartPipeline(j.ID)
+	default:
+		Enqueue(j.ID)
+	}
+}
 
-// MarkCancel 标记取消任务
+// wake 非阻塞唤醒调度器，合并重复通知
+func wake() {
+	select {
+	case wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// MarkCancel 持久化取消请求
+// 若任务正在本实例执行，同时终止其正在运行的构建步骤；其他实例由心跳发现取消请求
 func MarkCancel(id uint64) {
-	// 写锁保护：避免并发写入竞态
-	cancelLock.Lock()
-	cancelMap[id] = true
-	cancelLock.Unlock()
+	if err := repository.NewJobRepository(globalDB).RequestCancel(id); err != nil {
+		log.Printf("request cancel job=%d err: %v", id, err)
+	}
+	cancelLocal(id)
 }
 
-// IsCanceled 判断任务是否取消
+// IsCanceled 判断任务是否已被请求取消
 func IsCanceled(id uint64) bool {
-	// 读锁保护：并发读取取消状态
-	cancelLock.RLock()
-	v := cancelMap[id]
-	cancelLock.RUnlock()
+	v, err := repository.NewJobRepository(globalDB).IsCancelRequested(id)
+	if err != nil {
+		log.Printf("load cancel flag job=%d err: %v", id, err)
+	}
 	return v
 }
+
+// recoverExpired 处理租约过期的 running 任务
+// 未被取消且认领次数未超限的重新入队，否则标记失败
+func recoverExpired() {
+	repo := repository.NewJobRepository(globalDB)
+	items, err := repo.ListExpiredLeases(time.Now())
+	if err != nil {
+		log.Printf("list expired leases err: %v", err)
+		return
+	}
+	for i := range items {
+		recoverLease(repo, &items[i])
+	}
+}
+
+// recoverOwnLeases 启动时回收本机已退出的执行器实例遗留的 running 任务，无需等待租约过期
+func recoverOwnLeases() {
+	repo := repository.NewJobRepository(globalDB)
+	items, err := repo.ListRunning()
+	if err != nil {
+		log.Printf("list running jobs err: %v", err)
+		return
+	}
+	for i := range items {
+		if staleOwner(items[i].LeaseOwner) {
+			recoverLease(repo, &items[i])
+		}
+	}
+}
+
+// recoverLease 处理失联执行器持有的任务：未超过认领上限时重新入队，否则以系统失败结束
+func recoverLease(repo *repository.JobRepository, j *model.Job) {
+	if !j.CancelRequested && j.Attempts < maxAttempts {
+		if ok, _ := repo.Requeue(j.ID, j.LeaseOwner, actorSystem, "worker "+j.LeaseOwner+" lost, re-queued"); ok {
+			_ = repo.AppendLog(j.ID, fmt.Sprintf("[RECOVER] worker %s lost, job re-queued\n", j.LeaseOwner))
+			log.Printf("requeue job=%d from worker=%s", j.ID, j.LeaseOwner)
+			Enqueue(j.ID)
+		}
+		return
+	}
+	closeOrphan(j, model.JobStatusFailed, model.FailureSystem, "worker "+j.LeaseOwner+" lost",
+		fmt.Sprintf("[FAILED] worker %s lost after %d attempts\n", j.LeaseOwner, j.Attempts))
+}
+
+// staleOwner 判断租约持有者是否为本机已退出的执行器实例（标识格式见 newWorkerID）：
+// 主机名相同且不是当前实例，进程号为当前进程（容器重启后进程号复用）或该进程已不存在
+func staleOwner(owner string) bool {
+	if owner == "" || owner == workerID {
+		return false
+	}
+	rest, _, ok := cutLast(owner, "-")
+	if !ok {
+		return false
+	}
+	host, pidStr, ok := cutLast(rest, "-")
+	if !ok {
+		return false
+	}
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return false
+	}
+	if self, _ := os.Hostname(); host != self {
+		return false
+	}
+	return pid == os.Getpid() || !processAlive(pid)
+}
+
+// cutLast 以最后一个 sep 切分 s
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// releaseStaleRetries 处理执行器在放行前失联而遗留的 waiting_retry 任务
+// 原任务已失败时放行，原任务仍在执行时留给其执行器或回收流程处理，其余情况取消
+func releaseStaleRetries() {
+	repo := repository.NewJobRepository(globalDB)
+	items, err := repo.ListWaitingRetry(time.Now().Add(-leaseTTL))
+	if err != nil {
+		log.Printf("list waiting retries err: %v", err)
+		return
+	}
+	for i := range items {
+		r := &items[i]
+		orig, err := repo.Get(r.RetryOf)
+		if err != nil {
+			releaseRetry(r, false)
+			continue
+		}
+		switch orig.Status {
+		case model.JobStatusRunning:
+		case model.JobStatusFailed, model.JobStatusTimedOut:
+			releaseRetry(r, true)
+		default:
+			releaseRetry(r, false)
+		}
+		if orig.Status != model.JobStatusRunning && r.PipelineID > 0 {
+			advancePipeline(r.PipelineID)
+		}
+	}
+}
+
+// reapOverdue 回收超时后仍为 running 的任务
+// 执行器会在超时到期时自行终止任务；超出宽限期仍未结束，说明执行器卡死或记录已无人负责
+// （如无租约的 running 记录），直接标记为 timed_out
+func reapOverdue(cfg config.Config) {
+	repo := repository.NewJobRepository(globalDB)
+	items, err := repo.ListRunning()
+	if err != nil {
+		log.Printf("list running jobs err: %v", err)
+		return
+	}
+	now := time.Now()
+	for i := range items {
+		j := &items[i]
+		started := j.UpdatedAt
+		if j.StartTime != nil {
+			started = *j.StartTime
+		}
+		timeout := jobTimeout(cfg, j)
+		if now.Sub(started) < timeout+reapGrace {
+			continue
+		}
+		owner := j.LeaseOwner
+		if owner == "" {
+			owner = "none"
+		}
+		log.Printf("reap overdue job=%d owner=%s", j.ID, owner)
+		closeOrphan(j, model.JobStatusTimedOut, model.FailureTimeout, "exceeded timeout of "+timeout.String()+", reaped",
+			fmt.Sprintf("[TIMED OUT] job exceeded timeout of %s without result from worker %s, reaped\n", timeout, owner))
+	}
+}
+
+// closeOrphan 将已无执行器负责的 running 任务转为终态：记录失败原因、结果日志与结束时间，并按策略自动重试
+// 任务恰好在本实例执行时一并终止其进程
+func closeOrphan(j *model.Job, status, reason, note, logText string) {
+	repo := repository.NewJobRepository(globalDB)
+	retry := prepareRetry(j, reason)
+	ok := setStatus(j.ID, model.JobStatusRunning, status, actorSystem, note)
+	if ok {
+		cancelLocal(j.ID)
+		_ = repo.ReleaseLease(j.ID, j.LeaseOwner)
+		_ = repo.SetFailureReason(j.ID, reason)
+		_ = repo.AppendLog(j.ID, logText)
+		now := time.Now()
+		_ = repo.UpdateTimes(j.ID, nil, &now)
+	}
+	releaseRetry(retry, ok)
+	if ok && j.PipelineID > 0 {
+		advancePipeline(j.PipelineID)
+	}
+}
+
+// archiveLogs 压缩归档已结束任务的日志块
+func archiveLogs() {
+	repo := repository.NewJobRepository(globalDB)
+	ids, err := repo.ListArchivable(time.Now().Add(-logArchiveDelay), 50)
+	if err != nil {
+		log.Printf("list archivable logs err: %v", err)
+		return
+	}
+	for _, id := range ids {
+		if err := repo.ArchiveLog(id); err != nil {
+			log.Printf("archive log job=%d err: %v", id, err)
+		}
+	}
+}
+
+// newArtifactService 按配置创建使用本地存储的产物服务
+func newArtifactService(cfg config.Config) *artifactsvc.Service {
+	return artifactsvc.NewService(globalDB, storage.NewLocal(cfg.ArtifactDir), cfg.ArtifactMaxSize, cfg.ArtifactExpireIn)
+}
+
+// purgeArtifacts 删除已过期的产物文件与记录
+func purgeArtifacts(cfg config.Config) {
+	n, err := newArtifactService(cfg).PurgeExpired(time.Now())
+	if err != nil {
+		log.Printf("purge artifacts err: %v", err)
+	}
+	if n > 0 {
+		log.Printf("purged %d expired artifact(s)", n)
+	}
+}
+
+// prepareRetry 按任务的自动重试策略预先创建 waiting_retry 状态的重试任务，不满足策略时返回 nil
+func prepareRetry(j *model.Job, reason string) *model.Job {
+	r, err := jobsvc.NewService(globalDB).PrepareAutoRetry(j, reason, actorSystem)
+	if err != nil {
+		log.Printf("prepare retry job=%d err: %v", j.ID, err)
+		return nil
+	}
+	return r
+}
+
+// releaseRetry 原任务失败已落库时放行重试任务；原任务状态已被他处修改时取消重试任务
+// 这是 waiting_retry 转为 pending 的唯一路径
+func releaseRetry(r *model.Job, failed bool) {
+	if r == nil {
+		return
+	}
+	if !failed {
+		if setStatus(r.ID, model.JobStatusWaitingRetry, model.JobStatusCanceled, actorSystem, "retried job did not fail") {
+			closeUnstarted(repository.NewJobRepository(globalDB), r.ID, "[CANCELED] retried job did not fail\n")
+		}
+		return
+	}
+	if setStatus(r.ID, model.JobStatusWaitingRetry, model.JobStatusPending, actorSystem, fmt.Sprintf("automatic retry of job %d", r.RetryOf)) {
+		log.Printf("retry job=%d as job=%d", r.RetryOf, r.ID)
+		Enqueue(r.ID)
+	}
+}
+
+// setStatus 经任务服务的状态机执行条件状态转换
+// 转换失败（非法或状态已被修改）时记录日志并返回 false
+func setStatus(id uint64, from, to, actor, note string) bool {
+	ok, err := jobsvc.NewService(globalDB).Transition(id, from, to, actor, note)
+	if err != nil {
+		log.Printf("transition job=%d %s -> %s err: %v", id, from, to, err)
+	}
+	return ok
+}
+
+// trackRunning 登记执行中任务的取消函数
+func trackRunning(id uint64, cancel context.CancelFunc) {
+	runningLock.Lock()
+	runningMap[id] = cancel
+	runningLock.Unlock()
+}
+
+// untrackRunning 任务结束后移除登记
+func untrackRunning(id uint64) {
+	runningLock.Lock()
+	delete(runningMap, id)
+	runningLock.Unlock()
+}
+
+// cancelLocal 终止本实例上正在执行的任务
+func cancelLocal(id uint64) {
+	runningLock.Lock()
+	cancel := runningMap[id]
+	runningLock.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
@@ -0,0 +1,378 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+	"webci-refactored/internal/config"
+	"webci-refactored/internal/dal"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB 为每个测试创建独立的内存 SQLite 并完成迁移
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	globalDB = db
+	wakeCh = make(chan struct{}, 1)
+	return db
+}
+
+func TestClaimNextIsExclusive(t *testing.T) {
+	db := openTestDB(t)
+	repo := repository.NewJobRepository(db)
+	if err := repo.Create(&model.Job{Kind: model.JobKindPipeline, Status: "pending"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Create(&model.Job{Kind: model.JobKindJob, Status: "pending"}); err != nil {
+		t.Fatal(err)
+	}
+	a, err := repo.ClaimNext("worker-a", time.Minute)
+	if err != nil || a == nil {
+		t.Fatalf("first claim: %v %v", a, err)
+	}
+	if a.Kind != model.JobKindJob || a.Status != "running" || a.LeaseOwner != "worker-a" || a.Attempts != 1 {
+		t.Fatalf("unexpected claimed job: %+v", a)
+	}
+	b, err := repo.ClaimNext("worker-b", time.Minute)
+	if err != nil || b != nil {
+		t.Fatalf("pipeline parent or claimed job must not be claimed again: %v %v", b, err)
+	}
+}
+
+func TestRecoverExpiredRequeuesOrFails(t *testing.T) {
+	db := openTestDB(t)
+	repo := repository.NewJobRepository(db)
+	past := time.Now().Add(-time.Minute)
+	retry := &model.Job{Kind: model.JobKindJob, Status: "running", LeaseOwner: "dead", LeaseExpiresAt: &past, Attempts: 1}
+	exhausted := &model.Job{Kind: model.JobKindJob, Status: "running", LeaseOwner: "dead", LeaseExpiresAt: &past, Attempts: maxAttempts}
+	future := time.Now().Add(time.Minute)
+	alive := &model.Job{Kind: model.JobKindJob, Status: "running", LeaseOwner: "alive", LeaseExpiresAt: &future, Attempts: 1}
+	for _, j := range []*model.Job{retry, exhausted, alive} {
+		if err := repo.Create(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recoverExpired()
+
+	want := map[uint64]string{retry.ID: "pending", exhausted.ID: "failed", alive.ID: "running"}
+	for id, status := range want {
+		j, err := repo.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.Status != status {
+			t.Fatalf("job %d status = %s, want %s", id, j.Status, status)
+		}
+	}
+	if j, _ := repo.Get(retry.ID); j.LeaseOwner != "" || j.LeaseExpiresAt != nil {
+		t.Fatalf("requeued job should drop its lease: %+v", j)
+	}
+}
+
+func TestRecoverOwnLeasesAtStartup(t *testing.T) {
+	db := openTestDB(t)
+	repo := repository.NewJobRepository(db)
+	prev := workerID
+	workerID = newWorkerID()
+	t.Cleanup(func() { workerID = prev })
+	host, _ := os.Hostname()
+	future := time.Now().Add(time.Minute)
+	// 同一主机、同一进程号的旧实例（容器重启）与当前实例、其他主机的实例，租约均未过期
+	restarted := &model.Job{Kind: model.JobKindJob, Status: "running", LeaseOwner: fmt.Sprintf("%s-%d-deadbeef", host, os.Getpid()), LeaseExpiresAt: &future, Attempts: 1}
+	current := &model.Job{Kind: model.JobKindJob, Status: "running", LeaseOwner: workerID, LeaseExpiresAt: &future, Attempts: 1}
+	other := &model.Job{Kind: model.JobKindJob, Status: "running", LeaseOwner: "other-host-1-deadbeef", LeaseExpiresAt: &future, Attempts: 1}
+	for _, j := range []*model.Job{restarted, current, other} {
+		if err := repo.Create(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recoverOwnLeases()
+
+	want := map[uint64]string{restarted.ID: "pending", current.ID: "running", other.ID: "running"}
+	for id, status := range want {
+		if j, _ := repo.Get(id); j.Status != status {
+			t.Fatalf("job %d status = %s, want %s", id, j.Status, status)
+		}
+	}
+}
+
+func TestClaimNextRespectsEnvironmentLimit(t *testing.T) {
+	db := openTestDB(t)
+	repo := repository.NewJobRepository(db)
+	prod := &model.Environment{Name: "prod", MaxConcurrency: 1}
+	if err := db.Create(prod).Error; err != nil {
+		t.Fatal(err)
+	}
+	first := &model.Job{Kind: model.JobKindJob, EnvID: prod.ID, Status: "pending"}
+	second := &model.Job{Kind: model.JobKindJob, EnvID: prod.ID, Status: "pending"}
+	other := &model.Job{Kind: model.JobKindJob, Status: "pending"}
+	for _, j := range []*model.Job{first, second, other} {
+		if err := repo.Create(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var claimed []uint64
+	for {
+		j, err := repo.ClaimNext("worker", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j == nil {
+			break
+		}
+		claimed = append(claimed, j.ID)
+	}
+	if len(claimed) != 2 || claimed[0] != first.ID || claimed[1] != other.ID {
+		t.Fatalf("claimed %v, want [%d %d]", claimed, first.ID, other.ID)
+	}
+	// 前一个 prod 任务结束后，排队中的任务才可被认领
+	if _, err := repo.TransitionStatus(first.ID, model.JobStatusRunning, model.JobStatusSuccess, "worker", ""); err != nil {
+		t.Fatal(err)
+	}
+	j, err := repo.ClaimNext("worker", time.Minute)
+	if err != nil || j == nil || j.ID != second.ID {
+		t.Fatalf("expected job %d after slot freed, got %v %v", second.ID, j, err)
+	}
+}
+
+func TestAggregateStatus(t *testing.T) {
+	cases := []struct {
+		statuses []string
+		canceled bool
+		want     string
+	}{
+		{[]string{model.JobStatusSuccess, model.JobStatusSkipped}, false, model.JobStatusSuccess},
+		{[]string{model.JobStatusFailed, model.JobStatusSkipped}, false, model.JobStatusFailed},
+		{[]string{model.JobStatusSuccess, model.JobStatusCanceled}, false, model.JobStatusCanceled},
+		{[]string{model.JobStatusCanceled, model.JobStatusCanceled}, true, model.JobStatusCanceled},
+		{[]string{model.JobStatusSuccess, model.JobStatusRunning}, true, model.JobStatusRunning},
+		{[]string{model.JobStatusPending, model.JobStatusCreated}, false, model.JobStatusPending},
+		{[]string{model.JobStatusWaitingRetry, model.JobStatusCreated}, false, model.JobStatusRunning},
+	}
+	for _, c := range cases {
+		if got := aggregateStatus(c.statuses, c.canceled); got != c.want {
+			t.Errorf("aggregateStatus(%v, %v) = %s, want %s", c.statuses, c.canceled, got, c.want)
+		}
+	}
+}
+
+func TestLogChunksRangeReadAndArchive(t *testing.T) {
+	db := openTestDB(t)
+	repo := repository.NewJobRepository(db)
+	j := &model.Job{Kind: model.JobKindJob, Status: model.JobStatusRunning}
+	if err := repo.Create(j); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"hello\n", "wörld\n", "done\n"} {
+		if err := repo.AppendLog(j.ID, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	full := "hello\nwörld\ndone\n"
+	check := func(offset, limit int64, want string) {
+		t.Helper()
+		got, err := repo.ReadLog(j.ID, offset, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Fatalf("ReadLog(%d, %d) = %q, want %q", offset, limit, got, want)
+		}
+	}
+	check(0, -1, full)
+	check(3, 6, full[3:9])
+	check(int64(len(full)), 10, "")
+
+	if err := repo.ArchiveLog(j.ID); err != nil {
+		t.Fatal(err)
+	}
+	var chunks int64
+	db.Model(&model.JobLogChunk{}).Where("job_id = ?", j.ID).Count(&chunks)
+	if chunks != 0 {
+		t.Fatalf("archived chunks should be removed, %d left", chunks)
+	}
+	check(3, 6, full[3:9])
+	// 归档后追加的日志与归档内容拼接读取
+	if err := repo.AppendLog(j.ID, "late\n"); err != nil {
+		t.Fatal(err)
+	}
+	check(0, -1, full+"late\n")
+	check(int64(len(full))-2, 4, "e\nla")
+	got, _ := repo.Get(j.ID)
+	if got.LogSize != int64(len(full)+5) || !got.LogArchived {
+		t.Fatalf("unexpected log bookkeeping: size=%d archived=%v", got.LogSize, got.LogArchived)
+	}
+}
+
+func TestAdvancePipelineHoldsManualJobs(t *testing.T) {
+	db := openTestDB(t)
+	repo := repository.NewJobRepository(db)
+	parent := &model.Job{Kind: model.JobKindPipeline, Status: model.JobStatusPending, TriggerUser: "alice"}
+	if err := repo.Create(parent); err != nil {
+		t.Fatal(err)
+	}
+	build := &model.Job{Kind: model.JobKindJob, PipelineID: parent.ID, Name: "build", Status: model.JobStatusSuccess, TriggerUser: "alice"}
+	deploy := &model.Job{Kind: model.JobKindJob, PipelineID: parent.ID, Name: "deploy", Needs: model.StringList{"build"}, Manual: true, Status: model.JobStatusCreated, TriggerUser: "alice"}
+	notify := &model.Job{Kind: model.JobKindJob, PipelineID: parent.ID, Name: "notify", Needs: model.StringList{"deploy"}, Status: model.JobStatusCreated, TriggerUser: "alice"}
+	for _, j := range []*model.Job{build, deploy, notify} {
+		if err := repo.Create(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	advancePipeline(parent.ID)
+	if got, _ := repo.Get(deploy.ID); got.Status != model.JobStatusManual {
+		t.Fatalf("manual job should wait for manual action, got %s", got.Status)
+	}
+	if got, _ := repo.Get(notify.ID); got.Status != model.JobStatusCreated {
+		t.Fatalf("downstream job should wait for the manual job, got %s", got.Status)
+	}
+	if got, _ := repo.Get(parent.ID); got.Status != model.JobStatusRunning {
+		t.Fatalf("pipeline should stay running, got %s", got.Status)
+	}
+}
+
+func TestFailCreatesAutomaticRetry(t *testing.T) {
+	db := openTestDB(t)
+	repo := repository.NewJobRepository(db)
+	j := &model.Job{Kind: model.JobKindJob, Status: "running", TriggerUser: "alice", Steps: model.StringList{"false"},
+		RetryMax: 1, RetryWhen: model.StringList{model.FailureScript}, RollbackOf: 5}
+	if err := repo.Create(j); err != nil {
+		t.Fatal(err)
+	}
+	fail(j, model.JobStatusFailed, model.FailureScript, "step failed", "[FAILED] step failed\n")
+	got, _ := repo.Get(j.ID)
+	if got.Status != model.JobStatusFailed || got.FailureReason != model.FailureScript {
+		t.Fatalf("unexpected original job: %s %q", got.Status, got.FailureReason)
+	}
+	var retries []model.Job
+	db.Where("retry_of = ?", j.ID).Find(&retries)
+	if len(retries) != 1 || retries[0].Status != model.JobStatusPending || retries[0].RetryCount != 1 || retries[0].TriggerUser != "alice" {
+		t.Fatalf("expected one pending retry, got %+v", retries)
+	}
+	// 回滚任务的自动重试仍是同一次回滚
+	if retries[0].RollbackOf != 5 {
+		t.Fatalf("retry must keep rollback_of, got %d", retries[0].RollbackOf)
+	}
+
+	// 重试次数用完后不再重试
+	r := &retries[0]
+	if _, err := repo.TransitionStatus(r.ID, model.JobStatusPending, model.JobStatusRunning, "test", ""); err != nil {
+		t.Fatal(err)
+	}
+	fail(r, model.JobStatusFailed, model.FailureScript, "step failed", "[FAILED] step failed\n")
+	var n int64
+	db.Model(&model.Job{}).Where("retry_of = ?", r.ID).Count(&n)
+	if n != 0 {
+		t.Fatalf("retry budget exhausted, got %d new jobs", n)
+	}
+}
+
+func TestPipelineRetryWaitsForRelease(t *testing.T) {
+	db := openTestDB(t)
+	repo := repository.NewJobRepository(db)
+	parent := &model.Job{Kind: model.JobKindPipeline, Status: model.JobStatusRunning, TriggerUser: "alice"}
+	if err := repo.Create(parent); err != nil {
+		t.Fatal(err)
+	}
+	build := &model.Job{Kind: model.JobKindJob, PipelineID: parent.ID, Name: "build", Status: model.JobStatusRunning, TriggerUser: "alice", RetryMax: 1}
+	if err := repo.Create(build); err != nil {
+		t.Fatal(err)
+	}
+	// 重试任务已创建、原任务失败尚未落库时，并发的流水线推进不能放行重试任务
+	r := prepareRetry(build, model.FailureScript)
+	if r == nil || r.Status != model.JobStatusWaitingRetry {
+		t.Fatalf("expected a waiting_retry job, got %+v", r)
+	}
+	advancePipeline(parent.ID)
+	if got, _ := repo.Get(r.ID); got.Status != model.JobStatusWaitingRetry {
+		t.Fatalf("pipeline advance must not release the retry, got %s", got.Status)
+	}
+	if got, _ := repo.Get(parent.ID); got.Status != model.JobStatusRunning {
+		t.Fatalf("pipeline must keep running while a retry is waiting, got %s", got.Status)
+	}
+	if !finish(build.ID, model.JobStatusFailed, "", "") {
+		t.Fatal("finish build")
+	}
+	releaseRetry(r, true)
+	if got, _ := repo.Get(r.ID); got.Status != model.JobStatusPending {
+		t.Fatalf("retry should be released, got %s", got.Status)
+	}
+
+	// 执行器在放行前失联：维护流程按原任务状态放行或取消
+	lost := &model.Job{Kind: model.JobKindJob, Status: model.JobStatusFailed, TriggerUser: "alice"}
+	done := &model.Job{Kind: model.JobKindJob, Status: model.JobStatusSuccess, TriggerUser: "alice"}
+	for _, j := range []*model.Job{lost, done} {
+		if err := repo.Create(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stale := time.Now().Add(-2 * leaseTTL)
+	var retries []*model.Job
+	for _, orig := range []*model.Job{lost, done} {
+		w := &model.Job{Kind: model.JobKindJob, Status: model.JobStatusWaitingRetry, RetryOf: orig.ID, TriggerUser: "alice"}
+		if err := repo.Create(w); err != nil {
+			t.Fatal(err)
+		}
+		db.Model(&model.Job{}).Where("id = ?", w.ID).UpdateColumn("updated_at", stale)
+		retries = append(retries, w)
+	}
+	releaseStaleRetries()
+	if got, _ := repo.Get(retries[0].ID); got.Status != model.JobStatusPending {
+		t.Fatalf("retry of a failed job should be released, got %s", got.Status)
+	}
+	if got, _ := repo.Get(retries[1].ID); got.Status != model.JobStatusCanceled {
+		t.Fatalf("retry of a job that did not fail should be canceled, got %s", got.Status)
+	}
+}
+
+func TestReapOverdueTimesOutOrphans(t *testing.T) {
+	db := openTestDB(t)
+	repo := repository.NewJobRepository(db)
+	cfg := config.Config{JobTimeout: time.Hour}
+	env := &model.Environment{Name: "prod", TimeoutSeconds: 60}
+	if err := db.Create(env).Error; err != nil {
+		t.Fatal(err)
+	}
+	longAgo := time.Now().Add(-2 * time.Hour)
+	recent := time.Now().Add(-10 * time.Minute)
+	orphan := &model.Job{Kind: model.JobKindJob, Status: "running", StartTime: &longAgo}
+	fresh := &model.Job{Kind: model.JobKindJob, Status: "running", StartTime: &recent}
+	envCapped := &model.Job{Kind: model.JobKindJob, EnvID: env.ID, Status: "running", StartTime: &recent}
+	pipeline := &model.Job{Kind: model.JobKindPipeline, Status: "running", StartTime: &longAgo}
+	for _, j := range []*model.Job{orphan, fresh, envCapped, pipeline} {
+		if err := repo.Create(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := jobTimeout(cfg, &model.Job{EnvID: env.ID, TimeoutSeconds: 5}); got != 5*time.Second {
+		t.Fatalf("job timeout should win, got %s", got)
+	}
+
+	reapOverdue(cfg)
+	want := map[uint64]string{orphan.ID: "timed_out", fresh.ID: "running", envCapped.ID: "timed_out", pipeline.ID: "running"}
+	for id, status := range want {
+		j, _ := repo.Get(id)
+		if j.Status != status {
+			t.Fatalf("job %d: status %s, want %s", id, j.Status, status)
+		}
+		if status == "timed_out" && (j.FailureReason != model.FailureTimeout || j.EndTime == nil) {
+			t.Fatalf("job %d: reason %q end %v", id, j.FailureReason, j.EndTime)
+		}
+	}
+}
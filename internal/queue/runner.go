@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// StepError 构建步骤以非零退出码结束
+type StepError struct {
+	Index    int
+	Step     string
+	ExitCode int
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step %d exited with code %d: %s", e.Index, e.ExitCode, e.Step)
+}
+
+// runSteps 在工作区中依次执行构建步骤，输出写入 out
+// 任一步骤失败即停止；ctx 取消时终止当前步骤所在的进程组
+func runSteps(ctx context.Context, dir string, steps []string, env []string, out io.Writer) error {
+	for i, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "[STEP %d/%d] $ %s\n", i+1, len(steps), step)
+		cmd := shellCommand(ctx, step)
+		cmd.Dir = dir
+		cmd.Env = env
+		// stdout 与 stderr 共用同一个写入器，保证输出顺序与终端一致
+		cmd.Stdout = out
+		cmd.Stderr = out
+		setProcessGroup(cmd)
+		cmd.Cancel = func() error { return killProcessGroup(cmd) }
+		// 子进程可能继承管道不退出：给输出收尾留出有限时间
+		cmd.WaitDelay = 5 * time.Second
+		err := cmd.Run()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return &StepError{Index: i + 1, Step: step, ExitCode: exitErr.ExitCode()}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// logWriter 将步骤输出按整行追加到任务日志
+// 不完整的行暂存在缓冲区，直到换行或 Flush 时写出
+type logWriter struct {
+	mu     sync.Mutex
+	buf    []byte
+	append func(text string) error
+}
+
+func newLogWriter(appendFn func(text string) error) *logWriter {
+	return &logWriter{append: appendFn}
+}
+
+// Write 实现 io.Writer，可被多个 goroutine 并发调用
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	if idx := bytes.LastIndexByte(w.buf, '\n'); idx >= 0 {
+		text := string(w.buf[:idx+1])
+		w.buf = append(w.buf[:0], w.buf[idx+1:]...)
+		if err := w.append(text); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush 写出缓冲区中剩余的不完整行
+func (w *logWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) == 0 {
+		return nil
+	}
+	text := string(w.buf) + "\n"
+	w.buf = w.buf[:0]
+	return w.append(text)
+}
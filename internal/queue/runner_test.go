@@ -0,0 +1,114 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestRunStepsOutputAndExitCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("posix shell required")
+	}
+	var out bytes.Buffer
+	err := runSteps(context.Background(), t.TempDir(), []string{"echo hello", "echo oops >&2; exit 3", "echo never"}, nil, &out)
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) {
+		t.Fatalf("expected StepError, got %v", err)
+	}
+	if stepErr.Index != 2 || stepErr.ExitCode != 3 {
+		t.Fatalf("unexpected step error: %+v", stepErr)
+	}
+	log := out.String()
+	if !strings.Contains(log, "hello\n") || !strings.Contains(log, "oops\n") {
+		t.Fatalf("missing step output: %q", log)
+	}
+	if strings.Contains(log, "never") {
+		t.Fatalf("step after failure should not run: %q", log)
+	}
+}
+
+func TestRunStepsCancelKillsProcessGroup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("posix shell required")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start := time.Now()
+	// 后台子进程持有输出管道：只有整组终止才能及时返回
+	err := runSteps(ctx, t.TempDir(), []string{"sleep 30 & sleep 30"}, nil, &bytes.Buffer{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if d := time.Since(start); d > 3*time.Second {
+		t.Fatalf("cancel took too long: %s", d)
+	}
+}
+
+func TestLogWriterBuffersPartialLines(t *testing.T) {
+	var chunks []string
+	w := newLogWriter(func(text string) error { chunks = append(chunks, text); return nil })
+	_, _ = w.Write([]byte("a\nb"))
+	_, _ = w.Write([]byte("c\n"))
+	_, _ = w.Write([]byte("tail"))
+	_ = w.Flush()
+	want := []string{"a\n", "bc\n", "tail\n"}
+	if strings.Join(chunks, "|") != strings.Join(want, "|") {
+		t.Fatalf("chunks = %#v, want %#v", chunks, want)
+	}
+}
+
+func TestCheckoutRevision(t *testing.T) {
+	src := t.TempDir()
+	r, err := git.PlainInit(src, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(src, "scripts"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "scripts", "build.sh"), []byte("echo build\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.Add("scripts/build.sh"); err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "dev", Email: "dev@example.com", When: time.Now()}
+	hash, err := wt.Commit("init", &git.CommitOptions{Author: sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "ws")
+	co, err := checkoutRevision(context.Background(), src, head.Name().Short(), "", dst)
+	if err != nil {
+		t.Fatalf("checkout: %v", err)
+	}
+	if co.Hash != hash.String() || co.Author != "dev" {
+		t.Fatalf("unexpected checkout result: %+v", co)
+	}
+	fi, err := os.Stat(filepath.Join(dst, "scripts", "build.sh"))
+	if err != nil {
+		t.Fatalf("file not exported: %v", err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0o100 == 0 {
+		t.Fatalf("executable bit lost: %v", fi.Mode())
+	}
+}
@@ -0,0 +1,101 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// checkoutResult 检出结果：记录工作区对应的提交信息
+type checkoutResult struct {
+	Hash    string
+	Message string
+	Author  string
+	When    time.Time
+}
+
+// checkoutRevision 将本地仓库中的提交导出到任务工作区
+// commit 非空时检出该提交（流水线创建时固定的版本），否则检出分支当前指向的提交
+// 直接通过 go-git 读取提交树写出文件，不依赖系统 git 命令，也兼容裸仓库
+func checkoutRevision(ctx context.Context, repoPath, branch, commit, dir string) (*checkoutResult, error) {
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("open repo: %w", err)
+	}
+	hash := plumbing.NewHash(commit)
+	if commit == "" {
+		ref, err := r.Reference(plumbing.NewBranchReferenceName(branch), true)
+		if err != nil {
+			return nil, fmt.Errorf("resolve branch %s: %w", branch, err)
+		}
+		hash = ref.Hash()
+	}
+	co, err := r.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("read commit %s: %w", hash, err)
+	}
+	tree, err := co.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("read tree: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		// 取消优先：大仓库导出过程中也能及时中止
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return writeTreeFile(dir, f)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("export tree: %w", err)
+	}
+	return &checkoutResult{Hash: hash.String(), Message: co.Message, Author: co.Author.Name, When: co.Author.When}, nil
+}
+
+// writeTreeFile 将单个 blob 写入工作区，保留可执行位与符号链接
+func writeTreeFile(root string, f *object.File) error {
+	target := filepath.Join(root, filepath.FromSlash(f.Name))
+	// 防御：拒绝逃逸出工作区的路径
+	if !strings.HasPrefix(target, filepath.Clean(root)+string(os.PathSeparator)) {
+		return fmt.Errorf("invalid path in tree: %s", f.Name)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if f.Mode == filemode.Symlink {
+		link, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, target)
+	}
+	perm := os.FileMode(0o644)
+	if f.Mode == filemode.Executable {
+		perm = 0o755
+	}
+	rd, err := f.Reader()
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rd); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,37 @@
+package router
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// disconnectPoll 检查客户端是否断开的间隔
+const disconnectPoll = 200 * time.Millisecond
+
+// requestContext 派生请求级 context：客户端断开连接（浏览器关闭页面或中止请求）时取消，
+// 处理器据此停止进行中的 GitLab 调用；处理器返回后须调用 cancel 结束检查
+func requestContext(c context.Context, ctx *app.RequestContext) (context.Context, context.CancelFunc) {
+	rc, cancel := context.WithCancel(c)
+	alive := connAlive(ctx.GetConn())
+	if alive == nil {
+		return rc, cancel
+	}
+	go func() {
+		t := time.NewTicker(disconnectPoll)
+		defer t.Stop()
+		for {
+			select {
+			case <-rc.Done():
+				return
+			case <-t.C:
+				if !alive() {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return rc, cancel
+}
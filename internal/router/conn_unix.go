@@ -0,0 +1,21 @@
+//go:build !windows
+
+package router
+
+import (
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/cloudwego/hertz/pkg/network/netpoll"
+)
+
+// connAlive 返回检查连接是否仍然打开的函数：netpoll 在对端关闭时立即标记连接失效，
+// 但要等处理器返回才执行关闭回调，因此只能轮询；不支持的连接类型返回 nil
+func connAlive(conn network.Conn) func() bool {
+	hc, ok := conn.(*netpoll.Conn)
+	if !ok {
+		return nil
+	}
+	if a, ok := hc.Conn.(interface{ IsActive() bool }); ok {
+		return a.IsActive
+	}
+	return nil
+}
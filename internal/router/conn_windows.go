@@ -0,0 +1,8 @@
+//go:build windows
+
+package router
+
+import "github.com/cloudwego/hertz/pkg/network"
+
+// connAlive Windows 下使用标准库网络层，无法感知连接关闭
+func connAlive(conn network.Conn) func() bool { return nil }
@@ -2,97 +2,165 @@ package router
 
 import (
 	"context"
-	"log"
 	"webci-refactored/internal/config"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/handler/artifact"
+	audithandler "webci-refactored/internal/handler/audit"
+	authhandler "webci-refactored/internal/handler/auth"
 	"webci-refactored/internal/handler/branch"
 	"webci-refactored/internal/handler/dashboard"
 	"webci-refactored/internal/handler/environment"
 	"webci-refactored/internal/handler/gitlab"
 	"webci-refactored/internal/handler/job"
+	"webci-refactored/internal/middleware"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/app/server"
 	"gorm.io/gorm"
 )
 
-// indexPageHandler 首页处理器：直接显示GitLab流水线页面
-func indexPageHandler(c context.Context, ctx *app.RequestContext) {
-	// 如果GitLab处理器可用，直接显示GitLab页面
-	// 否则显示简单的HTML页面提示用户访问GitLab页面
-	cfg := config.Load()
-
-	// 创建GitLab处理器
-	gitlabHandler, err := gitlab.NewHandler(cfg)
-	if err != nil {
+// indexPageHandler 首页处理器：已配置 GitLab 时直接显示GitLab流水线页面
+// 否则显示简单的HTML页面提示用户访问GitLab页面
+func indexPageHandler(gh *gitlab.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) {
+		html := `<html><body><h1>WebCI</h1><p><a href="/gitlab">访问GitLab流水线页面</a></p></body></html>`
+		if gh.Configured() {
+			html = gh.PageContent()
+		}
 		ctx.Header("Content-Type", "text/html; charset=utf-8")
 		ctx.SetStatusCode(200)
-		ctx.Write([]byte(`<html><body><h1>WebCI</h1><p><a href="/gitlab">访问GitLab流水线页面</a></p></body></html>`))
-		return
+		ctx.Write([]byte(html))
 	}
-
-	// GitLab处理器创建成功，显示GitLab页面内容
-	html := gitlabHandler.PageContent()
-	ctx.Header("Content-Type", "text/html; charset=utf-8")
-	ctx.SetStatusCode(200)
-	ctx.Write([]byte(html))
 }
 
 // NewServer 创建并配置 Hertz 服务
 // 注册路由、绑定中间件、挂载静态资源
+// 除登录外的全部接口与页面都需要认证；读接口任何已登录用户（viewer）可访问，写接口按角色逐级放开：
+// developer 触发与处理任务，maintainer 管理分支、环境与合并代码，admin 管理用户、GitLab 配置并查看审计日志；
+// 每个写接口都记录审计事件
 func NewServer(cfg config.Config, db *gorm.DB) *server.Hertz {
 	// 1) 初始化各模块处理器
+	// GitLab处理器最先创建：数据库中保存的 GitLab 配置（含本地仓库路径）优先于环境变量
+	gitlabHandler := gitlab.NewHandler(cfg, db)
+	cfg = gitlabHandler.Config()
+	// GITLAB_SYNC_INTERVAL 大于 0 时后台同步 GitLab 数据到本地镜像
+	gitlabHandler.StartSync()
+	authHandler := authhandler.NewHandler(db, cfg)
+	auditHandler := audithandler.NewHandler(db)
 	branchHandler := branch.NewHandler(db, cfg.RepoPath)
-	envHandler := environment.NewHandler(db)
-	jobHandler := job.NewHandler(db)
+	envHandler := environment.NewHandler(db, cfg.RepoPath)
+	jobHandler := job.NewHandler(db, cfg.RepoPath)
+	artifactHandler := artifact.NewHandler(db, cfg)
 	dashboardHandler := dashboard.NewHandler(db)
 
-	// 创建GitLab处理器
-	log.Printf("Creating GitLab handler with config - BaseURL: %s, Project: %s", cfg.GitLabBaseURL, cfg.GitLabProject)
-	gitlabHandler, err := gitlab.NewHandler(cfg)
-	if err != nil {
-		log.Printf("Warning: failed to create gitlab handler: %v", err)
-		gitlabHandler = nil
-	} else {
-		log.Printf("Successfully created GitLab handler")
+	// GitLab 配置变更时同步各处理层的本地仓库路径
+	gitlabHandler.OnRepoPath(branchHandler.UpdateRepoPath)
+	gitlabHandler.OnRepoPath(jobHandler.UpdateRepoPath)
+	gitlabHandler.OnRepoPath(envHandler.UpdateRepoPath)
+	// GitLab 单点登录开启用户令牌时，写操作以当前用户自己的 GitLab 令牌执行
+	if authHandler.Logic().GitLabUserTokens() {
+		gitlabHandler.UseUserTokens(authHandler.Logic().GitLabToken)
 	}
 
 	// 2) 创建 Hertz 服务实例
 	h := server.Default(server.WithHostPorts(cfg.HTTPAddr))
 
+	// 认证与角色中间件
+	authn := middleware.Authenticate(authHandler.Logic())
+	developer := middleware.Require(model.RoleDeveloper)
+	maintainer := middleware.Require(model.RoleMaintainer)
+	admin := middleware.Require(model.RoleAdmin)
+	// 写接口审计：放在角色校验之前，被拒绝的调用同样留痕
+	audited := func(action string) app.HandlerFunc { return middleware.Audit(auditHandler.Logic(), action) }
+
+	// 登录页、登录接口与 GitLab 单点登录跳转无需认证
+	h.GET("/login", authLoginPageHandler(authHandler))
+	h.POST("/api/auth/login", audited("auth.login"), authLoginHandler(authHandler))
+	h.GET("/auth/gitlab/login", authGitLabLoginHandler(authHandler))
+	h.GET("/auth/gitlab/callback", authGitLabCallbackHandler(authHandler))
+	// GitLab webhook 以 X-Gitlab-Token 校验，不经过登录认证
+	h.POST("/api/gitlab/webhook", gitlabWebhookHandler(gitlabHandler))
+
 	// 3) 注册 API 路由
-	api := h.Group("/api")
+	api := h.Group("/api", authn)
 	{
+		// 当前用户：会话、密码与个人 API 令牌
+		authGroup := api.Group("/auth")
+		{
+			authGroup.POST("/logout", audited("auth.logout"), authLogoutHandler(authHandler))
+			authGroup.GET("/me", authMeHandler(authHandler))
+			authGroup.PUT("/password", audited("auth.password"), authChangePasswordHandler(authHandler))
+			authGroup.POST("/gitlab/link", audited("auth.gitlab.link"), authGitLabLinkHandler(authHandler))
+			authGroup.GET("/tokens", authListTokensHandler(authHandler))
+			authGroup.POST("/tokens", audited("auth.token.create"), authCreateTokenHandler(authHandler))
+			authGroup.DELETE("/tokens/:id", audited("auth.token.revoke"), authRevokeTokenHandler(authHandler))
+		}
+
+		// 用户管理：仅管理员
+		users := api.Group("/users", admin)
+		{
+			users.GET("", userListHandler(authHandler))
+			users.POST("", audited("user.create"), userCreateHandler(authHandler))
+			users.PUT("/:id", audited("user.update"), userUpdateHandler(authHandler))
+		}
+
+		// 审计日志：仅管理员
+		auditGroup := api.Group("/audit", admin)
+		{
+			auditGroup.GET("", auditListHandler(auditHandler))
+			auditGroup.GET("/export", auditExportHandler(auditHandler))
+		}
+
 		// 分支相关路由
 		branches := api.Group("/branches")
 		{
 			branches.GET("", branchListHandler(branchHandler))
-			branches.POST("", branchCreateHandler(branchHandler))
+			branches.POST("", audited("branch.create"), maintainer, branchCreateHandler(branchHandler))
 			branches.GET("/:id", branchGetHandler(branchHandler))
-			branches.PUT("/:id", branchUpdateHandler(branchHandler))
-			branches.DELETE("/:id", branchDeleteHandler(branchHandler))
-			branches.POST("/:id/refresh", branchRefreshHandler(branchHandler))
-			branches.POST("/:id/mock_push", branchMockPushHandler(branchHandler))
+			branches.PUT("/:id", audited("branch.update"), maintainer, branchUpdateHandler(branchHandler))
+			branches.DELETE("/:id", audited("branch.delete"), maintainer, branchDeleteHandler(branchHandler))
+			branches.POST("/:id/refresh", audited("branch.refresh"), developer, branchRefreshHandler(branchHandler))
+			branches.POST("/:id/mock_push", audited("branch.mock_push"), developer, branchMockPushHandler(branchHandler))
 		}
 
 		// 环境相关路由
 		envs := api.Group("/environments")
 		{
 			envs.GET("", envListHandler(envHandler))
-			envs.POST("", envCreateHandler(envHandler))
+			envs.POST("", audited("environment.create"), maintainer, envCreateHandler(envHandler))
 			envs.GET("/:id", envGetHandler(envHandler))
-			envs.PUT("/:id", envUpdateHandler(envHandler))
-			envs.DELETE("/:id", envDeleteHandler(envHandler))
+			envs.PUT("/:id", audited("environment.update"), maintainer, envUpdateHandler(envHandler))
+			envs.DELETE("/:id", audited("environment.delete"), maintainer, envDeleteHandler(envHandler))
+			envs.GET("/:id/variables", envListVariablesHandler(envHandler))
+			envs.PUT("/:id/variables/:key", audited("environment.variable.set"), maintainer, envSetVariableHandler(envHandler))
+			envs.DELETE("/:id/variables/:key", audited("environment.variable.delete"), maintainer, envDeleteVariableHandler(envHandler))
+			envs.GET("/:id/deployments", envListDeploymentsHandler(envHandler))
+			envs.GET("/:id/deployments/:deployment_id/changes", envDeploymentChangesHandler(envHandler))
+			envs.GET("/:id/changes", envPendingChangesHandler(envHandler))
+			envs.POST("/:id/rollback", audited("environment.rollback"), maintainer, envRollbackHandler(envHandler))
+			envs.GET("/:id/freezes", envListFreezesHandler(envHandler))
+			envs.POST("/:id/freezes", audited("environment.freeze.create"), maintainer, envCreateFreezeHandler(envHandler))
+			envs.DELETE("/:id/freezes/:freeze_id", audited("environment.freeze.delete"), maintainer, envDeleteFreezeHandler(envHandler))
 		}
 
 		// 任务相关路由
 		jobs := api.Group("/jobs")
 		{
 			jobs.GET("", jobListHandler(jobHandler))
-			jobs.POST("", jobCreateHandler(jobHandler))
+			jobs.POST("", audited("job.create"), developer, jobCreateHandler(jobHandler))
 			jobs.GET("/:id", jobGetHandler(jobHandler))
-			jobs.PUT("/:id/status", jobUpdateStatusHandler(jobHandler))
+			jobs.PUT("/:id/status", audited("job.status"), developer, jobUpdateStatusHandler(jobHandler))
 			jobs.GET("/:id/log", jobLogHandler(jobHandler))
-			jobs.POST("/:id/cancel", jobCancelHandler(jobHandler))
+			jobs.GET("/:id/log/stream", jobStreamLogHandler(jobHandler))
+			jobs.GET("/:id/events", jobEventsHandler(jobHandler))
+			jobs.POST("/:id/cancel", audited("job.cancel"), developer, jobCancelHandler(jobHandler))
+			jobs.POST("/:id/retry", audited("job.retry"), developer, jobRetryHandler(jobHandler))
+			jobs.POST("/:id/approve", audited("job.approve"), developer, jobApproveHandler(jobHandler))
+			jobs.POST("/:id/reject", audited("job.reject"), developer, jobRejectHandler(jobHandler))
+			jobs.GET("/:id/approvals", jobApprovalsHandler(jobHandler))
+			jobs.GET("/:id/artifacts", artifactListHandler(artifactHandler))
+			jobs.GET("/:id/artifacts/download", artifactDownloadAllHandler(artifactHandler))
+			jobs.GET("/:id/artifacts/:artifact_id/download", artifactDownloadHandler(artifactHandler))
 		}
 
 		// 仪表盘相关路由
@@ -104,96 +172,101 @@ func NewServer(cfg config.Config, db *gorm.DB) *server.Hertz {
 		}
 
 		gitlabAPI := api.Group("/gitlab")
-		gitlabAPI.GET("/config", func(c context.Context, ctx *app.RequestContext) {
-			ctx.JSON(200, map[string]interface{}{
-				"code":    0,
-				"message": "ok",
-				"data": map[string]string{
-					"base_url":   cfg.GitLabBaseURL,
-					"project_id": cfg.GitLabProject,
-					"repo_path":  cfg.RepoPath,
-				},
-			})
-		})
-		gitlabAPI.POST("/config", func(c context.Context, ctx *app.RequestContext) {
-			var in struct {
-				BaseURL   string `json:"base_url"`
-				Token     string `json:"token"`
-				ProjectID string `json:"project_id"`
-				RepoPath  string `json:"repo_path"`
-			}
-			if err := ctx.Bind(&in); err != nil {
-				ctx.JSON(400, map[string]interface{}{"code": 400, "message": err.Error()})
-				return
-			}
-			newCfg := cfg
-			if in.BaseURL != "" {
-				newCfg.GitLabBaseURL = in.BaseURL
-			}
-			if in.Token != "" {
-				newCfg.GitLabToken = in.Token
-			}
-			if in.ProjectID != "" {
-				newCfg.GitLabProject = in.ProjectID
-			}
-			if in.RepoPath != "" {
-				newCfg.RepoPath = in.RepoPath
-			}
-			if gitlabHandler != nil {
-				if err := gitlabHandler.UpdateConfig(newCfg); err != nil {
-					ctx.JSON(400, map[string]interface{}{"code": 400, "message": err.Error()})
-					return
-				}
-			}
-			cfg = newCfg
-			if in.RepoPath != "" {
-				branchHandler.UpdateRepoPath(in.RepoPath)
-			}
-			ctx.JSON(200, map[string]interface{}{
-				"code":    0,
-				"message": "ok",
-				"data": map[string]string{
-					"base_url":   cfg.GitLabBaseURL,
-					"project_id": cfg.GitLabProject,
-					"repo_path":  cfg.RepoPath,
-				},
-			})
-		})
-		if gitlabHandler != nil {
-			gitlabAPI.GET("/pipelines", gitlabListPipelinesHandler(gitlabHandler))
-			gitlabAPI.GET("/pipelines/:id", gitlabGetPipelineHandler(gitlabHandler))
-			gitlabAPI.GET("/branches", gitlabListBranchesHandler(gitlabHandler))
-			gitlabAPI.GET("/jobs", gitlabListJobsHandler(gitlabHandler))
-			gitlabAPI.POST("/branches", gitlabCreateBranchHandler(gitlabHandler))
-			gitlabAPI.POST("/merge_requests", gitlabCreateMRHandler(gitlabHandler))
-			gitlabAPI.POST("/merge_requests/:iid/merge", gitlabAcceptMRHandler(gitlabHandler))
-			gitlabAPI.POST("/promote", gitlabPromoteHandler(gitlabHandler))
-			gitlabAPI.POST("/merge_requests/auto", gitlabAutoMergeHandler(gitlabHandler))
-		}
+		gitlabAPI.GET("/config", gitlabGetConfigHandler(gitlabHandler))
+		gitlabAPI.POST("/config", audited("gitlab.config"), admin, gitlabUpdateConfigHandler(gitlabHandler))
+		gitlabAPI.GET("/config/versions", admin, gitlabConfigHistoryHandler(gitlabHandler))
+		gitlabAPI.POST("/config/versions/:version/restore", audited("gitlab.config.restore"), admin, gitlabRestoreConfigHandler(gitlabHandler))
+		gitlabAPI.GET("/sync", gitlabSyncStatusHandler(gitlabHandler))
+		gitlabAPI.POST("/sync", audited("gitlab.sync"), maintainer, gitlabTriggerSyncHandler(gitlabHandler))
+		gitlabAPI.GET("/pipelines", gitlabListPipelinesHandler(gitlabHandler))
+		gitlabAPI.GET("/pipelines/:id", gitlabGetPipelineHandler(gitlabHandler))
+		gitlabAPI.PUT("/pipelines/:id/task_type", audited("gitlab.pipeline.task_type"), maintainer, gitlabSetTaskTypeHandler(gitlabHandler))
+		gitlabAPI.GET("/branches", gitlabListBranchesHandler(gitlabHandler))
+		gitlabAPI.GET("/jobs", gitlabListJobsHandler(gitlabHandler))
+		gitlabAPI.POST("/branches", audited("gitlab.branch.create"), developer, gitlabCreateBranchHandler(gitlabHandler))
+		gitlabAPI.POST("/merge_requests", audited("gitlab.merge_request.create"), developer, gitlabCreateMRHandler(gitlabHandler))
+		gitlabAPI.POST("/merge_requests/:iid/merge", audited("gitlab.merge"), maintainer, gitlabAcceptMRHandler(gitlabHandler))
+		gitlabAPI.POST("/promote", audited("gitlab.promote"), maintainer, gitlabPromoteHandler(gitlabHandler))
+		gitlabAPI.POST("/merge_requests/auto", audited("gitlab.auto_merge"), maintainer, gitlabAutoMergeHandler(gitlabHandler))
 	}
 
-	// 4) 注册首页路由
-	h.GET("/", indexPageHandler)
+	// 4) 注册首页路由：未登录时重定向到登录页
+	h.GET("/", authn, indexPageHandler(gitlabHandler))
 
-	// 5) 注册GitLab页面路由（仅在GitLab处理器创建成功时注册）
-	if gitlabHandler != nil {
-		h.GET("/gitlab", gitlabPageHandler(gitlabHandler))
-	}
+	// 5) 注册GitLab页面路由
+	h.GET("/gitlab", authn, gitlabPageHandler(gitlabHandler))
 
 	// 6) 注册兜底处理器：处理未匹配的路由，返回 index.html 实现 SPA 支持
-	h.NoRoute(func(c context.Context, ctx *app.RequestContext) {
+	h.NoRoute(authn, func(c context.Context, ctx *app.RequestContext) {
 		// 对于 /api 前缀的请求，返回 404 JSON 响应
 		if len(ctx.Request.URI().Path()) >= 4 && string(ctx.Request.URI().Path())[:4] == "/api" {
 			ctx.JSON(404, map[string]interface{}{"code": 404, "message": "api not found"})
 			return
 		}
 		// 其他请求返回首页
-		indexPageHandler(c, ctx)
+		indexPageHandler(gitlabHandler)(c, ctx)
 	})
 
 	return h
 }
 
+// 认证处理器包装函数
+func authLoginPageHandler(h *authhandler.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.LoginPage(ctx) }
+}
+
+func authLoginHandler(h *authhandler.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.Login(ctx) }
+}
+
+func authGitLabLoginHandler(h *authhandler.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.GitLabLogin(ctx) }
+}
+
+func authGitLabCallbackHandler(h *authhandler.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.GitLabCallback(ctx) }
+}
+
+func authGitLabLinkHandler(h *authhandler.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.GitLabLink(ctx) }
+}
+
+func authLogoutHandler(h *authhandler.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.Logout(ctx) }
+}
+
+func authMeHandler(h *authhandler.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.Me(ctx) }
+}
+
+func authChangePasswordHandler(h *authhandler.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.ChangePassword(ctx) }
+}
+
+func authListTokensHandler(h *authhandler.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.ListTokens(ctx) }
+}
+
+func authCreateTokenHandler(h *authhandler.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.CreateToken(ctx) }
+}
+
+func authRevokeTokenHandler(h *authhandler.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.RevokeToken(ctx) }
+}
+
+func userListHandler(h *authhandler.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.ListUsers(ctx) }
+}
+
+func userCreateHandler(h *authhandler.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.CreateUser(ctx) }
+}
+
+func userUpdateHandler(h *authhandler.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.UpdateUser(ctx) }
+}
+
 // 分支处理器包装函数
 func branchListHandler(h *branch.Handler) func(c context.Context, ctx *app.RequestContext) {
 	return func(c context.Context, ctx *app.RequestContext) { h.List(ctx) }
@@ -244,6 +317,46 @@ func envDeleteHandler(h *environment.Handler) func(c context.Context, ctx *app.R
 	return func(c context.Context, ctx *app.RequestContext) { h.Delete(ctx) }
 }
 
+func envListVariablesHandler(h *environment.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.ListVariables(ctx) }
+}
+
+func envSetVariableHandler(h *environment.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.SetVariable(ctx) }
+}
+
+func envDeleteVariableHandler(h *environment.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.DeleteVariable(ctx) }
+}
+
+func envListDeploymentsHandler(h *environment.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.ListDeployments(ctx) }
+}
+
+func envDeploymentChangesHandler(h *environment.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.DeploymentChanges(ctx) }
+}
+
+func envPendingChangesHandler(h *environment.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.PendingChanges(ctx) }
+}
+
+func envRollbackHandler(h *environment.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.Rollback(ctx) }
+}
+
+func envListFreezesHandler(h *environment.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.ListFreezes(ctx) }
+}
+
+func envCreateFreezeHandler(h *environment.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.CreateFreeze(ctx) }
+}
+
+func envDeleteFreezeHandler(h *environment.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.DeleteFreeze(ctx) }
+}
+
 // 任务处理器包装函数
 func jobListHandler(h *job.Handler) func(c context.Context, ctx *app.RequestContext) {
 	return func(c context.Context, ctx *app.RequestContext) { h.List(ctx) }
@@ -261,14 +374,55 @@ func jobUpdateStatusHandler(h *job.Handler) func(c context.Context, ctx *app.Req
 	return func(c context.Context, ctx *app.RequestContext) { h.UpdateStatus(ctx) }
 }
 
+func jobEventsHandler(h *job.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.Events(ctx) }
+}
+
 func jobLogHandler(h *job.Handler) func(c context.Context, ctx *app.RequestContext) {
 	return func(c context.Context, ctx *app.RequestContext) { h.Log(ctx) }
 }
 
+func jobStreamLogHandler(h *job.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) {
+		rc, cancel := requestContext(c, ctx)
+		defer cancel()
+		h.StreamLog(rc, ctx)
+	}
+}
+
 func jobCancelHandler(h *job.Handler) func(c context.Context, ctx *app.RequestContext) {
 	return func(c context.Context, ctx *app.RequestContext) { h.Cancel(ctx) }
 }
 
+func jobRetryHandler(h *job.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.Retry(ctx) }
+}
+
+func jobApproveHandler(h *job.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.Approve(ctx) }
+}
+
+func jobRejectHandler(h *job.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.Reject(ctx) }
+}
+
+func jobApprovalsHandler(h *job.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.Approvals(ctx) }
+}
+
+// 产物处理器包装函数
+func artifactListHandler(h *artifact.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.List(ctx) }
+}
+
+func artifactDownloadHandler(h *artifact.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.Download(ctx) }
+}
+
+func artifactDownloadAllHandler(h *artifact.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.DownloadAll(ctx) }
+}
+
 // 仪表盘处理器包装函数
 func dashboardOverviewHandler(h *dashboard.Handler) func(c context.Context, ctx *app.RequestContext) {
 	return func(c context.Context, ctx *app.RequestContext) { h.Overview(ctx) }
@@ -288,7 +442,15 @@ func gitlabListPipelinesHandler(h *gitlab.Handler) func(c context.Context, ctx *
 }
 
 func gitlabGetPipelineHandler(h *gitlab.Handler) func(c context.Context, ctx *app.RequestContext) {
-	return func(c context.Context, ctx *app.RequestContext) { h.GetPipeline(ctx) }
+	return func(c context.Context, ctx *app.RequestContext) {
+		rc, cancel := requestContext(c, ctx)
+		defer cancel()
+		h.GetPipeline(rc, ctx)
+	}
+}
+
+func gitlabSetTaskTypeHandler(h *gitlab.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.SetTaskType(c, ctx) }
 }
 
 func gitlabListBranchesHandler(h *gitlab.Handler) func(c context.Context, ctx *app.RequestContext) {
@@ -297,7 +459,39 @@ func gitlabListBranchesHandler(h *gitlab.Handler) func(c context.Context, ctx *a
 
 // 新增的GitLab任务列表处理器包装函数
 func gitlabListJobsHandler(h *gitlab.Handler) func(c context.Context, ctx *app.RequestContext) {
-	return func(c context.Context, ctx *app.RequestContext) { h.ListJobs(ctx) }
+	return func(c context.Context, ctx *app.RequestContext) {
+		rc, cancel := requestContext(c, ctx)
+		defer cancel()
+		h.ListJobs(rc, ctx)
+	}
+}
+
+func gitlabGetConfigHandler(h *gitlab.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.GetConfig(ctx) }
+}
+
+func gitlabUpdateConfigHandler(h *gitlab.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.UpdateConfig(ctx) }
+}
+
+func gitlabConfigHistoryHandler(h *gitlab.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.ConfigHistory(ctx) }
+}
+
+func gitlabRestoreConfigHandler(h *gitlab.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.RestoreConfig(ctx) }
+}
+
+func gitlabSyncStatusHandler(h *gitlab.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.SyncStatus(ctx) }
+}
+
+func gitlabTriggerSyncHandler(h *gitlab.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.TriggerSync(ctx) }
+}
+
+func gitlabWebhookHandler(h *gitlab.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.Webhook(ctx) }
 }
 
 // GitLab页面处理器包装函数
@@ -324,3 +518,11 @@ func gitlabPromoteHandler(h *gitlab.Handler) func(c context.Context, ctx *app.Re
 func gitlabAutoMergeHandler(h *gitlab.Handler) func(c context.Context, ctx *app.RequestContext) {
 	return func(c context.Context, ctx *app.RequestContext) { h.AutoMerge(ctx) }
 }
+
+func auditListHandler(h *audithandler.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.List(ctx) }
+}
+
+func auditExportHandler(h *audithandler.Handler) func(c context.Context, ctx *app.RequestContext) {
+	return func(c context.Context, ctx *app.RequestContext) { h.Export(ctx) }
+}
@@ -0,0 +1,120 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// Mask 密文变量在日志与接口响应中的替代文本
+const Mask = "[MASKED]"
+
+// ErrMalformed 密文格式错误或无法用当前密钥解密
+var ErrMalformed = errors.New("malformed secret")
+
+// ErrNoKey 未配置服务端密钥：临时密钥加密的数据重启后无法解密，不应用于需要持久保存的密文
+var ErrNoKey = errors.New("SECRET_KEY is not set, data encrypted with a temporary key cannot be read after restart")
+
+var (
+	mu   sync.RWMutex
+	aead cipher.AEAD
+	// persistent 是否以配置的服务端密钥初始化
+	persistent bool
+)
+
+// Setup 以服务端密钥初始化加密器（AES-256-GCM）
+// key 为 base64 编码的 32 字节时直接作为密钥，其他非空字符串经 SHA-256 派生；
+// 为空时生成进程内临时密钥，重启后此前加密的数据无法解密
+func Setup(key string) error {
+	var k []byte
+	switch raw, err := base64.StdEncoding.DecodeString(key); {
+	case key == "":
+		k = make([]byte, 32)
+		if _, err := rand.Read(k); err != nil {
+			return err
+		}
+	case err == nil && len(raw) == 32:
+		k = raw
+	default:
+		sum := sha256.Sum256([]byte(key))
+		k = sum[:]
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	aead, persistent = gcm, key != ""
+	mu.Unlock()
+	return nil
+}
+
+// Persistent 是否使用配置的服务端密钥，为否时加密结果仅在本进程内可解密
+func Persistent() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return persistent
+}
+
+// current 返回当前加密器，未初始化时使用临时密钥
+func current() (cipher.AEAD, error) {
+	mu.RLock()
+	a := aead
+	mu.RUnlock()
+	if a != nil {
+		return a, nil
+	}
+	if err := Setup(""); err != nil {
+		return nil, err
+	}
+	return current()
+}
+
+// Encrypt 加密明文，返回 base64(nonce|密文)
+func Encrypt(plain string) (string, error) {
+	a, err := current()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, a.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(a.Seal(nonce, nonce, []byte(plain), nil)), nil
+}
+
+// Decrypt 解密 Encrypt 的输出
+func Decrypt(enc string) (string, error) {
+	a, err := current()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil || len(data) < a.NonceSize() {
+		return "", ErrMalformed
+	}
+	plain, err := a.Open(nil, data[:a.NonceSize()], data[a.NonceSize():], nil)
+	if err != nil {
+		return "", ErrMalformed
+	}
+	return string(plain), nil
+}
+
+// MaskText 将文本中出现的密文值替换为 Mask
+func MaskText(text string, values []string) string {
+	for _, v := range values {
+		if v != "" {
+			text = strings.ReplaceAll(text, v, Mask)
+		}
+	}
+	return text
+}
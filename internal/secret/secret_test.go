@@ -0,0 +1,33 @@
+package secret
+
+import "testing"
+
+func TestEncryptRoundTripAndKeyMismatch(t *testing.T) {
+	if err := Setup("server-key-1"); err != nil {
+		t.Fatal(err)
+	}
+	enc, err := Encrypt("s3cr3t-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enc == "s3cr3t-value" {
+		t.Fatal("value stored in plain text")
+	}
+	plain, err := Decrypt(enc)
+	if err != nil || plain != "s3cr3t-value" {
+		t.Fatalf("decrypt: %q %v", plain, err)
+	}
+	if err := Setup("server-key-2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(enc); err != ErrMalformed {
+		t.Fatalf("decrypt with another key should fail, got %v", err)
+	}
+}
+
+func TestMaskText(t *testing.T) {
+	got := MaskText("token=abcdefgh used abcdefgh", []string{"abcdefgh", ""})
+	if got != "token=[MASKED] used [MASKED]" {
+		t.Fatalf("unexpected masked text %q", got)
+	}
+}
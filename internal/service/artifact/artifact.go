@@ -0,0 +1,263 @@
+package artifact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+	"webci-refactored/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// ErrTooLarge 任务产物总大小超过上限
+var ErrTooLarge = errors.New("artifacts exceed size limit")
+
+// ErrExpired 产物已过期
+var ErrExpired = errors.New("artifact expired")
+
+// purgeBatch 单次清理的过期产物数量
+const purgeBatch = 100
+
+// Service 产物服务
+// 负责从工作区收集产物、写入存储后端以及过期清理
+type Service struct {
+	artifacts *repository.ArtifactRepository
+	store     storage.Storage
+	maxSize   int64
+	expireIn  time.Duration
+}
+
+// NewService 创建产物服务
+// maxSize 为单个任务产物总大小上限（字节），expireIn 为未声明保留时长时的默认值
+func NewService(db *gorm.DB, store storage.Storage, maxSize int64, expireIn time.Duration) *Service {
+	return &Service{artifacts: repository.NewArtifactRepository(db), store: store, maxSize: maxSize, expireIn: expireIn}
+}
+
+// file 待收集的工作区文件
+type file struct {
+	rel  string
+	abs  string
+	size int64
+}
+
+// Collect 按任务声明的产物路径从工作区收集文件，写入存储并记录到 artifacts 表
+// 匹配到目录时收集其下全部普通文件；符号链接与解析后位于工作区之外的文件被忽略。
+// 总大小超过上限时返回 ErrTooLarge 且不写入任何产物；同一任务重复执行时覆盖上次的产物
+func (s *Service) Collect(j *model.Job, workspace string, out io.Writer) ([]model.Artifact, error) {
+	if len(j.ArtifactPaths) == 0 {
+		return nil, nil
+	}
+	if err := s.deleteJob(j.ID); err != nil {
+		return nil, err
+	}
+	files, err := matchFiles(workspace, j.ArtifactPaths, out)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(out, "[ARTIFACTS] no files matched\n")
+		return nil, nil
+	}
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	if total > s.maxSize {
+		return nil, fmt.Errorf("%w: %d bytes > %d bytes", ErrTooLarge, total, s.maxSize)
+	}
+	var expiresAt *time.Time
+	switch {
+	case j.ArtifactsExpireIn < 0:
+	case j.ArtifactsExpireIn > 0:
+		t := time.Now().Add(time.Duration(j.ArtifactsExpireIn) * time.Second)
+		expiresAt = &t
+	default:
+		t := time.Now().Add(s.expireIn)
+		expiresAt = &t
+	}
+	items := make([]model.Artifact, 0, len(files))
+	for _, f := range files {
+		a, err := s.upload(j.ID, f, expiresAt)
+		if err != nil {
+			// 部分失败时撤销已写入的产物，避免留下不完整的集合
+			_ = s.deleteJob(j.ID)
+			return nil, fmt.Errorf("upload artifact %s: %w", f.rel, err)
+		}
+		items = append(items, *a)
+	}
+	fmt.Fprintf(out, "[ARTIFACTS] uploaded %d file(s), %d bytes\n", len(items), total)
+	return items, nil
+}
+
+// upload 写入单个文件并记录，存储时同步计算 SHA-256
+func (s *Service) upload(jobID uint64, f file, expiresAt *time.Time) (*model.Artifact, error) {
+	src, err := os.Open(f.abs)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	key := fmt.Sprintf("jobs/%d/%s", jobID, f.rel)
+	h := sha256.New()
+	n, err := s.store.Put(key, io.TeeReader(src, h))
+	if err != nil {
+		return nil, err
+	}
+	a := &model.Artifact{JobID: jobID, Path: f.rel, Size: n, SHA256: hex.EncodeToString(h.Sum(nil)), StorageKey: key, ExpiresAt: expiresAt}
+	if err := s.artifacts.Create(a); err != nil {
+		_ = s.store.Delete(key)
+		return nil, err
+	}
+	return a, nil
+}
+
+// matchFiles 展开产物路径，返回按相对路径排序、去重后的文件列表
+func matchFiles(workspace string, patterns []string, out io.Writer) ([]file, error) {
+	root, err := filepath.EvalSymlinks(workspace)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]file{}
+	add := func(abs string) error {
+		rel, err := filepath.Rel(workspace, abs)
+		if err != nil {
+			return err
+		}
+		// 路径中的目录可能是指向工作区外的符号链接，按解析后的真实路径判断
+		real, err := filepath.EvalSymlinks(abs)
+		if err != nil {
+			return nil
+		}
+		if r, err := filepath.Rel(root, real); err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+			return nil
+		}
+		info, err := os.Lstat(abs)
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = file{rel: rel, abs: abs, size: info.Size()}
+		return nil
+	}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(workspace, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			fmt.Fprintf(out, "[ARTIFACTS] %s: no matching files\n", pattern)
+		}
+		for _, m := range matches {
+			info, err := os.Lstat(m)
+			if err != nil {
+				continue
+			}
+			if !info.IsDir() {
+				if err := add(m); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			// WalkDir 不跟随符号链接，目录内的链接在 add 中被过滤
+			err = filepath.WalkDir(m, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.Type().IsRegular() {
+					return add(p)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	files := make([]file, 0, len(seen))
+	for _, f := range seen {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, k int) bool { return files[i].rel < files[k].rel })
+	return files, nil
+}
+
+// List 查询任务未过期的产物
+func (s *Service) List(jobID uint64) ([]model.Artifact, error) {
+	items, err := s.artifacts.ListByJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	kept := items[:0]
+	for _, a := range items {
+		if !expired(&a, now) {
+			kept = append(kept, a)
+		}
+	}
+	return kept, nil
+}
+
+// Get 获取任务下的单个产物，已过期（尚未被清理）的返回 ErrExpired
+func (s *Service) Get(jobID, id uint64) (*model.Artifact, error) {
+	a, err := s.artifacts.Get(jobID, id)
+	if err != nil {
+		return nil, err
+	}
+	if expired(a, time.Now()) {
+		return nil, ErrExpired
+	}
+	return a, nil
+}
+
+// Open 打开产物内容
+func (s *Service) Open(a *model.Artifact) (io.ReadCloser, error) { return s.store.Open(a.StorageKey) }
+
+// PurgeExpired 删除已过期的产物文件与记录，返回清理数量
+func (s *Service) PurgeExpired(now time.Time) (int, error) {
+	items, err := s.artifacts.ListExpired(now, purgeBatch)
+	if err != nil {
+		return 0, err
+	}
+	for i, a := range items {
+		if err := s.remove(&a); err != nil {
+			return i, err
+		}
+	}
+	return len(items), nil
+}
+
+// deleteJob 删除任务的全部产物
+func (s *Service) deleteJob(jobID uint64) error {
+	items, err := s.artifacts.ListByJob(jobID)
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		if err := s.remove(&items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove 先删除存储对象再删除记录，失败时记录仍在，下次清理重试
+func (s *Service) remove(a *model.Artifact) error {
+	if err := s.store.Delete(a.StorageKey); err != nil {
+		return err
+	}
+	return s.artifacts.Delete(a.ID)
+}
+
+// expired 判断产物在 now 时是否已过期
+func expired(a *model.Artifact, now time.Time) bool {
+	return a.ExpiresAt != nil && !a.ExpiresAt.After(now)
+}
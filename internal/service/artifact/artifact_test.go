@@ -0,0 +1,131 @@
+package artifact
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"webci-refactored/internal/dal"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/storage"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestService 创建使用独立内存 SQLite 与临时存储目录的产物服务
+func newTestService(t *testing.T, maxSize int64) *Service {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return NewService(db, storage.NewLocal(t.TempDir()), maxSize, time.Hour)
+}
+
+// writeFile 在工作区内写入测试文件
+func writeFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	p := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectMatchesFilesAndSkipsEscapes(t *testing.T) {
+	svc := newTestService(t, 1<<20)
+	ws := t.TempDir()
+	outside := t.TempDir()
+	writeFile(t, ws, "dist/app", "binary")
+	writeFile(t, ws, "dist/sub/readme.txt", "docs")
+	writeFile(t, ws, "report.xml", "<ok/>")
+	writeFile(t, outside, "secret", "nope")
+	if err := os.Symlink(filepath.Join(outside, "secret"), filepath.Join(ws, "dist", "leak")); err != nil {
+		t.Fatal(err)
+	}
+
+	j := &model.Job{ID: 7, ArtifactPaths: model.StringList{"dist", "*.xml", "missing/*"}}
+	var out strings.Builder
+	items, err := svc.Collect(j, ws, &out)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	var paths []string
+	for _, a := range items {
+		paths = append(paths, a.Path)
+	}
+	if strings.Join(paths, ",") != "dist/app,dist/sub/readme.txt,report.xml" {
+		t.Fatalf("unexpected artifacts: %v", paths)
+	}
+	if !strings.Contains(out.String(), "missing/*: no matching files") {
+		t.Fatalf("unmatched pattern not logged: %q", out.String())
+	}
+	if items[0].ExpiresAt == nil || items[0].SHA256 == "" {
+		t.Fatalf("expiry and checksum expected: %+v", items[0])
+	}
+	rc, err := svc.Open(&items[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "binary" {
+		t.Fatalf("stored content = %q", data)
+	}
+
+	// 重复收集覆盖上次结果
+	j.ArtifactPaths = model.StringList{"report.xml"}
+	if _, err := svc.Collect(j, ws, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := svc.List(7); len(list) != 1 {
+		t.Fatalf("re-collect should replace artifacts, got %d", len(list))
+	}
+}
+
+func TestCollectSizeLimitAndExpiry(t *testing.T) {
+	svc := newTestService(t, 8)
+	ws := t.TempDir()
+	writeFile(t, ws, "big.bin", "0123456789")
+	_, err := svc.Collect(&model.Job{ID: 1, ArtifactPaths: model.StringList{"big.bin"}}, ws, io.Discard)
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+	if list, _ := svc.List(1); len(list) != 0 {
+		t.Fatalf("oversized artifacts must not be stored: %v", list)
+	}
+
+	writeFile(t, ws, "small.txt", "ok")
+	items, err := svc.Collect(&model.Job{ID: 2, ArtifactPaths: model.StringList{"small.txt"}, ArtifactsExpireIn: 1}, ws, io.Discard)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("collect: %v %v", items, err)
+	}
+	kept, err := svc.Collect(&model.Job{ID: 3, ArtifactPaths: model.StringList{"small.txt"}, ArtifactsExpireIn: -1}, ws, io.Discard)
+	if err != nil || kept[0].ExpiresAt != nil {
+		t.Fatalf("expire_in never should not expire: %v %v", kept, err)
+	}
+	later := time.Now().Add(2 * time.Second)
+	if _, err := svc.Get(2, items[0].ID); err != nil {
+		t.Fatalf("artifact should still be valid: %v", err)
+	}
+	n, err := svc.PurgeExpired(later)
+	if err != nil || n != 1 {
+		t.Fatalf("purge: %d %v", n, err)
+	}
+	if _, err := svc.Open(&items[0]); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("purged file should be gone: %v", err)
+	}
+	if list, _ := svc.List(3); len(list) != 1 {
+		t.Fatalf("non-expiring artifact purged")
+	}
+}
@@ -0,0 +1,182 @@
+package audit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// maxSummary 请求摘要最大长度，超出部分截断
+	maxSummary = 1024
+	// exportBatch 导出时每批读取的事件数
+	exportBatch = 500
+	// redacted 脱敏占位
+	redacted = "***"
+)
+
+// targetFields 请求体中用于标识操作对象的字段，按此顺序拼接到对象描述
+var targetFields = []string{"name", "username", "branch", "source_prefix", "source_branch", "target_branch", "target", "project_id"}
+
+// Filter 审计事件查询条件
+type Filter = repository.AuditFilter
+
+// Service 审计服务
+// 记录写接口的调用并提供查询与 CSV 导出
+type Service struct {
+	repo *repository.AuditRepository
+}
+
+// NewService 创建审计服务
+func NewService(db *gorm.DB) *Service {
+	return &Service{repo: repository.NewAuditRepository(db)}
+}
+
+// Record 写入审计事件：按状态码补全结果，超长字段截断
+func (s *Service) Record(e *model.AuditEvent) error {
+	if e.Result == "" {
+		e.Result = model.AuditSuccess
+		if e.Status >= 400 {
+			e.Result = model.AuditFailure
+		}
+	}
+	e.Target = truncate(e.Target, 255)
+	e.Path = truncate(e.Path, 255)
+	e.Error = truncate(e.Error, 512)
+	return s.repo.Create(e)
+}
+
+// List 按条件分页查询审计事件
+func (s *Service) List(f Filter, limit, offset int) ([]model.AuditEvent, int64, error) {
+	return s.repo.List(f, limit, offset)
+}
+
+// Export 按条件将审计事件以 CSV 写出（按时间倒序）
+func (s *Service) Export(w io.Writer, f Filter) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"id", "time", "actor", "action", "target", "method", "path", "status", "result", "error", "summary", "remote_addr"}); err != nil {
+		return err
+	}
+	// 按 ID 向前翻页，导出期间新写入的事件不会导致重复或遗漏
+	for {
+		items, _, err := s.repo.List(f, exportBatch, 0)
+		if err != nil {
+			return err
+		}
+		for _, e := range items {
+			f.BeforeID = e.ID
+			row := []string{strconv.FormatUint(e.ID, 10), e.CreatedAt.Format(time.RFC3339), e.Actor, e.Action, e.Target, e.Method, e.Path, strconv.Itoa(e.Status), e.Result, e.Error, e.Summary, e.RemoteAddr}
+			for i := range row {
+				row[i] = csvSafe(row[i])
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+		if len(items) < exportBatch {
+			break
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Describe 根据请求路径、查询串与 JSON 请求体生成操作对象与脱敏的请求摘要
+// 对象为去掉 /api/ 前缀的路径加上请求体中的标识字段；摘要中的密码、令牌与密文变量值替换为 ***
+func Describe(path, query string, body []byte) (target, summary string) {
+	target = strings.TrimPrefix(path, "/api/")
+	var fields map[string]interface{}
+	if len(body) > 0 && json.Unmarshal(body, &fields) == nil {
+		for _, k := range targetFields {
+			if v, ok := fields[k].(string); ok && v != "" {
+				target += " " + k + "=" + v
+			}
+		}
+		redact(fields)
+		b, _ := json.Marshal(fields)
+		summary = string(b)
+	} else if len(body) > 0 {
+		summary = fmt.Sprintf("<%d bytes>", len(body))
+	}
+	if query != "" {
+		summary = strings.TrimSpace("?" + redactQuery(query) + " " + summary)
+	}
+	return target, truncate(summary, maxSummary)
+}
+
+// sensitive 判断字段名是否为敏感字段
+func sensitive(key string) bool {
+	k := strings.ToLower(key)
+	if k == "secret" {
+		// 变量的 secret 字段是密文标记，不是密钥本身
+		return false
+	}
+	return strings.Contains(k, "password") || strings.Contains(k, "token") || strings.Contains(k, "secret")
+}
+
+// redact 脱敏请求体：敏感字段与标记为密文（secret=true）的变量值，递归处理嵌套对象与数组
+// （如 POST /api/jobs 的 variables: [{key, value, secret}]）
+func redact(fields map[string]interface{}) {
+	for k, v := range fields {
+		switch {
+		case sensitive(k):
+			fields[k] = redacted
+		case k == "value" && fields["secret"] == true:
+			fields[k] = redacted
+		default:
+			redactValue(v)
+		}
+	}
+}
+
+// redactValue 脱敏嵌套在对象或数组中的值
+func redactValue(v interface{}) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		redact(t)
+	case []interface{}:
+		for _, e := range t {
+			redactValue(e)
+		}
+	}
+}
+
+// redactQuery 脱敏查询串中的敏感参数
+func redactQuery(query string) string {
+	parts := strings.Split(query, "&")
+	for i, p := range parts {
+		if k, _, ok := strings.Cut(p, "="); ok && sensitive(k) {
+			parts[i] = k + "=" + redacted
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
+
+// csvSafe 防止单元格以公式字符开头被电子表格执行
+func csvSafe(v string) string {
+	if v != "" && strings.ContainsRune("=+-@", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// truncate 按字节截断字符串，不切断 UTF-8 字符
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
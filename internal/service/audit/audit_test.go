@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+	"webci-refactored/internal/dal"
+	"webci-refactored/internal/dal/model"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestDescribeRedacts(t *testing.T) {
+	target, summary := Describe("/api/gitlab/merge_requests", "", []byte(`{"source_branch":"feature/a","target_branch":"main","title":"x"}`))
+	if target != "gitlab/merge_requests source_branch=feature/a target_branch=main" {
+		t.Fatalf("target: %q", target)
+	}
+	if !strings.Contains(summary, `"title":"x"`) {
+		t.Fatalf("summary: %q", summary)
+	}
+	_, summary = Describe("/api/auth/password", "", []byte(`{"old_password":"a","new_password":"b"}`))
+	if strings.Contains(summary, `"a"`) || strings.Contains(summary, `"b"`) {
+		t.Fatalf("passwords must be redacted: %q", summary)
+	}
+	_, summary = Describe("/api/gitlab/config", "", []byte(`{"token":"glpat-x","base_url":"u"}`))
+	if strings.Contains(summary, "glpat-x") {
+		t.Fatalf("token must be redacted: %q", summary)
+	}
+	_, summary = Describe("/api/environments/1/variables/K", "", []byte(`{"value":"hidden","secret":true}`))
+	if strings.Contains(summary, "hidden") || !strings.Contains(summary, `"secret":true`) {
+		t.Fatalf("secret variable value must be redacted: %q", summary)
+	}
+	_, summary = Describe("/api/environments/1/variables/K", "", []byte(`{"value":"plain"}`))
+	if !strings.Contains(summary, "plain") {
+		t.Fatalf("plain variable value should be kept: %q", summary)
+	}
+}
+
+func TestDescribeRedactsArrays(t *testing.T) {
+	body := `{"branch_id":1,"variables":[{"key":"K","value":"hunter2","secret":true},{"key":"P","value":"visible"}],"steps":[[{"token":"t0k"}]]}`
+	_, summary := Describe("/api/jobs", "", []byte(body))
+	if strings.Contains(summary, "hunter2") || strings.Contains(summary, "t0k") {
+		t.Fatalf("secret values inside arrays must be redacted: %q", summary)
+	}
+	if !strings.Contains(summary, "visible") || !strings.Contains(summary, `"key":"K"`) {
+		t.Fatalf("non-secret array values should be kept: %q", summary)
+	}
+}
+
+func TestListAndExport(t *testing.T) {
+	s := NewService(openTestDB(t))
+	events := []model.AuditEvent{
+		{Actor: "alice", Action: "gitlab.merge", Target: "gitlab/merge_requests/3/merge", Status: 200},
+		{Actor: "bob", Action: "job.retry", Target: "jobs/7/retry", Status: 403, Error: "requires role developer"},
+		{Actor: "alice", Action: "gitlab.promote", Target: "gitlab/promote name=x", Status: 500, Error: "=cmd"},
+	}
+	for i := range events {
+		if err := s.Record(&events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if events[1].Result != model.AuditFailure || events[0].Result != model.AuditSuccess {
+		t.Fatalf("result should follow status: %+v", events)
+	}
+	if items, total, _ := s.List(Filter{Action: "gitlab.*"}, 10, 0); total != 2 || items[0].Action != "gitlab.promote" {
+		t.Fatalf("prefix filter: %d %+v", total, items)
+	}
+	if _, total, _ := s.List(Filter{Actor: "alice", Result: model.AuditFailure}, 10, 0); total != 1 {
+		t.Fatalf("actor/result filter: %d", total)
+	}
+	if _, total, _ := s.List(Filter{Target: "jobs/7"}, 10, 0); total != 1 {
+		t.Fatalf("target filter: %d", total)
+	}
+	future := time.Now().Add(time.Hour)
+	if _, total, _ := s.List(Filter{Since: &future}, 10, 0); total != 0 {
+		t.Fatalf("since filter: %d", total)
+	}
+
+	var buf bytes.Buffer
+	if err := s.Export(&buf, Filter{}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(rows) != 4 || rows[0][0] != "id" || rows[1][2] != "alice" {
+		t.Fatalf("csv: %v %v", rows, err)
+	}
+	if rows[1][9] != "'=cmd" {
+		t.Fatalf("formula cells must be neutralized: %q", rows[1][9])
+	}
+}
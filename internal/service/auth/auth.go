@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// 认证错误：供上层映射 HTTP 状态码
+var (
+	// ErrInvalidCredentials 用户名或密码错误（含用户已禁用），不区分具体原因
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrInvalidToken 令牌不存在、已过期或所属用户已禁用
+	ErrInvalidToken = errors.New("invalid or expired token")
+	// ErrUserExists 用户名已被占用
+	ErrUserExists = errors.New("user already exists")
+	// ErrAccountConflict 同名本地用户已关联其他 GitLab 账号
+	ErrAccountConflict = errors.New("username is linked to another gitlab account")
+	// ErrLinkRequired 存在同名本地用户，需以本地密码登录后主动关联 GitLab 账号
+	ErrLinkRequired = errors.New("a local user with this username exists, sign in with the local password and link the gitlab account")
+)
+
+// minPasswordLen 密码最短长度
+const minPasswordLen = 8
+
+// usernamePattern 用户名规则：字母、数字、点、下划线与连字符，以字母或数字开头
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// roleRanks 角色权限等级，数值越大权限越高
+var roleRanks = map[string]int{
+	model.RoleViewer:     1,
+	model.RoleDeveloper:  2,
+	model.RoleMaintainer: 3,
+	model.RoleAdmin:      4,
+}
+
+// ValidRole 判断角色取值是否合法
+func ValidRole(role string) bool { return roleRanks[role] > 0 }
+
+// HasRole 判断角色 have 是否拥有角色 need 的权限
+func HasRole(have, need string) bool { return ValidRole(have) && roleRanks[have] >= roleRanks[need] }
+
+// Service 认证服务
+// 提供本地用户管理、密码登录、GitLab 单点登录与访问令牌校验
+type Service struct {
+	db          *gorm.DB
+	users       *repository.UserRepository
+	tokens      *repository.TokenRepository
+	credentials *repository.CredentialRepository
+}
+
+// NewService 创建认证服务
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, users: repository.NewUserRepository(db), tokens: repository.NewTokenRepository(db), credentials: repository.NewCredentialRepository(db)}
+}
+
+// CreateUser 创建本地用户，校验用户名、密码长度与角色
+func (s *Service) CreateUser(username, password, role string) (*model.User, error) {
+	if !usernamePattern.MatchString(username) {
+		return nil, fmt.Errorf("invalid username %q", username)
+	}
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("invalid role %q", role)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.users.GetByUsername(username); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUserExists, username)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	u := &model.User{Username: username, PasswordHash: hash, Role: role}
+	if err := s.users.Create(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// UserUpdate 用户的部分更新，字段为空时保留原有设置
+type UserUpdate struct {
+	Role     *string
+	Password *string
+	Disabled *bool
+}
+
+// UpdateUser 更新用户角色、密码或禁用状态
+// 禁用用户或修改密码时吊销其全部登录会话
+func (s *Service) UpdateUser(id uint64, in UserUpdate) (*model.User, error) {
+	u, err := s.users.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if in.Role != nil {
+		if !ValidRole(*in.Role) {
+			return nil, fmt.Errorf("invalid role %q", *in.Role)
+		}
+		u.Role = *in.Role
+	}
+	revoke := false
+	if in.Password != nil {
+		hash, err := hashPassword(*in.Password)
+		if err != nil {
+			return nil, err
+		}
+		u.PasswordHash = hash
+		revoke = true
+	}
+	if in.Disabled != nil {
+		u.Disabled = *in.Disabled
+		revoke = revoke || u.Disabled
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := repository.NewUserRepository(tx).Update(u); err != nil {
+			return err
+		}
+		if !revoke {
+			return nil
+		}
+		return tx.Where("user_id = ? AND kind = ?", u.ID, model.TokenKindSession).Delete(&model.APIToken{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// ListUsers 列出全部用户
+func (s *Service) ListUsers() ([]model.User, error) { return s.users.List() }
+
+// GetUser 按用户名获取用户
+func (s *Service) GetUser(username string) (*model.User, error) {
+	return s.users.GetByUsername(username)
+}
+
+// IsAdmin 判断用户名对应的用户是否为未禁用的管理员
+func (s *Service) IsAdmin(username string) bool {
+	u, err := s.users.GetByUsername(username)
+	return err == nil && !u.Disabled && u.Role == model.RoleAdmin
+}
+
+// Bootstrap 启动时确保管理员存在
+// admins 中已存在的用户提升为管理员，不存在的以 password 创建；尚无任何用户且未指定管理员时创建 admin 用户。
+// password 为空时为新建用户生成随机密码，返回用户名到生成密码的映射供启动日志输出
+func (s *Service) Bootstrap(admins []string, password string) (map[string]string, error) {
+	n, err := s.users.Count()
+	if err != nil {
+		return nil, err
+	}
+	if len(admins) == 0 && n == 0 {
+		admins = []string{"admin"}
+	}
+	generated := map[string]string{}
+	for _, name := range admins {
+		u, err := s.users.GetByUsername(name)
+		if err == nil {
+			if u.Role != model.RoleAdmin {
+				u.Role = model.RoleAdmin
+				if err := s.users.Update(u); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		pw := password
+		if pw == "" {
+			if pw, err = randomHex(12); err != nil {
+				return nil, err
+			}
+			generated[name] = pw
+		}
+		if _, err := s.CreateUser(name, pw, model.RoleAdmin); err != nil {
+			return nil, err
+		}
+	}
+	return generated, nil
+}
+
+// hashPassword 校验密码长度并计算 bcrypt 哈希
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLen {
+		return "", fmt.Errorf("password must be at least %d characters", minPasswordLen)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// randomHex 生成 n 字节随机数的十六进制文本
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"webci-refactored/internal/dal"
+	"webci-refactored/internal/dal/model"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestHasRole(t *testing.T) {
+	if !HasRole(model.RoleAdmin, model.RoleDeveloper) || HasRole(model.RoleViewer, model.RoleDeveloper) || HasRole("", model.RoleViewer) {
+		t.Fatal("unexpected role ordering")
+	}
+}
+
+func TestLoginAndTokens(t *testing.T) {
+	s := NewService(openTestDB(t))
+	generated, err := s.Bootstrap(nil, "")
+	if err != nil || len(generated["admin"]) == 0 {
+		t.Fatalf("bootstrap should create admin with a generated password: %v %v", generated, err)
+	}
+	if again, _ := s.Bootstrap(nil, ""); len(again) != 0 {
+		t.Fatalf("bootstrap must not recreate users: %v", again)
+	}
+	if _, _, err := s.Login("admin", "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+	session, u, err := s.Login("admin", generated["admin"])
+	if err != nil || u.Role != model.RoleAdmin {
+		t.Fatalf("login failed: %v", err)
+	}
+	if got, err := s.Authenticate(session); err != nil || got.Username != "admin" {
+		t.Fatalf("session should authenticate: %v", err)
+	}
+
+	dev, err := s.CreateUser("dev", "password1", model.RoleDeveloper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateUser("dev", "password1", model.RoleDeveloper); !errors.Is(err, ErrUserExists) {
+		t.Fatalf("expected ErrUserExists, got %v", err)
+	}
+	if _, err := s.CreateUser("bad", "short", model.RoleDeveloper); err == nil {
+		t.Fatal("short passwords must be rejected")
+	}
+	plain, tok, err := s.CreateToken(dev.ID, "ci", nil)
+	if err != nil || tok.TokenHash == plain {
+		t.Fatalf("token must be stored hashed: %v", err)
+	}
+	if got, err := s.Authenticate(plain); err != nil || got.ID != dev.ID {
+		t.Fatalf("personal token should authenticate: %v", err)
+	}
+	past := time.Now().Add(-time.Minute)
+	if _, _, err := s.CreateToken(dev.ID, "old", &past); err == nil {
+		t.Fatal("expired tokens must not be created")
+	}
+
+	disabled := true
+	if _, err := s.UpdateUser(dev.ID, UserUpdate{Disabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(plain); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("tokens of disabled users must be refused, got %v", err)
+	}
+	if ok, _ := s.RevokeToken(dev.ID, tok.ID); !ok {
+		t.Fatal("revoke should find the token")
+	}
+	if err := s.Logout(session); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(session); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("logged out session must be refused, got %v", err)
+	}
+}
@@ -0,0 +1,296 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"webci-refactored/internal/config"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/secret"
+
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// refreshLeeway 访问令牌到期前提前刷新的余量
+const refreshLeeway = time.Minute
+
+// GitLabOAuth GitLab OAuth2 授权码登录配置
+// GitLab 作为身份提供方：授权地址 <站点>/oauth/authorize，令牌地址 <站点>/oauth/token，用户信息 <站点>/api/v4/user
+type GitLabOAuth struct {
+	conf        *oauth2.Config
+	apiURL      string
+	defaultRole string
+	userToken   bool
+	client      *http.Client
+}
+
+// gitlabProfile GitLab 当前用户信息（仅取需要的字段）
+type gitlabProfile struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	State    string `json:"state"`
+}
+
+// NewGitLabOAuth 根据配置创建 GitLab 单点登录，未配置应用 ID 时返回 nil
+func NewGitLabOAuth(cfg config.Config) (*GitLabOAuth, error) {
+	if cfg.GitLabOAuthClientID == "" {
+		return nil, nil
+	}
+	if cfg.GitLabOAuthURL == "" || cfg.GitLabOAuthRedirectURL == "" {
+		return nil, errors.New("gitlab oauth requires GITLAB_OAUTH_URL (or GITLAB_BASE_URL) and GITLAB_OAUTH_REDIRECT_URL")
+	}
+	if !ValidRole(cfg.GitLabOAuthDefaultRole) {
+		return nil, fmt.Errorf("invalid GITLAB_OAUTH_DEFAULT_ROLE %q", cfg.GitLabOAuthDefaultRole)
+	}
+	base := strings.TrimRight(cfg.GitLabOAuthURL, "/")
+	// 仅登录时只需读取用户信息；以用户身份操作 GitLab 时还需要 api 权限
+	scopes := []string{"read_user"}
+	if cfg.GitLabOAuthUserToken {
+		scopes = append(scopes, "api")
+	}
+	return &GitLabOAuth{
+		conf: &oauth2.Config{
+			ClientID:     cfg.GitLabOAuthClientID,
+			ClientSecret: cfg.GitLabOAuthClientSecret,
+			RedirectURL:  cfg.GitLabOAuthRedirectURL,
+			Scopes:       scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:   base + "/oauth/authorize",
+				TokenURL:  base + "/oauth/token",
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+		},
+		apiURL:      base + "/api/v4",
+		defaultRole: cfg.GitLabOAuthDefaultRole,
+		userToken:   cfg.GitLabOAuthUserToken,
+		client:      newOAuthClient(cfg.GitLabOAuthInsecureTLS),
+	}, nil
+}
+
+// newOAuthClient 创建访问 GitLab 的 HTTP 客户端，insecure 为真时跳过证书校验
+func newOAuthClient(insecure bool) *http.Client {
+	if !insecure {
+		return &http.Client{Timeout: 15 * time.Second}
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	return &http.Client{Timeout: 15 * time.Second, Transport: tr}
+}
+
+// AuthCodeURL 返回跳转到 GitLab 授权页的地址
+func (o *GitLabOAuth) AuthCodeURL(state string) string { return o.conf.AuthCodeURL(state) }
+
+// UserToken 是否以用户自己的 GitLab 令牌执行写操作
+func (o *GitLabOAuth) UserToken() bool { return o.userToken }
+
+// context 绑定 OAuth 使用的 HTTP 客户端
+func (o *GitLabOAuth) context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, o.client)
+}
+
+// profile 以访问令牌查询 GitLab 当前用户
+func (o *GitLabOAuth) profile(ctx context.Context, tok *oauth2.Token) (*gitlabProfile, error) {
+	resp, err := o.conf.Client(o.context(ctx), tok).Get(o.apiURL + "/user")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gitlab user lookup failed: %s", resp.Status)
+	}
+	var p gitlabProfile
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		return nil, err
+	}
+	if p.ID == 0 || p.Username == "" {
+		return nil, errors.New("gitlab user lookup returned no user")
+	}
+	return &p, nil
+}
+
+// authorize 以授权码换取 GitLab 令牌并查询当前用户，GitLab 账号非正常状态时拒绝
+func (o *GitLabOAuth) authorize(ctx context.Context, code string) (*oauth2.Token, *gitlabProfile, error) {
+	if code == "" {
+		return nil, nil, errors.New("authorization code required")
+	}
+	tok, err := o.conf.Exchange(o.context(ctx), code)
+	if err != nil {
+		return nil, nil, fmt.Errorf("exchange authorization code: %w", err)
+	}
+	p, err := o.profile(ctx, tok)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.State != "" && p.State != "active" {
+		return nil, nil, ErrInvalidCredentials
+	}
+	return tok, p, nil
+}
+
+// LoginWithGitLab 以授权码换取 GitLab 令牌并登录
+// 按 GitLab 用户 ID 查找已关联的用户；未关联时以默认角色创建同名用户，已有同名本地用户时拒绝并要求先关联；
+// 开启用户令牌时加密保存其 GitLab 令牌。返回会话令牌明文与用户
+func (s *Service) LoginWithGitLab(ctx context.Context, o *GitLabOAuth, code string) (string, *model.User, error) {
+	tok, p, err := o.authorize(ctx, code)
+	if err != nil {
+		return "", nil, err
+	}
+	u, err := s.linkGitLabUser(p, o.defaultRole)
+	if err != nil {
+		return "", nil, err
+	}
+	if u.Disabled {
+		return "", nil, ErrInvalidCredentials
+	}
+	if o.userToken {
+		if err := s.saveCredential(u.ID, tok); err != nil {
+			return "", nil, err
+		}
+	}
+	expires := time.Now().Add(SessionTTL)
+	plain, _, err := s.issue(u.ID, model.TokenKindSession, "", &expires)
+	if err != nil {
+		return "", nil, err
+	}
+	_ = s.tokens.DeleteExpired(time.Now())
+	return plain, u, nil
+}
+
+// linkGitLabUser 将 GitLab 账号映射为本地用户，用户名与 GitLab 用户名一致
+func (s *Service) linkGitLabUser(p *gitlabProfile, role string) (*model.User, error) {
+	u, err := s.users.GetByGitLabID(p.ID)
+	if err == nil {
+		return u, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if !usernamePattern.MatchString(p.Username) {
+		return nil, fmt.Errorf("gitlab username %q is not a valid username", p.Username)
+	}
+	exist, err := s.users.GetByUsername(p.Username)
+	switch {
+	case err == nil:
+		// 从不自动认领同名本地用户：GitLab 用户名可被任何人注册或改名，须由本地用户登录后主动关联
+		if exist.GitLabID != 0 {
+			return nil, ErrAccountConflict
+		}
+		return nil, ErrLinkRequired
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		nu := &model.User{Username: p.Username, Role: role, GitLabID: p.ID}
+		if err := s.users.Create(nu); err != nil {
+			return nil, err
+		}
+		return nu, nil
+	default:
+		return nil, err
+	}
+}
+
+// LinkGitLab 将已登录的本地用户关联到授权码对应的 GitLab 账号
+// 该 GitLab 账号已关联其他用户，或本地用户已关联其他 GitLab 账号时拒绝；开启用户令牌时加密保存其 GitLab 令牌
+func (s *Service) LinkGitLab(ctx context.Context, o *GitLabOAuth, code string, userID uint64) (*model.User, error) {
+	tok, p, err := o.authorize(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.users.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Disabled {
+		return nil, ErrInvalidCredentials
+	}
+	if other, err := s.users.GetByGitLabID(p.ID); err == nil {
+		if other.ID != u.ID {
+			return nil, ErrAccountConflict
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if u.GitLabID != 0 && u.GitLabID != p.ID {
+		return nil, ErrAccountConflict
+	}
+	if u.GitLabID == 0 {
+		u.GitLabID = p.ID
+		if err := s.users.Update(u); err != nil {
+			return nil, err
+		}
+	}
+	if o.userToken {
+		if err := s.saveCredential(u.ID, tok); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// saveCredential 加密保存用户的 GitLab 令牌
+func (s *Service) saveCredential(userID uint64, tok *oauth2.Token) error {
+	access, err := secret.Encrypt(tok.AccessToken)
+	if err != nil {
+		return err
+	}
+	c := &model.GitLabCredential{UserID: userID, AccessToken: access}
+	if tok.RefreshToken != "" {
+		if c.RefreshToken, err = secret.Encrypt(tok.RefreshToken); err != nil {
+			return err
+		}
+	}
+	if !tok.Expiry.IsZero() {
+		exp := tok.Expiry
+		c.ExpiresAt = &exp
+	}
+	return s.credentials.Save(c)
+}
+
+// GitLabToken 返回用户保存的 GitLab 访问令牌，临近过期时先刷新；用户未关联 GitLab 时返回空
+func (s *Service) GitLabToken(ctx context.Context, o *GitLabOAuth, username string) (string, error) {
+	u, err := s.users.GetByUsername(username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	c, err := s.credentials.GetByUser(u.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	access, err := secret.Decrypt(c.AccessToken)
+	if err != nil {
+		return "", err
+	}
+	if c.ExpiresAt == nil || time.Now().Add(refreshLeeway).Before(*c.ExpiresAt) {
+		return access, nil
+	}
+	if c.RefreshToken == "" {
+		return "", errors.New("gitlab token expired, please log in with gitlab again")
+	}
+	refresh, err := secret.Decrypt(c.RefreshToken)
+	if err != nil {
+		return "", err
+	}
+	// 令牌源仅在过期时刷新，故把过期时间提前刷新余量
+	old := &oauth2.Token{AccessToken: access, RefreshToken: refresh, Expiry: c.ExpiresAt.Add(-refreshLeeway)}
+	tok, err := o.conf.TokenSource(o.context(ctx), old).Token()
+	if err != nil {
+		return "", fmt.Errorf("refresh gitlab token: %w", err)
+	}
+	if tok.RefreshToken == "" {
+		tok.RefreshToken = refresh
+	}
+	if err := s.saveCredential(u.ID, tok); err != nil {
+		return "", err
+	}
+	return tok.AccessToken, nil
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"webci-refactored/internal/config"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+)
+
+// fakeGitLab 本地替身身份提供方：签发授权码令牌、刷新令牌并返回当前用户
+func fakeGitLab(t *testing.T, users map[string]map[string]interface{}) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		var access string
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			access = r.Form.Get("code")
+		case "refresh_token":
+			access = r.Form.Get("refresh_token") + "-refreshed"
+		}
+		if _, ok := users[access]; !ok || r.Form.Get("client_id") != "app" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": access, "refresh_token": access, "token_type": "bearer", "expires_in": 7200})
+	})
+	mux.HandleFunc("/api/v4/user", func(w http.ResponseWriter, r *http.Request) {
+		u, ok := users[r.Header.Get("Authorization")[len("Bearer "):]]
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(u)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLoginWithGitLab(t *testing.T) {
+	alice := map[string]interface{}{"id": 42, "username": "alice", "state": "active"}
+	srv := fakeGitLab(t, map[string]map[string]interface{}{
+		"alice-code":           alice,
+		"alice-code-refreshed": alice,
+		"bob-code":             {"id": 7, "username": "bob", "state": "active"},
+		"eve-code":             {"id": 9, "username": "admin", "state": "active"},
+		"mallory-code":         {"id": 8, "username": "mallory", "state": "blocked"},
+	})
+	cfg := config.Config{GitLabOAuthClientID: "app", GitLabOAuthClientSecret: "s", GitLabOAuthURL: srv.URL,
+		GitLabOAuthRedirectURL: "http://ci/auth/gitlab/callback", GitLabOAuthDefaultRole: model.RoleDeveloper, GitLabOAuthUserToken: true}
+	o, err := NewGitLabOAuth(cfg)
+	if err != nil || o == nil {
+		t.Fatalf("oauth config: %v", err)
+	}
+	if off, _ := NewGitLabOAuth(config.Config{}); off != nil {
+		t.Fatal("oauth must be disabled without a client id")
+	}
+	db := openTestDB(t)
+	s := NewService(db)
+	ctx := context.Background()
+
+	// 首次登录创建同名用户并可用会话令牌认证
+	session, u, err := s.LoginWithGitLab(ctx, o, "alice-code")
+	if err != nil || u.Username != "alice" || u.GitLabID != 42 || u.Role != model.RoleDeveloper {
+		t.Fatalf("first login: %+v %v", u, err)
+	}
+	if who, err := s.Authenticate(session); err != nil || who.ID != u.ID {
+		t.Fatalf("session should authenticate alice: %v", err)
+	}
+	// 再次登录复用同一用户
+	if _, again, err := s.LoginWithGitLab(ctx, o, "alice-code"); err != nil || again.ID != u.ID {
+		t.Fatalf("relogin should map to the same user: %v", err)
+	}
+	// 同名本地用户不会被自动认领，须由本地用户登录后主动关联
+	local, err := s.CreateUser("bob", "bobpassword", model.RoleMaintainer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.LoginWithGitLab(ctx, o, "bob-code"); !errors.Is(err, ErrLinkRequired) {
+		t.Fatalf("local bob must not be claimed by login: %v", err)
+	}
+	if got, _ := s.users.Get(local.ID); got.GitLabID != 0 {
+		t.Fatalf("local bob must stay unlinked: %+v", got)
+	}
+	if err := s.CheckPassword(local.ID, "wrongpassword"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong password must be refused: %v", err)
+	}
+	if err := s.CheckPassword(local.ID, "bobpassword"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.LinkGitLab(ctx, o, "alice-code", local.ID); !errors.Is(err, ErrAccountConflict) {
+		t.Fatalf("gitlab account linked to alice must not be linked again: %v", err)
+	}
+	if bob, err := s.LinkGitLab(ctx, o, "bob-code", local.ID); err != nil || bob.GitLabID != 7 {
+		t.Fatalf("local bob should be linked explicitly: %+v %v", bob, err)
+	}
+	if _, bob, err := s.LoginWithGitLab(ctx, o, "bob-code"); err != nil || bob.ID != local.ID || bob.Role != model.RoleMaintainer {
+		t.Fatalf("linked bob should log in: %+v %v", bob, err)
+	}
+	// 未关联的管理员同样不能被同名 GitLab 账号接管，已关联其他 GitLab 账号时拒绝
+	if _, err := s.CreateUser("admin", "adminpassword", model.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.LoginWithGitLab(ctx, o, "eve-code"); !errors.Is(err, ErrLinkRequired) {
+		t.Fatalf("unlinked admin must not be taken over: %v", err)
+	}
+	admin, _ := s.users.GetByUsername("admin")
+	admin.GitLabID = 1
+	_ = s.users.Update(admin)
+	if _, _, err := s.LoginWithGitLab(ctx, o, "eve-code"); !errors.Is(err, ErrAccountConflict) {
+		t.Fatalf("linked username must not be taken over: %v", err)
+	}
+	if _, err := s.LinkGitLab(ctx, o, "eve-code", admin.ID); !errors.Is(err, ErrAccountConflict) {
+		t.Fatalf("user linked to another gitlab account must be refused: %v", err)
+	}
+	if _, _, err := s.LoginWithGitLab(ctx, o, "mallory-code"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("blocked gitlab user must be refused: %v", err)
+	}
+	if _, _, err := s.LoginWithGitLab(ctx, o, "bad-code"); err == nil {
+		t.Fatal("invalid code must fail")
+	}
+	disabled := true
+	if _, err := s.UpdateUser(u.ID, UserUpdate{Disabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.LoginWithGitLab(ctx, o, "alice-code"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("disabled user must be refused: %v", err)
+	}
+
+	// 用户令牌加密保存，过期前直接返回，临近过期时刷新
+	if tok, err := s.GitLabToken(ctx, o, "bob"); err != nil || tok != "bob-code" {
+		t.Fatalf("bob token: %q %v", tok, err)
+	}
+	creds := repository.NewCredentialRepository(db)
+	c, _ := creds.GetByUser(u.ID)
+	if c == nil || c.AccessToken == "alice-code" || c.AccessToken == "" {
+		t.Fatalf("token must be stored encrypted: %+v", c)
+	}
+	past := time.Now().Add(-time.Minute)
+	c.ExpiresAt = &past
+	_ = creds.Save(c)
+	if tok, err := s.GitLabToken(ctx, o, "alice"); err != nil || tok != "alice-code-refreshed" {
+		t.Fatalf("expired token should be refreshed: %q %v", tok, err)
+	}
+	if c, _ := creds.GetByUser(u.ID); c.ExpiresAt == nil || !c.ExpiresAt.After(time.Now()) {
+		t.Fatal("refreshed token should be saved")
+	}
+	if tok, err := s.GitLabToken(ctx, o, "admin"); err != nil || tok != "" {
+		t.Fatalf("unlinked user has no gitlab token: %q %v", tok, err)
+	}
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+	"webci-refactored/internal/dal/model"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	// SessionTTL 登录会话有效期
+	SessionTTL = 24 * time.Hour
+	// tokenPrefix 令牌明文前缀，便于在日志与密钥扫描中识别
+	tokenPrefix = "wci_"
+	// touchInterval 最近使用时间的最小更新间隔，避免每个请求都写库
+	touchInterval = time.Minute
+)
+
+// Login 校验用户名与密码，成功后创建登录会话，返回会话令牌明文与用户
+func (s *Service) Login(username, password string) (string, *model.User, error) {
+	u, err := s.users.GetByUsername(username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if u.Disabled || bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		return "", nil, ErrInvalidCredentials
+	}
+	expires := time.Now().Add(SessionTTL)
+	plain, _, err := s.issue(u.ID, model.TokenKindSession, "", &expires)
+	if err != nil {
+		return "", nil, err
+	}
+	// 顺带清理已过期的令牌
+	_ = s.tokens.DeleteExpired(time.Now())
+	return plain, u, nil
+}
+
+// ChangePassword 校验旧密码后修改用户自己的密码，并吊销其全部登录会话
+func (s *Service) ChangePassword(userID uint64, oldPassword, newPassword string) error {
+	u, err := s.users.Get(userID)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(oldPassword)) != nil {
+		return ErrInvalidCredentials
+	}
+	_, err = s.UpdateUser(userID, UserUpdate{Password: &newPassword})
+	return err
+}
+
+// CheckPassword 校验用户的本地密码，不一致或用户已禁用时返回 ErrInvalidCredentials
+func (s *Service) CheckPassword(userID uint64, password string) error {
+	u, err := s.users.Get(userID)
+	if err != nil {
+		return err
+	}
+	if u.Disabled || bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// Logout 吊销登录会话或令牌
+func (s *Service) Logout(plain string) error { return s.tokens.DeleteByHash(hashToken(plain)) }
+
+// CreateToken 为用户创建个人 API 令牌，明文仅在创建时返回一次
+func (s *Service) CreateToken(userID uint64, name string, expiresAt *time.Time) (string, *model.APIToken, error) {
+	if name == "" {
+		return "", nil, errors.New("token name required")
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, errors.New("expires_at must be in the future")
+	}
+	return s.issue(userID, model.TokenKindPersonal, name, expiresAt)
+}
+
+// ListTokens 查询用户的个人 API 令牌
+func (s *Service) ListTokens(userID uint64) ([]model.APIToken, error) {
+	return s.tokens.ListByUser(userID, model.TokenKindPersonal)
+}
+
+// RevokeToken 吊销用户的令牌，返回是否存在
+func (s *Service) RevokeToken(userID, id uint64) (bool, error) { return s.tokens.Delete(userID, id) }
+
+// Authenticate 校验令牌明文，返回令牌所属的用户
+// 令牌不存在、已过期或用户已禁用时返回 ErrInvalidToken
+func (s *Service) Authenticate(plain string) (*model.User, error) {
+	if plain == "" {
+		return nil, ErrInvalidToken
+	}
+	t, err := s.tokens.GetByHash(hashToken(plain))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if t.ExpiresAt != nil && !now.Before(*t.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	u, err := s.users.Get(t.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.Disabled {
+		return nil, ErrInvalidToken
+	}
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) >= touchInterval {
+		_ = s.tokens.Touch(t.ID, now)
+	}
+	return u, nil
+}
+
+// issue 生成随机令牌并保存其哈希，返回令牌明文与记录
+func (s *Service) issue(userID uint64, kind, name string, expiresAt *time.Time) (string, *model.APIToken, error) {
+	r, err := randomHex(20)
+	if err != nil {
+		return "", nil, err
+	}
+	plain := tokenPrefix + r
+	t := &model.APIToken{UserID: userID, Kind: kind, Name: name, TokenHash: hashToken(plain), Prefix: plain[:len(tokenPrefix)+4], ExpiresAt: expiresAt}
+	if err := s.tokens.Create(t); err != nil {
+		return "", nil, err
+	}
+	return plain, t, nil
+}
+
+// hashToken 计算令牌明文的 SHA-256 哈希
+func hashToken(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,12 +1,16 @@
 package branch
 
 import (
+	"errors"
+	"fmt"
 	"time"
 	"webci-refactored/internal/dal/model"
 	"webci-refactored/internal/dal/repository"
+	"webci-refactored/internal/pipeline"
 
 	git "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"gorm.io/gorm"
 )
 
@@ -53,3 +57,41 @@ func (s *Service) RefreshBranch(b *model.Branch) error {
 	b.UpdatedAt = time.Now()
 	return s.branches.Update(b)
 }
+
+// ErrNoPipelineFile 分支提交中不存在流水线定义文件
+var ErrNoPipelineFile = errors.New("pipeline file not found")
+
+// ReadPipelineFile 读取分支 ref 当前指向提交中的流水线定义文件
+// 返回文件内容与提交哈希；未配置仓库路径或仓库中没有该分支时返回 ErrNoPipelineFile（演示模式）
+func (s *Service) ReadPipelineFile(b *model.Branch) ([]byte, string, error) {
+	if s.repoPath == "" {
+		return nil, "", ErrNoPipelineFile
+	}
+	r, err := git.PlainOpen(s.repoPath)
+	if err != nil {
+		return nil, "", err
+	}
+	ref, err := r.Reference(plumbing.NewBranchReferenceName(b.Name), true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, "", fmt.Errorf("%w: branch %s does not exist in the repository", ErrNoPipelineFile, b.Name)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	commitObj, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := commitObj.File(pipeline.FileName)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, ref.Hash().String(), ErrNoPipelineFile
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return nil, "", err
+	}
+	return []byte(content), ref.Hash().String(), nil
+}
@@ -6,6 +6,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// statuses 参与汇总的任务状态：全部状态，各状态数量之和等于总数
+var statuses = model.JobStatuses
+
 // Service 仪表盘服务
 // 提供汇总统计与分支/环境维度统计
 type Service struct{ db *gorm.DB }
@@ -17,7 +20,6 @@ func NewService(db *gorm.DB) *Service { return &Service{db: db} }
 func (s *Service) Overview() (map[string]int64, error) {
 	// 统计各状态数量，并附加总数
 	res := map[string]int64{}
-	statuses := []string{"pending", "running", "success", "failed"}
 	for _, st := range statuses {
 		var c int64
 		if err := s.db.Model(&model.Job{}).Where("status = ?", st).Count(&c).Error; err != nil {
@@ -37,7 +39,6 @@ func (s *Service) Overview() (map[string]int64, error) {
 func (s *Service) BranchStats(branchID uint64) (map[string]int64, error) {
 	// 指定分支 ID 的状态分布
 	res := map[string]int64{}
-	statuses := []string{"pending", "running", "success", "failed"}
 	for _, st := range statuses {
 		var c int64
 		if err := s.db.Model(&model.Job{}).Where("branch_id = ? AND status = ?", branchID, st).Count(&c).Error; err != nil {
@@ -57,7 +58,6 @@ func (s *Service) BranchStats(branchID uint64) (map[string]int64, error) {
 func (s *Service) EnvironmentStats(envID uint64) (map[string]int64, error) {
 	// 指定环境 ID 的状态分布
 	res := map[string]int64{}
-	statuses := []string{"pending", "running", "success", "failed"}
 	for _, st := range statuses {
 		var c int64
 		if err := s.db.Model(&model.Job{}).Where("env_id = ? AND status = ?", envID, st).Count(&c).Error; err != nil {
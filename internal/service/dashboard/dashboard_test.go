@@ -0,0 +1,42 @@
+package dashboard
+
+import (
+	"testing"
+	"webci-refactored/internal/dal"
+	"webci-refactored/internal/dal/model"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestStatsCoverEveryStatus(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range model.JobStatuses {
+		if err := db.Create(&model.Job{BranchID: 1, EnvID: 1, Kind: model.JobKindJob, Status: st, TriggerUser: "alice"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewService(db)
+	overview, _ := s.Overview()
+	branch, _ := s.BranchStats(1)
+	env, _ := s.EnvironmentStats(1)
+	for name, res := range map[string]map[string]int64{"overview": overview, "branch": branch, "environment": env} {
+		var sum int64
+		for _, st := range model.JobStatuses {
+			if res[st] != 1 {
+				t.Errorf("%s: expected one %s job, got %d", name, st, res[st])
+			}
+			sum += res[st]
+		}
+		if sum != res["total"] || sum != int64(len(model.JobStatuses)) {
+			t.Errorf("%s: status counts sum to %d, total is %d", name, sum, res["total"])
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// 变更计算错误
+var (
+	// ErrNoRepository 未配置本地仓库路径
+	ErrNoRepository = errors.New("repository path not configured")
+	// ErrNoCommit 部署记录没有提交信息（如演示模式下的任务）
+	ErrNoCommit = errors.New("deployment has no commit")
+	// ErrNoRef 未指定比较目标且环境尚无成功部署
+	ErrNoRef = errors.New("ref required: environment has no successful deployment")
+	// ErrUnknownRevision 仓库中不存在指定的分支、标签或提交
+	ErrUnknownRevision = errors.New("unknown revision")
+)
+
+// maxChangeCommits 单次变更列出的最大提交数，超出时标记 truncated
+const maxChangeCommits = 200
+
+// Commit 变更中的提交摘要
+type Commit struct {
+	Hash       string    `json:"hash"`
+	Title      string    `json:"title"`
+	Author     string    `json:"author"`
+	AuthoredAt time.Time `json:"authored_at"`
+}
+
+// FileChange 单个文件的增删行数
+type FileChange struct {
+	Path      string `json:"path"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+// Changes 两个提交之间的变更：from 为空表示没有可比较的历史部署
+type Changes struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Commits 自 from 以来的提交，最新的在前；from 不是 to 的祖先（如回滚或换分支）时以二者的合并基点为界
+	Commits   []Commit `json:"commits"`
+	Truncated bool     `json:"truncated"`
+	// Files 两个提交的文件树差异统计，from 为空时不计算
+	Files     []FileChange `json:"files"`
+	Additions int          `json:"additions"`
+	Deletions int          `json:"deletions"`
+}
+
+// diff 基于 go-git 计算 from..to 的提交区间与文件差异
+func (s *Service) diff(from, to string) (*Changes, error) {
+	if s.repoPath == "" {
+		return nil, ErrNoRepository
+	}
+	r, err := git.PlainOpen(s.repoPath)
+	if err != nil {
+		return nil, err
+	}
+	toCommit, err := resolveCommit(r, to)
+	if err != nil {
+		return nil, err
+	}
+	c := &Changes{To: toCommit.Hash.String(), Commits: []Commit{}, Files: []FileChange{}}
+	var ignore []plumbing.Hash
+	var fromCommit *object.Commit
+	if from != "" {
+		if fromCommit, err = resolveCommit(r, from); err != nil {
+			return nil, err
+		}
+		c.From = fromCommit.Hash.String()
+		bases, err := fromCommit.MergeBase(toCommit)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range bases {
+			ignore = append(ignore, b.Hash)
+		}
+	}
+
+	// 自 to 向前遍历，到达合并基点即停止该路径
+	iter := object.NewCommitPreorderIter(toCommit, nil, ignore)
+	defer iter.Close()
+	err = iter.ForEach(func(cm *object.Commit) error {
+		if len(c.Commits) == maxChangeCommits {
+			c.Truncated = true
+			return storer.ErrStop
+		}
+		title, _, _ := strings.Cut(strings.TrimSpace(cm.Message), "\n")
+		c.Commits = append(c.Commits, Commit{Hash: cm.Hash.String(), Title: title, Author: cm.Author.Name, AuthoredAt: cm.Author.When})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if fromCommit != nil && fromCommit.Hash != toCommit.Hash {
+		patch, err := fromCommit.Patch(toCommit)
+		if err != nil {
+			return nil, err
+		}
+		for _, st := range patch.Stats() {
+			c.Files = append(c.Files, FileChange{Path: st.Name, Additions: st.Addition, Deletions: st.Deletion})
+			c.Additions += st.Addition
+			c.Deletions += st.Deletion
+		}
+	}
+	return c, nil
+}
+
+// resolveCommit 将分支名、标签或提交哈希解析为提交对象
+func resolveCommit(r *git.Repository, rev string) (*object.Commit, error) {
+	h, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRevision, rev)
+	}
+	return r.CommitObject(*h)
+}
@@ -0,0 +1,145 @@
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+
+	"gorm.io/gorm"
+)
+
+// 回滚错误
+var (
+	// ErrDeployRunning 环境中已有排队或执行中的部署
+	ErrDeployRunning = errors.New("deploy already running")
+	// ErrNoRollbackTarget 没有可回滚到的历史成功部署
+	ErrNoRollbackTarget = errors.New("no previous successful deployment to roll back to")
+	// ErrNotRollbackable 指定的部署不是成功部署
+	ErrNotRollbackable = errors.New("deployment is not rollbackable")
+)
+
+// Service 部署服务
+// 记录环境的部署历史，并基于本地仓库计算两次部署之间的变更
+type Service struct {
+	repoPath string
+	deploys  *repository.DeploymentRepository
+	branches *repository.BranchRepository
+}
+
+// NewService 创建部署服务；repoPath 为空时无法计算变更（演示模式）
+func NewService(db *gorm.DB, repoPath string) *Service {
+	return &Service{
+		repoPath: repoPath,
+		deploys:  repository.NewDeploymentRepository(db),
+		branches: repository.NewBranchRepository(db),
+	}
+}
+
+func (s *Service) SetRepoPath(path string) { s.repoPath = path }
+
+// IsDeployment 判断任务是否构成一次部署：绑定环境的顶层任务（独立任务或流水线父任务）
+func IsDeployment(j *model.Job) bool { return j.EnvID > 0 && j.PipelineID == 0 }
+
+// Record 记录任务以 status 结束的部署
+func (s *Service) Record(j *model.Job, status string) error {
+	d := &model.Deployment{
+		EnvID:       j.EnvID,
+		JobID:       j.ID,
+		BranchID:    j.BranchID,
+		CommitID:    j.CommitID,
+		RollbackOf:  j.RollbackOf,
+		TriggerUser: j.TriggerUser,
+		Status:      status,
+		StartedAt:   j.StartTime,
+		FinishedAt:  time.Now(),
+	}
+	if b, err := s.branches.Get(j.BranchID); err == nil {
+		d.BranchName = b.Name
+	}
+	return s.deploys.Record(d)
+}
+
+// List 分页查询环境的部署历史，最新的在前；status 非空时按部署结果过滤
+func (s *Service) List(envID uint64, status string, limit, offset int) ([]model.Deployment, int64, error) {
+	return s.deploys.ListByEnv(envID, status, limit, offset)
+}
+
+// RollbackTarget 确定回滚目标部署
+// id 为 0 时选择当前版本之前最近一次提交不同的成功部署；环境中已有排队或执行中的部署时返回 ErrDeployRunning
+func (s *Service) RollbackTarget(envID, id uint64) (*model.Deployment, error) {
+	active, err := s.deploys.Active(envID)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil {
+		return nil, fmt.Errorf("%w: job %d is %s", ErrDeployRunning, active.ID, active.Status)
+	}
+	if id > 0 {
+		d, err := s.deploys.Get(envID, id)
+		if err != nil {
+			return nil, err
+		}
+		if d.Status != model.JobStatusSuccess {
+			return nil, fmt.Errorf("%w: deployment %d finished with %s", ErrNotRollbackable, d.ID, d.Status)
+		}
+		return d, nil
+	}
+	current, err := s.deploys.LastSuccessful(envID, 0)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, ErrNoRollbackTarget
+	}
+	d, err := s.deploys.LastSuccessfulExcept(envID, current.CommitID)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, ErrNoRollbackTarget
+	}
+	return d, nil
+}
+
+// Changes 计算部署相对于其之前最近一次成功部署的变更
+// 此前没有成功部署时列出该提交之前的历史（受条数上限约束）
+func (s *Service) Changes(envID, id uint64) (*Changes, error) {
+	d, err := s.deploys.Get(envID, id)
+	if err != nil {
+		return nil, err
+	}
+	if d.CommitID == "" {
+		return nil, ErrNoCommit
+	}
+	prev, err := s.deploys.LastSuccessful(envID, d.ID)
+	if err != nil {
+		return nil, err
+	}
+	from := ""
+	if prev != nil {
+		from = prev.CommitID
+	}
+	return s.diff(from, d.CommitID)
+}
+
+// Pending 计算 ref（分支名、标签或提交哈希）相对于环境当前部署版本的变更，即"上次部署以来改了什么"
+// ref 为空时使用最近一次成功部署的分支
+func (s *Service) Pending(envID uint64, ref string) (*Changes, error) {
+	last, err := s.deploys.LastSuccessful(envID, 0)
+	if err != nil {
+		return nil, err
+	}
+	from := ""
+	if last != nil {
+		from = last.CommitID
+		if ref == "" {
+			ref = last.BranchName
+		}
+	}
+	if ref == "" {
+		return nil, ErrNoRef
+	}
+	return s.diff(from, ref)
+}
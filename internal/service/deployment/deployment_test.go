@@ -0,0 +1,140 @@
+package deployment
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"webci-refactored/internal/dal"
+	"webci-refactored/internal/dal/model"
+
+	"github.com/glebarez/sqlite"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// commitFile 在测试仓库中写入文件并提交，返回提交哈希
+func commitFile(t *testing.T, w *git.Worktree, root, name, content, msg string) string {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add(name); err != nil {
+		t.Fatal(err)
+	}
+	h, err := w.Commit(msg, &git.CommitOptions{Author: &object.Signature{Name: "alice", When: time.Now()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h.String()
+}
+
+// openTestDB 为每个测试创建独立的内存 SQLite 并完成迁移
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestRecordAndChangesSinceLastDeploy(t *testing.T) {
+	db := openTestDB(t)
+	root := t.TempDir()
+	r, err := git.PlainInit(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, _ := r.Worktree()
+	c1 := commitFile(t, w, root, "app.txt", "v1\n", "initial")
+	c2 := commitFile(t, w, root, "app.txt", "v2\nmore\n", "second")
+	c3 := commitFile(t, w, root, "notes.txt", "hi\n", "third\n\nbody")
+
+	env := &model.Environment{Name: "prod"}
+	db.Create(env)
+	svc := NewService(db, root)
+	for i, d := range []struct {
+		commit, status string
+	}{{c1, model.JobStatusSuccess}, {c2, model.JobStatusFailed}, {c3, model.JobStatusSuccess}} {
+		j := &model.Job{ID: uint64(i + 1), EnvID: env.ID, CommitID: d.commit, TriggerUser: "bob"}
+		if err := svc.Record(j, d.status); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 同一任务重复记录被忽略
+	if err := svc.Record(&model.Job{ID: 3, EnvID: env.ID, CommitID: c3}, model.JobStatusSuccess); err != nil {
+		t.Fatal(err)
+	}
+	items, total, err := svc.List(env.ID, "", 10, 0)
+	if err != nil || total != 3 || items[0].CommitID != c3 || items[1].Status != model.JobStatusFailed {
+		t.Fatalf("unexpected history: %d %+v %v", total, items, err)
+	}
+	var e model.Environment
+	db.First(&e, env.ID)
+	if e.CurrentDeployCommit != c3 {
+		t.Fatalf("current deploy = %s, want %s", e.CurrentDeployCommit, c3)
+	}
+
+	// 第三次部署相对于上一次成功部署（跳过失败的第二次）
+	ch, err := svc.Changes(env.ID, items[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.From != c1 || ch.To != c3 || len(ch.Commits) != 2 || ch.Commits[0].Title != "third" || ch.Commits[1].Hash != c2 {
+		t.Fatalf("unexpected changes: %+v", ch)
+	}
+	if len(ch.Files) != 2 || ch.Additions != 3 || ch.Deletions != 1 {
+		t.Fatalf("unexpected file stats: %+v", ch.Files)
+	}
+	// 首次部署没有可比较的历史，列出全部提交
+	if ch, err := svc.Changes(env.ID, items[2].ID); err != nil || ch.From != "" || len(ch.Commits) != 1 {
+		t.Fatalf("first deployment changes: %+v %v", ch, err)
+	}
+
+	c4 := commitFile(t, w, root, "app.txt", "v3\n", "fourth")
+	head, _ := r.Head()
+	ch, err = svc.Pending(env.ID, head.Name().Short())
+	if err != nil || ch.From != c3 || ch.To != c4 || len(ch.Commits) != 1 {
+		t.Fatalf("pending changes: %+v %v", ch, err)
+	}
+	if _, err := svc.Pending(env.ID, "no-such-branch"); err == nil {
+		t.Fatal("expected unknown revision error")
+	}
+}
+
+func TestRollbackTarget(t *testing.T) {
+	db := openTestDB(t)
+	env := &model.Environment{Name: "prod"}
+	db.Create(env)
+	svc := NewService(db, "")
+	if _, err := svc.RollbackTarget(env.ID, 0); !errors.Is(err, ErrNoRollbackTarget) {
+		t.Fatalf("expected ErrNoRollbackTarget, got %v", err)
+	}
+	for i, d := range []struct {
+		commit, status string
+	}{{"aaa", model.JobStatusSuccess}, {"bbb", model.JobStatusSuccess}, {"ccc", model.JobStatusFailed}, {"bbb", model.JobStatusSuccess}} {
+		if err := svc.Record(&model.Job{ID: uint64(i + 1), EnvID: env.ID, CommitID: d.commit}, d.status); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 当前版本为 bbb：回滚到上一个不同提交的成功部署
+	d, err := svc.RollbackTarget(env.ID, 0)
+	if err != nil || d.CommitID != "aaa" {
+		t.Fatalf("default target: %+v %v", d, err)
+	}
+	if _, err := svc.RollbackTarget(env.ID, 3); !errors.Is(err, ErrNotRollbackable) {
+		t.Fatalf("failed deployment must not be a target, got %v", err)
+	}
+	// 有排队中的部署时拒绝回滚
+	db.Create(&model.Job{Kind: model.JobKindJob, EnvID: env.ID, Status: model.JobStatusPending})
+	if _, err := svc.RollbackTarget(env.ID, 1); !errors.Is(err, ErrDeployRunning) {
+		t.Fatalf("expected ErrDeployRunning, got %v", err)
+	}
+}
@@ -11,13 +11,15 @@ import (
 // Service 环境服务
 // 提供环境的校验与业务封装
 type Service struct {
-	db   *gorm.DB
-	envs *repository.EnvironmentRepository
+	db      *gorm.DB
+	envs    *repository.EnvironmentRepository
+	freezes *repository.FreezeRepository
+	users   *repository.UserRepository
 }
 
 // NewService 创建环境服务
 func NewService(db *gorm.DB) *Service {
-	return &Service{db: db, envs: repository.NewEnvironmentRepository(db)}
+	return &Service{db: db, envs: repository.NewEnvironmentRepository(db), freezes: repository.NewFreezeRepository(db), users: repository.NewUserRepository(db)}
 }
 
 // Create 创建环境，校验名称非空与唯一
@@ -0,0 +1,202 @@
+package environment
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"webci-refactored/internal/cron"
+	"webci-refactored/internal/dal/model"
+)
+
+// cronLookahead 计算 cron 冻结窗口结束时间时最多向后查找的时长
+const cronLookahead = 31 * 24 * time.Hour
+
+// isAdmin 判断用户是否为未禁用的管理员，只有管理员可以覆盖冻结窗口
+func (s *Service) isAdmin(username string) bool {
+	u, err := s.users.GetByUsername(username)
+	return err == nil && !u.Disabled && u.Role == model.RoleAdmin
+}
+
+// Override 管理员对冻结窗口的覆盖：覆盖人与原因
+type Override struct {
+	By     string
+	Reason string
+}
+
+// ActiveFreeze 生效中的冻结窗口
+type ActiveFreeze struct {
+	FreezeID uint64    `json:"freeze_id"`
+	EnvID    uint64    `json:"env_id"`
+	EnvName  string    `json:"env_name"`
+	Reason   string    `json:"reason"`
+	Cron     string    `json:"cron,omitempty"`
+	Timezone string    `json:"timezone,omitempty"`
+	Until    time.Time `json:"until"`
+}
+
+// FreezeInput 创建冻结窗口的参数：cron 与 starts_at/ends_at 二选一
+// 时间支持 RFC3339、"2006-01-02 15:04" 与 "2006-01-02"，不带时区的按 timezone 解析；
+// 仅写日期的 ends_at 表示包含当天（冻结到次日零点）
+type FreezeInput struct {
+	Cron     string
+	Timezone string
+	StartsAt string
+	EndsAt   string
+	Reason   string
+}
+
+// localLayouts 不带时区的时间写法
+var localLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+// parseFreezeTime 解析冻结窗口时间，返回时间与是否仅为日期
+func parseFreezeTime(s string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, false, nil
+	}
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, false, nil
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("invalid time %q", s)
+}
+
+// loadLocation 加载时区，空值表示 UTC
+func loadLocation(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", tz)
+	}
+	return loc, nil
+}
+
+// CreateFreeze 为环境创建冻结窗口
+func (s *Service) CreateFreeze(envID uint64, in FreezeInput) (*model.FreezeWindow, error) {
+	loc, err := loadLocation(in.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	f := &model.FreezeWindow{EnvID: envID, Timezone: in.Timezone, Reason: in.Reason}
+	switch {
+	case in.Cron != "" && (in.StartsAt != "" || in.EndsAt != ""):
+		return nil, errors.New("cron and starts_at/ends_at are mutually exclusive")
+	case in.Cron != "":
+		if _, err := cron.Parse(in.Cron); err != nil {
+			return nil, err
+		}
+		f.Cron = in.Cron
+	case in.StartsAt != "" && in.EndsAt != "":
+		start, _, err := parseFreezeTime(in.StartsAt, loc)
+		if err != nil {
+			return nil, err
+		}
+		end, dateOnly, err := parseFreezeTime(in.EndsAt, loc)
+		if err != nil {
+			return nil, err
+		}
+		if dateOnly {
+			end = end.AddDate(0, 0, 1)
+		}
+		if !end.After(start) {
+			return nil, errors.New("ends_at must be after starts_at")
+		}
+		start, end = start.UTC(), end.UTC()
+		f.StartsAt, f.EndsAt = &start, &end
+	default:
+		return nil, errors.New("cron or starts_at and ends_at required")
+	}
+	if err := s.freezes.Create(f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ListFreezes 查询环境的冻结窗口
+func (s *Service) ListFreezes(envID uint64) ([]model.FreezeWindow, error) {
+	return s.freezes.ListByEnv(envID)
+}
+
+// DeleteFreeze 删除冻结窗口，返回是否存在
+func (s *Service) DeleteFreeze(envID, id uint64) (bool, error) {
+	return s.freezes.Delete(envID, id)
+}
+
+// ActiveFreezes 查询 at 时刻全部环境中生效的冻结窗口
+func (s *Service) ActiveFreezes(at time.Time) ([]ActiveFreeze, error) {
+	items, err := s.freezes.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	out := []ActiveFreeze{}
+	names := map[uint64]string{}
+	for i := range items {
+		until, ok := freezeActive(&items[i], at)
+		if !ok {
+			continue
+		}
+		f := &items[i]
+		name, seen := names[f.EnvID]
+		if !seen {
+			// 环境已删除的冻结窗口不再展示
+			e, err := s.envs.Get(f.EnvID)
+			if err != nil {
+				names[f.EnvID] = ""
+				continue
+			}
+			name, names[f.EnvID] = e.Name, e.Name
+		}
+		if name == "" {
+			continue
+		}
+		out = append(out, ActiveFreeze{FreezeID: f.ID, EnvID: f.EnvID, EnvName: name, Reason: f.Reason, Cron: f.Cron, Timezone: f.Timezone, Until: until})
+	}
+	return out, nil
+}
+
+// activeFreeze 查询环境在 at 时刻生效的冻结窗口，多个窗口同时生效时取结束最晚的一个；不存在时返回 nil
+func (s *Service) activeFreeze(e *model.Environment, at time.Time) (*ActiveFreeze, error) {
+	items, err := s.freezes.ListByEnv(e.ID)
+	if err != nil {
+		return nil, err
+	}
+	var active *ActiveFreeze
+	for i := range items {
+		f := &items[i]
+		until, ok := freezeActive(f, at)
+		if !ok || (active != nil && !until.After(active.Until)) {
+			continue
+		}
+		active = &ActiveFreeze{FreezeID: f.ID, EnvID: e.ID, EnvName: e.Name, Reason: f.Reason, Cron: f.Cron, Timezone: f.Timezone, Until: until}
+	}
+	return active, nil
+}
+
+// freezeActive 判断冻结窗口在 at 时刻是否生效，并返回本次冻结的结束时间
+// cron 窗口按其时区求值；表达式或时区无效（如时区数据库变化）的窗口视为不生效
+func freezeActive(f *model.FreezeWindow, at time.Time) (time.Time, bool) {
+	if f.Cron == "" {
+		if f.StartsAt == nil || f.EndsAt == nil || at.Before(*f.StartsAt) || !at.Before(*f.EndsAt) {
+			return time.Time{}, false
+		}
+		return *f.EndsAt, true
+	}
+	sched, err := cron.Parse(f.Cron)
+	if err != nil {
+		return time.Time{}, false
+	}
+	loc, err := loadLocation(f.Timezone)
+	if err != nil {
+		return time.Time{}, false
+	}
+	local := at.In(loc)
+	if !sched.Match(local) {
+		return time.Time{}, false
+	}
+	return sched.ActiveUntil(local, cronLookahead), true
+}
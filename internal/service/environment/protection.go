@@ -0,0 +1,73 @@
+package environment
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/pipeline"
+)
+
+// ErrDeployBlocked 环境保护规则禁止本次部署（分支不在允许范围内或处于冻结窗口）
+var ErrDeployBlocked = errors.New("deploy not allowed")
+
+// ValidateProtection 校验环境保护规则：分支模式可解析，审批人数不为负且不超过审批人名单
+func ValidateProtection(e *model.Environment) error {
+	for _, pat := range e.DeployBranches {
+		if _, err := pipeline.MatchBranch(pat, ""); err != nil {
+			return fmt.Errorf("invalid deploy branch pattern %q: %v", pat, err)
+		}
+	}
+	if e.RequiredApprovals < 0 {
+		return errors.New("required_approvals must not be negative")
+	}
+	if len(e.Approvers) > 0 && e.RequiredApprovals > len(e.Approvers) {
+		return errors.New("required_approvals exceeds number of approvers")
+	}
+	return nil
+}
+
+// Admission 部署准入结果
+type Admission struct {
+	// NeedsApproval 环境要求审批，任务须等待审批后放行
+	NeedsApproval bool
+	// Overridden 被管理员覆盖的冻结窗口，未覆盖时为 nil
+	Overridden *ActiveFreeze
+}
+
+// CheckDeploy 按环境保护规则校验分支 branch 在 at 时刻向环境部署
+// 分支不匹配允许的模式，或处于冻结窗口且未由管理员附原因覆盖时返回 ErrDeployBlocked；envID 为 0 表示不部署到环境
+func (s *Service) CheckDeploy(envID uint64, branch string, at time.Time, override *Override) (*Admission, error) {
+	if envID == 0 {
+		return &Admission{}, nil
+	}
+	e, err := s.envs.Get(envID)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.DeployBranches) > 0 {
+		allowed := false
+		for _, pat := range e.DeployBranches {
+			if ok, _ := pipeline.MatchBranch(pat, branch); ok {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, fmt.Errorf("%w: branch %s may not deploy to %s", ErrDeployBlocked, branch, e.Name)
+		}
+	}
+	a := &Admission{NeedsApproval: e.RequiredApprovals > 0}
+	f, err := s.activeFreeze(e, at)
+	if err != nil || f == nil {
+		return a, err
+	}
+	if override == nil || override.Reason == "" {
+		return nil, fmt.Errorf("%w: %s is frozen until %s (%s)", ErrDeployBlocked, e.Name, f.Until.Format(time.RFC3339), f.Reason)
+	}
+	if !s.isAdmin(override.By) {
+		return nil, fmt.Errorf("%w: %s is frozen and only an admin may override the freeze", ErrDeployBlocked, e.Name)
+	}
+	a.Overridden = f
+	return a, nil
+}
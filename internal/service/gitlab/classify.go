@@ -0,0 +1,165 @@
+package gitlab
+
+import (
+	"errors"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+
+	"gorm.io/gorm"
+)
+
+// 任务类型
+const (
+	TaskTypeCreateBranch = "创建分支"
+	TaskTypeMerge        = "分支合并"
+	TaskTypeChange       = "修改文件"
+)
+
+// 操作记录类型
+const (
+	HintCreateBranch = "create_branch"
+	HintMerge        = "merge"
+)
+
+// ErrInvalidTaskType 不支持的任务类型
+var ErrInvalidTaskType = errors.New("task_type must be one of 创建分支/分支合并/修改文件")
+
+// RefSHA 分支上的一次提交
+type RefSHA struct {
+	Ref string
+	SHA string
+}
+
+// PipelineRef 待判别的流水线
+type PipelineRef struct {
+	ID  int64
+	Ref string
+	SHA string
+}
+
+// Classifier 流水线任务类型判别
+// 依据只取流水线的分支与提交：webhook 事件优先，其次为本系统的操作记录，都没有时为“修改文件”；
+// 结果按流水线 ID 保存，同样的依据总是得到同样的结果，来源为 default 的结果在新依据出现后更新，人工修正的结果保持不变
+type Classifier struct {
+	events *EventStore
+	repo   *repository.GitLabTaskTypeRepository
+}
+
+// NewClassifier 创建任务类型判别实例
+func NewClassifier(db *gorm.DB, events *EventStore) *Classifier {
+	return &Classifier{events: events, repo: repository.NewGitLabTaskTypeRepository(db)}
+}
+
+// RecordHint 保存一条操作记录，没有提交的记录不能作为依据，直接忽略
+func (c *Classifier) RecordHint(h *model.GitLabTaskHint) error {
+	if h.SHA == "" || h.Branch == "" {
+		return nil
+	}
+	h.Title = truncate(h.Title, 255)
+	return c.repo.CreateHint(h)
+}
+
+// Classify 返回流水线的任务类型（按流水线 ID 索引），尚无结果或结果来源为 default 的流水线重新判别并保存
+func (c *Classifier) Classify(items []PipelineRef) (map[int64]string, error) {
+	ids := make([]int64, 0, len(items))
+	for _, p := range items {
+		ids = append(ids, p.ID)
+	}
+	saved, err := c.repo.ListTypes(ids)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[int64]model.GitLabPipelineType, len(saved))
+	for _, t := range saved {
+		existing[t.PipelineID] = t
+	}
+	out := make(map[int64]string, len(items))
+	var pending []PipelineRef
+	var keys []RefSHA
+	for _, p := range items {
+		if t, ok := existing[p.ID]; ok && t.Source != model.TaskTypeSourceDefault {
+			out[p.ID] = t.TaskType
+			continue
+		}
+		pending = append(pending, p)
+		keys = append(keys, RefSHA{Ref: p.Ref, SHA: p.SHA})
+	}
+	if len(pending) == 0 {
+		return out, nil
+	}
+	byEvent, err := c.events.TaskTypes(keys)
+	if err != nil {
+		return nil, err
+	}
+	byHint, err := c.hintTaskTypes(keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pending {
+		k := RefSHA{Ref: p.Ref, SHA: p.SHA}
+		taskType, source := TaskTypeChange, model.TaskTypeSourceDefault
+		if t, ok := byEvent[k]; ok {
+			taskType, source = t, model.TaskTypeSourceEvent
+		} else if t, ok := byHint[k]; ok {
+			taskType, source = t, model.TaskTypeSourceHint
+		}
+		out[p.ID] = taskType
+		if t, ok := existing[p.ID]; ok && t.TaskType == taskType && t.Source == source {
+			continue
+		}
+		if err := c.repo.SaveType(&model.GitLabPipelineType{PipelineID: p.ID, Ref: p.Ref, SHA: p.SHA, TaskType: taskType, Source: source}); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// SetTaskType 人工修正流水线的任务类型；taskType 为空时撤销修正，下次展示时重新自动判别
+func (c *Classifier) SetTaskType(p PipelineRef, taskType, actor string) (*model.GitLabPipelineType, error) {
+	if taskType == "" {
+		if _, err := c.repo.DeleteType(p.ID); err != nil {
+			return nil, err
+		}
+		if _, err := c.Classify([]PipelineRef{p}); err != nil {
+			return nil, err
+		}
+		return c.repo.GetType(p.ID)
+	}
+	switch taskType {
+	case TaskTypeCreateBranch, TaskTypeMerge, TaskTypeChange:
+	default:
+		return nil, ErrInvalidTaskType
+	}
+	t := &model.GitLabPipelineType{PipelineID: p.ID, Ref: p.Ref, SHA: p.SHA, TaskType: taskType, Source: model.TaskTypeSourceManual, UpdatedBy: actor}
+	if err := c.repo.SaveType(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// hintTaskTypes 依据操作记录判别提交的任务类型，同一提交两者兼有时以创建分支为准
+func (c *Classifier) hintTaskTypes(keys []RefSHA) (map[RefSHA]string, error) {
+	shas := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if k.SHA != "" {
+			shas = append(shas, k.SHA)
+		}
+	}
+	hints, err := c.repo.ListHintsBySHAs(shas)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[RefSHA]string)
+	for _, h := range hints {
+		k := RefSHA{Ref: h.Branch, SHA: h.SHA}
+		switch h.Kind {
+		case HintCreateBranch:
+			out[k] = TaskTypeCreateBranch
+		case HintMerge:
+			if out[k] != TaskTypeCreateBranch {
+				out[k] = TaskTypeMerge
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,69 @@
+package gitlab
+
+import (
+	"errors"
+	"testing"
+	"webci-refactored/internal/dal/model"
+)
+
+func TestClassifier(t *testing.T) {
+	db := newTestDB(t)
+	events := NewEventStore(db)
+	c := NewClassifier(db, events)
+
+	// 本系统建分支 feature/y（起点 shaA）与合并到 main（合并提交 shaC）
+	if err := c.RecordHint(&model.GitLabTaskHint{Kind: HintCreateBranch, Branch: "feature/y", SHA: shaA}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RecordHint(&model.GitLabTaskHint{Kind: HintMerge, Branch: "main", SHA: shaC, MRIID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	// 重复记录与没有提交的记录被忽略
+	if err := c.RecordHint(&model.GitLabTaskHint{Kind: HintMerge, Branch: "main", SHA: shaC, MRIID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RecordHint(&model.GitLabTaskHint{Kind: HintMerge, Branch: "test/y"}); err != nil {
+		t.Fatal(err)
+	}
+
+	pipelines := []PipelineRef{{1, "feature/y", shaA}, {2, "main", shaC}, {3, "feature/y", shaB}, {4, "main", shaA}}
+	want := map[int64]string{1: TaskTypeCreateBranch, 2: TaskTypeMerge, 3: TaskTypeChange, 4: TaskTypeChange}
+	for round := 0; round < 2; round++ {
+		got, err := c.Classify(pipelines)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for id, w := range want {
+			if got[id] != w {
+				t.Fatalf("round %d pipeline %d: got %q want %q", round, id, got[id], w)
+			}
+		}
+	}
+	if n, _ := c.repo.ListTypes([]int64{1, 2, 3, 4}); len(n) != 4 {
+		t.Fatalf("results must be stored per pipeline: %+v", n)
+	}
+
+	// 之后收到的 webhook 事件更新来源为 default 的结果，已判别的结果不变
+	if _, _, err := events.Ingest("Merge Request Hook", "m1", []byte(`{"object_attributes":{"iid":5,"action":"merge","target_branch":"feature/y","merge_commit_sha":"`+shaB+`"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.Classify(pipelines); got[3] != TaskTypeMerge || got[1] != TaskTypeCreateBranch {
+		t.Fatalf("event must upgrade default result: %v", got)
+	}
+
+	// 人工修正优先于任何依据，撤销后恢复自动判别
+	if _, err := c.SetTaskType(PipelineRef{2, "main", shaC}, "部署", "root"); !errors.Is(err, ErrInvalidTaskType) {
+		t.Fatalf("unknown task type must be rejected: %v", err)
+	}
+	m, err := c.SetTaskType(PipelineRef{2, "main", shaC}, TaskTypeChange, "root")
+	if err != nil || m.Source != model.TaskTypeSourceManual || m.UpdatedBy != "root" {
+		t.Fatalf("manual: %+v %v", m, err)
+	}
+	if got, _ := c.Classify(pipelines); got[2] != TaskTypeChange {
+		t.Fatalf("manual correction must stick: %v", got)
+	}
+	r, err := c.SetTaskType(PipelineRef{2, "main", shaC}, "", "root")
+	if err != nil || r.TaskType != TaskTypeMerge || r.Source != model.TaskTypeSourceHint {
+		t.Fatalf("reset: %+v %v", r, err)
+	}
+}
@@ -0,0 +1,85 @@
+package gitlab
+
+import (
+	"fmt"
+	"webci-refactored/internal/config"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+	"webci-refactored/internal/secret"
+
+	"gorm.io/gorm"
+)
+
+// ConfigStore GitLab 配置持久化
+// 以版本形式保存 GitLab 地址、令牌（加密）、项目与本地仓库路径，重启后以最新版本覆盖环境变量中的配置
+type ConfigStore struct {
+	repo *repository.GitLabConfigRepository
+}
+
+// NewConfigStore 创建 GitLab 配置持久化实例
+func NewConfigStore(db *gorm.DB) *ConfigStore {
+	return &ConfigStore{repo: repository.NewGitLabConfigRepository(db)}
+}
+
+// Overlay 以数据库中的当前版本覆盖 base 的 GitLab 配置，尚无版本时原样返回；令牌无法解密时返回错误与该版本
+func (s *ConfigStore) Overlay(base config.Config) (config.Config, *model.GitLabConfig, error) {
+	c, err := s.repo.Latest()
+	if err != nil || c == nil {
+		return base, nil, err
+	}
+	cfg, err := s.apply(base, c)
+	if err != nil {
+		return base, c, fmt.Errorf("decrypt saved gitlab config version %d (check SECRET_KEY): %w", c.Version, err)
+	}
+	return cfg, c, nil
+}
+
+// CheckKey 校验已配置服务端密钥：临时密钥加密的令牌重启后无法解密，此时拒绝保存配置
+func (s *ConfigStore) CheckKey() error {
+	if !secret.Persistent() {
+		return secret.ErrNoKey
+	}
+	return nil
+}
+
+// Resolve 以指定版本覆盖 base 的 GitLab 配置
+func (s *ConfigStore) Resolve(base config.Config, version int) (config.Config, *model.GitLabConfig, error) {
+	c, err := s.repo.GetByVersion(version)
+	if err != nil {
+		return base, nil, err
+	}
+	cfg, err := s.apply(base, c)
+	return cfg, c, err
+}
+
+// Save 将配置保存为新版本，令牌加密存储；未配置服务端密钥时返回 secret.ErrNoKey
+func (s *ConfigStore) Save(cfg config.Config, actor, note string) (*model.GitLabConfig, error) {
+	if err := s.CheckKey(); err != nil {
+		return nil, err
+	}
+	token, err := secret.Encrypt(cfg.GitLabToken)
+	if err != nil {
+		return nil, err
+	}
+	c := &model.GitLabConfig{BaseURL: cfg.GitLabBaseURL, Token: token, ProjectID: cfg.GitLabProject, RepoPath: cfg.RepoPath, CreatedBy: actor, Note: note}
+	if err := s.repo.Create(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// History 按版本倒序列出配置历史（不含令牌）
+func (s *ConfigStore) History(limit int) ([]model.GitLabConfig, error) { return s.repo.List(limit) }
+
+// apply 解密令牌并覆盖 base 的 GitLab 字段
+func (s *ConfigStore) apply(base config.Config, c *model.GitLabConfig) (config.Config, error) {
+	token, err := secret.Decrypt(c.Token)
+	if err != nil {
+		return base, err
+	}
+	base.GitLabBaseURL = c.BaseURL
+	base.GitLabToken = token
+	base.GitLabProject = c.ProjectID
+	base.RepoPath = c.RepoPath
+	return base, nil
+}
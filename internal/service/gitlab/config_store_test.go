@@ -0,0 +1,80 @@
+package gitlab
+
+import (
+	"errors"
+	"testing"
+	"webci-refactored/internal/config"
+	"webci-refactored/internal/dal"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/secret"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestConfigStoreVersions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := secret.Setup("test-key"); err != nil {
+		t.Fatal(err)
+	}
+	s := NewConfigStore(db)
+	base := config.Config{HTTPAddr: ":8080", GitLabBaseURL: "https://env/api/v4", GitLabToken: "env-token", GitLabProject: "env/proj"}
+	if cfg, cur, err := s.Overlay(base); err != nil || cur != nil || cfg.GitLabToken != "env-token" {
+		t.Fatalf("without saved versions the environment config is kept: %v %v", cur, err)
+	}
+
+	v1 := base
+	v1.GitLabBaseURL, v1.GitLabToken, v1.GitLabProject, v1.RepoPath = "https://a/api/v4", "token-a", "grp/a", "/repo/a"
+	if c, err := s.Save(v1, "root", "first"); err != nil || c.Version != 1 {
+		t.Fatalf("save v1: %+v %v", c, err)
+	}
+	v2 := v1
+	v2.GitLabToken = "token-b"
+	if c, err := s.Save(v2, "root", ""); err != nil || c.Version != 2 {
+		t.Fatalf("save v2: %+v %v", c, err)
+	}
+
+	var raw model.GitLabConfig
+	db.Where("version = ?", 2).First(&raw)
+	if raw.Token == "" || raw.Token == "token-b" {
+		t.Fatalf("token must be stored encrypted: %q", raw.Token)
+	}
+	cfg, cur, err := s.Overlay(base)
+	if err != nil || cur.Version != 2 || cfg.GitLabToken != "token-b" || cfg.RepoPath != "/repo/a" || cfg.HTTPAddr != ":8080" {
+		t.Fatalf("overlay should apply the latest version: %+v %+v %v", cfg, cur, err)
+	}
+	if cfg, _, err := s.Resolve(base, 1); err != nil || cfg.GitLabToken != "token-a" || cfg.GitLabProject != "grp/a" {
+		t.Fatalf("resolve v1: %+v %v", cfg, err)
+	}
+	if _, _, err := s.Resolve(base, 9); err == nil {
+		t.Fatal("unknown version must fail")
+	}
+	if items, _ := s.History(10); len(items) != 2 || items[0].Version != 2 || items[0].CreatedBy != "root" {
+		t.Fatalf("history: %+v", items)
+	}
+
+	// 服务端密钥变更后已保存的配置无法解密，须报错而不是静默回退
+	if err := secret.Setup("other-key"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, cur, err := s.Overlay(base); !errors.Is(err, secret.ErrMalformed) || cur == nil || cur.Version != 2 || cfg.GitLabToken != "env-token" {
+		t.Fatalf("undecryptable config must be reported: %+v %v", cur, err)
+	}
+	// 未配置服务端密钥时拒绝保存
+	if err := secret.Setup(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Save(v2, "root", ""); !errors.Is(err, secret.ErrNoKey) {
+		t.Fatalf("save without SECRET_KEY must be refused: %v", err)
+	}
+	if items, _ := s.History(10); len(items) != 2 {
+		t.Fatalf("refused save must not add a version: %+v", items)
+	}
+}
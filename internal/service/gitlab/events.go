@@ -0,0 +1,151 @@
+package gitlab
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+
+	"github.com/xanzy/go-gitlab"
+	"gorm.io/gorm"
+)
+
+// zeroSHA push 事件中表示分支不存在的提交（before 为它即新建分支，after 为它即删除分支）
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// ErrUnsupportedEvent 不处理的 webhook 事件类型
+var ErrUnsupportedEvent = errors.New("unsupported gitlab event")
+
+// EventStore GitLab webhook 事件存储
+// 解析并保存 push、merge_request、pipeline 与 job 事件，据此判别流水线的任务类型（包括在 GitLab 上直接完成的操作）
+type EventStore struct {
+	repo *repository.GitLabEventRepository
+}
+
+// NewEventStore 创建 GitLab webhook 事件存储实例
+func NewEventStore(db *gorm.DB) *EventStore {
+	return &EventStore{repo: repository.NewGitLabEventRepository(db)}
+}
+
+// Ingest 解析一次投递并入库
+// eventType 为 X-Gitlab-Event 请求头，deliveryID 为 X-Gitlab-Event-UUID（可为空，此时以负载摘要代替）；
+// 重复投递不再写入，返回已保存的事件与 duplicate=true；不处理的事件类型返回 ErrUnsupportedEvent
+func (s *EventStore) Ingest(eventType, deliveryID string, payload []byte) (*model.GitLabEvent, bool, error) {
+	switch gitlab.EventType(eventType) {
+	case gitlab.EventTypePush, gitlab.EventTypeMergeRequest, gitlab.EventTypePipeline, gitlab.EventTypeJob:
+	default:
+		return nil, false, ErrUnsupportedEvent
+	}
+	parsed, err := gitlab.ParseWebhook(gitlab.EventType(eventType), payload)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid %s payload: %v", eventType, err)
+	}
+	e := toEvent(parsed)
+	if e == nil {
+		return nil, false, ErrUnsupportedEvent
+	}
+	if deliveryID == "" {
+		sum := sha256.Sum256(append([]byte(eventType+"\n"), payload...))
+		deliveryID = hex.EncodeToString(sum[:])
+	}
+	e.DeliveryID = truncate(deliveryID, 64)
+	e.Payload = string(payload)
+	created, err := s.repo.Create(e)
+	if err != nil {
+		return nil, false, err
+	}
+	if !created {
+		prev, err := s.repo.GetByDeliveryID(e.DeliveryID)
+		if err != nil {
+			return nil, true, err
+		}
+		return prev, true, nil
+	}
+	return e, false, nil
+}
+
+// TaskTypes 依据已接收的事件判别提交的任务类型，没有依据的提交不出现在结果中
+// push 事件的 before 为全零表示分支由该提交创建；MR 合并事件的合并提交（快进合并时为源分支最后一个提交）表示目标分支上的合并；
+// 同一提交两者兼有时以创建分支为准
+func (s *EventStore) TaskTypes(keys []RefSHA) (map[RefSHA]string, error) {
+	shas := make([]string, 0, len(keys))
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		if k.SHA != "" && !seen[k.SHA] {
+			seen[k.SHA] = true
+			shas = append(shas, k.SHA)
+		}
+	}
+	events, err := s.repo.ListBySHAs(shas, model.GitLabEventPush, model.GitLabEventMergeRequest)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[RefSHA]string)
+	for _, e := range events {
+		k := RefSHA{Ref: e.Ref, SHA: e.SHA}
+		switch {
+		case e.Kind == model.GitLabEventPush && e.BeforeSHA == zeroSHA:
+			out[k] = TaskTypeCreateBranch
+		case e.Kind == model.GitLabEventMergeRequest && e.Action == "merge":
+			if out[k] != TaskTypeCreateBranch {
+				out[k] = TaskTypeMerge
+			}
+		}
+	}
+	return out, nil
+}
+
+// toEvent 提取事件关键字段，不处理的类型返回 nil
+func toEvent(parsed interface{}) *model.GitLabEvent {
+	switch ev := parsed.(type) {
+	case *gitlab.PushEvent:
+		e := &model.GitLabEvent{Kind: model.GitLabEventPush, Ref: branchName(ev.Ref), SHA: ev.After, BeforeSHA: ev.Before, Username: ev.UserUsername, URL: ev.Project.WebURL}
+		if n := len(ev.Commits); n > 0 && ev.Commits[n-1] != nil {
+			e.Title = truncate(ev.Commits[n-1].Title, 255)
+		}
+		return e
+	case *gitlab.MergeEvent:
+		a := ev.ObjectAttributes
+		e := &model.GitLabEvent{Kind: model.GitLabEventMergeRequest, Action: a.Action, Ref: a.TargetBranch, SourceRef: a.SourceBranch, SHA: a.MergeCommitSHA, MRIID: int64(a.IID), Title: truncate(a.Title, 255), URL: a.URL}
+		if e.SHA == "" && a.Action == "merge" {
+			// 快进合并不产生合并提交，目标分支指向源分支最后一个提交
+			e.SHA = a.LastCommit.ID
+		}
+		if ev.User != nil {
+			e.Username = ev.User.Username
+		}
+		return e
+	case *gitlab.PipelineEvent:
+		a := ev.ObjectAttributes
+		e := &model.GitLabEvent{Kind: model.GitLabEventPipeline, Action: a.Status, Ref: a.Ref, SHA: a.SHA, BeforeSHA: a.BeforeSHA, PipelineID: int64(a.ID), URL: a.URL}
+		if ev.User != nil {
+			e.Username = ev.User.Username
+		}
+		return e
+	case *gitlab.JobEvent:
+		e := &model.GitLabEvent{Kind: model.GitLabEventJob, Action: ev.BuildStatus, Ref: ev.Ref, SHA: ev.SHA, BeforeSHA: ev.BeforeSHA, PipelineID: int64(ev.PipelineID), JobID: int64(ev.BuildID), Title: truncate(ev.BuildName, 255)}
+		if ev.User != nil {
+			e.Username = ev.User.Username
+		}
+		return e
+	}
+	return nil
+}
+
+// branchName 去掉 refs/heads/ 前缀
+func branchName(ref string) string { return strings.TrimPrefix(ref, "refs/heads/") }
+
+// truncate 截断到 n 字节以内（不截断多字节字符）
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,90 @@
+package gitlab
+
+import (
+	"errors"
+	"testing"
+	"webci-refactored/internal/dal"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	shaA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	shaB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	shaC = "cccccccccccccccccccccccccccccccccccccccc"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestEventStoreIngest(t *testing.T) {
+	s := NewEventStore(newTestDB(t))
+	push := `{"object_kind":"push","before":"` + zeroSHA + `","after":"` + shaA + `","ref":"refs/heads/feature/x","user_username":"alice","commits":[{"id":"` + shaA + `","title":"init"}]}`
+	e, dup, err := s.Ingest("Push Hook", "uuid-1", []byte(push))
+	if err != nil || dup || e.ID == 0 || e.Kind != "push" || e.Ref != "feature/x" || e.BeforeSHA != zeroSHA || e.Username != "alice" || e.Title != "init" {
+		t.Fatalf("push: %+v dup=%v err=%v", e, dup, err)
+	}
+	again, dup, err := s.Ingest("Push Hook", "uuid-1", []byte(push))
+	if err != nil || !dup || again.ID != e.ID {
+		t.Fatalf("redelivery must be deduplicated: %+v dup=%v err=%v", again, dup, err)
+	}
+	// 没有投递标识时按负载去重
+	pipeline := `{"object_kind":"pipeline","object_attributes":{"id":42,"ref":"main","sha":"` + shaB + `","status":"running"}}`
+	p1, _, err := s.Ingest("Pipeline Hook", "", []byte(pipeline))
+	if err != nil || p1.PipelineID != 42 || p1.Action != "running" {
+		t.Fatalf("pipeline: %+v %v", p1, err)
+	}
+	if p2, dup, _ := s.Ingest("Pipeline Hook", "", []byte(pipeline)); !dup || p2.ID != p1.ID {
+		t.Fatalf("identical payload without uuid must be deduplicated: %+v", p2)
+	}
+	if _, _, err := s.Ingest("Note Hook", "uuid-2", []byte(`{}`)); !errors.Is(err, ErrUnsupportedEvent) {
+		t.Fatalf("note events are not handled: %v", err)
+	}
+	if _, _, err := s.Ingest("Push Hook", "uuid-3", []byte(`{`)); err == nil || errors.Is(err, ErrUnsupportedEvent) {
+		t.Fatalf("malformed payload must fail: %v", err)
+	}
+}
+
+func TestEventStoreTaskTypes(t *testing.T) {
+	s := NewEventStore(newTestDB(t))
+	deliveries := []struct{ kind, id, body string }{
+		// 在 GitLab 上新建 feature/x（before 全零）
+		{"Push Hook", "1", `{"before":"` + zeroSHA + `","after":"` + shaA + `","ref":"refs/heads/feature/x"}`},
+		// 普通推送
+		{"Push Hook", "2", `{"before":"` + shaA + `","after":"` + shaB + `","ref":"refs/heads/feature/x"}`},
+		// MR 合并到 main 产生合并提交 shaC
+		{"Merge Request Hook", "3", `{"object_attributes":{"iid":7,"action":"merge","source_branch":"feature/x","target_branch":"main","merge_commit_sha":"` + shaC + `"}}`},
+		// 快进合并：没有合并提交，目标分支指向最后一个提交
+		{"Merge Request Hook", "4", `{"object_attributes":{"iid":8,"action":"merge","source_branch":"feature/x","target_branch":"test/x","last_commit":{"id":"` + shaB + `"}}}`},
+		// 仅打开 MR 不影响判别
+		{"Merge Request Hook", "5", `{"object_attributes":{"iid":9,"action":"open","source_branch":"feature/x","target_branch":"release/x","merge_commit_sha":"` + shaA + `"}}`},
+	}
+	for _, d := range deliveries {
+		if _, _, err := s.Ingest(d.kind, d.id, []byte(d.body)); err != nil {
+			t.Fatalf("ingest %s: %v", d.id, err)
+		}
+	}
+	types, err := s.TaskTypes([]RefSHA{{"feature/x", shaA}, {"feature/x", shaB}, {"main", shaC}, {"test/x", shaB}, {"main", shaA}, {"release/x", shaA}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[RefSHA]string{{"feature/x", shaA}: TaskTypeCreateBranch, {"main", shaC}: TaskTypeMerge, {"test/x", shaB}: TaskTypeMerge}
+	if len(types) != len(want) {
+		t.Fatalf("types: %v", types)
+	}
+	for k, v := range want {
+		if types[k] != v {
+			t.Fatalf("%v: got %q want %q (all %v)", k, types[k], v, types)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package gitlab
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"log"
@@ -12,6 +13,14 @@ import (
 	"github.com/xanzy/go-gitlab"
 )
 
+// callTimeout 单次 GitLab API 调用的超时，包含客户端对 5xx 的退避重试
+const callTimeout = 10 * time.Second
+
+// callContext 为单次 GitLab API 调用派生带超时的 context，调用方取消时一并取消
+func callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, callTimeout)
+}
+
 // Service GitLab服务
 type Service struct {
 	client        *gitlab.Client
@@ -71,25 +80,35 @@ func NewService(cfg config.Config) (*Service, error) {
 	return s, nil
 }
 
-func (s *Service) Reconfigure(cfg config.Config) error {
-	if cfg.GitLabToken == "" {
-		return fmt.Errorf("GITLAB_TOKEN is required")
-	}
-	if cfg.GitLabBaseURL == "" {
-		return fmt.Errorf("GITLAB_BASE_URL is required")
-	}
-	if cfg.GitLabProject == "" {
-		return fmt.Errorf("GITLAB_PROJECT_ID is required")
+// CheckProject 以一次项目查询校验地址、令牌与项目是否可用
+func (s *Service) CheckProject() error {
+	if _, _, err := s.client.Projects.GetProject(s.config.GitLabProject, nil); err != nil {
+		return fmt.Errorf("gitlab check failed: %v", err)
 	}
+	return nil
+}
+
+// WithToken 返回以 OAuth 访问令牌（用户自己的 GitLab 令牌）访问同一项目的服务副本，缓存不与原服务共享
+func (s *Service) WithToken(token string) (*Service, error) {
 	transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
 	httpClient := &http.Client{Transport: transport}
-	client, err := gitlab.NewClient(cfg.GitLabToken, gitlab.WithBaseURL(cfg.GitLabBaseURL), gitlab.WithHTTPClient(httpClient))
+	client, err := gitlab.NewOAuthClient(token, gitlab.WithBaseURL(s.config.GitLabBaseURL), gitlab.WithHTTPClient(httpClient))
 	if err != nil {
-		return fmt.Errorf("failed to create gitlab client: %v", err)
+		return nil, fmt.Errorf("failed to create gitlab client: %v", err)
 	}
-	s.client = client
-	s.config = cfg
-	return nil
+	return &Service{
+		client:   client,
+		config:   s.config,
+		cacheTTL: s.cacheTTL,
+		pipelineCache: make(map[int]struct {
+			v   *gitlab.Pipeline
+			exp time.Time
+		}),
+		commitCache: make(map[string]struct {
+			v   *gitlab.Commit
+			exp time.Time
+		}),
+	}, nil
 }
 
 // ListPipelines 获取项目流水线列表
@@ -110,12 +129,15 @@ func (s *Service) ListPipelines() ([]*gitlab.PipelineInfo, error) {
 	return pipelines, nil
 }
 
-func (s *Service) ListPipelinesWithPagination(page, perPage int) ([]*gitlab.PipelineInfo, *gitlab.Response, error) {
+// ListPipelinesWithPagination 分页获取项目流水线列表
+func (s *Service) ListPipelinesWithPagination(ctx context.Context, page, perPage int) ([]*gitlab.PipelineInfo, *gitlab.Response, error) {
 	log.Printf("Listing pipelines (page=%d, perPage=%d) for project: %s", page, perPage, s.config.GitLabProject)
+	ctx, cancel := callContext(ctx)
+	defer cancel()
 	pipelines, resp, err := s.client.Pipelines.ListProjectPipelines(s.config.GitLabProject, &gitlab.ListProjectPipelinesOptions{
 		Sort:        gitlab.String("desc"),
 		ListOptions: gitlab.ListOptions{Page: page, PerPage: perPage},
-	})
+	}, gitlab.WithContext(ctx))
 	if err != nil {
 		log.Printf("Failed to list pipelines: %v, response: %+v", err, resp)
 		return nil, resp, fmt.Errorf("failed to list pipelines: %v", err)
@@ -124,7 +146,7 @@ func (s *Service) ListPipelinesWithPagination(page, perPage int) ([]*gitlab.Pipe
 }
 
 // GetPipeline 获取单个流水线详情
-func (s *Service) GetPipeline(pipelineID int) (*gitlab.Pipeline, error) {
+func (s *Service) GetPipeline(ctx context.Context, pipelineID int) (*gitlab.Pipeline, error) {
 	s.mu.Lock()
 	if e, ok := s.pipelineCache[pipelineID]; ok && time.Now().Before(e.exp) {
 		v := e.v
@@ -133,7 +155,9 @@ func (s *Service) GetPipeline(pipelineID int) (*gitlab.Pipeline, error) {
 	}
 	s.mu.Unlock()
 	log.Printf("Getting pipeline %d for project: %s", pipelineID, s.config.GitLabProject)
-	pipeline, resp, err := s.client.Pipelines.GetPipeline(s.config.GitLabProject, pipelineID)
+	ctx, cancel := callContext(ctx)
+	defer cancel()
+	pipeline, resp, err := s.client.Pipelines.GetPipeline(s.config.GitLabProject, pipelineID, gitlab.WithContext(ctx))
 	if err != nil {
 		log.Printf("Failed to get pipeline %d: %v, response: %+v", pipelineID, err, resp)
 		return nil, fmt.Errorf("failed to get pipeline: %v", err)
@@ -147,12 +171,21 @@ func (s *Service) GetPipeline(pipelineID int) (*gitlab.Pipeline, error) {
 	return pipeline, nil
 }
 
+// ForgetPipeline 丢弃流水线详情缓存，流水线状态变化时调用
+func (s *Service) ForgetPipeline(pipelineID int) {
+	s.mu.Lock()
+	delete(s.pipelineCache, pipelineID)
+	s.mu.Unlock()
+}
+
 // ListJobs 获取流水线作业列表
-func (s *Service) ListJobs(pipelineID int) ([]*gitlab.Job, error) {
+func (s *Service) ListJobs(ctx context.Context, pipelineID int) ([]*gitlab.Job, error) {
 	log.Printf("Listing jobs for pipeline %d in project: %s", pipelineID, s.config.GitLabProject)
 
 	// 获取作业列表
-	jobs, resp, err := s.client.Jobs.ListPipelineJobs(s.config.GitLabProject, pipelineID, &gitlab.ListJobsOptions{})
+	ctx, cancel := callContext(ctx)
+	defer cancel()
+	jobs, resp, err := s.client.Jobs.ListPipelineJobs(s.config.GitLabProject, pipelineID, &gitlab.ListJobsOptions{}, gitlab.WithContext(ctx))
 	if err != nil {
 		log.Printf("Failed to list jobs for pipeline %d: %v, response: %+v", pipelineID, err, resp)
 		return nil, fmt.Errorf("failed to list jobs: %v", err)
@@ -192,7 +225,8 @@ func (s *Service) GetCommits() ([]*gitlab.Commit, error) {
 	return commits, nil
 }
 
-func (s *Service) GetCommit(sha string) (*gitlab.Commit, error) {
+// GetCommit 获取单个提交
+func (s *Service) GetCommit(ctx context.Context, sha string) (*gitlab.Commit, error) {
 	s.mu.Lock()
 	if e, ok := s.commitCache[sha]; ok && time.Now().Before(e.exp) {
 		v := e.v
@@ -200,7 +234,9 @@ func (s *Service) GetCommit(sha string) (*gitlab.Commit, error) {
 		return v, nil
 	}
 	s.mu.Unlock()
-	commit, resp, err := s.client.Commits.GetCommit(s.config.GitLabProject, sha, nil)
+	ctx, cancel := callContext(ctx)
+	defer cancel()
+	commit, resp, err := s.client.Commits.GetCommit(s.config.GitLabProject, sha, nil, gitlab.WithContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get commit: %v", err)
 	}
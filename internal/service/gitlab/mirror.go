@@ -0,0 +1,507 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+
+	"github.com/xanzy/go-gitlab"
+	"gorm.io/gorm"
+)
+
+const (
+	// syncPageSize 同步时每页拉取的数量（GitLab 上限 100）
+	syncPageSize = 100
+	// syncOverlap 增量游标回退量：与游标同一时刻更新的对象不会因边界而漏掉，重复拉取的对象覆盖写入
+	syncOverlap = time.Minute
+	// FullSyncInterval 全量对齐间隔：列出 GitLab 上的全部流水线与合并请求，删除本地多出的对象
+	FullSyncInterval = 30 * time.Minute
+	// retryLimit 每次同步重试获取详情失败的流水线的数量上限
+	retryLimit = 50
+)
+
+// partialError 部分对象同步失败：其余对象与游标已正常写入，资源仍记为同步成功并保留失败原因
+type partialError struct{ msg string }
+
+func (e *partialError) Error() string { return e.msg }
+
+// SyncReport 一次同步的结果
+type SyncReport struct {
+	// Full 是否进行了全量对齐
+	Full bool `json:"full"`
+	// 写入的流水线、合并请求与分支数量
+	Pipelines     int `json:"pipelines"`
+	MergeRequests int `json:"merge_requests"`
+	Branches      int `json:"branches"`
+	// 删除的流水线、合并请求与分支数量
+	DeletedPipelines     int `json:"deleted_pipelines"`
+	DeletedMergeRequests int `json:"deleted_merge_requests"`
+	DeletedBranches      int `json:"deleted_branches"`
+	// 获取详情失败、只保存了列表字段的流水线数量
+	FailedPipelines int `json:"failed_pipelines"`
+}
+
+// Mirror GitLab 本地镜像
+// 后台增量同步流水线（含作业与提交）、合并请求与分支到本地表，CI 页面与分支列表直接读取本地表；
+// 流水线与合并请求按 GitLab 更新时间游标增量拉取，并定期全量对齐以清理 GitLab 上已删除的对象
+type Mirror struct {
+	repo *repository.GitLabMirrorRepository
+	// mu 串行化同步，定时同步与手动触发不会并发写入
+	mu sync.Mutex
+}
+
+// NewMirror 创建 GitLab 本地镜像实例
+func NewMirror(db *gorm.DB) *Mirror {
+	return &Mirror{repo: repository.NewGitLabMirrorRepository(db)}
+}
+
+// Sync 以 api 的配置执行一次同步
+// 镜像属于其他 GitLab 地址或项目时先清空；距上次全量对齐超过 FullSyncInterval 或 full 为真时进行全量对齐。
+// 各资源分别记录进度，一种资源失败不影响其余资源，返回的错误汇总全部失败原因
+func (m *Mirror) Sync(ctx context.Context, api *Service, full bool) (*SyncReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	project := api.config.GitLabBaseURL + "#" + api.config.GitLabProject
+	states, err := m.repo.States()
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range states {
+		if st.Project != project {
+			if err := m.repo.Reset(); err != nil {
+				return nil, err
+			}
+			states = map[string]model.GitLabSyncState{}
+			break
+		}
+	}
+	report := &SyncReport{}
+	var errs []string
+	resources := []struct {
+		name string
+		run  func(context.Context, *Service, *model.GitLabSyncState, bool, *SyncReport) error
+	}{
+		{model.SyncResourcePipelines, m.syncPipelines},
+		{model.SyncResourceMergeRequests, m.syncMergeRequests},
+		{model.SyncResourceBranches, m.syncBranches},
+	}
+	for _, r := range resources {
+		st, ok := states[r.name]
+		if !ok {
+			st = model.GitLabSyncState{Resource: r.name}
+		}
+		st.Project = project
+		resFull := full || st.LastFullAt == nil || time.Since(*st.LastFullAt) >= FullSyncInterval
+		report.Full = report.Full || resFull
+		runErr := r.run(ctx, api, &st, resFull, report)
+		now := time.Now()
+		var partial *partialError
+		if errors.As(runErr, &partial) {
+			st.LastError = partial.Error()
+			st.LastSyncedAt = &now
+			if resFull {
+				st.LastFullAt = &now
+			}
+		} else if runErr != nil {
+			st.LastError = runErr.Error()
+			errs = append(errs, r.name+": "+runErr.Error())
+		} else {
+			st.LastError = ""
+			st.LastSyncedAt = &now
+			if resFull {
+				st.LastFullAt = &now
+			}
+		}
+		if err := m.repo.SaveState(&st); err != nil {
+			return report, err
+		}
+	}
+	if len(errs) > 0 {
+		return report, errors.New(strings.Join(errs, "; "))
+	}
+	return report, nil
+}
+
+// LastSynced 返回流水线最近一次成功同步的时间，尚未同步时为 nil
+func (m *Mirror) LastSynced() (*time.Time, error) {
+	st, err := m.repo.GetState(model.SyncResourcePipelines)
+	if err != nil {
+		return nil, err
+	}
+	return st.LastSyncedAt, nil
+}
+
+// States 返回各资源的同步进度
+func (m *Mirror) States() ([]model.GitLabSyncState, error) {
+	states, err := m.repo.States()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]model.GitLabSyncState, 0, len(states))
+	for _, s := range states {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Resource < out[k].Resource })
+	return out, nil
+}
+
+// PipelineCursor 流水线键集分页游标
+type PipelineCursor = repository.PipelineCursor
+
+// PipelinePage 镜像中按 ID 倒序的一页流水线
+type PipelinePage struct {
+	Items []model.GitLabPipeline
+	// Commits 流水线提交，按 SHA 索引
+	Commits map[string]model.GitLabCommit
+	// Total 流水线总数；Newer、Older 为本页之前（ID 更大）与之后（ID 更小）的流水线数量
+	Total, Newer, Older int64
+}
+
+// Pipelines 按游标（游标为空时按偏移量）查询镜像中的一页流水线。
+// 上一页不足一页时说明已到最前，改为返回第一页，保证每页条数一致
+func (m *Mirror) Pipelines(cur PipelineCursor, limit, offset int) (*PipelinePage, error) {
+	items, err := m.repo.ListPipelines(cur, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if cur.AfterID > 0 && len(items) < limit {
+		if items, err = m.repo.ListPipelines(PipelineCursor{}, limit, 0); err != nil {
+			return nil, err
+		}
+	}
+	page := &PipelinePage{Items: items}
+	if page.Total, err = m.repo.CountPipelines(0, 0); err != nil {
+		return nil, err
+	}
+	if len(items) > 0 {
+		if page.Newer, err = m.repo.CountPipelines(items[0].ID, 0); err != nil {
+			return nil, err
+		}
+		if page.Older, err = m.repo.CountPipelines(0, items[len(items)-1].ID); err != nil {
+			return nil, err
+		}
+	} else if cur.BeforeID > 0 || offset > 0 {
+		page.Newer = page.Total
+	}
+	shas := make([]string, 0, len(items))
+	for _, p := range items {
+		shas = append(shas, p.SHA)
+	}
+	if page.Commits, err = m.repo.GetCommits(shas); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Branches 查询镜像中的分支
+func (m *Mirror) Branches() ([]model.GitLabBranch, error) { return m.repo.ListBranches() }
+
+// syncPipelines 按更新时间升序拉取游标之后变化的流水线并逐条写入（含详情、作业与提交），每页结束推进游标；
+// 单条获取详情失败时只保存列表字段并记下原因，之后的同步重试；列表请求失败或被取消时停止，下次从游标处继续。
+// 全量对齐时删除 GitLab 上已不存在的流水线
+func (m *Mirror) syncPipelines(ctx context.Context, api *Service, st *model.GitLabSyncState, full bool, report *SyncReport) error {
+	var failures []string
+	store := func(p *gitlab.PipelineInfo) error {
+		err := m.storePipeline(ctx, api, p)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		report.FailedPipelines++
+		failures = append(failures, err.Error())
+		return m.repo.SavePipelineError(pipelineRow(p, err))
+	}
+	opt := &gitlab.ListProjectPipelinesOptions{
+		OrderBy:     gitlab.String("updated_at"),
+		Sort:        gitlab.String("asc"),
+		ListOptions: gitlab.ListOptions{PerPage: syncPageSize, Page: 1},
+	}
+	initial := st.Cursor == nil
+	if !initial {
+		after := st.Cursor.Add(-syncOverlap)
+		opt.UpdatedAfter = &after
+	}
+	// 首次同步会列出全部流水线，同时得到对齐所需的 ID 集合
+	seen := make(map[int64]bool)
+	for {
+		list, resp, err := api.client.Pipelines.ListProjectPipelines(api.config.GitLabProject, opt, gitlab.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("list pipelines: %v", err)
+		}
+		for _, p := range list {
+			seen[int64(p.ID)] = true
+			if err := store(p); err != nil {
+				return err
+			}
+			report.Pipelines++
+			if p.UpdatedAt != nil && (st.Cursor == nil || p.UpdatedAt.After(*st.Cursor)) {
+				t := *p.UpdatedAt
+				st.Cursor = &t
+			}
+		}
+		if err := m.repo.SaveState(st); err != nil {
+			return err
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	// 重试之前获取详情失败的流水线（本轮刚失败的除外）
+	retry, err := m.repo.FailedPipelines(retryLimit)
+	if err != nil {
+		return err
+	}
+	for _, p := range retry {
+		if seen[p.ID] {
+			continue
+		}
+		info := &gitlab.PipelineInfo{ID: int(p.ID), IID: int(p.IID), Ref: p.Ref, SHA: p.SHA, Status: p.Status, Source: p.Source, WebURL: p.WebURL, CreatedAt: &p.CreatedAt, UpdatedAt: &p.UpdatedAt}
+		if err := store(info); err != nil {
+			return err
+		}
+	}
+	if full {
+		if err := m.reconcilePipelines(ctx, api, initial, seen, report); err != nil {
+			return err
+		}
+	}
+	if len(failures) > 0 {
+		return &partialError{msg: fmt.Sprintf("%d pipelines failed, first: %s", len(failures), failures[0])}
+	}
+	return nil
+}
+
+// reconcilePipelines 删除 GitLab 上已不存在的流水线；首次同步已列出全部流水线，直接使用其 ID 集合
+func (m *Mirror) reconcilePipelines(ctx context.Context, api *Service, initial bool, seen map[int64]bool, report *SyncReport) error {
+	if !initial {
+		ids, err := m.remotePipelineIDs(ctx, api)
+		if err != nil {
+			return err
+		}
+		seen = ids
+	}
+	local, err := m.repo.PipelineIDs()
+	if err != nil {
+		return err
+	}
+	var gone []int64
+	for _, id := range local {
+		if !seen[id] {
+			gone = append(gone, id)
+		}
+	}
+	report.DeletedPipelines += len(gone)
+	return m.repo.DeletePipelines(gone)
+}
+
+// remotePipelineIDs 列出 GitLab 上全部流水线的 ID
+func (m *Mirror) remotePipelineIDs(ctx context.Context, api *Service) (map[int64]bool, error) {
+	ids := make(map[int64]bool)
+	opt := &gitlab.ListProjectPipelinesOptions{ListOptions: gitlab.ListOptions{PerPage: syncPageSize, Page: 1}}
+	for {
+		list, resp, err := api.client.Pipelines.ListProjectPipelines(api.config.GitLabProject, opt, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("list pipelines: %v", err)
+		}
+		for _, p := range list {
+			ids[int64(p.ID)] = true
+		}
+		if resp.NextPage == 0 {
+			return ids, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// pipelineRow 以列表中的字段构造获取详情失败的流水线记录
+func pipelineRow(p *gitlab.PipelineInfo, cause error) *model.GitLabPipeline {
+	row := &model.GitLabPipeline{ID: int64(p.ID), IID: int64(p.IID), Ref: p.Ref, SHA: p.SHA, Status: p.Status, Source: p.Source, WebURL: p.WebURL, SyncedAt: time.Now(), SyncError: truncate(cause.Error(), 512)}
+	if p.CreatedAt != nil {
+		row.CreatedAt = *p.CreatedAt
+	}
+	if p.UpdatedAt != nil {
+		row.UpdatedAt = *p.UpdatedAt
+	}
+	return row
+}
+
+// storePipeline 获取流水线详情、全部作业与（尚未保存的）提交后写入；流水线已被删除时删除本地记录。
+// 每条流水线的请求共用一个 callTimeout，单条卡住不会拖住整轮同步
+func (m *Mirror) storePipeline(ctx context.Context, api *Service, info *gitlab.PipelineInfo) error {
+	ctx, cancel := callContext(ctx)
+	defer cancel()
+	project := api.config.GitLabProject
+	d, resp, err := api.client.Pipelines.GetPipeline(project, info.ID, gitlab.WithContext(ctx))
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return m.repo.DeletePipelines([]int64{int64(info.ID)})
+	}
+	if err != nil {
+		return fmt.Errorf("get pipeline %d: %v", info.ID, err)
+	}
+	p := &model.GitLabPipeline{ID: int64(d.ID), IID: int64(d.IID), Ref: d.Ref, SHA: d.SHA, Status: d.Status, Source: string(d.Source), WebURL: d.WebURL, Duration: d.Duration, FinishedAt: d.FinishedAt, SyncedAt: time.Now()}
+	if d.User != nil {
+		p.TriggerUser = d.User.Name
+		if p.TriggerUser == "" {
+			p.TriggerUser = d.User.Username
+		}
+	}
+	if d.CreatedAt != nil {
+		p.CreatedAt = *d.CreatedAt
+	}
+	if d.UpdatedAt != nil {
+		p.UpdatedAt = *d.UpdatedAt
+	}
+	var jobs []model.GitLabJob
+	jopt := &gitlab.ListJobsOptions{ListOptions: gitlab.ListOptions{PerPage: syncPageSize, Page: 1}}
+	for {
+		list, resp, err := api.client.Jobs.ListPipelineJobs(project, info.ID, jopt, gitlab.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("list jobs of pipeline %d: %v", info.ID, err)
+		}
+		for _, j := range list {
+			job := model.GitLabJob{ID: int64(j.ID), PipelineID: p.ID, Name: j.Name, Stage: j.Stage, Status: j.Status, WebURL: j.WebURL, Duration: j.Duration, StartedAt: j.StartedAt, FinishedAt: j.FinishedAt}
+			if j.CreatedAt != nil {
+				job.CreatedAt = *j.CreatedAt
+			}
+			jobs = append(jobs, job)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		jopt.Page = resp.NextPage
+	}
+	var commit *model.GitLabCommit
+	if p.SHA != "" {
+		has, err := m.repo.HasCommit(p.SHA)
+		if err != nil {
+			return err
+		}
+		if !has {
+			c, _, err := api.client.Commits.GetCommit(project, p.SHA, nil, gitlab.WithContext(ctx))
+			if err != nil {
+				return fmt.Errorf("get commit %s: %v", p.SHA, err)
+			}
+			commit = &model.GitLabCommit{SHA: c.ID, Title: truncate(c.Title, 512), Message: c.Message, AuthorName: c.AuthorName}
+			if c.CreatedAt != nil {
+				commit.CreatedAt = *c.CreatedAt
+			}
+		}
+	}
+	return m.repo.SavePipeline(p, jobs, commit)
+}
+
+// syncMergeRequests 按更新时间升序拉取游标之后变化的合并请求；全量对齐时删除 GitLab 上已不存在的合并请求
+func (m *Mirror) syncMergeRequests(ctx context.Context, api *Service, st *model.GitLabSyncState, full bool, report *SyncReport) error {
+	opt := &gitlab.ListProjectMergeRequestsOptions{
+		OrderBy:     gitlab.String("updated_at"),
+		Sort:        gitlab.String("asc"),
+		ListOptions: gitlab.ListOptions{PerPage: syncPageSize, Page: 1},
+	}
+	if st.Cursor != nil {
+		after := st.Cursor.Add(-syncOverlap)
+		opt.UpdatedAfter = &after
+	}
+	for {
+		list, resp, err := api.client.MergeRequests.ListProjectMergeRequests(api.config.GitLabProject, opt, gitlab.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("list merge requests: %v", err)
+		}
+		for _, mr := range list {
+			if err := m.repo.SaveMergeRequest(toMergeRequest(mr)); err != nil {
+				return err
+			}
+			report.MergeRequests++
+			if mr.UpdatedAt != nil && (st.Cursor == nil || mr.UpdatedAt.After(*st.Cursor)) {
+				t := *mr.UpdatedAt
+				st.Cursor = &t
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	if !full {
+		return nil
+	}
+	remote := make(map[int64]bool)
+	all := &gitlab.ListProjectMergeRequestsOptions{ListOptions: gitlab.ListOptions{PerPage: syncPageSize, Page: 1}}
+	for {
+		list, resp, err := api.client.MergeRequests.ListProjectMergeRequests(api.config.GitLabProject, all, gitlab.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("list merge requests: %v", err)
+		}
+		for _, mr := range list {
+			remote[int64(mr.IID)] = true
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		all.Page = resp.NextPage
+	}
+	local, err := m.repo.MergeRequestIIDs()
+	if err != nil {
+		return err
+	}
+	var gone []int64
+	for _, iid := range local {
+		if !remote[iid] {
+			gone = append(gone, iid)
+		}
+	}
+	report.DeletedMergeRequests += len(gone)
+	return m.repo.DeleteMergeRequests(gone)
+}
+
+// syncBranches 列出全部分支并整体对齐（GitLab 分支接口不支持按更新时间过滤）
+func (m *Mirror) syncBranches(ctx context.Context, api *Service, st *model.GitLabSyncState, full bool, report *SyncReport) error {
+	var branches []model.GitLabBranch
+	now := time.Now()
+	opt := &gitlab.ListBranchesOptions{ListOptions: gitlab.ListOptions{PerPage: syncPageSize, Page: 1}}
+	for {
+		list, resp, err := api.client.Branches.ListBranches(api.config.GitLabProject, opt, gitlab.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("list branches: %v", err)
+		}
+		for _, b := range list {
+			br := model.GitLabBranch{Name: b.Name, Protected: b.Protected, SyncedAt: now}
+			if b.Commit != nil {
+				br.CommitSHA = b.Commit.ID
+			}
+			branches = append(branches, br)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	deleted, err := m.repo.ReplaceBranches(branches)
+	if err != nil {
+		return err
+	}
+	report.Branches += len(branches)
+	report.DeletedBranches += deleted
+	return nil
+}
+
+// toMergeRequest 转换为镜像模型
+func toMergeRequest(mr *gitlab.MergeRequest) *model.GitLabMergeRequest {
+	m := &model.GitLabMergeRequest{IID: int64(mr.IID), Title: truncate(mr.Title, 512), State: mr.State, SourceBranch: mr.SourceBranch, TargetBranch: mr.TargetBranch, WebURL: mr.WebURL, MergeCommitSHA: mr.MergeCommitSHA, SquashCommitSHA: mr.SquashCommitSHA, MergedAt: mr.MergedAt}
+	if mr.Author != nil {
+		m.Author = mr.Author.Username
+	}
+	if mr.CreatedAt != nil {
+		m.CreatedAt = *mr.CreatedAt
+	}
+	if mr.UpdatedAt != nil {
+		m.UpdatedAt = *mr.UpdatedAt
+	}
+	return m
+}
@@ -0,0 +1,309 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"webci-refactored/internal/config"
+	"webci-refactored/internal/dal/model"
+)
+
+// fakeGitLab 以内存数据模拟 GitLab 的流水线、作业、提交、分支与合并请求接口
+type fakeGitLab struct {
+	mu        sync.Mutex
+	pipelines map[int]map[string]interface{}
+	branches  []string
+	// updatedAfter 记录流水线列表请求携带的 updated_after
+	updatedAfter []string
+	// broken 详情请求返回 403 的流水线（5xx 会被客户端退避重试，拖慢测试）
+	broken map[int]bool
+}
+
+var (
+	rePipelineJobs = regexp.MustCompile(`/pipelines/(\d+)/jobs$`)
+	rePipeline     = regexp.MustCompile(`/pipelines/(\d+)$`)
+	reCommit       = regexp.MustCompile(`/repository/commits/(\w+)$`)
+)
+
+func (f *fakeGitLab) setPipeline(id int, status string, updated time.Time) {
+	f.pipelines[id] = map[string]interface{}{"id": id, "iid": id, "ref": "main", "sha": fmt.Sprintf("%040x", id), "status": status,
+		"created_at": updated.Add(-time.Minute), "updated_at": updated, "duration": 60, "user": map[string]string{"username": "alice", "name": "Alice"}}
+}
+
+func (f *fakeGitLab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	q := r.URL.Query()
+	page := func(items []interface{}) {
+		per, _ := strconv.Atoi(q.Get("per_page"))
+		n, _ := strconv.Atoi(q.Get("page"))
+		if per <= 0 {
+			per = 20
+		}
+		if n <= 0 {
+			n = 1
+		}
+		start, end := (n-1)*per, n*per
+		if start > len(items) {
+			start = len(items)
+		}
+		if end > len(items) {
+			end = len(items)
+		}
+		if end < len(items) {
+			w.Header().Set("X-Next-Page", strconv.Itoa(n+1))
+		}
+		w.Header().Set("X-Total", strconv.Itoa(len(items)))
+		_ = json.NewEncoder(w).Encode(items[start:end])
+	}
+	path := r.URL.Path
+	switch {
+	case rePipelineJobs.MatchString(path):
+		id, _ := strconv.Atoi(rePipelineJobs.FindStringSubmatch(path)[1])
+		page([]interface{}{map[string]interface{}{"id": id * 10, "name": "build", "stage": "build", "status": f.pipelines[id]["status"]}})
+	case rePipeline.MatchString(path):
+		id, _ := strconv.Atoi(rePipeline.FindStringSubmatch(path)[1])
+		p, ok := f.pipelines[id]
+		if f.broken[id] {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"404 Not found"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(p)
+	case len(path) > 10 && path[len(path)-10:] == "/pipelines":
+		after, _ := time.Parse(time.RFC3339, q.Get("updated_after"))
+		if q.Get("updated_after") != "" {
+			f.updatedAfter = append(f.updatedAfter, q.Get("updated_after"))
+		}
+		var ids []int
+		for id, p := range f.pipelines {
+			if after.IsZero() || p["updated_at"].(time.Time).After(after) {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, k int) bool {
+			if q.Get("order_by") == "updated_at" {
+				return f.pipelines[ids[i]]["updated_at"].(time.Time).Before(f.pipelines[ids[k]]["updated_at"].(time.Time))
+			}
+			return ids[i] > ids[k]
+		})
+		var items []interface{}
+		for _, id := range ids {
+			items = append(items, f.pipelines[id])
+		}
+		page(items)
+	case reCommit.MatchString(path):
+		sha := reCommit.FindStringSubmatch(path)[1]
+		_ = json.NewEncoder(w).Encode(map[string]string{"id": sha, "title": "commit " + sha[36:], "author_name": "Bob"})
+	case len(path) > 20 && path[len(path)-20:] == "/repository/branches":
+		var items []interface{}
+		for _, b := range f.branches {
+			items = append(items, map[string]interface{}{"name": b, "commit": map[string]string{"id": "abc"}})
+		}
+		page(items)
+	case len(path) > 15 && path[len(path)-15:] == "/merge_requests":
+		page([]interface{}{map[string]interface{}{"iid": 7, "title": "feature", "state": "merged", "source_branch": "feature/a", "target_branch": "main", "merge_commit_sha": "def", "updated_at": time.Now().UTC()}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestMirrorSync(t *testing.T) {
+	t0 := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	fake := &fakeGitLab{pipelines: map[int]map[string]interface{}{}, branches: []string{"main", "feature/a"}}
+	for id := 1; id <= 3; id++ {
+		fake.setPipeline(id, "success", t0.Add(time.Duration(id)*time.Hour))
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	api, err := NewService(config.Config{GitLabBaseURL: srv.URL + "/api/v4", GitLabToken: "t", GitLabProject: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := newTestDB(t)
+	m := NewMirror(db)
+	ctx := context.Background()
+
+	if synced, _ := m.LastSynced(); synced != nil {
+		t.Fatal("nothing is synced yet")
+	}
+	report, err := m.Sync(ctx, api, false)
+	if err != nil || report.Pipelines != 3 || report.Branches != 2 || report.MergeRequests != 1 || !report.Full {
+		t.Fatalf("initial sync: %+v %v", report, err)
+	}
+	pg, err := m.Pipelines(PipelineCursor{}, 2, 0)
+	if err != nil || pg.Total != 3 || len(pg.Items) != 2 || pg.Items[0].ID != 3 || pg.Items[0].TriggerUser != "Alice" || pg.Commits[pg.Items[0].SHA].AuthorName != "Bob" {
+		t.Fatalf("pipelines: %+v err=%v", pg, err)
+	}
+	if synced, _ := m.LastSynced(); synced == nil {
+		t.Fatal("last synced must be recorded")
+	}
+
+	// 增量：只拉取游标（回退 syncOverlap）之后变化的流水线：2 条变化加游标处的 3 号
+	fake.mu.Lock()
+	fake.setPipeline(2, "failed", t0.Add(5*time.Hour))
+	fake.setPipeline(4, "running", t0.Add(6*time.Hour))
+	fake.mu.Unlock()
+	report, err = m.Sync(ctx, api, false)
+	if err != nil || report.Full || report.Pipelines != 3 {
+		t.Fatalf("incremental sync should fetch only the changed pipelines: %+v %v", report, err)
+	}
+	if len(fake.updatedAfter) == 0 || fake.updatedAfter[len(fake.updatedAfter)-1] != t0.Add(3*time.Hour-syncOverlap).Format(time.RFC3339) {
+		t.Fatalf("updated_after cursor: %v", fake.updatedAfter)
+	}
+	pg, _ = m.Pipelines(PipelineCursor{}, 10, 0)
+	if pg.Total != 4 || pg.Items[0].ID != 4 || pg.Items[2].Status != "failed" {
+		t.Fatalf("after incremental sync: %+v", pg.Items)
+	}
+
+	// 全量对齐删除 GitLab 上已删除的流水线与分支
+	fake.mu.Lock()
+	delete(fake.pipelines, 1)
+	fake.branches = []string{"main"}
+	fake.mu.Unlock()
+	report, err = m.Sync(ctx, api, true)
+	if err != nil || report.DeletedPipelines != 1 || report.DeletedBranches != 1 {
+		t.Fatalf("full sync: %+v %v", report, err)
+	}
+	if pg, _ = m.Pipelines(PipelineCursor{}, 10, 0); pg.Total != 3 {
+		t.Fatalf("deleted pipeline must be removed: total=%d", pg.Total)
+	}
+	if b, _ := m.Branches(); len(b) != 1 || b[0].Name != "main" {
+		t.Fatalf("branches: %+v", b)
+	}
+
+	// 切换到其他项目时清空镜像
+	other, _ := NewService(config.Config{GitLabBaseURL: srv.URL + "/api/v4", GitLabToken: "t", GitLabProject: "2"})
+	fake.mu.Lock()
+	fake.pipelines = map[int]map[string]interface{}{}
+	fake.mu.Unlock()
+	if _, err := m.Sync(ctx, other, false); err != nil {
+		t.Fatal(err)
+	}
+	states, _ := m.States()
+	if pg, _ = m.Pipelines(PipelineCursor{}, 10, 0); pg.Total != 0 || len(states) != 3 || states[0].Project != srv.URL+"/api/v4#2" {
+		t.Fatalf("mirror must be reset for another project: total=%d states=%+v", pg.Total, states)
+	}
+	var mr model.GitLabMergeRequest
+	if err := db.First(&mr).Error; err != nil || mr.IID != 7 {
+		t.Fatalf("merge requests of the new project are synced: %+v %v", mr, err)
+	}
+}
+
+func TestMirrorSyncPipelineFailure(t *testing.T) {
+	t0 := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	fake := &fakeGitLab{pipelines: map[int]map[string]interface{}{}, broken: map[int]bool{2: true}}
+	for id := 1; id <= 3; id++ {
+		fake.setPipeline(id, "success", t0.Add(time.Duration(id)*time.Hour))
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	api, err := NewService(config.Config{GitLabBaseURL: srv.URL + "/api/v4", GitLabToken: "t", GitLabProject: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMirror(newTestDB(t))
+	ctx := context.Background()
+
+	// 单条详情失败不阻塞游标：其余流水线正常写入，失败的只保存列表字段
+	report, err := m.Sync(ctx, api, false)
+	if err != nil || report.FailedPipelines != 1 || report.Pipelines != 3 {
+		t.Fatalf("sync with a broken pipeline: %+v %v", report, err)
+	}
+	pg, _ := m.Pipelines(PipelineCursor{}, 10, 0)
+	items := pg.Items
+	if len(items) != 3 || items[1].ID != 2 || items[1].SyncError == "" || items[1].TriggerUser != "" || items[0].TriggerUser != "Alice" {
+		t.Fatalf("pipelines: %+v", items)
+	}
+	if synced, _ := m.LastSynced(); synced == nil {
+		t.Fatal("partial failure still counts as synced")
+	}
+	states, _ := m.States()
+	if states[2].Resource != model.SyncResourcePipelines || states[2].LastError == "" {
+		t.Fatalf("failure must be recorded: %+v", states)
+	}
+
+	// 恢复后下次同步重试并清除失败原因
+	fake.mu.Lock()
+	fake.broken = nil
+	fake.mu.Unlock()
+	if report, err = m.Sync(ctx, api, false); err != nil || report.FailedPipelines != 0 {
+		t.Fatalf("retry: %+v %v", report, err)
+	}
+	pg, _ = m.Pipelines(PipelineCursor{}, 10, 0)
+	items = pg.Items
+	if items[1].SyncError != "" || items[1].TriggerUser != "Alice" {
+		t.Fatalf("retried pipeline: %+v", items[1])
+	}
+}
+
+func TestMirrorPipelinesKeyset(t *testing.T) {
+	t0 := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	fake := &fakeGitLab{pipelines: map[int]map[string]interface{}{}}
+	for id := 1; id <= 7; id++ {
+		fake.setPipeline(id, "success", t0.Add(time.Duration(id)*time.Minute))
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	api, err := NewService(config.Config{GitLabBaseURL: srv.URL + "/api/v4", GitLabToken: "t", GitLabProject: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMirror(newTestDB(t))
+	ctx := context.Background()
+	if _, err := m.Sync(ctx, api, false); err != nil {
+		t.Fatal(err)
+	}
+	ids := func(pg *PipelinePage) []int64 {
+		var out []int64
+		for _, p := range pg.Items {
+			out = append(out, p.ID)
+		}
+		return out
+	}
+
+	first, _ := m.Pipelines(PipelineCursor{}, 3, 0)
+	if fmt.Sprint(ids(first)) != "[7 6 5]" || first.Total != 7 || first.Newer != 0 || first.Older != 4 {
+		t.Fatalf("first page: %v %+v", ids(first), first)
+	}
+	// 新流水线到来后，按游标取下一页不受影响；按偏移量则会错位
+	fake.mu.Lock()
+	fake.setPipeline(8, "running", t0.Add(time.Hour))
+	fake.setPipeline(9, "running", t0.Add(time.Hour))
+	fake.mu.Unlock()
+	if _, err := m.Sync(ctx, api, false); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := m.Pipelines(PipelineCursor{BeforeID: 5}, 3, 0)
+	if fmt.Sprint(ids(second)) != "[4 3 2]" || second.Total != 9 || second.Newer != 5 || second.Older != 1 {
+		t.Fatalf("second page: %v %+v", ids(second), second)
+	}
+	if byOffset, _ := m.Pipelines(PipelineCursor{}, 3, 3); fmt.Sprint(ids(byOffset)) != "[6 5 4]" {
+		t.Fatalf("offset page: %v", ids(byOffset))
+	}
+	// 上一页紧邻当前页
+	prev, _ := m.Pipelines(PipelineCursor{AfterID: 4}, 3, 0)
+	if fmt.Sprint(ids(prev)) != "[7 6 5]" || prev.Newer != 2 {
+		t.Fatalf("previous page: %v %+v", ids(prev), prev)
+	}
+	// 上一页不足一页时返回第一页
+	top, _ := m.Pipelines(PipelineCursor{AfterID: 7}, 3, 0)
+	if fmt.Sprint(ids(top)) != "[9 8 7]" || top.Newer != 0 {
+		t.Fatalf("top page: %v %+v", ids(top), top)
+	}
+	if empty, _ := m.Pipelines(PipelineCursor{BeforeID: 1}, 3, 0); len(empty.Items) != 0 || empty.Newer != 9 {
+		t.Fatalf("past the end: %+v", empty)
+	}
+}
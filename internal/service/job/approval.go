@@ -0,0 +1,179 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 审批错误
+var (
+	// ErrNotWaiting 任务不在等待审批状态
+	ErrNotWaiting = errors.New("job is not waiting for approval")
+	// ErrApproverNotAllowed 审批人无权审批（不在环境审批人名单中，或为部署触发人本人）
+	ErrApproverNotAllowed = errors.New("approver not allowed")
+	// ErrAlreadyDecided 审批人已对该任务作出决定
+	ErrAlreadyDecided = errors.New("approver already decided")
+)
+
+// Approve 记录审批人对等待审批任务的批准
+// 批准数达到环境要求时任务转为 pending 并返回 true，由调用方放行（入队或启动流水线）
+// 写入批准、统计批准数与状态推进在同一事务中完成，并发的最后两个批准不会让任务停留在等待审批状态
+func (s *Service) Approve(id uint64, approver, comment string) (*model.Job, bool, error) {
+	j, e, err := s.checkApprover(id, approver)
+	if err != nil {
+		return nil, false, err
+	}
+	var n int64
+	released := false
+	err = s.decide(id, &model.Approval{JobID: id, EnvID: j.EnvID, Approver: approver, Decision: model.ApprovalApproved, Comment: comment}, func(tx *gorm.DB) error {
+		var err error
+		if n, err = repository.NewApprovalRepository(tx).CountApproved(id); err != nil || n < int64(e.RequiredApprovals) {
+			return err
+		}
+		released = true
+		return transitionTx(tx, id, model.JobStatusWaitingForApproval, model.JobStatusPending, approver, fmt.Sprintf("approved (%d/%d)", n, e.RequiredApprovals))
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	_ = s.jobs.AppendLog(id, fmt.Sprintf("[APPROVAL] approved by %s (%d/%d)\n", approver, n, e.RequiredApprovals))
+	if released {
+		j.Status = model.JobStatusPending
+	}
+	return j, released, nil
+}
+
+// Reject 记录审批人对等待审批任务的拒绝，任务（流水线连同未开始的子任务）立即转为 canceled
+func (s *Service) Reject(id uint64, approver, comment string) (*model.Job, error) {
+	j, _, err := s.checkApprover(id, approver)
+	if err != nil {
+		return nil, err
+	}
+	note := "rejected by " + approver
+	if comment != "" {
+		note += ": " + comment
+	}
+	err = s.decide(id, &model.Approval{JobID: id, EnvID: j.EnvID, Approver: approver, Decision: model.ApprovalRejected, Comment: comment}, func(tx *gorm.DB) error {
+		return transitionTx(tx, id, model.JobStatusWaitingForApproval, model.JobStatusCanceled, approver, note)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.jobs.AppendLog(id, "[REJECTED] "+note+"\n"); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := s.jobs.UpdateTimes(id, nil, &now); err != nil {
+		return nil, err
+	}
+	if j.Kind == model.JobKindPipeline {
+		children, err := s.jobs.ListByPipeline(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range children {
+			if _, err := s.Cancel(c.ID, approver); err != nil && !errors.Is(err, ErrIllegalTransition) {
+				return nil, err
+			}
+		}
+	}
+	j.Status = model.JobStatusCanceled
+	return j, nil
+}
+
+// Approvals 查询任务的审批记录
+func (s *Service) Approvals(id uint64) ([]model.Approval, error) {
+	if _, err := s.jobs.Get(id); err != nil {
+		return nil, err
+	}
+	return s.approvals.ListByJob(id)
+}
+
+// checkApprover 校验任务处于等待审批状态，且审批人有权审批、尚未作出决定
+func (s *Service) checkApprover(id uint64, approver string) (*model.Job, *model.Environment, error) {
+	if approver == "" {
+		return nil, nil, errors.New("approver required")
+	}
+	j, err := s.jobs.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if j.Status != model.JobStatusWaitingForApproval {
+		return nil, nil, fmt.Errorf("%w: job is %s", ErrNotWaiting, j.Status)
+	}
+	e, err := repository.NewEnvironmentRepository(s.db).Get(j.EnvID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if approver == j.TriggerUser {
+		return nil, nil, fmt.Errorf("%w: %s triggered this deploy", ErrApproverNotAllowed, approver)
+	}
+	if len(e.Approvers) > 0 && !contains(e.Approvers, approver) {
+		return nil, nil, fmt.Errorf("%w: %s is not an approver of %s", ErrApproverNotAllowed, approver, e.Name)
+	}
+	decided, err := s.approvals.Decided(id, approver)
+	if err != nil {
+		return nil, nil, err
+	}
+	if decided {
+		return nil, nil, fmt.Errorf("%w: %s", ErrAlreadyDecided, approver)
+	}
+	return j, e, nil
+}
+
+// decide 在事务中写入审批决定 a 并执行 fn：锁定任务行后重新校验任务仍在等待审批、审批人尚未作出决定，
+// fn 失败时审批记录一并回滚，不会留下与任务状态不符的审批
+func (s *Service) decide(id uint64, a *model.Approval, fn func(tx *gorm.DB) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var j model.Job
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&j, id).Error; err != nil {
+			return err
+		}
+		if j.Status != model.JobStatusWaitingForApproval {
+			return fmt.Errorf("%w: job is %s", ErrNotWaiting, j.Status)
+		}
+		approvals := repository.NewApprovalRepository(tx)
+		decided, err := approvals.Decided(id, a.Approver)
+		if err != nil {
+			return err
+		}
+		if decided {
+			return fmt.Errorf("%w: %s", ErrAlreadyDecided, a.Approver)
+		}
+		if err := approvals.Create(a); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// transitionTx 在事务 tx 中推进审批任务的状态，状态已被并发修改时返回 ErrNotWaiting
+func transitionTx(tx *gorm.DB, id uint64, from, to, actor, note string) error {
+	if r := []rune(note); len(r) > 255 {
+		note = string(r[:255])
+	}
+	ok, err := repository.NewJobRepository(tx).TransitionStatus(id, from, to, actor, note)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: job status changed concurrently", ErrNotWaiting)
+	}
+	return nil
+}
+
+// contains 判断列表中是否包含 v
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
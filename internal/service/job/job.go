@@ -3,50 +3,451 @@ package job
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 	"webci-refactored/internal/dal/model"
 	"webci-refactored/internal/dal/repository"
+	"webci-refactored/internal/pipeline"
+	"webci-refactored/internal/service/deployment"
+	"webci-refactored/internal/service/environment"
+	"webci-refactored/internal/service/variable"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrIllegalTransition 状态机不允许的转换，或状态已被并发修改
+var ErrIllegalTransition = errors.New("illegal status transition")
+
+// ErrUnknownStatus 未定义的任务状态
+var ErrUnknownStatus = errors.New("unknown job status")
+
+// transitions 任务状态机：键为当前状态，值为允许转换到的目标状态
+// 终态（success/failed/canceled/timed_out/skipped）不允许再转换
+var transitions = map[string][]string{
+	// created → manual：when: manual 的子任务依赖满足后等待手动放行
+	model.JobStatusCreated: {model.JobStatusPending, model.JobStatusManual, model.JobStatusSkipped, model.JobStatusCanceled},
+	model.JobStatusManual:  {model.JobStatusPending, model.JobStatusSkipped, model.JobStatusCanceled},
+	model.JobStatusPending: {model.JobStatusRunning, model.JobStatusSkipped, model.JobStatusCanceled},
+	// 审批通过转为 pending，被拒绝转为 canceled
+	model.JobStatusWaitingForApproval: {model.JobStatusPending, model.JobStatusCanceled},
+	// 原任务失败落库后放行为 pending，原任务未失败时转为 canceled
+	model.JobStatusWaitingRetry: {model.JobStatusPending, model.JobStatusCanceled},
+	// running → pending：执行器失联后由恢复流程重新入队
+	model.JobStatusRunning:  {model.JobStatusSuccess, model.JobStatusFailed, model.JobStatusCanceled, model.JobStatusTimedOut, model.JobStatusPending},
+	model.JobStatusSuccess:  nil,
+	model.JobStatusFailed:   nil,
+	model.JobStatusCanceled: nil,
+	model.JobStatusTimedOut: nil,
+	model.JobStatusSkipped:  nil,
+}
+
+// userTransitions 允许用户通过状态接口手动执行的转换：仅放行手动任务（manual → pending）
+// 取消走 Cancel；其余转换由执行器、流水线推进与审批内部完成，用户不能绕过依赖或抢占执行器持有的任务
+var userTransitions = map[string][]string{
+	model.JobStatusManual: {model.JobStatusPending},
+}
+
+// IsKnownStatus 判断是否为已定义的任务状态
+func IsKnownStatus(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+// IsTerminal 判断状态是否为终态
+func IsTerminal(status string) bool {
+	next, ok := transitions[status]
+	return ok && len(next) == 0
+}
+
+// CanTransition 判断状态机是否允许 from → to
+func CanTransition(from, to string) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CanSetStatus 判断用户是否可以通过状态接口执行 from → to
+func CanSetStatus(from, to string) bool {
+	for _, s := range userTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
 // Service 任务服务
 // 封装任务创建、状态机与日志操作
 type Service struct {
-	db   *gorm.DB
-	jobs *repository.JobRepository
+	db        *gorm.DB
+	jobs      *repository.JobRepository
+	branches  *repository.BranchRepository
+	approvals *repository.ApprovalRepository
+	envs      *environment.Service
+	deploys   *deployment.Service
 }
 
 // NewService 创建任务服务
 func NewService(db *gorm.DB) *Service {
-	return &Service{db: db, jobs: repository.NewJobRepository(db)}
+	return &Service{
+		db:        db,
+		jobs:      repository.NewJobRepository(db),
+		branches:  repository.NewBranchRepository(db),
+		approvals: repository.NewApprovalRepository(db),
+		envs:      environment.NewService(db),
+		deploys:   deployment.NewService(db, ""),
+	}
+}
+
+// JobOptions 单个任务的可选定义
+type JobOptions struct {
+	// Artifacts 任务成功后收集的产物路径
+	Artifacts []string
+	// Retry 自动重试策略
+	Retry pipeline.Retry
+	// TimeoutSeconds 任务超时（秒），0 表示使用环境或服务默认值
+	TimeoutSeconds int
+	// Variables 任务变量：普通变量随任务保存，密文变量加密后存入 variables 表
+	Variables []model.Variable
+	// FreezeOverride 环境处于冻结窗口时管理员覆盖冻结的原因
+	FreezeOverride string
+}
+
+// admit 按目标环境的保护规则确定新部署任务 j 的初始状态：需要审批时为 waiting_for_approval，否则为 pending
+// 环境处于冻结窗口时，仅当触发用户为管理员且给出覆盖原因 override 才放行，并将原因记录到任务上；
+// 分支不允许部署或冻结未被覆盖时返回 environment.ErrDeployBlocked
+func (s *Service) admit(j *model.Job, override string) error {
+	name := ""
+	if b, err := s.branches.Get(j.BranchID); err == nil {
+		name = b.Name
+	}
+	var o *environment.Override
+	if override != "" {
+		o = &environment.Override{By: j.TriggerUser, Reason: override}
+	}
+	a, err := s.envs.CheckDeploy(j.EnvID, name, time.Now(), o)
+	if err != nil {
+		return err
+	}
+	j.Status = model.JobStatusPending
+	if a.NeedsApproval {
+		j.Status = model.JobStatusWaitingForApproval
+	}
+	j.FreezeOverride = ""
+	if a.Overridden != nil {
+		j.FreezeOverride = override
+	}
+	return nil
+}
+
+// envLocks 进程内按环境串行化部署任务的创建：环境 ID -> *sync.Mutex
+var envLocks sync.Map
+
+// deployTx 在事务中创建任务 j：j 为部署任务（顶层且绑定环境）时按环境串行执行，
+// 进程内持有该环境的互斥锁，并在事务中锁定环境行（多实例部署时由数据库串行化），
+// 使“环境中是否已有排队或执行中的部署”的检查与任务插入不会被并发的部署穿插
+func (s *Service) deployTx(j *model.Job, fn func(tx *gorm.DB) error) error {
+	if !deployment.IsDeployment(j) {
+		return s.db.Transaction(fn)
+	}
+	mu, _ := envLocks.LoadOrStore(j.EnvID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var env model.Environment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&env, j.EnvID).Error; err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// CheckDeploy 在创建任务前预先校验分支 branch 能否向环境 envID 部署，被保护规则禁止时返回 environment.ErrDeployBlocked
+func (s *Service) CheckDeploy(envID uint64, branch string) error {
+	_, err := s.envs.CheckDeploy(envID, branch, time.Now(), nil)
+	return err
+}
+
+// logOverride 任务覆盖了冻结窗口时在日志中留痕
+func (s *Service) logOverride(j *model.Job) error {
+	if j.FreezeOverride == "" {
+		return nil
+	}
+	return s.jobs.AppendLog(j.ID, fmt.Sprintf("[FREEZE] environment freeze overridden by %s: %s\n", j.TriggerUser, j.FreezeOverride))
 }
 
 // Create 创建 pending 任务并推入队列
-func (s *Service) Create(branchID, envID uint64, triggerUser string) (*model.Job, error) {
-	// 基础校验：触发用户必填
+// steps 为构建步骤列表，由执行器依次运行
+func (s *Service) Create(branchID, envID uint64, triggerUser string, steps []string, opts JobOptions) (*model.Job, error) {
+	// 基础校验：触发用户必填，产物路径须位于工作区内，重试策略须合法
 	if triggerUser == "" {
 		return nil, errors.New("trigger_user required")
 	}
-	// 构造初始任务：状态 pending，等待执行器接手
-	j := &model.Job{BranchID: branchID, EnvID: envID, Status: "pending", TriggerUser: triggerUser}
-	if err := s.jobs.Create(j); err != nil {
+	if err := pipeline.ValidateRetry(opts.Retry); err != nil {
+		return nil, err
+	}
+	if opts.TimeoutSeconds < 0 {
+		return nil, errors.New("timeout_seconds must not be negative")
+	}
+	plain, secrets, err := splitVariables(opts.Variables)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(opts.Artifacts))
+	for _, a := range opts.Artifacts {
+		p, err := pipeline.CleanArtifactPath(a)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	// 构造初始任务：状态 pending 等待执行器接手，受保护环境先等待审批
+	j := &model.Job{Kind: model.JobKindJob, BranchID: branchID, EnvID: envID, TriggerUser: triggerUser, Steps: steps, ArtifactPaths: paths,
+		RetryMax: opts.Retry.Max, RetryWhen: opts.Retry.When, TimeoutSeconds: opts.TimeoutSeconds, Variables: plain}
+	if err := s.admit(j, opts.FreezeOverride); err != nil {
+		return nil, err
+	}
+	// 事务：任务与其密文变量一起写入，执行器认领时变量已就绪
+	err = s.deployTx(j, func(tx *gorm.DB) error {
+		if err := repository.NewJobRepository(tx).CreateWithEvent(j, triggerUser); err != nil {
+			return err
+		}
+		return storeSecrets(tx, j.ID, secrets)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.logOverride(j); err != nil {
 		return nil, err
 	}
 	return j, nil
 }
 
+// CreatePipeline 按流水线定义文件创建父任务与子任务
+// 父任务代表整条流水线，部署到受保护环境时先等待审批；子任务初始为 created，由执行器按依赖逐个放行
+// 定义文件校验失败时返回 *pipeline.ValidationError，且不会创建任何任务；
+// vars 为触发时传入的变量，覆盖流水线文件中的同名变量并注入每个子任务；override 为覆盖冻结窗口的原因
+func (s *Service) CreatePipeline(b *model.Branch, envID uint64, triggerUser, commit string, content []byte, vars []model.Variable, override string) (*model.Job, error) {
+	if triggerUser == "" {
+		return nil, errors.New("trigger_user required")
+	}
+	plain, secrets, err := splitVariables(vars)
+	if err != nil {
+		return nil, err
+	}
+	p, err := pipeline.Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	specs, err := p.ForBranch(b.Name)
+	if err != nil {
+		return nil, err
+	}
+	parent := &model.Job{Kind: model.JobKindPipeline, BranchID: b.ID, EnvID: envID, Name: "pipeline", TriggerUser: triggerUser, CommitID: commit}
+	if err := s.admit(parent, override); err != nil {
+		return nil, err
+	}
+	// 事务：父任务与子任务要么全部创建，要么全部回滚
+	err = s.deployTx(parent, func(tx *gorm.DB) error {
+		jobs := repository.NewJobRepository(tx)
+		if err := jobs.CreateWithEvent(parent, triggerUser); err != nil {
+			return err
+		}
+		for _, spec := range specs {
+			// 产物保留秒数：0 使用服务默认值，-1 永久保留
+			expireIn := int(spec.Artifacts.ExpireIn / time.Second)
+			if spec.Artifacts.Never {
+				expireIn = -1
+			}
+			child := model.Job{
+				Kind:              model.JobKindJob,
+				PipelineID:        parent.ID,
+				BranchID:          b.ID,
+				EnvID:             envID,
+				Name:              spec.Name,
+				Stage:             spec.Stage,
+				Needs:             spec.Needs,
+				TimeoutSeconds:    int(spec.Timeout / time.Second),
+				Variables:         mergeVariables(spec.Variables, plain),
+				Steps:             spec.Script,
+				ArtifactPaths:     spec.Artifacts.Paths,
+				ArtifactsExpireIn: expireIn,
+				RetryMax:          spec.Retry.Max,
+				RetryWhen:         spec.Retry.When,
+				Manual:            spec.Manual,
+				Status:            model.JobStatusCreated,
+				TriggerUser:       triggerUser,
+				CommitID:          commit,
+			}
+			if err := jobs.CreateWithEvent(&child, triggerUser); err != nil {
+				return err
+			}
+			if err := storeSecrets(tx, child.ID, secrets); err != nil {
+				return err
+			}
+			parent.Jobs = append(parent.Jobs, child)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.logOverride(parent); err != nil {
+		return nil, err
+	}
+	return parent, nil
+}
+
+// splitVariables 校验变量并拆分为普通变量与密文变量，同名变量以后出现的为准
+func splitVariables(vars []model.Variable) (model.StringMap, []model.Variable, error) {
+	plain := model.StringMap{}
+	secretByKey := map[string]model.Variable{}
+	for _, v := range vars {
+		if err := variable.Validate(&v); err != nil {
+			return nil, nil, err
+		}
+		if v.Secret {
+			secretByKey[v.Key] = v
+			delete(plain, v.Key)
+		} else {
+			plain[v.Key] = v.Value
+			delete(secretByKey, v.Key)
+		}
+	}
+	secrets := make([]model.Variable, 0, len(secretByKey))
+	for _, v := range secretByKey {
+		secrets = append(secrets, v)
+	}
+	if len(plain) == 0 {
+		plain = nil
+	}
+	return plain, secrets, nil
+}
+
+// storeSecrets 加密并写入任务级密文变量
+func storeSecrets(tx *gorm.DB, jobID uint64, secrets []model.Variable) error {
+	vars := repository.NewVariableRepository(tx)
+	for _, v := range secrets {
+		v.Scope, v.OwnerID = model.VariableScopeJob, jobID
+		if err := variable.Seal(&v); err != nil {
+			return err
+		}
+		if err := vars.Upsert(&v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeVariables 合并流水线定义的变量与触发时传入的变量，后者优先
+func mergeVariables(defined map[string]string, override model.StringMap) model.StringMap {
+	if len(override) == 0 {
+		return defined
+	}
+	merged := model.StringMap{}
+	for k, v := range defined {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
 // AppendLog 追加日志
 func (s *Service) AppendLog(id uint64, text string) error { return s.jobs.AppendLog(id, text) }
 
-// SetStatus 设置任务状态
-func (s *Service) SetStatus(id uint64, status string) error {
-	// 直接透传到仓库层更新状态
-	return s.jobs.UpdateStatus(id, status)
+// Transition 按状态机执行条件状态转换，并记录操作者与备注到 job_events
+// 仅当任务当前状态仍为 from 时生效，返回是否转换成功；非法转换返回 ErrIllegalTransition
+// 部署任务结束时同时写入部署记录
+func (s *Service) Transition(id uint64, from, to, actor, note string) (bool, error) {
+	if !IsKnownStatus(to) {
+		return false, fmt.Errorf("%w: %q", ErrUnknownStatus, to)
+	}
+	if !CanTransition(from, to) {
+		return false, fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, to)
+	}
+	// 备注列长度有限，超长部分截断
+	if r := []rune(note); len(r) > 255 {
+		note = string(r[:255])
+	}
+	ok, err := s.jobs.TransitionStatus(id, from, to, actor, note)
+	if !ok || err != nil {
+		return ok, err
+	}
+	// 绑定环境的顶层任务从执行中结束即为一次部署，记录到部署历史
+	if from == model.JobStatusRunning && IsTerminal(to) {
+		if j, err := s.jobs.Get(id); err == nil && deployment.IsDeployment(j) {
+			if err := s.deploys.Record(j, to); err != nil {
+				return true, fmt.Errorf("record deployment: %w", err)
+			}
+		}
+	}
+	return true, nil
 }
 
-// Cancel 标记任务取消
-func (s *Service) Cancel(id uint64) error {
-	// 仅追加一条取消请求的日志；真正的取消由执行器在运行阶段识别
-	return s.jobs.AppendLog(id, fmt.Sprintf("\n[INFO] cancel requested at %s", time.Now().Format(time.RFC3339)))
+// SetStatus 手动设置任务状态
+// 仅允许 userTransitions 中的转换（放行手动任务），返回更新后的任务
+func (s *Service) SetStatus(id uint64, status, actor string) (*model.Job, error) {
+	if !IsKnownStatus(status) {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStatus, status)
+	}
+	j, err := s.jobs.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !CanSetStatus(j.Status, status) {
+		return nil, fmt.Errorf("%w: %s -> %s cannot be set manually", ErrIllegalTransition, j.Status, status)
+	}
+	ok, err := s.Transition(id, j.Status, status, actor, "played manually")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: job status changed concurrently", ErrIllegalTransition)
+	}
+	if err := s.jobs.AppendLog(id, fmt.Sprintf("[INFO] played by %s\n", actor)); err != nil {
+		return nil, err
+	}
+	return s.jobs.Get(id)
+}
+
+// Cancel 取消任务
+// 尚未开始的任务（created/manual/waiting_retry/waiting_for_approval/pending）直接转为 canceled；执行中的任务持久化取消请求，
+// 由执行器中止步骤后转为 canceled。返回任务是否仍在执行中，调用方据此中止本地进程
+func (s *Service) Cancel(id uint64, actor string) (bool, error) {
+	// 状态可能在读取后被执行器改变（如刚被认领），按最新状态重试
+	for attempt := 0; attempt < 3; attempt++ {
+		j, err := s.jobs.Get(id)
+		if err != nil {
+			return false, err
+		}
+		switch j.Status {
+		case model.JobStatusCreated, model.JobStatusManual, model.JobStatusWaitingRetry, model.JobStatusWaitingForApproval, model.JobStatusPending:
+			ok, err := s.Transition(id, j.Status, model.JobStatusCanceled, actor, "canceled before start")
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				continue
+			}
+			if err := s.jobs.AppendLog(id, fmt.Sprintf("[CANCELED] canceled by %s before start\n", actor)); err != nil {
+				return false, err
+			}
+			now := time.Now()
+			return false, s.jobs.UpdateTimes(id, nil, &now)
+		case model.JobStatusRunning:
+			if err := s.jobs.RequestCancel(id); err != nil {
+				return false, err
+			}
+			return true, s.jobs.AppendLog(id, fmt.Sprintf("[INFO] cancel requested by %s at %s\n", actor, time.Now().Format(time.RFC3339)))
+		default:
+			return false, fmt.Errorf("%w: job already %s", ErrIllegalTransition, j.Status)
+		}
+	}
+	return false, fmt.Errorf("%w: job status changed concurrently", ErrIllegalTransition)
 }
@@ -0,0 +1,321 @@
+package job
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"webci-refactored/internal/dal"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/service/deployment"
+	"webci-refactored/internal/service/environment"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestCanTransition(t *testing.T) {
+	cases := []struct {
+		from, to string
+		want     bool
+	}{
+		{model.JobStatusPending, model.JobStatusRunning, true},
+		{model.JobStatusRunning, model.JobStatusSuccess, true},
+		{model.JobStatusRunning, model.JobStatusTimedOut, true},
+		{model.JobStatusCreated, model.JobStatusSkipped, true},
+		{model.JobStatusManual, model.JobStatusPending, true},
+		{model.JobStatusCreated, model.JobStatusManual, true},
+		{model.JobStatusSuccess, model.JobStatusPending, false},
+		{model.JobStatusFailed, model.JobStatusRunning, false},
+		{model.JobStatusPending, model.JobStatusSuccess, false},
+		{model.JobStatusPending, "done", false},
+	}
+	for _, c := range cases {
+		if got := CanTransition(c.from, c.to); got != c.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", c.from, c.to, got, c.want)
+		}
+	}
+	// 状态机与 model.JobStatuses 必须一致，否则仪表盘统计会漏掉状态
+	if len(transitions) != len(model.JobStatuses) {
+		t.Fatalf("model.JobStatuses has %d statuses, state machine has %d", len(model.JobStatuses), len(transitions))
+	}
+	for _, st := range model.JobStatuses {
+		if !IsKnownStatus(st) {
+			t.Errorf("status %s missing from the state machine", st)
+		}
+	}
+}
+
+func TestTransitionRejectsIllegalAndUnknown(t *testing.T) {
+	s := &Service{}
+	if _, err := s.Transition(1, model.JobStatusSuccess, model.JobStatusPending, "api", ""); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("expected ErrIllegalTransition, got %v", err)
+	}
+	if _, err := s.Transition(1, model.JobStatusPending, "done", "api", ""); !errors.Is(err, ErrUnknownStatus) {
+		t.Fatalf("expected ErrUnknownStatus, got %v", err)
+	}
+}
+
+func TestSetStatusOnlyPlaysManualJobs(t *testing.T) {
+	db := openTestDB(t)
+	s := NewService(db)
+	jobs := map[string]*model.Job{}
+	for _, status := range []string{model.JobStatusCreated, model.JobStatusRunning, model.JobStatusManual} {
+		j := &model.Job{Kind: model.JobKindJob, Status: status, TriggerUser: "alice"}
+		if err := db.Create(j).Error; err != nil {
+			t.Fatal(err)
+		}
+		jobs[status] = j
+	}
+	// created → pending 会绕过依赖，running → pending 会抢占执行器持有的任务，均不能手动设置
+	for _, c := range []struct{ from, to string }{
+		{model.JobStatusCreated, model.JobStatusPending},
+		{model.JobStatusRunning, model.JobStatusPending},
+		{model.JobStatusRunning, model.JobStatusSuccess},
+		{model.JobStatusManual, model.JobStatusSkipped},
+	} {
+		if _, err := s.SetStatus(jobs[c.from].ID, c.to, "bob"); !errors.Is(err, ErrIllegalTransition) {
+			t.Fatalf("%s -> %s must be refused, got %v", c.from, c.to, err)
+		}
+	}
+	if _, err := s.SetStatus(jobs[model.JobStatusManual].ID, "done", "bob"); !errors.Is(err, ErrUnknownStatus) {
+		t.Fatalf("expected ErrUnknownStatus, got %v", err)
+	}
+	j, err := s.SetStatus(jobs[model.JobStatusManual].ID, model.JobStatusPending, "bob")
+	if err != nil || j.Status != model.JobStatusPending {
+		t.Fatalf("manual job should be played: %+v %v", j, err)
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	j := &model.Job{RetryMax: 2, RetryWhen: model.StringList{model.FailureScript}}
+	if !ShouldRetry(j, model.FailureScript) {
+		t.Fatal("script failure should be retried")
+	}
+	if ShouldRetry(j, model.FailureTimeout) {
+		t.Fatal("timeout is not in retry_when")
+	}
+	j.RetryCount = 2
+	if ShouldRetry(j, model.FailureScript) {
+		t.Fatal("retries exhausted")
+	}
+	if !ShouldRetry(&model.Job{RetryMax: 1}, model.FailureSystem) {
+		t.Fatal("empty retry_when should match any reason")
+	}
+	if ShouldRetry(&model.Job{}, model.FailureScript) {
+		t.Fatal("no retry policy")
+	}
+}
+
+func TestLatestAttempts(t *testing.T) {
+	children := []model.Job{
+		{ID: 1, Name: "build"},
+		{ID: 2, Name: "test"},
+		{ID: 3, Name: "deploy"},
+		{ID: 4, Name: "test", RetryOf: 2},
+	}
+	got := LatestAttempts(children)
+	if len(got) != 3 || got[0].ID != 1 || got[1].ID != 4 || got[2].ID != 3 {
+		t.Fatalf("unexpected latest attempts: %+v", got)
+	}
+}
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestProtectedEnvironmentApprovalGate(t *testing.T) {
+	db := openTestDB(t)
+	env := &model.Environment{Name: "prod", DeployBranches: model.StringList{"main", "release/*"}, RequiredApprovals: 2, Approvers: model.StringList{"bob", "carol"}}
+	main := &model.Branch{Name: "main"}
+	feature := &model.Branch{Name: "feature/x"}
+	for _, v := range []interface{}{env, main, feature} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewService(db)
+	if _, err := s.Create(feature.ID, env.ID, "alice", []string{"echo"}, JobOptions{}); !errors.Is(err, environment.ErrDeployBlocked) {
+		t.Fatalf("feature branch must not deploy, got %v", err)
+	}
+	j, err := s.Create(main.ID, env.ID, "alice", []string{"echo"}, JobOptions{})
+	if err != nil || j.Status != model.JobStatusWaitingForApproval {
+		t.Fatalf("expected waiting_for_approval, got %v %v", j, err)
+	}
+	for _, who := range []string{"alice", "dave"} {
+		if _, _, err := s.Approve(j.ID, who, ""); !errors.Is(err, ErrApproverNotAllowed) {
+			t.Fatalf("%s must not approve, got %v", who, err)
+		}
+	}
+	if _, released, err := s.Approve(j.ID, "bob", "lgtm"); err != nil || released {
+		t.Fatalf("first approval must not release: %v %v", released, err)
+	}
+	if _, _, err := s.Approve(j.ID, "bob", ""); !errors.Is(err, ErrAlreadyDecided) {
+		t.Fatalf("expected ErrAlreadyDecided, got %v", err)
+	}
+	if got, released, err := s.Approve(j.ID, "carol", ""); err != nil || !released || got.Status != model.JobStatusPending {
+		t.Fatalf("second approval should release: %v %v", released, err)
+	}
+	approvals, _ := s.Approvals(j.ID)
+	if len(approvals) != 2 || approvals[0].Approver != "bob" || approvals[0].Comment != "lgtm" {
+		t.Fatalf("unexpected approvals: %+v", approvals)
+	}
+
+	r, _ := s.Create(main.ID, env.ID, "alice", []string{"echo"}, JobOptions{})
+	if _, err := s.Reject(r.ID, "carol", "not today"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.jobs.Get(r.ID); got.Status != model.JobStatusCanceled || got.EndTime == nil {
+		t.Fatalf("rejected job should be canceled: %+v", got)
+	}
+
+	start, end := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	db.Create(&model.FreezeWindow{EnvID: env.ID, StartsAt: &start, EndsAt: &end, Reason: "holiday"})
+	if _, err := s.Create(main.ID, env.ID, "alice", []string{"echo"}, JobOptions{}); !errors.Is(err, environment.ErrDeployBlocked) {
+		t.Fatalf("deploys inside a freeze window must be refused, got %v", err)
+	}
+	db.Create(&model.User{Username: "root", Role: model.RoleAdmin})
+	if _, err := s.Create(main.ID, env.ID, "alice", []string{"echo"}, JobOptions{FreezeOverride: "hotfix"}); !errors.Is(err, environment.ErrDeployBlocked) {
+		t.Fatalf("only admins may override a freeze, got %v", err)
+	}
+	o, err := s.Create(main.ID, env.ID, "root", []string{"echo"}, JobOptions{FreezeOverride: "hotfix"})
+	if err != nil || o.FreezeOverride != "hotfix" || o.Status != model.JobStatusWaitingForApproval {
+		t.Fatalf("admin override should admit the deploy: %+v %v", o, err)
+	}
+}
+
+func TestCronFreezeWindow(t *testing.T) {
+	db := openTestDB(t)
+	s := NewService(db)
+	main := &model.Branch{Name: "main"}
+	db.Create(main)
+	env := &model.Environment{Name: "prod"}
+	db.Create(env)
+	envs := environment.NewService(db)
+	// 当前时刻所在星期的每一分钟都冻结
+	now := time.Now().UTC()
+	spec := "* * * * " + strconv.Itoa(int(now.Weekday()))
+	if _, err := envs.CreateFreeze(env.ID, environment.FreezeInput{Cron: spec, Reason: "weekend"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create(main.ID, env.ID, "alice", []string{"echo"}, JobOptions{}); !errors.Is(err, environment.ErrDeployBlocked) {
+		t.Fatalf("deploys inside a cron freeze must be refused, got %v", err)
+	}
+	active, err := envs.ActiveFreezes(now)
+	if err != nil || len(active) != 1 || active[0].EnvName != "prod" || !active[0].Until.After(now) {
+		t.Fatalf("unexpected active freezes: %+v %v", active, err)
+	}
+	if active, _ := envs.ActiveFreezes(now.Add(24 * time.Hour)); len(active) != 0 {
+		t.Fatalf("freeze should not be active the next day: %+v", active)
+	}
+	if _, err := envs.CreateFreeze(env.ID, environment.FreezeInput{Cron: spec, StartsAt: "2024-01-01"}); err == nil {
+		t.Fatal("cron and date range are mutually exclusive")
+	}
+	if _, err := envs.CreateFreeze(env.ID, environment.FreezeInput{Cron: spec, Timezone: "Mars/Base"}); err == nil {
+		t.Fatal("invalid timezone must be rejected")
+	}
+	f, err := envs.CreateFreeze(env.ID, environment.FreezeInput{StartsAt: "2024-02-09", EndsAt: "2024-02-17", Timezone: "Asia/Shanghai"})
+	if err != nil || f.EndsAt.Sub(*f.StartsAt) != 9*24*time.Hour {
+		t.Fatalf("date-only range should include the end day: %+v %v", f, err)
+	}
+}
+
+func TestConcurrentRollbacksEnqueueOnce(t *testing.T) {
+	db := openTestDB(t)
+	s := NewService(db)
+	main := &model.Branch{Name: "main"}
+	env := &model.Environment{Name: "staging"}
+	for _, v := range []interface{}{main, env} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	j := &model.Job{BranchID: main.ID, EnvID: env.ID, Kind: model.JobKindJob, Status: model.JobStatusSuccess, TriggerUser: "alice"}
+	db.Create(j)
+	d := &model.Deployment{EnvID: env.ID, JobID: j.ID, BranchID: main.ID, BranchName: "main", CommitID: "abc", Status: model.JobStatusSuccess}
+	db.Create(d)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = s.Rollback(d, "alice", "")
+		}(i)
+	}
+	wg.Wait()
+	var ok, running int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			ok++
+		case errors.Is(err, deployment.ErrDeployRunning):
+			running++
+		default:
+			t.Fatalf("unexpected rollback error: %v", err)
+		}
+	}
+	var n int64
+	db.Model(&model.Job{}).Where("rollback_of = ?", d.ID).Count(&n)
+	if ok != 1 || running != 1 || n != 1 {
+		t.Fatalf("expected exactly one rollback job, got ok=%d running=%d jobs=%d", ok, running, n)
+	}
+}
+
+func TestConcurrentApprovalsReleaseOnce(t *testing.T) {
+	db := openTestDB(t)
+	// 单连接：sqlite 共享缓存下并发写事务直接报表锁，这里让事务排队执行
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	s := NewService(db)
+	main := &model.Branch{Name: "main"}
+	env := &model.Environment{Name: "prod", RequiredApprovals: 2}
+	for _, v := range []interface{}{main, env} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	j, err := s.Create(main.ID, env.ID, "alice", []string{"echo"}, JobOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	released := make([]bool, 2)
+	for i, who := range []string{"bob", "carol"} {
+		wg.Add(1)
+		go func(i int, who string) {
+			defer wg.Done()
+			var err error
+			if _, released[i], err = s.Approve(j.ID, who, ""); err != nil {
+				t.Error(err)
+			}
+		}(i, who)
+	}
+	wg.Wait()
+	if released[0] == released[1] {
+		t.Fatalf("exactly one approval should release the job: %v", released)
+	}
+	if got, _ := s.jobs.Get(j.ID); got.Status != model.JobStatusPending {
+		t.Fatalf("job should be pending after two approvals, got %s", got.Status)
+	}
+
+	// 通过预检后任务状态已变化：事务内重新校验，不留下审批记录
+	late := &model.Approval{JobID: j.ID, EnvID: env.ID, Approver: "dave", Decision: model.ApprovalApproved}
+	if err := s.decide(j.ID, late, func(*gorm.DB) error { return nil }); !errors.Is(err, ErrNotWaiting) {
+		t.Fatalf("expected ErrNotWaiting, got %v", err)
+	}
+	if approvals, _ := s.Approvals(j.ID); len(approvals) != 2 {
+		t.Fatalf("late approval must not be stored: %+v", approvals)
+	}
+}
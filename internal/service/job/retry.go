@@ -0,0 +1,199 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotRetryable 任务当前状态不允许重试
+var ErrNotRetryable = errors.New("job cannot be retried")
+
+// retryAlways 自动重试条件：任意失败原因
+const retryAlways = "always"
+
+// ShouldRetry 判断失败任务是否满足其自动重试策略
+// 已用完重试次数，或失败原因不在 retry_when 中（为空表示任意原因）时不重试
+func ShouldRetry(j *model.Job, reason string) bool {
+	if j.RetryCount >= j.RetryMax {
+		return false
+	}
+	if len(j.RetryWhen) == 0 {
+		return true
+	}
+	for _, w := range j.RetryWhen {
+		if w == retryAlways || w == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// LatestAttempts 按任务名只保留流水线子任务的最新一次尝试
+// 被重试取代的子任务不参与依赖判断与状态汇总；结果沿用任务首次出现的位置，保持定义顺序
+func LatestAttempts(children []model.Job) []model.Job {
+	index := make(map[string]int, len(children))
+	latest := make([]model.Job, 0, len(children))
+	for _, c := range children {
+		if i, ok := index[c.Name]; ok {
+			if c.ID > latest[i].ID {
+				latest[i] = c
+			}
+			continue
+		}
+		index[c.Name] = len(latest)
+		latest = append(latest, c)
+	}
+	return latest
+}
+
+// Retry 手动重试已结束的任务：复制分支、环境、提交、变量（含密文变量）与步骤到新任务，并以 retry_of 关联原任务
+// 流水线父任务重试时按各子任务的最新尝试整体复制一条新流水线；流水线子任务须通过重试流水线重跑。
+// triggerUser 为空时沿用原任务的触发用户；override 为覆盖冻结窗口的原因
+func (s *Service) Retry(id uint64, triggerUser, override string) (*model.Job, error) {
+	j, err := s.jobs.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !IsTerminal(j.Status) || j.Status == model.JobStatusSkipped {
+		return nil, fmt.Errorf("%w: job is %s", ErrNotRetryable, j.Status)
+	}
+	if j.PipelineID > 0 {
+		return nil, fmt.Errorf("%w: retry pipeline %d instead", ErrNotRetryable, j.PipelineID)
+	}
+	if triggerUser == "" {
+		triggerUser = j.TriggerUser
+	}
+	r := cloneJob(j, triggerUser)
+	if err := s.admit(r, override); err != nil {
+		return nil, err
+	}
+	if j.Kind == model.JobKindPipeline {
+		return s.retryPipeline(j, r, triggerUser)
+	}
+	if err := s.createClone(r, j.ID, triggerUser); err != nil {
+		return nil, err
+	}
+	if err := s.jobs.AppendLog(r.ID, fmt.Sprintf("[RETRY] retry of job %d by %s\n", j.ID, triggerUser)); err != nil {
+		return nil, err
+	}
+	if err := s.logOverride(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// retryPipeline 以已确定初始状态的 parent 复制流水线父任务 p 与各子任务的最新尝试，子任务重新从 created 开始按依赖放行
+func (s *Service) retryPipeline(p, parent *model.Job, triggerUser string) (*model.Job, error) {
+	if err := s.clonePipeline(p, parent, triggerUser); err != nil {
+		return nil, err
+	}
+	if err := s.jobs.AppendLog(parent.ID, fmt.Sprintf("[RETRY] retry of pipeline %d by %s\n", p.ID, triggerUser)); err != nil {
+		return nil, err
+	}
+	if err := s.logOverride(parent); err != nil {
+		return nil, err
+	}
+	return parent, nil
+}
+
+// clonePipeline 在事务中创建复制出的流水线父任务 parent（状态由调用方设置），并复制 p 各子任务的最新尝试
+func (s *Service) clonePipeline(p, parent *model.Job, actor string) error {
+	return s.deployTx(parent, func(tx *gorm.DB) error { return clonePipelineTx(tx, p, parent, actor) })
+}
+
+// clonePipelineTx 在事务 tx 中复制流水线
+// parent 为新发起的回滚任务时，子任务同样标记为回滚且不再指向原子任务
+func clonePipelineTx(tx *gorm.DB, p, parent *model.Job, actor string) error {
+	jobs := repository.NewJobRepository(tx)
+	vars := repository.NewVariableRepository(tx)
+	children, err := jobs.ListByPipeline(p.ID)
+	if err != nil {
+		return err
+	}
+	if err := jobs.CreateWithEvent(parent, actor); err != nil {
+		return err
+	}
+	for _, c := range LatestAttempts(children) {
+		child := cloneJob(&c, actor)
+		child.PipelineID = parent.ID
+		child.Status = model.JobStatusCreated
+		if parent.RollbackOf > 0 && parent.RetryOf == 0 {
+			child.RetryOf = 0
+			child.RollbackOf = parent.RollbackOf
+		}
+		if err := jobs.CreateWithEvent(child, actor); err != nil {
+			return err
+		}
+		if err := vars.Copy(model.VariableScopeJob, c.ID, child.ID); err != nil {
+			return err
+		}
+		parent.Jobs = append(parent.Jobs, *child)
+	}
+	return nil
+}
+
+// PrepareAutoRetry 按自动重试策略为失败任务创建 waiting_retry 状态的重试任务，策略不满足时返回 nil
+// 重试任务在原任务的失败状态落库后再由调用方放行，避免流水线在两者之间误判为已结束；
+// 流水线推进不处理 waiting_retry，放行只有调用方一条路径，不会重复入队
+func (s *Service) PrepareAutoRetry(j *model.Job, reason, actor string) (*model.Job, error) {
+	if !ShouldRetry(j, reason) {
+		return nil, nil
+	}
+	r := cloneJob(j, j.TriggerUser)
+	r.RetryCount = j.RetryCount + 1
+	r.Status = model.JobStatusWaitingRetry
+	if err := s.createClone(r, j.ID, actor); err != nil {
+		return nil, err
+	}
+	msg := fmt.Sprintf("[RETRY] automatic retry %d/%d of job %d after %s\n", r.RetryCount, j.RetryMax, j.ID, reason)
+	if err := s.jobs.AppendLog(r.ID, msg); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// createClone 在事务中创建复制出的任务，并复制原任务的密文变量（密文原样复制，不解密）
+func (s *Service) createClone(r *model.Job, fromID uint64, actor string) error {
+	return s.deployTx(r, func(tx *gorm.DB) error { return createCloneTx(tx, r, fromID, actor) })
+}
+
+// createCloneTx 在事务 tx 中创建复制出的任务并复制密文变量
+func createCloneTx(tx *gorm.DB, r *model.Job, fromID uint64, actor string) error {
+	if err := repository.NewJobRepository(tx).CreateWithEvent(r, actor); err != nil {
+		return err
+	}
+	return repository.NewVariableRepository(tx).Copy(model.VariableScopeJob, fromID, r.ID)
+}
+
+// cloneJob 复制任务定义、归属、回滚标记与提交信息，新任务的 retry_of 指向原任务
+// 手动重试重新计算自动重试次数（retry_count 为 0），由调用方按需覆盖
+func cloneJob(j *model.Job, triggerUser string) *model.Job {
+	return &model.Job{
+		Kind:              j.Kind,
+		PipelineID:        j.PipelineID,
+		BranchID:          j.BranchID,
+		EnvID:             j.EnvID,
+		Name:              j.Name,
+		Stage:             j.Stage,
+		Needs:             j.Needs,
+		TimeoutSeconds:    j.TimeoutSeconds,
+		Variables:         j.Variables,
+		Steps:             j.Steps,
+		ArtifactPaths:     j.ArtifactPaths,
+		ArtifactsExpireIn: j.ArtifactsExpireIn,
+		RetryOf:           j.ID,
+		RetryMax:          j.RetryMax,
+		RetryWhen:         j.RetryWhen,
+		RollbackOf:        j.RollbackOf,
+		Manual:            j.Manual,
+		TriggerUser:       triggerUser,
+		CommitID:          j.CommitID,
+		CommitMessage:     j.CommitMessage,
+		CommitAuthor:      j.CommitAuthor,
+		CommitTime:        j.CommitTime,
+	}
+}
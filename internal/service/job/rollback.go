@@ -0,0 +1,64 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+	"webci-refactored/internal/service/deployment"
+
+	"gorm.io/gorm"
+)
+
+// Rollback 重新部署历史部署 d：复制其任务（流水线则复制整条流水线）并固定到 d 的提交
+// 新任务的 rollback_of 指向 d，重试链不延续；override 为覆盖冻结窗口的原因。
+// 环境中已有排队或执行中的部署时返回 deployment.ErrDeployRunning，检查与插入在同一个按环境串行的事务中完成
+func (s *Service) Rollback(d *model.Deployment, triggerUser, override string) (*model.Job, error) {
+	if triggerUser == "" {
+		return nil, errors.New("trigger_user required")
+	}
+	j, err := s.jobs.Get(d.JobID)
+	if err != nil {
+		return nil, err
+	}
+	r := cloneJob(j, triggerUser)
+	if err := s.admit(r, override); err != nil {
+		return nil, err
+	}
+	r.RetryOf = 0
+	r.RetryCount = 0
+	r.RollbackOf = d.ID
+	r.CommitID = d.CommitID
+	err = s.deployTx(r, func(tx *gorm.DB) error {
+		active, err := repository.NewDeploymentRepository(tx).Active(r.EnvID)
+		if err != nil {
+			return err
+		}
+		if active != nil {
+			return fmt.Errorf("%w: job %d is %s", deployment.ErrDeployRunning, active.ID, active.Status)
+		}
+		if j.Kind == model.JobKindPipeline {
+			return clonePipelineTx(tx, j, r, triggerUser)
+		}
+		return createCloneTx(tx, r, j.ID, triggerUser)
+	})
+	if err != nil {
+		return nil, err
+	}
+	msg := fmt.Sprintf("[ROLLBACK] rollback to deployment %d (commit %s) by %s\n", d.ID, shortCommit(d.CommitID), triggerUser)
+	if err := s.jobs.AppendLog(r.ID, msg); err != nil {
+		return nil, err
+	}
+	if err := s.logOverride(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// shortCommit 截取提交哈希前 8 位用于日志
+func shortCommit(h string) string {
+	if len(h) > 8 {
+		return h[:8]
+	}
+	return h
+}
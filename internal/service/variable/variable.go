@@ -0,0 +1,142 @@
+package variable
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+	"webci-refactored/internal/secret"
+
+	"gorm.io/gorm"
+)
+
+// keyPattern 变量名须为合法的环境变量名
+var keyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// minSecretLength 密文变量的最短长度：过短的值在日志中掩码会误伤正常输出
+const minSecretLength = 8
+
+// reservedPrefix 执行器内置变量前缀，不允许用户覆盖
+const reservedPrefix = "CI_"
+
+// Validate 校验变量名与值：密文变量须为至少 8 个字符的单行文本，保证能在日志中可靠掩码
+func Validate(v *model.Variable) error {
+	if !keyPattern.MatchString(v.Key) {
+		return fmt.Errorf("invalid variable key %q", v.Key)
+	}
+	if strings.HasPrefix(v.Key, reservedPrefix) {
+		return fmt.Errorf("variable key %q uses reserved prefix %s", v.Key, reservedPrefix)
+	}
+	if v.Secret && (len(v.Value) < minSecretLength || strings.ContainsAny(v.Value, "\r\n")) {
+		return fmt.Errorf("secret variable %s must be a single line of at least %d characters", v.Key, minSecretLength)
+	}
+	return nil
+}
+
+// Seal 准备变量落库：密文变量的值以服务端密钥加密，明文列清空
+// 未配置服务端密钥时返回 secret.ErrNoKey：临时密钥加密的密文重启后无法解密，使用它的任务将全部失败
+func Seal(v *model.Variable) error {
+	if !v.Secret {
+		v.Encrypted = ""
+		return nil
+	}
+	if !secret.Persistent() {
+		return secret.ErrNoKey
+	}
+	enc, err := secret.Encrypt(v.Value)
+	if err != nil {
+		return err
+	}
+	v.Encrypted, v.Value = enc, ""
+	return nil
+}
+
+// Service 变量服务
+// 管理环境级变量，并在执行前解析任务的全部变量
+type Service struct {
+	vars *repository.VariableRepository
+	envs *repository.EnvironmentRepository
+}
+
+// NewService 创建变量服务
+func NewService(db *gorm.DB) *Service {
+	return &Service{vars: repository.NewVariableRepository(db), envs: repository.NewEnvironmentRepository(db)}
+}
+
+// ListEnvironment 查询环境变量，密文变量的值在 JSON 中输出为掩码
+func (s *Service) ListEnvironment(envID uint64) ([]model.Variable, error) {
+	if _, err := s.envs.Get(envID); err != nil {
+		return nil, err
+	}
+	return s.vars.List(model.VariableScopeEnvironment, envID)
+}
+
+// SetEnvironment 新增或覆盖环境变量
+func (s *Service) SetEnvironment(envID uint64, v *model.Variable) error {
+	if _, err := s.envs.Get(envID); err != nil {
+		return err
+	}
+	if err := Validate(v); err != nil {
+		return err
+	}
+	if err := Seal(v); err != nil {
+		return err
+	}
+	v.Scope, v.OwnerID = model.VariableScopeEnvironment, envID
+	return s.vars.Upsert(v)
+}
+
+// DeleteEnvironment 删除环境变量，返回变量是否存在
+func (s *Service) DeleteEnvironment(envID uint64, key string) (bool, error) {
+	return s.vars.Delete(model.VariableScopeEnvironment, envID, key)
+}
+
+// Resolved 任务执行时注入的变量
+type Resolved struct {
+	// Env KEY=VALUE 形式的环境变量，后出现的同名变量覆盖先出现的
+	Env []string
+	// Secrets 需要在日志中掩码的密文值
+	Secrets []string
+}
+
+// Resolve 解析任务执行所需的变量并解密密文
+// 优先级由低到高：环境变量 → 任务变量（流水线定义与创建时传入的普通变量）→ 任务级密文变量
+func (s *Service) Resolve(j *model.Job) (*Resolved, error) {
+	r := &Resolved{}
+	add := func(items []model.Variable) error {
+		for _, v := range items {
+			value := v.Value
+			if v.Secret {
+				plain, err := secret.Decrypt(v.Encrypted)
+				if err != nil {
+					return fmt.Errorf("decrypt variable %s: %w", v.Key, err)
+				}
+				value = plain
+				r.Secrets = append(r.Secrets, plain)
+			}
+			r.Env = append(r.Env, v.Key+"="+value)
+		}
+		return nil
+	}
+	if j.EnvID > 0 {
+		items, err := s.vars.List(model.VariableScopeEnvironment, j.EnvID)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(items); err != nil {
+			return nil, err
+		}
+	}
+	for k, v := range j.Variables {
+		r.Env = append(r.Env, k+"="+v)
+	}
+	items, err := s.vars.List(model.VariableScopeJob, j.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := add(items); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
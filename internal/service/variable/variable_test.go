@@ -0,0 +1,127 @@
+package variable
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"webci-refactored/internal/dal"
+	"webci-refactored/internal/dal/model"
+	"webci-refactored/internal/dal/repository"
+	"webci-refactored/internal/secret"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestResolvePrecedenceAndEncryption(t *testing.T) {
+	if err := secret.Setup("test-key"); err != nil {
+		t.Fatal(err)
+	}
+	db := openTestDB(t)
+	svc := NewService(db)
+	env := &model.Environment{Name: "prod"}
+	if err := db.Create(env).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []*model.Variable{
+		{Key: "REGION", Value: "eu"},
+		{Key: "DEPLOY_TOKEN", Value: "env-token-123", Secret: true},
+		{Key: "LEVEL", Value: "info"},
+	} {
+		if err := svc.SetEnvironment(env.ID, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j := &model.Job{EnvID: env.ID, Variables: model.StringMap{"LEVEL": "debug"}}
+	if err := db.Create(j).Error; err != nil {
+		t.Fatal(err)
+	}
+	jobSecret := &model.Variable{Scope: model.VariableScopeJob, OwnerID: j.ID, Key: "DEPLOY_TOKEN", Value: "job-token-456", Secret: true}
+	if err := Seal(jobSecret); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.NewVariableRepository(db).Upsert(jobSecret); err != nil {
+		t.Fatal(err)
+	}
+
+	// 密文不以明文落库，接口输出为掩码
+	var stored model.Variable
+	db.Where("scope = ? AND `key` = ?", model.VariableScopeEnvironment, "DEPLOY_TOKEN").First(&stored)
+	if stored.Value != "" || stored.Encrypted == "" || strings.Contains(stored.Encrypted, "env-token-123") {
+		t.Fatalf("secret stored in plain text: %+v", stored)
+	}
+	out, _ := json.Marshal(stored)
+	if strings.Contains(string(out), "env-token") || !strings.Contains(string(out), secret.Mask) {
+		t.Fatalf("secret leaked in JSON: %s", out)
+	}
+
+	r, err := svc.Resolve(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := map[string]string{}
+	for _, kv := range r.Env {
+		k, v, _ := strings.Cut(kv, "=")
+		last[k] = v
+	}
+	if last["REGION"] != "eu" || last["LEVEL"] != "debug" || last["DEPLOY_TOKEN"] != "job-token-456" {
+		t.Fatalf("unexpected precedence: %v", last)
+	}
+	if strings.Join(r.Secrets, ",") != "env-token-123,job-token-456" {
+		t.Fatalf("unexpected secrets to mask: %v", r.Secrets)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	bad := []model.Variable{
+		{Key: "1ABC", Value: "x"},
+		{Key: "CI_JOB_ID", Value: "1"},
+		{Key: "TOKEN", Value: "short", Secret: true},
+		{Key: "TOKEN", Value: "multi\nline-secret", Secret: true},
+	}
+	for _, v := range bad {
+		if err := Validate(&v); err == nil {
+			t.Fatalf("expected validation error for %+v", v)
+		}
+	}
+	if err := Validate(&model.Variable{Key: "TOKEN", Value: "long-enough", Secret: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSealRequiresServerKey(t *testing.T) {
+	if err := secret.Setup(""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = secret.Setup("test-key") })
+	db := openTestDB(t)
+	svc := NewService(db)
+	env := &model.Environment{Name: "prod"}
+	if err := db.Create(env).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SetEnvironment(env.ID, &model.Variable{Key: "DEPLOY_TOKEN", Value: "env-token-123", Secret: true}); !errors.Is(err, secret.ErrNoKey) {
+		t.Fatalf("secret variable without SECRET_KEY must be refused, got %v", err)
+	}
+	if items, _ := svc.ListEnvironment(env.ID); len(items) != 0 {
+		t.Fatalf("refused secret must not be stored: %+v", items)
+	}
+	// 普通变量不需要服务端密钥
+	if err := svc.SetEnvironment(env.ID, &model.Variable{Key: "REGION", Value: "eu"}); err != nil {
+		t.Fatal(err)
+	}
+}
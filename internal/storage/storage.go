@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidKey 对象键为空或试图逃出存储根目录
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage 产物存储后端
+// 键为以 / 分隔的相对路径；实现需保证 Put 要么完整写入、要么不留下对象
+type Storage interface {
+	// Put 写入对象并返回写入的字节数，已存在的同名对象被覆盖
+	Put(key string, r io.Reader) (int64, error)
+	// Open 打开对象读取，对象不存在时返回的错误满足 errors.Is(err, os.ErrNotExist)
+	Open(key string) (io.ReadCloser, error)
+	// Delete 删除对象，对象不存在时不报错
+	Delete(key string) error
+}
+
+// Local 本地文件系统存储
+// 对象保存在根目录下与键同名的文件中
+type Local struct {
+	root string
+}
+
+// NewLocal 创建以 root 为根目录的本地存储
+func NewLocal(root string) *Local { return &Local{root: root} }
+
+// path 将对象键映射为根目录下的文件路径
+func (s *Local) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.root, clean), nil
+}
+
+// Put 先写入同目录临时文件再重命名，避免读取方看到写了一半的对象
+func (s *Local) Put(key string, r io.Reader) (int64, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return 0, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".put-*")
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return 0, err
+	}
+	return n, nil
+}
+
+// Open 打开对象文件
+func (s *Local) Open(key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// Delete 删除对象文件
+func (s *Local) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}